@@ -26,7 +26,7 @@ func printGlyph(g *truetype.GlyphBuf) {
 	e := 0
 	for i, p := range g.Point {
 		fmt.Printf("%4d, %4d", p.X, p.Y)
-		if p.Flags&0x01 != 0 {
+		if p.OnCurve() {
 			fmt.Print("  on\n")
 		} else {
 			fmt.Print("  off\n")
@@ -0,0 +1,132 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+// Package face adapts a TrueType font to the font.Face interface of the
+// golang.org/x/image/font package, so that the font can be drawn by code
+// that draws any font.Face, such as a font.Drawer.
+package face
+
+import (
+	"image"
+
+	"github.com/Bitnick2002/freetype-go/freetype"
+	"github.com/Bitnick2002/freetype-go/freetype/raster"
+	"github.com/Bitnick2002/freetype-go/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Options are optional arguments to NewFace.
+type Options struct {
+	// Size is the font size in points, as in ``a 10 point font size''.
+	// A zero value means to use a 12 point font size.
+	Size float64
+	// DPI is the dots-per-inch resolution.
+	// A zero value means to use 72 DPI.
+	DPI float64
+	// Hinting is how to quantize the glyph nodes. Both font.HintingVertical
+	// and font.HintingFull run the font's hinting instructions.
+	// A zero value means to use no hinting.
+	Hinting font.Hinting
+}
+
+// face is a font.Face that draws glyphs with a freetype.Context, so that
+// they are drawn exactly as the Context's DrawString draws them.
+type face struct {
+	f       *truetype.Font
+	c       *freetype.Context
+	scale   int32
+	hinter  *truetype.Hinter
+	glyph   *truetype.GlyphBuf
+	metrics font.Metrics
+}
+
+// NewFace returns a font.Face for the given Font. The returned Face is not
+// safe for concurrent use by multiple goroutines, as its methods may re-use
+// its buffers and the masks that Glyph returns.
+func NewFace(f *truetype.Font, opts *Options) font.Face {
+	size, dpi, hinting := 12.0, 72.0, font.HintingNone
+	if opts != nil {
+		if opts.Size > 0 {
+			size = opts.Size
+		}
+		if opts.DPI > 0 {
+			dpi = opts.DPI
+		}
+		hinting = opts.Hinting
+	}
+	a := &face{
+		f:     f,
+		c:     freetype.NewContext(),
+		scale: freetype.Scale(size, dpi),
+		glyph: truetype.NewGlyphBuf(),
+	}
+	a.c.SetDPI(dpi)
+	a.c.SetFont(f)
+	a.c.SetFontSize(size)
+	if hinting != font.HintingNone {
+		a.c.SetHinting(freetype.FullHinting)
+		a.hinter = &truetype.Hinter{}
+	}
+	m := f.Metrics(a.scale)
+	a.metrics = font.Metrics{
+		Height:     fixed.Int26_6(m.Height),
+		Ascent:     fixed.Int26_6(m.Ascent),
+		Descent:    fixed.Int26_6(m.Descent),
+		XHeight:    fixed.Int26_6(m.XHeight),
+		CapHeight:  fixed.Int26_6(m.CapHeight),
+		CaretSlope: image.Point{X: 0, Y: 1},
+	}
+	return a
+}
+
+// Close satisfies the font.Face interface.
+func (a *face) Close() error { return nil }
+
+// Metrics satisfies the font.Face interface.
+func (a *face) Metrics() font.Metrics { return a.metrics }
+
+// Kern satisfies the font.Face interface.
+func (a *face) Kern(r0, r1 rune) fixed.Int26_6 {
+	return fixed.Int26_6(a.f.Kerning(a.scale, a.f.Index(r0), a.f.Index(r1)))
+}
+
+// GlyphAdvance satisfies the font.Face interface.
+func (a *face) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	i, ok := a.f.IndexOK(r)
+	return fixed.Int26_6(a.f.HMetric(a.scale, i).AdvanceWidth), ok
+}
+
+// GlyphBounds satisfies the font.Face interface. The bounds are those of the
+// glyph's outline, hinted if the Face is hinted, whose Y axis points down.
+func (a *face) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	i, ok := a.f.IndexOK(r)
+	if err := a.glyph.Load(a.f, a.scale, i, a.hinter); err != nil {
+		return fixed.Rectangle26_6{}, 0, false
+	}
+	b := a.glyph.B
+	bounds = fixed.Rectangle26_6{
+		Min: fixed.Point26_6{X: fixed.Int26_6(b.XMin), Y: fixed.Int26_6(-b.YMax)},
+		Max: fixed.Point26_6{X: fixed.Int26_6(b.XMax), Y: fixed.Int26_6(-b.YMin)},
+	}
+	return bounds, fixed.Int26_6(a.f.HMetric(a.scale, i).AdvanceWidth), ok
+}
+
+// Glyph satisfies the font.Face interface.
+func (a *face) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+
+	i, ok := a.f.IndexOK(r)
+	// A fixed.Int26_6 is a 26.6 fixed point number, and a raster.Fix32 a
+	// 24.8 one.
+	m, offset, err := a.c.GlyphMask(i, raster.Point{
+		X: raster.Fix32(dot.X) << 2,
+		Y: raster.Fix32(dot.Y) << 2,
+	})
+	if err != nil {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	return m.Bounds().Add(offset), m, m.Bounds().Min, fixed.Int26_6(a.f.HMetric(a.scale, i).AdvanceWidth), ok
+}
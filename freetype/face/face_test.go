@@ -0,0 +1,145 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package face
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Bitnick2002/freetype-go/freetype"
+	"github.com/Bitnick2002/freetype-go/freetype/raster"
+	"github.com/Bitnick2002/freetype-go/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func parseTestFont(t *testing.T) *truetype.Font {
+	b, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := truetype.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// TestDrawer tests that a font.Drawer that draws with a Face draws exactly
+// the same pixels as a freetype.Context.
+func TestDrawer(t *testing.T) {
+	f := parseTestFont(t)
+	const s = "Hello, AVAWAY world"
+	for _, hinting := range []font.Hinting{font.HintingNone, font.HintingFull} {
+		opts := &Options{Size: 18, DPI: 96, Hinting: hinting}
+		r := image.Rect(0, 0, 400, 60)
+		// The dot is at a sub-pixel position, so that the glyphs are drawn at
+		// various sub-pixel phases.
+		dot := fixed.Point26_6{X: 10<<6 + 21, Y: 40<<6 + 13}
+
+		want := image.NewRGBA(r)
+		draw.Draw(want, r, image.White, image.ZP, draw.Src)
+		c := freetype.NewContext()
+		c.SetDPI(opts.DPI)
+		c.SetFont(f)
+		c.SetFontSize(opts.Size)
+		if hinting != font.HintingNone {
+			c.SetHinting(freetype.FullHinting)
+		}
+		c.SetClip(r)
+		c.SetDst(want)
+		c.SetSrc(image.Black)
+		p, err := c.DrawString(s, raster.Point{X: raster.Fix32(dot.X) << 2, Y: raster.Fix32(dot.Y) << 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := image.NewRGBA(r)
+		draw.Draw(got, r, image.White, image.ZP, draw.Src)
+		d := &font.Drawer{
+			Dst:  got,
+			Src:  image.Black,
+			Face: NewFace(f, opts),
+			Dot:  dot,
+		}
+		d.DrawString(s)
+
+		if bytes.Count(want.Pix, []byte{0xff}) == len(want.Pix) {
+			t.Fatalf("hinting=%v: freetype.Context drew nothing", hinting)
+		}
+		if !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("hinting=%v: font.Drawer and freetype.Context drew different pixels", hinting)
+		}
+		if gotX, wantX := raster.Fix32(d.Dot.X)<<2, p.X; gotX != wantX {
+			t.Errorf("hinting=%v: dot: got %v, want %v", hinting, gotX, wantX)
+		}
+	}
+}
+
+func TestGlyphBounds(t *testing.T) {
+	f := parseTestFont(t)
+	a := NewFace(f, &Options{Size: 32})
+	for _, r := range "AVg,é" {
+		bounds, advance, ok := a.GlyphBounds(r)
+		if !ok {
+			t.Errorf("%q: GlyphBounds: not ok", r)
+			continue
+		}
+		if a, ok := a.GlyphAdvance(r); !ok || a != advance {
+			t.Errorf("%q: GlyphAdvance: got %v, %t, want %v, true", r, a, ok, advance)
+		}
+		// The mask of a glyph drawn at the origin covers its bounds.
+		dr, _, _, glyphAdvance, ok := a.Glyph(fixed.Point26_6{}, r)
+		if !ok {
+			t.Errorf("%q: Glyph: not ok", r)
+			continue
+		}
+		if glyphAdvance != advance {
+			t.Errorf("%q: Glyph advance: got %v, want %v", r, glyphAdvance, advance)
+		}
+		want := image.Rect(
+			bounds.Min.X.Floor(), bounds.Min.Y.Floor(),
+			bounds.Max.X.Ceil(), bounds.Max.Y.Ceil(),
+		)
+		if dr != want {
+			t.Errorf("%q: Glyph rectangle: got %v, want %v", r, dr, want)
+		}
+	}
+	// luxisr has no glyph for U+4E2D.
+	if _, _, ok := a.GlyphBounds('中'); ok {
+		t.Errorf("GlyphBounds: missing rune is ok")
+	}
+	if _, ok := a.GlyphAdvance('中'); ok {
+		t.Errorf("GlyphAdvance: missing rune is ok")
+	}
+	if _, _, _, _, ok := a.Glyph(fixed.Point26_6{}, '中'); ok {
+		t.Errorf("Glyph: missing rune is ok")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	f := parseTestFont(t)
+	const scale = 12 * 64
+	m := NewFace(f, nil).Metrics()
+	if got, want := m.Ascent, fixed.Int26_6(f.TypoAscender(scale)); got != want {
+		t.Errorf("Ascent: got %v, want %v", got, want)
+	}
+	if got, want := m.Descent, fixed.Int26_6(-f.TypoDescender(scale)); got != want {
+		t.Errorf("Descent: got %v, want %v", got, want)
+	}
+	if got, want := m.Height, fixed.Int26_6(f.Metrics(scale).Height); got != want {
+		t.Errorf("Height: got %v, want %v", got, want)
+	}
+	if got, want := m.XHeight, fixed.Int26_6(f.Metrics(scale).XHeight); got != want || got == 0 {
+		t.Errorf("XHeight: got %v, want %v", got, want)
+	}
+	if m.Descent <= 0 || m.Ascent <= 0 {
+		t.Errorf("Ascent, Descent: got %v, %v, want positive values", m.Ascent, m.Descent)
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"errors"
 	"image"
 	"image/draw"
+	"math"
+	"strings"
+	"unicode"
 
 	"github.com/Bitnick2002/freetype-go/freetype/raster"
 	"github.com/Bitnick2002/freetype-go/freetype/truetype"
@@ -28,11 +31,12 @@ const (
 )
 
 // An entry in the glyph cache is keyed explicitly by the glyph index and
-// implicitly by the quantized x and y fractional offset. It maps to a mask
-// image and an offset.
+// whether it is drawn as a small capital, and implicitly by the quantized x
+// and y fractional offset. It maps to a mask image and an offset.
 type cacheEntry struct {
 	valid  bool
 	glyph  truetype.Index
+	small  bool
 	mask   *image.Alpha
 	offset image.Point
 }
@@ -53,13 +57,64 @@ func Pt(x, y int) raster.Point {
 	}
 }
 
-// A Context holds the state for drawing text in a given font and size.
+// Hinting is the policy for hinting glyphs, which adjusts their outlines to
+// fit the pixel grid.
+type Hinting int
+
+const (
+	// NoHinting draws glyphs' outlines as they are.
+	NoHinting Hinting = iota
+	// FullHinting runs the font's hinting instructions on glyphs' outlines.
+	FullHinting
+)
+
+// A Direction is the direction in which the pen advances when drawing text.
+type Direction int
+
+const (
+	// LeftToRight text, such as Latin text, advances rightward.
+	LeftToRight Direction = iota
+	// RightToLeft text, such as Hebrew or Arabic text, advances leftward.
+	RightToLeft
+	// TopToBottom text, such as vertical CJK text, advances downward, by
+	// each glyph's vertical metrics.
+	TopToBottom
+)
+
+// A SrcAlignment determines which pixel of the source image each destination
+// pixel is drawn with, for a source image that is not uniform, such as a
+// gradient or texture.
+type SrcAlignment int
+
+const (
+	// AlignDst aligns the source image with the destination image, so that
+	// the destination pixel at (x, y) is drawn with the source pixel at
+	// (x, y). Text drawn over a gradient shows the part of the gradient
+	// that is under it.
+	AlignDst SrcAlignment = iota
+	// AlignText aligns the source image's origin with the top-left corner of
+	// the drawn text's bounding box, so that the destination pixel at (x, y)
+	// is drawn with the source pixel at (x-minX, y-minY), where (minX, minY)
+	// is that corner. The bounding box is the rectangle that DrawStringBounds
+	// returns, before it is clipped. Text filled with a texture shows the
+	// same part of the texture wherever it is drawn.
+	AlignText
+)
+
+// A Context holds the state for drawing text in a given font and size. It
+// re-uses one GlyphBuf to load every glyph, and caches rasterized glyphs, so
+// that drawing text whose glyphs are cached does not allocate.
 type Context struct {
 	r        *raster.Rasterizer
 	font     *truetype.Font
 	glyphBuf *truetype.GlyphBuf
-	// clip is the clip rectangle for drawing.
-	clip image.Rectangle
+	// hinter hints the loaded glyphs, or is nil if glyphs are not hinted.
+	hinter *truetype.Hinter
+	// clip is the clip rectangle for drawing. clipMask is the clip mask, or
+	// nil, and clipBuf holds a glyph mask multiplied by the clip mask.
+	clip     image.Rectangle
+	clipMask *image.Alpha
+	clipBuf  image.Alpha
 	// dst and src are the destination and source images for drawing.
 	dst draw.Image
 	src image.Image
@@ -67,14 +122,53 @@ type Context struct {
 	// 26.6 fixed point units in 1 em.
 	fontSize, dpi float64
 	scale         int32
+	// gamma is the gamma correction applied to glyph masks. gammaPainter
+	// applies it, and is nil if gamma is 1.
+	gamma        float64
+	gammaPainter *raster.GammaCorrectionPainter
+	// fillRule is the rule by which glyphs' contours are filled.
+	fillRule truetype.FillRule
+	// srcAlignment is how the src image is aligned with the drawn text.
+	srcAlignment SrcAlignment
+	// direction is the direction in which DrawString advances.
+	direction Direction
+	// lineHeight is the distance between lines, or zero for the font's
+	// default. tabWidth is the distance between tab stops, or zero if tabs
+	// are not expanded.
+	lineHeight, tabWidth raster.Fix32
+	// smallCaps is the size of synthetic small capitals relative to the font
+	// size, or zero if lower case letters are drawn as they are.
+	// smallCapsAdvance is whether the small capitals' own advance widths are
+	// used to lay them out.
+	smallCaps        float64
+	smallCapsAdvance bool
+	// xPhases is the number of horizontal sub-pixel positions per pixel
+	// that glyphs are drawn at. It is a power of two, at most nXFractions,
+	// or zero if glyphs are drawn at their unrounded positions.
+	xPhases int
 	// cache is the glyph cache.
 	cache [nGlyphs * nXFractions * nYFractions]cacheEntry
 }
 
+// PointToPixel converts the given number of points (as in ``a 12 point font'')
+// into pixels at the given screen resolution in dots per inch. There are 72
+// points per inch, so that at 72 DPI a point is a pixel.
+func PointToPixel(pt, dpi float64) float64 {
+	return pt * dpi / 72
+}
+
+// Scale returns the number of 26.6 fixed point units in 1 em of a font of the
+// given size in points at the given screen resolution in dots per inch. It is
+// the scale that a Context passes to the truetype package's methods, such as
+// GlyphBuf.Load and Font.HMetric.
+func Scale(fontSize, dpi float64) int32 {
+	return int32(PointToPixel(fontSize, dpi) * 64)
+}
+
 // PointToFix32 converts the given number of points (as in ``a 12 point font'')
 // into fixed point units.
 func (c *Context) PointToFix32(x float64) raster.Fix32 {
-	return raster.Fix32(x * float64(c.dpi) * (256.0 / 72.0))
+	return raster.Fix32(PointToPixel(x, c.dpi) * 256)
 }
 
 // drawContour draws the given closed contour with the given offset.
@@ -91,12 +185,27 @@ func (c *Context) drawContour(ps []truetype.Point, dx, dy raster.Fix32) {
 	}
 	c.r.Start(start)
 	q0, on0 := start, true
+	// cubic holds the pending control points of a cubic curve, and n is how
+	// many there are.
+	var cubic [2]raster.Point
+	n := 0
 	for _, p := range ps[1:] {
 		q := raster.Point{
 			X: dx + raster.Fix32(p.X<<2),
 			Y: dy - raster.Fix32(p.Y<<2),
 		}
-		on := p.Flags&0x01 != 0
+		if p.Cubic() {
+			cubic[n&1] = q
+			n++
+			continue
+		}
+		if n != 0 {
+			c.r.Add3(cubic[0], cubic[1], q)
+			n = 0
+			q0, on0 = q, true
+			continue
+		}
+		on := p.OnCurve()
 		if on {
 			if on0 {
 				c.r.Add1(q)
@@ -117,7 +226,9 @@ func (c *Context) drawContour(ps []truetype.Point, dx, dy raster.Fix32) {
 		q0, on0 = q, on
 	}
 	// Close the curve.
-	if on0 {
+	if n != 0 {
+		c.r.Add3(cubic[0], cubic[1], start)
+	} else if on0 {
 		c.r.Add1(start)
 	} else {
 		c.r.Add2(q0, start)
@@ -125,12 +236,23 @@ func (c *Context) drawContour(ps []truetype.Point, dx, dy raster.Fix32) {
 }
 
 // rasterize returns the glyph mask and integer-pixel offset to render the
-// given glyph at the given sub-pixel offsets.
+// given glyph, as a small capital if small is true, at the given sub-pixel
+// offsets.
 // The 24.8 fixed point arguments fx and fy must be in the range [0, 1).
-func (c *Context) rasterize(glyph truetype.Index, fx, fy raster.Fix32) (*image.Alpha, image.Point, error) {
-	if err := c.glyphBuf.Load(c.font, c.scale, glyph, nil); err != nil {
+func (c *Context) rasterize(glyph truetype.Index, small bool, fx, fy raster.Fix32) (*image.Alpha, image.Point, error) {
+	scale := c.scale
+	if small {
+		scale = c.smallCapsScale()
+	}
+	if err := c.glyphBuf.Load(c.font, scale, glyph, c.hinter); err != nil {
 		return nil, image.ZP, err
 	}
+	if small {
+		// Scaling a capital down also thins its strokes, which emboldening
+		// compensates for, by roughly the stem width that a regular weight
+		// font loses, of about a twelfth of an em.
+		c.glyphBuf.Embolden(int32((1 - c.smallCaps) * float64(c.scale) / 12))
+	}
 	// Calculate the integer-pixel bounds for the glyph.
 	xmin := int(fx+raster.Fix32(c.glyphBuf.B.XMin<<2)) >> 8
 	ymin := int(fy-raster.Fix32(c.glyphBuf.B.YMax<<2)) >> 8
@@ -146,43 +268,112 @@ func (c *Context) rasterize(glyph truetype.Index, fx, fy raster.Fix32) (*image.A
 	// rasterizer space. xmin and ymin are typically <= 0.
 	fx += raster.Fix32(-xmin << 8)
 	fy += raster.Fix32(-ymin << 8)
-	// Rasterize the glyph's vectors.
+	// Rasterize the glyph's vectors. Overlapping compound glyph components
+	// are filled by the non-zero winding rule, whatever the fill rule, so
+	// that they leave no holes.
 	c.r.Clear()
+	c.r.UseNonZeroWinding = c.fillRule == truetype.FillNonZero || c.glyphBuf.Overlap
 	e0 := 0
 	for _, e1 := range c.glyphBuf.End {
 		c.drawContour(c.glyphBuf.Point[e0:e1], fx, fy)
 		e0 = e1
 	}
 	a := image.NewAlpha(image.Rect(0, 0, xmax-xmin, ymax-ymin))
-	c.r.Rasterize(raster.NewAlphaSrcPainter(a))
+	if c.gammaPainter == nil {
+		c.r.Rasterize(raster.NewAlphaSrcPainter(a))
+	} else {
+		c.gammaPainter.Painter = raster.NewAlphaSrcPainter(a)
+		c.r.Rasterize(c.gammaPainter)
+	}
 	return a, image.Point{xmin, ymin}, nil
 }
 
 // glyph returns the glyph mask and integer-pixel offset to render the given
 // glyph at the given sub-pixel point. It is a cache for the rasterize method.
 // Unlike rasterize, p's co-ordinates do not have to be in the range [0, 1).
-func (c *Context) glyph(glyph truetype.Index, p raster.Point) (*image.Alpha, image.Point, error) {
-	// Split p.X and p.Y into their integer and fractional parts.
-	ix, fx := int(p.X>>8), p.X&0xff
-	iy, fy := int(p.Y>>8), p.Y&0xff
+func (c *Context) glyph(glyph truetype.Index, small bool, p raster.Point) (*image.Alpha, image.Point, error) {
+	x, y := p.X, p.Y
+	if c.xPhases != 0 {
+		// Round x and y to the nearest sub-pixel phase. The glyph is
+		// rasterized at the phase, rather than at p, so that its cached
+		// mask does not depend on where it was first drawn.
+		xStep := raster.Fix32(256 / c.xPhases)
+		yStep := raster.Fix32(256 / nYFractions)
+		x = (x + xStep/2) &^ (xStep - 1)
+		y = (y + yStep/2) &^ (yStep - 1)
+	}
+	// Split x and y into their integer and fractional parts.
+	ix, fx := int(x>>8), x&0xff
+	iy, fy := int(y>>8), y&0xff
 	// Calculate the index t into the cache array.
 	tg := int(glyph) % nGlyphs
 	tx := int(fx) / (256 / nXFractions)
 	ty := int(fy) / (256 / nYFractions)
 	t := ((tg*nXFractions)+tx)*nYFractions + ty
 	// Check for a cache hit.
-	if c.cache[t].valid && c.cache[t].glyph == glyph {
+	if c.cache[t].valid && c.cache[t].glyph == glyph && c.cache[t].small == small {
 		return c.cache[t].mask, c.cache[t].offset.Add(image.Point{ix, iy}), nil
 	}
 	// Rasterize the glyph and put the result into the cache.
-	mask, offset, err := c.rasterize(glyph, fx, fy)
+	mask, offset, err := c.rasterize(glyph, small, fx, fy)
 	if err != nil {
 		return nil, image.ZP, err
 	}
-	c.cache[t] = cacheEntry{true, glyph, mask, offset}
+	c.cache[t] = cacheEntry{true, glyph, small, mask, offset}
 	return mask, offset.Add(image.Point{ix, iy}), nil
 }
 
+// GlyphMask returns the mask with which DrawString draws the glyph with the
+// given index, with the glyph's origin at p, and the position in the
+// destination image of the mask's top-left corner. The mask is cached by the
+// Context, and so it must not be modified, and it is only valid until the
+// Context's next call.
+func (c *Context) GlyphMask(index truetype.Index, p raster.Point) (*image.Alpha, image.Point, error) {
+	if c.font == nil {
+		return nil, image.ZP, errors.New("freetype: GlyphMask called with a nil font")
+	}
+	return c.glyph(index, false, p)
+}
+
+// RenderGlyph returns the mask of the glyph with the given index, as drawn at
+// the Context's font size, DPI and hinting policy, and the position of the
+// mask's top-left corner relative to the glyph's origin. The mask's bounds
+// start at (0, 0) and are cropped to the pixels that the glyph covers, so
+// that a glyph with no contours, such as a space, has an empty mask. Unlike
+// GlyphMask's, the mask is not shared with the Context's cache.
+func (c *Context) RenderGlyph(index truetype.Index) (*image.Alpha, image.Point, error) {
+	if c.font == nil {
+		return nil, image.ZP, errors.New("freetype: RenderGlyph called with a nil font")
+	}
+	mask, offset, err := c.glyph(index, false, raster.Point{})
+	if err != nil {
+		return nil, image.ZP, err
+	}
+	// Find the smallest rectangle that contains the non-zero pixels.
+	b := mask.Bounds()
+	r := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if mask.Pix[mask.PixOffset(x, y)] != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	m := image.NewAlpha(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(m, m.Bounds(), mask, r.Min, draw.Src)
+	return m, offset.Add(r.Min), nil
+}
+
+// RenderGlyph returns the mask of the glyph with the given index of the given
+// font, at the given font size in points and at 72 DPI, without hinting, as
+// per Context.RenderGlyph.
+func RenderGlyph(font *truetype.Font, index truetype.Index, fontSize float64) (*image.Alpha, image.Point, error) {
+	c := NewContext()
+	c.SetFont(font)
+	c.SetFontSize(fontSize)
+	return c.RenderGlyph(index)
+}
+
 // DrawString draws s at p and returns p advanced by the text extent. The text
 // is placed so that the left edge of the em square of the first character of s
 // and the baseline intersect at p. The majority of the affected pixels will be
@@ -190,36 +381,285 @@ func (c *Context) glyph(glyph truetype.Index, p raster.Point) (*image.Alpha, ima
 // For example, drawing a string that starts with a 'J' in an italic font may
 // affect pixels below and left of the point.
 // p is a raster.Point and can therefore represent sub-pixel positions.
+//
+// If the Context's direction is RightToLeft, then the pen advances leftward:
+// the right edge of the em square of the first character of s is placed at p,
+// and each following character is drawn to the left of the one before it. s
+// should then be in logical order, with any bidirectional reordering already
+// done.
+//
+// If the direction is TopToBottom, then the pen advances downward: p is on
+// the vertical line through the centers of the characters, at the top of the
+// first character's advance height, and each following character is drawn
+// below the one before it. The returned point is p advanced in Y rather
+// than in X.
+//
+// A '\n' in s starts a new line, at p's column and one line height below
+// the previous line, or for vertical text, at p's row and one line height to
+// the left of the previous column. The returned point is then on the last
+// line. If the Context has a tab width, then a '\t' in s advances the pen to
+// the next tab stop.
 func (c *Context) DrawString(s string, p raster.Point) (raster.Point, error) {
+	p, _, err := c.DrawStringBounds(s, p)
+	return p, err
+}
+
+// DrawStringBounds is like DrawString, but also returns the rectangle of
+// destination pixels that were drawn, which is the union of the drawn glyphs'
+// masks, clipped to the clip rectangle and to the bounds of any clip mask.
+// Since a glyph may extend beyond its advance, the rectangle is not
+// necessarily bounded by p and the returned point.
+func (c *Context) DrawStringBounds(s string, p raster.Point) (raster.Point, image.Rectangle, error) {
 	if c.font == nil {
-		return raster.Point{}, errors.New("freetype: DrawText called with a nil font")
+		return raster.Point{}, image.Rectangle{}, errors.New("freetype: DrawText called with a nil font")
 	}
-	prev, hasPrev := truetype.Index(0), false
-	for _, rune := range s {
-		index := c.font.Index(rune)
-		if hasPrev {
-			p.X += raster.Fix32(c.font.Kerning(c.scale, prev, index)) << 2
+	// origin is the destination point that is aligned with the src image's
+	// origin. Aligning the src image with the text's bounding box takes a
+	// first pass over the text, to find that box.
+	var origin image.Point
+	if c.srcAlignment == AlignText {
+		var textRect image.Rectangle
+		_, err := c.layout(s, p, func(index truetype.Index, small bool, o raster.Point) error {
+			mask, offset, err := c.glyph(index, small, o)
+			if err != nil {
+				return err
+			}
+			textRect = textRect.Union(mask.Bounds().Add(offset))
+			return nil
+		})
+		if err != nil {
+			return raster.Point{}, image.Rectangle{}, err
 		}
-		mask, offset, err := c.glyph(index, p)
+		origin = textRect.Min
+	}
+	var bounds image.Rectangle
+	p, err := c.layout(s, p, func(index truetype.Index, small bool, o raster.Point) error {
+		mask, offset, err := c.glyph(index, small, o)
 		if err != nil {
-			return raster.Point{}, err
+			return err
 		}
-		p.X += raster.Fix32(c.font.HMetric(c.scale, index).AdvanceWidth) << 2
 		glyphRect := mask.Bounds().Add(offset)
 		dr := c.clip.Intersect(glyphRect)
+		if c.clipMask != nil {
+			dr = dr.Intersect(c.clipMask.Bounds())
+		}
 		if !dr.Empty() {
-			mp := image.Point{0, dr.Min.Y - glyphRect.Min.Y}
-			draw.DrawMask(c.dst, dr, c.src, image.ZP, mask, mp, draw.Over)
+			mp := dr.Min.Sub(offset)
+			if c.clipMask != nil {
+				mask, mp = c.clipGlyph(mask, mp, dr), dr.Min
+			}
+			draw.DrawMask(c.dst, dr, c.src, dr.Min.Sub(origin), mask, mp, draw.Over)
+			bounds = bounds.Union(dr)
+		}
+		return nil
+	})
+	if err != nil {
+		return raster.Point{}, image.Rectangle{}, err
+	}
+	return p, bounds, nil
+}
+
+// clipGlyph returns the glyph mask, whose pixel at mp is drawn at dr.Min,
+// multiplied by the clip mask, over the destination rectangle dr. The
+// returned mask's bounds are dr, and it is valid until the next call.
+func (c *Context) clipGlyph(mask *image.Alpha, mp image.Point, dr image.Rectangle) *image.Alpha {
+	w, h := dr.Dx(), dr.Dy()
+	if cap(c.clipBuf.Pix) < w*h {
+		c.clipBuf.Pix = make([]uint8, w*h)
+	}
+	c.clipBuf.Pix, c.clipBuf.Stride, c.clipBuf.Rect = c.clipBuf.Pix[:w*h], w, dr
+	for y := 0; y < h; y++ {
+		m := mask.Pix[mask.PixOffset(mp.X, mp.Y+y):]
+		k := c.clipMask.Pix[c.clipMask.PixOffset(dr.Min.X, dr.Min.Y+y):]
+		b := c.clipBuf.Pix[y*w : y*w+w]
+		for x := range b {
+			b[x] = uint8((uint32(m[x])*uint32(k[x]) + 127) / 255)
+		}
+	}
+	return &c.clipBuf
+}
+
+// MeasureString returns how far DrawString would advance p when drawing s,
+// in the current font and at the current font size and resolution, without
+// drawing anything. The advance is negative if the Context's direction is
+// RightToLeft, and is downward, in Y, if the direction is TopToBottom. If s
+// has more than one line, then it returns the advance of its longest line.
+func (c *Context) MeasureString(s string) (raster.Fix32, error) {
+	if c.font == nil {
+		return 0, errors.New("freetype: MeasureString called with a nil font")
+	}
+	advance := raster.Fix32(0)
+	for _, line := range strings.Split(s, "\n") {
+		p, err := c.layout(line, raster.Point{}, func(truetype.Index, bool, raster.Point) error {
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		a := p.X
+		if c.direction == TopToBottom {
+			a = p.Y
+		}
+		if a < 0 && a < advance || a > 0 && a > advance {
+			advance = a
+		}
+	}
+	return advance, nil
+}
+
+// layout lays out s, starting at p, and calls f with each glyph, whether it
+// is drawn as a small capital, and the point at which to draw its origin. It
+// returns the final pen position.
+func (c *Context) layout(s string, p raster.Point, f func(index truetype.Index, small bool, o raster.Point) error) (raster.Point, error) {
+	lineStart := p
+	prev, hasPrev := truetype.Index(0), false
+	for _, rune := range s {
+		if rune == '\n' {
+			// Horizontal lines go downward, and vertical lines go leftward.
+			if c.direction == TopToBottom {
+				lineStart.X -= c.lineHeightFix32()
+			} else {
+				lineStart.Y += c.lineHeightFix32()
+			}
+			p, hasPrev = lineStart, false
+			continue
+		}
+		if rune == '\t' && c.tabWidth > 0 {
+			p, hasPrev = c.tab(lineStart, p), false
+			continue
+		}
+		index := c.font.Index(rune)
+		glyph, small := c.smallCap(rune, index)
+		// A small capital is laid out by its own metrics, at its own scale,
+		// if its advance is adjusted, and by the lower case letter's
+		// otherwise.
+		scale := c.scale
+		if small && c.smallCapsAdvance {
+			index, scale = glyph, c.smallCapsScale()
+		}
+		if hasPrev {
+			p.X += c.kern(scale, prev, index)
+		}
+		// o is where the glyph's origin is drawn. A right-to-left glyph is
+		// drawn after moving the pen, so that the glyph ends where the pen
+		// was, and a top-to-bottom glyph is drawn centered below the pen.
+		o, advance := p, c.advance(scale, index)
+		switch c.direction {
+		case RightToLeft:
+			p.X += advance
+			o = p
+		case TopToBottom:
+			var err error
+			if o, err = c.verticalOrigin(scale, index, p); err != nil {
+				return raster.Point{}, err
+			}
+			p.Y += advance
+		default:
+			p.X += advance
+		}
+		if err := f(glyph, small, o); err != nil {
+			return raster.Point{}, err
 		}
 		prev, hasPrev = index, true
 	}
 	return p, nil
 }
 
+// lineHeightFix32 returns the distance between lines, in fixed point units.
+func (c *Context) lineHeightFix32() raster.Fix32 {
+	if c.lineHeight != 0 {
+		return c.lineHeight
+	}
+	h := c.font.TypoAscender(c.scale) - c.font.TypoDescender(c.scale) + c.font.TypoLineGap(c.scale)
+	return raster.Fix32(h) << 2
+}
+
+// tab returns the pen position p advanced to the next tab stop after it, in
+// the line that starts at lineStart.
+func (c *Context) tab(lineStart, p raster.Point) raster.Point {
+	next := func(d raster.Fix32) raster.Fix32 {
+		return (d/c.tabWidth + 1) * c.tabWidth
+	}
+	switch c.direction {
+	case RightToLeft:
+		p.X = lineStart.X - next(lineStart.X-p.X)
+	case TopToBottom:
+		p.Y = lineStart.Y + next(p.Y-lineStart.Y)
+	default:
+		p.X = lineStart.X + next(p.X-lineStart.X)
+	}
+	return p
+}
+
+// smallCap returns the glyph to draw for the given rune, whose glyph index is
+// index, and whether to draw it as a small capital. If the Context draws
+// small capitals, then a lower case letter is drawn as its upper case
+// letter, if the font has one.
+func (c *Context) smallCap(r rune, index truetype.Index) (truetype.Index, bool) {
+	if c.smallCaps == 0 || !unicode.IsLower(r) {
+		return index, false
+	}
+	if upper := c.font.Index(unicode.ToUpper(r)); upper != 0 {
+		return upper, true
+	}
+	return index, false
+}
+
+// smallCapsScale returns the number of 26.6 fixed point units in 1 em for
+// small capitals.
+func (c *Context) smallCapsScale() int32 {
+	return int32(float64(c.scale) * c.smallCaps)
+}
+
+// advance returns how far the pen moves for the given glyph, at the given
+// scale, which is negative if the Context's direction is RightToLeft. If the
+// direction is TopToBottom, the pen moves downward by the glyph's advance
+// height.
+func (c *Context) advance(scale int32, index truetype.Index) raster.Fix32 {
+	switch c.direction {
+	case RightToLeft:
+		return -raster.Fix32(c.font.HMetric(scale, index).AdvanceWidth) << 2
+	case TopToBottom:
+		return raster.Fix32(c.font.VMetric(scale, index).AdvanceHeight) << 2
+	}
+	return raster.Fix32(c.font.HMetric(scale, index).AdvanceWidth) << 2
+}
+
+// kern returns how far the pen moves between the glyph prev and the glyph
+// index that follows it, at the given scale. Kerning is defined between
+// glyphs in left-to-right order, and so in right-to-left text, where index is
+// drawn to the left of prev, the pair is reversed. Vertical text is not
+// kerned.
+func (c *Context) kern(scale int32, prev, index truetype.Index) raster.Fix32 {
+	switch c.direction {
+	case RightToLeft:
+		return -raster.Fix32(c.font.Kerning(scale, index, prev)) << 2
+	case TopToBottom:
+		return 0
+	}
+	return raster.Fix32(c.font.Kerning(scale, prev, index)) << 2
+}
+
+// verticalOrigin returns where to draw the origin of the given glyph, at the
+// given scale, in vertical text, where p is on the vertical line at the top
+// of the glyph's advance height. The glyph is centered horizontally on the
+// line, and its top is the glyph's top side bearing below p.
+func (c *Context) verticalOrigin(scale int32, index truetype.Index, p raster.Point) (raster.Point, error) {
+	b, err := c.font.GlyphBounds(scale, index)
+	if err != nil {
+		return raster.Point{}, err
+	}
+	h, v := c.font.HMetric(scale, index), c.font.VMetric(scale, index)
+	return raster.Point{
+		X: p.X - raster.Fix32(h.AdvanceWidth)<<1,
+		Y: p.Y + raster.Fix32(v.TopSideBearing+b.YMax)<<2,
+	}, nil
+}
+
 // recalc recalculates scale and bounds values from the font size, screen
 // resolution and font metrics, and invalidates the glyph cache.
 func (c *Context) recalc() {
-	c.scale = int32(c.fontSize * c.dpi * (64.0 / 72.0))
+	c.scale = Scale(c.fontSize, c.dpi)
 	if c.font == nil {
 		c.r.SetBounds(0, 0)
 	} else {
@@ -269,17 +709,167 @@ func (c *Context) SetDst(dst draw.Image) {
 }
 
 // SetSrc sets the source image for draw operations. This is typically an
-// image.Uniform.
+// image.Uniform, which draws text in a solid color, but it may be any image,
+// such as a gradient or texture, in which case each drawn pixel is the source
+// pixel that SetSrcAlignment's alignment maps it to. Any part of the text
+// that maps to pixels outside the source image's bounds is not drawn.
 func (c *Context) SetSrc(src image.Image) {
 	c.src = src
 }
 
+// SetSrcAlignment sets how the source image is aligned with the text that
+// DrawString draws. The default is AlignDst.
+func (c *Context) SetSrcAlignment(alignment SrcAlignment) {
+	c.srcAlignment = alignment
+}
+
 // SetClip sets the clip rectangle for drawing.
 func (c *Context) SetClip(clip image.Rectangle) {
 	c.clip = clip
 }
 
-// TODO(nigeltao): implement Context.SetGamma.
+// SetClipMask sets the clip mask for drawing, which is sampled in destination
+// co-ordinates: the coverage of each glyph pixel that DrawString draws at
+// (x, y) is multiplied by the clip mask's alpha at (x, y), so that text is
+// drawn only where the clip mask is opaque, and partially where it is
+// translucent. Nothing is drawn outside the clip mask's bounds, and the clip
+// rectangle also applies. A nil mask, the default, does not clip.
+func (c *Context) SetClipMask(mask *image.Alpha) {
+	c.clipMask = mask
+}
+
+// SetGamma sets the gamma correction applied to each glyph's coverage before
+// it is composited onto the destination image. A gamma greater than 1 makes
+// text lighter and thinner, and a gamma less than 1 makes it darker and
+// heavier. The default gamma is 1, which applies no correction. A gamma that
+// is not positive and finite, such as zero or NaN, is treated as 1.
+func (c *Context) SetGamma(gamma float64) {
+	if !(gamma > 0) || math.IsInf(gamma, 1) {
+		gamma = 1
+	}
+	if c.gamma == gamma {
+		return
+	}
+	c.gamma = gamma
+	switch {
+	case gamma == 1:
+		c.gammaPainter = nil
+	case c.gammaPainter == nil:
+		c.gammaPainter = raster.NewGammaCorrectionPainter(nil, gamma)
+	default:
+		c.gammaPainter.SetGamma(gamma)
+	}
+	c.recalc()
+}
+
+// SetTolerance sets the maximum distance, in pixels, between the curves of
+// the glyphs that DrawString draws and the linear segments that approximate
+// them when they are rasterized. The default, or a tolerance of zero, is
+// chosen from the font size.
+func (c *Context) SetTolerance(tolerance raster.Fix32) {
+	if c.r.Tolerance == tolerance {
+		return
+	}
+	c.r.Tolerance = tolerance
+	c.recalc()
+}
+
+// SetWindingRule sets the rule by which the glyphs that DrawString draws have
+// their contours filled, as per truetype.GlyphBuf.MaskFill. The default is
+// truetype.FillNonZero, the rule that TrueType fonts use, which fills any
+// overlapping contours, such as those of some script fonts, without holes.
+func (c *Context) SetWindingRule(rule truetype.FillRule) {
+	if c.fillRule == rule {
+		return
+	}
+	c.fillRule = rule
+	c.recalc()
+}
+
+// SetDirection sets the direction in which DrawString lays out text. The
+// default direction is LeftToRight.
+func (c *Context) SetDirection(direction Direction) {
+	c.direction = direction
+}
+
+// SetHinting sets the policy for hinting the glyphs that DrawString draws.
+// The default is NoHinting.
+func (c *Context) SetHinting(hinting Hinting) {
+	if (c.hinter != nil) == (hinting == FullHinting) {
+		return
+	}
+	if hinting == FullHinting {
+		c.hinter = &truetype.Hinter{}
+	} else {
+		c.hinter = nil
+	}
+	c.recalc()
+}
+
+// SetLineHeight sets the distance between the baselines of the lines of text
+// that DrawString draws, or between the columns of vertical text. The default,
+// or a height of zero, is the font's ascender minus its descender plus its
+// line gap.
+func (c *Context) SetLineHeight(height raster.Fix32) {
+	c.lineHeight = height
+}
+
+// SetTabWidth sets the distance between the tab stops to which a tab in the
+// text that DrawString draws advances the pen, measured from the start of the
+// line. The default, or a width of zero, draws each tab as a glyph instead.
+func (c *Context) SetTabWidth(width raster.Fix32) {
+	c.tabWidth = width
+}
+
+// SetSmallCaps sets whether DrawString draws lower case letters as synthetic
+// small capitals, for a font that has no small capitals of its own. Each
+// lower case letter is drawn as its upper case letter, scaled down by scale,
+// such as 0.7, and emboldened to match the weight of the full-size letters.
+// If adjustAdvance is true, then the pen advances by the small capital's
+// scaled advance width. Otherwise, it advances by the lower case letter's, so
+// that the text is laid out as it would be without small capitals. A scale
+// of zero, the default, or less draws lower case letters as they are, and a
+// scale greater than 1 is treated as 1.
+func (c *Context) SetSmallCaps(scale float64, adjustAdvance bool) {
+	if scale < 0 {
+		scale = 0
+	} else if scale > 1 {
+		scale = 1
+	}
+	if c.smallCaps == scale && c.smallCapsAdvance == adjustAdvance {
+		return
+	}
+	c.smallCaps, c.smallCapsAdvance = scale, adjustAdvance
+	c.recalc()
+}
+
+// SetSubpixelRounding sets the number of horizontal sub-pixel positions, or
+// phases, per pixel that DrawString draws glyphs at. The pen's position is
+// tracked in fixed point, so that rounding errors do not accumulate along a
+// line, and each glyph's origin is rounded to the nearest phase only when the
+// glyph is drawn, so that a glyph is drawn the same at the same phase. One
+// phase draws every glyph at a whole pixel, which is the sharpest, and more
+// phases space the glyphs more evenly. The maximum is 4 phases, and other
+// numbers are rounded down to a power of two. Rounded glyphs are drawn at
+// whole pixels vertically.
+//
+// By default, or if phases is less than 1, glyphs are not rounded, and each
+// is drawn at the position that its mask was first drawn at in the Context's
+// cache, which is within a quarter of a pixel of its origin.
+func (c *Context) SetSubpixelRounding(phases int) {
+	n := 0
+	if phases >= 1 {
+		n = 1
+		for n*2 <= phases && n*2 <= nXFractions {
+			n *= 2
+		}
+	}
+	if c.xPhases == n {
+		return
+	}
+	c.xPhases = n
+	c.recalc()
+}
 
 // NewContext creates a new Context.
 func NewContext() *Context {
@@ -289,5 +879,6 @@ func NewContext() *Context {
 		fontSize: 12,
 		dpi:      72,
 		scale:    12 << 6,
+		gamma:    1,
 	}
 }
@@ -6,12 +6,19 @@
 package freetype
 
 import (
+	"bytes"
 	"image"
+	"image/color"
 	"image/draw"
 	"io/ioutil"
+	"math"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/Bitnick2002/freetype-go/freetype/raster"
+	"github.com/Bitnick2002/freetype-go/freetype/truetype"
 )
 
 func BenchmarkDrawString(b *testing.B) {
@@ -57,3 +64,775 @@ func BenchmarkDrawString(b *testing.B) {
 	mallocs = ms.Mallocs - mallocs
 	b.Logf("%d iterations, %d mallocs per iteration\n", b.N, int(mallocs)/b.N)
 }
+
+func TestMeasureString(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(18)
+	for _, s := range []string{"", "x", "Hello, world!", "AVAToWa"} {
+		advance, err := c.MeasureString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := c.DrawString(s, Pt(10, 50))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := advance, p.X-Pt(10, 50).X; got != want {
+			t.Errorf("%q: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestDrawStringBounds(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(18)
+	dst := c.dst.(*image.RGBA)
+	_, bounds, err := c.DrawStringBounds("Jumpy", Pt(10, 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The glyphs extend above and below the baseline.
+	if bounds.Min.Y >= 50 || bounds.Max.Y <= 50 {
+		t.Errorf("bounds %v do not straddle the baseline", bounds)
+	}
+	b := dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if dst.RGBAAt(x, y) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) && !image.Pt(x, y).In(bounds) {
+				t.Fatalf("pixel (%d, %d) was drawn, outside the bounds %v", x, y, bounds)
+			}
+		}
+	}
+
+	// Drawing outside the clip rectangle draws nothing.
+	c.SetClip(image.Rect(0, 0, 5, 5))
+	if _, bounds, err = c.DrawStringBounds("Jumpy", Pt(10, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if !bounds.Empty() {
+		t.Errorf("clipped: got bounds %v, want empty", bounds)
+	}
+}
+
+func TestRightToLeft(t *testing.T) {
+	// Drawing a string right-to-left should look the same as drawing its
+	// reverse left-to-right, from where the right-to-left pen ends.
+	const s, reversed = "AVAToWa", "aWoTAVA"
+	var dsts [2]*image.RGBA
+	var p raster.Point
+	for i, direction := range []Direction{RightToLeft, LeftToRight} {
+		c := testContext(t)
+		c.SetFontSize(18)
+		dsts[i] = c.dst.(*image.RGBA)
+		c.SetDirection(direction)
+		if direction == RightToLeft {
+			advance, err := c.MeasureString(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := Pt(300, 50)
+			if p, err = c.DrawString(s, start); err != nil {
+				t.Fatal(err)
+			}
+			if advance >= 0 || p.X != start.X+advance {
+				t.Fatalf("got advance %v and end point %v, from start point %v", advance, p, start)
+			}
+		} else {
+			q, err := c.DrawString(reversed, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.X != 300<<8 {
+				t.Errorf("left-to-right end point: got %v, want %v", q, Pt(300, 50))
+			}
+		}
+	}
+	if !bytes.Equal(dsts[0].Pix, dsts[1].Pix) {
+		t.Error("right-to-left and reversed left-to-right drawings differ")
+	}
+}
+
+func TestTopToBottom(t *testing.T) {
+	c := testContext(t)
+	font := c.font
+	c.SetFontSize(18)
+	c.SetDirection(TopToBottom)
+	start := Pt(50, 10)
+	for _, s := range []string{"I", "O", "II", "OO"} {
+		advance, err := c.MeasureString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, bounds, err := c.DrawStringBounds(s, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.X != start.X || p.Y != start.Y+advance {
+			t.Errorf("%q: got end point %v, want (%v, %v)", s, p, start.X, start.Y+advance)
+		}
+		// Each glyph is centered on the vertical line, and the first glyph's
+		// top is its top side bearing below the start point.
+		if bounds.Min.X+bounds.Max.X != 100 {
+			t.Errorf("%q: bounds %v are not centered on x=50", s, bounds)
+		}
+		v := font.VMetric(c.scale, font.Index(rune(s[0])))
+		if got, want := bounds.Min.Y, int(start.Y+raster.Fix32(v.TopSideBearing)<<2)>>8; got != want {
+			t.Errorf("%q: got top %d, want %d", s, got, want)
+		}
+		// The second glyph is one advance height below the first.
+		if len(s) == 2 {
+			_, b, err := c.DrawStringBounds(s[:1], start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := bounds.Max.Y-b.Max.Y, int(v.AdvanceHeight>>6); got < want || got > want+1 {
+				t.Errorf("%q: second glyph is %d pixels below the first, want %d", s, got, want)
+			}
+		}
+	}
+}
+
+func TestMultiLine(t *testing.T) {
+	c := testContext(t)
+	font := c.font
+	c.SetFontSize(18)
+	start := Pt(10, 30)
+	width := func(s string) raster.Fix32 {
+		a, err := c.MeasureString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	// The default line height is the font's ascender minus its descender
+	// plus its line gap.
+	scale := int32(18 << 6)
+	h := raster.Fix32(font.TypoAscender(scale)-font.TypoDescender(scale)+font.TypoLineGap(scale)) << 2
+	p, err := c.DrawString("Hello\nworld", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (raster.Point{X: start.X + width("world"), Y: start.Y + h}); p != want {
+		t.Errorf("default line height: got %v, want %v", p, want)
+	}
+	if got, want := width("Hello\nworld"), width("world"); got != want {
+		t.Errorf("multi-line width: got %v, want %v", got, want)
+	}
+
+	c.SetLineHeight(40 << 8)
+	if p, err = c.DrawString("a\n\nb", start); err != nil {
+		t.Fatal(err)
+	}
+	if want := (raster.Point{X: start.X + width("b"), Y: start.Y + 80<<8}); p != want {
+		t.Errorf("line height 40: got %v, want %v", p, want)
+	}
+
+	// Tabs are drawn as glyphs unless there is a tab width.
+	if got, want := width("a\tb"), width("a")+width("\t")+width("b"); got != want {
+		t.Errorf("unexpanded tab: got %v, want %v", got, want)
+	}
+	c.SetTabWidth(64 << 8)
+	if got, want := width("a\tb"), 64<<8+width("b"); got != want {
+		t.Errorf("tab: got %v, want %v", got, want)
+	}
+	if got, want := width("a\t\tb"), 128<<8+width("b"); got != want {
+		t.Errorf("two tabs: got %v, want %v", got, want)
+	}
+}
+
+func TestHinting(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(12)
+	draw := func(hinting Hinting) []byte {
+		dst := image.NewRGBA(image.Rect(0, 0, 200, 50))
+		c.SetDst(dst)
+		c.SetClip(dst.Bounds())
+		c.SetHinting(hinting)
+		if _, err := c.DrawString("Hello, world", Pt(10, 30)); err != nil {
+			t.Fatal(err)
+		}
+		return dst.Pix
+	}
+	unhinted := draw(NoHinting)
+	if hinted := draw(FullHinting); bytes.Equal(hinted, unhinted) {
+		t.Error("hinting did not change the drawn text")
+	}
+	// Turning hinting off again must not re-use the hinted glyphs.
+	if again := draw(NoHinting); !bytes.Equal(again, unhinted) {
+		t.Error("drawing without hinting again changed the drawn text")
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(200)
+	dst := c.dst.(*image.RGBA)
+	render := func(tolerance raster.Fix32) []byte {
+		draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+		c.SetTolerance(tolerance)
+		if _, err := c.DrawString("O", Pt(10, 300)); err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), dst.Pix...)
+	}
+	fine := render(0)
+	// A coarse tolerance approximates the curves by fewer, longer segments.
+	if coarse := render(4 << 8); bytes.Equal(coarse, fine) {
+		t.Error("a coarse tolerance did not change the drawn text")
+	}
+	// Restoring the default must not re-use the coarse glyphs.
+	if again := render(0); !bytes.Equal(again, fine) {
+		t.Error("drawing with the default tolerance again changed the drawn text")
+	}
+}
+
+func TestGamma(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(40)
+	dst := c.dst.(*image.RGBA)
+	render := func(gamma float64) []byte {
+		draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+		c.SetGamma(gamma)
+		if _, err := c.DrawString("O", Pt(10, 50)); err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), dst.Pix...)
+	}
+	linear := render(1)
+	// Black text on white has each pixel's red value at 0xff minus its
+	// coverage, and gamma correction raises the coverage to the power of
+	// gamma, which makes text lighter for a gamma greater than 1 and darker
+	// for a gamma less than 1. The coverage is quantized to 8 bits, and so
+	// the pixels with little coverage are only checked for the direction
+	// of their change.
+	for _, gamma := range []float64{0.5, 2.2} {
+		corrected, changed := render(gamma), 0
+		for i := 0; i < len(linear); i += 4 {
+			got, a := float64(corrected[i]), float64(0xff-linear[i])/0xff
+			if want := 0xff - 0xff*math.Pow(a, gamma); a >= 0x10/255.0 && math.Abs(got-want) > 3 {
+				t.Fatalf("gamma %v, pixel %d: got %#02x, want %#02x", gamma, i/4, int(got), int(want))
+			}
+			if lighter := corrected[i] > linear[i]; corrected[i] != linear[i] && lighter != (gamma > 1) {
+				t.Fatalf("gamma %v, pixel %d: got %#02x, linear %#02x", gamma, i/4, corrected[i], linear[i])
+			}
+			if corrected[i] != linear[i] {
+				changed++
+			}
+		}
+		if changed == 0 {
+			t.Errorf("gamma %v: drawn text is the same as for gamma 1", gamma)
+		}
+	}
+	// Bad gammas are treated as 1, and apply no correction.
+	for _, gamma := range []float64{0, -1, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if got := render(gamma); !bytes.Equal(got, linear) {
+			t.Errorf("gamma %v: drawn text differs from gamma 1", gamma)
+		}
+	}
+}
+
+func TestSmallCaps(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(12)
+	measure := func(s string) raster.Fix32 {
+		a, err := c.MeasureString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	lower, upper := measure("small caps"), measure("SMALL CAPS")
+	// Without adjusting the advance, the text is laid out as lower case.
+	c.SetSmallCaps(0.7, false)
+	if got := measure("small caps"); got != lower {
+		t.Errorf("unadjusted advance: got %d, want %d", got, lower)
+	}
+	// Adjusting the advance lays out the capitals at the smaller size, and
+	// the space, which has no upper case, at the full size.
+	c.SetSmallCaps(0.7, true)
+	c.SetFontSize(12 * 0.7)
+	want := measure("SMALL") + measure("CAPS")
+	c.SetFontSize(12)
+	want += measure(" ")
+	if got := measure("small caps"); got != want || got >= upper {
+		t.Errorf("adjusted advance: got %d, want %d, less than %d", got, want, upper)
+	}
+
+	// A small capital is shorter than a full-size capital, even though both
+	// are the same glyph, and so share a glyph cache entry's key.
+	height := func(s string) int {
+		_, r, err := c.DrawStringBounds(s, Pt(10, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Dy()
+	}
+	c.SetFontSize(40)
+	full, small := height("X"), height("x")
+	if small >= full || small < full/2 {
+		t.Errorf("small capital height: got %d, want less than %d", small, full)
+	}
+	// Turning small capitals off again must not re-use the small capitals.
+	dst := c.dst.(*image.RGBA)
+	render := func() []byte {
+		draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+		if _, err := c.DrawString("x", Pt(10, 100)); err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), dst.Pix...)
+	}
+	smallX := render()
+	c.SetSmallCaps(0, false)
+	if bytes.Equal(render(), smallX) {
+		t.Error("drawing without small capitals again drew a small capital")
+	}
+}
+
+func TestSubpixelRounding(t *testing.T) {
+	render := func(c *Context, xs ...raster.Fix32) []byte {
+		dst := c.dst.(*image.RGBA)
+		for _, x := range xs {
+			draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+			if _, err := c.DrawString("i", raster.Point{X: x, Y: 100 << 8}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return append([]byte(nil), dst.Pix...)
+	}
+	c, fresh := testContext(t), testContext(t)
+	c.SetFontSize(20)
+	fresh.SetFontSize(20)
+	// By default, the glyph is drawn at its unrounded position, both
+	// horizontally and vertically.
+	p := raster.Point{X: 10<<8 + 94, Y: 100<<8 + 160}
+	mask, offset, err := c.GlyphMask(c.font.Index('i'), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantOffset, err := fresh.rasterize(c.font.Index('i'), false, 94, 160)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mask.Pix, want.Pix) || offset != wantOffset.Add(image.Point{10, 100}) {
+		t.Error("the glyph was not drawn at its unrounded position by default")
+	}
+
+	c.SetSubpixelRounding(4)
+	fresh.SetSubpixelRounding(4)
+	// 0.26 and 0.37 of a pixel round to the same phase, so that the glyph is
+	// drawn the same whether or not it was first drawn at the other.
+	if !bytes.Equal(render(c, 10<<8+66, 10<<8+94), render(fresh, 10<<8+94)) {
+		t.Error("the glyph at the same phase was drawn differently")
+	}
+	if bytes.Equal(render(c, 10<<8), render(c, 10<<8+64)) {
+		t.Error("4 phases: a quarter pixel offset was not drawn")
+	}
+	// A single phase draws the glyph at the nearest whole pixel.
+	c.SetSubpixelRounding(1)
+	if !bytes.Equal(render(c, 10<<8), render(c, 10<<8+64)) {
+		t.Error("1 phase: a quarter pixel offset was drawn")
+	}
+	if !bytes.Equal(render(c, 11<<8), render(c, 10<<8+192)) {
+		t.Error("1 phase: three quarters of a pixel was not rounded up")
+	}
+	// Two phases, or three rounded down to two, draw half pixel offsets.
+	c.SetSubpixelRounding(3)
+	if bytes.Equal(render(c, 10<<8), render(c, 10<<8+128)) {
+		t.Error("2 phases: a half pixel offset was not drawn")
+	}
+	if !bytes.Equal(render(c, 10<<8+128), render(c, 10<<8+100)) {
+		t.Error("2 phases: 0.4 of a pixel was not rounded to a half")
+	}
+
+	// The pen's position is not rounded.
+	c.SetSubpixelRounding(1)
+	got, err := c.MeasureString("iiii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetSubpixelRounding(0)
+	if want, _ := c.MeasureString("iiii"); got != want {
+		t.Errorf("advance: got %d with 1 phase, want %d", got, want)
+	}
+}
+
+// testContext returns a Context that draws in the Luxi Sans font onto a new
+// white image.
+func testContext(tb testing.TB) *Context {
+	data, err := ioutil.ReadFile("../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	font, err := ParseFont(data)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+	c := NewContext()
+	c.SetDst(dst)
+	c.SetClip(dst.Bounds())
+	c.SetSrc(image.Black)
+	c.SetFont(font)
+	return c
+}
+
+func TestDrawStringAllocs(t *testing.T) {
+	c := testContext(t)
+	// The first call rasterizes and caches the glyphs. Later calls re-use
+	// them, and the Context's GlyphBuf, and so do not allocate.
+	if _, err := c.DrawString("Hello, world", Pt(10, 30)); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := c.DrawString("Hello, world", Pt(10, 30)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocations per DrawString, want 0", allocs)
+	}
+}
+
+func BenchmarkDrawShortStrings(b *testing.B) {
+	c := testContext(b)
+	words := strings.Fields("the quick brown fox jumps over the lazy dog")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 10000; j++ {
+			_, err := c.DrawString(words[j%len(words)], Pt(10*(j%64), 16+(j/64)%36*16))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRenderGlyph(t *testing.T) {
+	c := testContext(t)
+	c.SetFontSize(20)
+	c.SetDPI(96)
+	c.SetHinting(FullHinting)
+	index := c.font.Index('A')
+	m, offset, err := c.RenderGlyph(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Min != image.ZP || m.Bounds().Empty() {
+		t.Fatalf("bounds: got %v, want a non-empty rectangle at the origin", m.Bounds())
+	}
+	// The mask is cropped, and so its edges each have a non-zero pixel.
+	b := m.Bounds()
+	edges := [4]bool{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if m.AlphaAt(x, y).A != 0 {
+				edges[0] = edges[0] || x == b.Min.X
+				edges[1] = edges[1] || y == b.Min.Y
+				edges[2] = edges[2] || x == b.Max.X-1
+				edges[3] = edges[3] || y == b.Max.Y-1
+			}
+		}
+	}
+	if edges != [4]bool{true, true, true, true} {
+		t.Errorf("edges with non-zero pixels: got %v, want all", edges)
+	}
+
+	// Drawing the mask draws the same pixels as DrawString.
+	if _, err := c.DrawString("A", Pt(50, 60)); err != nil {
+		t.Fatal(err)
+	}
+	want := c.dst.(*image.RGBA)
+	got := image.NewRGBA(want.Bounds())
+	draw.Draw(got, got.Bounds(), image.White, image.ZP, draw.Src)
+	r := m.Bounds().Add(offset).Add(image.Pt(50, 60))
+	draw.DrawMask(got, r, image.Black, image.ZP, m, image.ZP, draw.Over)
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("RenderGlyph and DrawString drew different pixels")
+	}
+
+	// A space has an empty mask.
+	if m, _, err := c.RenderGlyph(c.font.Index(' ')); err != nil || !m.Bounds().Empty() {
+		t.Errorf("space: got %v, %v, want an empty mask", m.Bounds(), err)
+	}
+
+	// The function is like the method, at 72 DPI and without hinting.
+	c = testContext(t)
+	c.SetFontSize(20)
+	m0, offset0, err := c.RenderGlyph(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, offset1, err := RenderGlyph(c.font, index, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset0 != offset1 || !reflect.DeepEqual(m0, m1) {
+		t.Errorf("RenderGlyph function and method results differ")
+	}
+}
+
+func TestPointToPixel(t *testing.T) {
+	testCases := []struct {
+		pt, dpi, want float64
+	}{
+		{12, 72, 12},
+		{12, 96, 16},
+		{10.5, 144, 21},
+		{18, 300, 75},
+		{0, 96, 0},
+	}
+	c := NewContext()
+	for _, tc := range testCases {
+		if got := PointToPixel(tc.pt, tc.dpi); got != tc.want {
+			t.Errorf("PointToPixel(%v, %v): got %v, want %v", tc.pt, tc.dpi, got, tc.want)
+		}
+		c.SetDPI(tc.dpi)
+		if got, want := c.PointToFix32(tc.pt), raster.Fix32(tc.want*256); got != want {
+			t.Errorf("pt=%v, dpi=%v: PointToFix32: got %v, want %v", tc.pt, tc.dpi, got, want)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	testCases := []struct {
+		fontSize, dpi float64
+		want          int32
+	}{
+		{12, 72, 768},
+		{12, 96, 1024},
+		{9, 100, 800},
+		// 10 points at 300 DPI is 41.67 pixels, which is truncated to 2666
+		// 26.6 fixed point units.
+		{10, 300, 2666},
+		{0.5, 72, 32},
+	}
+	c := NewContext()
+	for _, tc := range testCases {
+		if got := Scale(tc.fontSize, tc.dpi); got != tc.want {
+			t.Errorf("Scale(%v, %v): got %d, want %d", tc.fontSize, tc.dpi, got, tc.want)
+		}
+		// SetFontSize and SetDPI recalculate the Context's scale with Scale.
+		c.SetFontSize(tc.fontSize)
+		c.SetDPI(tc.dpi)
+		if c.scale != tc.want {
+			t.Errorf("fontSize=%v, dpi=%v: Context scale: got %d, want %d", tc.fontSize, tc.dpi, c.scale, tc.want)
+		}
+	}
+}
+
+// pentagramFont returns luxisr with its 'A' glyph replaced by a pentagram,
+// whose contour crosses itself to wind twice around the star's center, at
+// (1024, 700) in FUnits.
+func pentagramFont(t *testing.T) *truetype.Font {
+	data, err := ioutil.ReadFile("../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u16 := func(b []byte, i int) int { return int(b[i])<<8 | int(b[i+1]) }
+	u32 := func(b []byte, i int) int { return u16(b, i)<<16 | u16(b, i+2) }
+	tables := map[string][]byte{}
+	for i, n := 0, u16(data, 4); i < n; i++ {
+		x := 12 + 16*i
+		offset, length := u32(data, x+8), u32(data, x+12)
+		tables[string(data[x:x+4])] = data[offset : offset+length]
+	}
+	const index = 36 // luxisr maps 'A' to glyph 36.
+	glyf, loca := tables["glyf"], tables["loca"]
+	if u16(tables["head"], 50) == 0 {
+		glyf = glyf[2*u16(loca, 2*index) : 2*u16(loca, 2*index+2)]
+	} else {
+		glyf = glyf[u32(loca, 4*index):u32(loca, 4*index+4)]
+	}
+	star := []byte{
+		0x00, 0x01, // numberOfContours.
+		0x01, 0xc5, 0x00, 0xd7, 0x06, 0x3b, 0x05, 0x14, // Bounding box.
+		0x00, 0x04, // endPtsOfContours.
+		0x00, 0x00, // instructionLength.
+		0x01, 0x01, 0x01, 0x01, 0x01, // Flags: all on-curve, with int16 deltas.
+		0x04, 0x00, 0x01, 0x61, 0xfc, 0x64, 0x04, 0x76, 0xfc, 0x64, // X deltas.
+		0x05, 0x14, 0xfb, 0xc3, 0x02, 0x9e, 0x00, 0x00, 0xfd, 0x62, // Y deltas.
+	}
+	if len(glyf) < len(star) {
+		t.Fatalf("glyph %d is too short to replace", index)
+	}
+	copy(glyf, star)
+	f, err := ParseFont(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestSetWindingRule(t *testing.T) {
+	testCases := []struct {
+		rule truetype.FillRule
+		want uint8
+	}{
+		// The star's center is inside by the non-zero rule, but outside by
+		// the even-odd rule.
+		{truetype.FillNonZero, 0x00},
+		{truetype.FillEvenOdd, 0xff},
+		{truetype.FillNonZero, 0x00},
+	}
+	c := testContext(t)
+	c.SetFont(pentagramFont(t))
+	c.SetFontSize(64)
+	dst := c.dst.(*image.RGBA)
+	for _, tc := range testCases {
+		// The rule is applied even though the glyph is already cached.
+		draw.Draw(dst, dst.Bounds(), image.White, image.ZP, draw.Src)
+		c.SetWindingRule(tc.rule)
+		if _, err := c.DrawString("A", Pt(100, 100)); err != nil {
+			t.Fatal(err)
+		}
+		// At 64 points, the center is 32 pixels right of and 21.875 pixels
+		// above the origin.
+		if got := dst.RGBAAt(132, 78).R; got != tc.want {
+			t.Errorf("rule %d: center: got %#x, want %#x", tc.rule, got, tc.want)
+		}
+		// A point in one of the star's arms is inside by either rule.
+		if got := dst.RGBAAt(132, 65).R; got != 0x00 {
+			t.Errorf("rule %d: arm: got %#x, want 0x00", tc.rule, got)
+		}
+	}
+}
+
+func TestSrcAlignment(t *testing.T) {
+	// src's pixels each encode their own co-ordinates.
+	src := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			src.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	const s = "Hello"
+	p := Pt(30, 100)
+
+	// A black on white drawing shows which pixels the text fully covers.
+	c := testContext(t)
+	c.SetFontSize(40)
+	_, bounds, err := c.DrawStringBounds(s, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := c.dst.(*image.RGBA)
+	if bounds.Min == image.ZP {
+		t.Fatalf("bounds: got %v, want a rectangle away from the origin", bounds)
+	}
+
+	testCases := []struct {
+		alignment SrcAlignment
+		origin    image.Point
+	}{
+		{AlignDst, image.ZP},
+		{AlignText, bounds.Min},
+	}
+	for _, tc := range testCases {
+		c := testContext(t)
+		c.SetFontSize(40)
+		c.SetSrc(src)
+		c.SetSrcAlignment(tc.alignment)
+		if _, err := c.DrawString(s, p); err != nil {
+			t.Fatal(err)
+		}
+		dst, n := c.dst.(*image.RGBA), 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if covered.RGBAAt(x, y).R != 0 {
+					continue
+				}
+				n++
+				sp := image.Pt(x, y).Sub(tc.origin)
+				if got, want := dst.RGBAAt(x, y), src.RGBAAt(sp.X, sp.Y); got != want {
+					t.Fatalf("alignment %d: pixel (%d, %d): got %v, want %v", tc.alignment, x, y, got, want)
+				}
+			}
+		}
+		if n == 0 {
+			t.Fatalf("alignment %d: no fully covered pixels", tc.alignment)
+		}
+	}
+}
+
+func TestClipMask(t *testing.T) {
+	const s = "Hello"
+	p := Pt(30, 100)
+	c := testContext(t)
+	c.SetFontSize(40)
+	_, bounds, err := c.DrawStringBounds(s, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := c.dst.(*image.RGBA)
+	// cx is in the middle of the text, and cuts through its glyphs.
+	cx := (bounds.Min.X + bounds.Max.X) / 2
+
+	testCases := []struct {
+		desc string
+		mask *image.Alpha
+		// alpha returns the mask's alpha at x.
+		alpha func(x int) uint8
+	}{
+		{
+			desc:  "nil",
+			alpha: func(x int) uint8 { return 0xff },
+		},
+		{
+			desc: "right half",
+			mask: func() *image.Alpha {
+				m := image.NewAlpha(image.Rect(cx, 0, 800, 600))
+				draw.Draw(m, m.Bounds(), image.Opaque, image.ZP, draw.Src)
+				return m
+			}(),
+			alpha: func(x int) uint8 {
+				if x < cx {
+					return 0
+				}
+				return 0xff
+			},
+		},
+		{
+			desc: "translucent left half",
+			mask: func() *image.Alpha {
+				m := image.NewAlpha(image.Rect(0, 0, 800, 600))
+				draw.Draw(m, image.Rect(0, 0, cx, 600), image.NewUniform(color.Alpha{0x80}), image.ZP, draw.Src)
+				return m
+			}(),
+			alpha: func(x int) uint8 {
+				if x < cx {
+					return 0x80
+				}
+				return 0
+			},
+		},
+	}
+	for _, tc := range testCases {
+		c := testContext(t)
+		c.SetFontSize(40)
+		c.SetClipMask(tc.mask)
+		if _, err := c.DrawString(s, p); err != nil {
+			t.Fatal(err)
+		}
+		got, drawn := c.dst.(*image.RGBA), false
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				g, w := got.RGBAAt(x, y).R, want.RGBAAt(x, y).R
+				switch a := tc.alpha(x); {
+				case a == 0xff && g != w:
+					t.Fatalf("%s: pixel (%d, %d): got %#x, want %#x", tc.desc, x, y, g, w)
+				case a == 0 && g != 0xff:
+					t.Fatalf("%s: pixel (%d, %d): got %#x, want 0xff", tc.desc, x, y, g)
+				case a == 0x80 && w == 0 && (g < 0x7e || g > 0x80):
+					t.Fatalf("%s: pixel (%d, %d): got %#x, want 0x7f", tc.desc, x, y, g)
+				}
+				drawn = drawn || g != 0xff
+			}
+		}
+		if !drawn {
+			t.Errorf("%s: nothing was drawn", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package raster
+
+import (
+	"math"
+)
+
+// flatness is the maximum distance, in Fix32 units, between a quadratic or
+// cubic segment and the linear segments that approximate it when dashing.
+const flatness = 16
+
+// A dasher holds state for dashing a path.
+type dasher struct {
+	// p is the destination that records the dashes.
+	p Adder
+	// dashes and phase are the dash pattern.
+	dashes []Fix32
+	phase  Fix32
+	// i is the index in dashes of the current dash or gap, and rem is the
+	// length that remains of it. on is whether it is a dash.
+	i   int
+	rem Fix32
+	on  bool
+	// a is the most recent segment point. started is whether a dash has been
+	// started at a, and not yet ended.
+	a       Point
+	started bool
+}
+
+// next moves the dasher to the next dash or gap in the pattern. A pattern
+// with an odd number of lengths alternates between dashes and gaps, so that
+// each length is a dash and then a gap, as for the SVG stroke-dasharray
+// property.
+func (d *dasher) next() {
+	d.i = (d.i + 1) % len(d.dashes)
+	d.rem = d.dashes[d.i]
+	d.on = !d.on
+}
+
+// Start starts a new curve, and restarts the dash pattern at its phase.
+func (d *dasher) Start(a Point) {
+	d.i, d.rem, d.on = 0, d.dashes[0], true
+	period := Fix32(0)
+	for _, x := range d.dashes {
+		period += x
+	}
+	if len(d.dashes)%2 != 0 {
+		period *= 2
+	}
+	phase := d.phase % period
+	if phase < 0 {
+		phase += period
+	}
+	for phase >= d.rem {
+		phase -= d.rem
+		d.next()
+	}
+	d.rem -= phase
+	d.a, d.started = a, false
+}
+
+// Add1 adds a linear segment to the current curve.
+func (d *dasher) Add1(b Point) {
+	a, length := d.a, b.Sub(d.a).Len()
+	for length > d.rem {
+		// The current dash or gap ends part way along the segment, at m.
+		m := Point{
+			a.X + Fix32(int64(b.X-a.X)*int64(d.rem)/int64(length)),
+			a.Y + Fix32(int64(b.Y-a.Y)*int64(d.rem)/int64(length)),
+		}
+		if d.on {
+			d.startDash(a)
+			d.p.Add1(m)
+			d.started = false
+		}
+		a, length = m, length-d.rem
+		d.next()
+	}
+	d.rem -= length
+	if d.on {
+		d.startDash(a)
+		d.p.Add1(b)
+	}
+	d.a = b
+}
+
+// startDash starts a dash at a, unless one has already been started.
+func (d *dasher) startDash(a Point) {
+	if !d.started {
+		d.p.Start(a)
+		d.started = true
+	}
+}
+
+// Add2 adds a quadratic segment to the current curve, approximated by linear
+// segments.
+func (d *dasher) Add2(b, c Point) {
+	// The distance between a quadratic segment and its approximation by n
+	// linear segments is at most dev/(4*n*n).
+	dev := d.a.Add(c).Sub(b.Add(b)).Len()
+	n := int(math.Ceil(math.Sqrt(float64(dev) / (4 * flatness))))
+	a := d.a
+	for i := 1; i < n; i++ {
+		t := float64(i) / float64(n)
+		s := 1 - t
+		d.Add1(Point{
+			Fix32(s*s*float64(a.X) + 2*s*t*float64(b.X) + t*t*float64(c.X)),
+			Fix32(s*s*float64(a.Y) + 2*s*t*float64(b.Y) + t*t*float64(c.Y)),
+		})
+	}
+	d.Add1(c)
+}
+
+// Add3 adds a cubic segment to the current curve, approximated by linear
+// segments.
+func (d *dasher) Add3(b, c, e Point) {
+	// The distance between a cubic segment and its approximation by n linear
+	// segments is at most 3*dev/(4*n*n).
+	dev := d.a.Add(c).Sub(b.Add(b)).Len()
+	if dev1 := b.Add(e).Sub(c.Add(c)).Len(); dev < dev1 {
+		dev = dev1
+	}
+	n := int(math.Ceil(math.Sqrt(3 * float64(dev) / (4 * flatness))))
+	a := d.a
+	for i := 1; i < n; i++ {
+		t := float64(i) / float64(n)
+		s := 1 - t
+		d.Add1(Point{
+			Fix32(s*s*s*float64(a.X) + 3*s*s*t*float64(b.X) + 3*s*t*t*float64(c.X) + t*t*t*float64(e.X)),
+			Fix32(s*s*s*float64(a.Y) + 3*s*s*t*float64(b.Y) + 3*s*t*t*float64(c.Y) + t*t*t*float64(e.Y)),
+		})
+	}
+	d.Add1(e)
+}
+
+// Dash adds the dashes of q to p. The dash pattern alternates between the
+// lengths of dashes and of the gaps between them, and starts at the given
+// phase, a distance into the pattern. The pattern restarts at each of q's
+// curves, and is measured by arc length along curved segments, which are
+// approximated by linear segments. Each dash is added as a separate curve,
+// and so the dashes of q can be passed to Stroke to draw a dashed line.
+// If the pattern is empty, or has no positive length, or has a negative
+// length, then q is added undashed.
+func Dash(p Adder, q Path, dashes []Fix32, phase Fix32) {
+	period := Fix32(0)
+	for _, x := range dashes {
+		if x < 0 {
+			period = 0
+			break
+		}
+		period += x
+	}
+	if period == 0 {
+		addPath(p, q)
+		return
+	}
+	addPath(&dasher{p: p, dashes: dashes, phase: phase}, q)
+}
+
+// addPath adds q to p.
+func addPath(p Adder, q Path) {
+	for i := 0; i < len(q); {
+		switch q[i] {
+		case 0:
+			p.Start(Point{q[i+1], q[i+2]})
+			i += 4
+		case 1:
+			p.Add1(Point{q[i+1], q[i+2]})
+			i += 4
+		case 2:
+			p.Add2(Point{q[i+1], q[i+2]}, Point{q[i+3], q[i+4]})
+			i += 6
+		case 3:
+			p.Add3(Point{q[i+1], q[i+2]}, Point{q[i+3], q[i+4]}, Point{q[i+5], q[i+6]})
+			i += 8
+		default:
+			panic("freetype/raster: bad path")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package raster
+
+import (
+	"testing"
+)
+
+// dashes returns the first and last points of each curve in p.
+func dashes(p Path) (first, last []Point) {
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case 0:
+			first = append(first, Point{p[i+1], p[i+2]})
+			last = append(last, Point{p[i+1], p[i+2]})
+			i += 4
+		case 1:
+			last[len(last)-1] = Point{p[i+1], p[i+2]}
+			i += 4
+		default:
+			panic("dashes are not linear")
+		}
+	}
+	return first, last
+}
+
+func TestDashLine(t *testing.T) {
+	// The phase starts the pattern half way through its first dash, and so
+	// there are dashes at 0-5, 10-20 and 25-35.
+	var q, p Path
+	q.Start(Point{0, 0})
+	q.Add1(Point{15 << 8, 0})
+	q.Add1(Point{35 << 8, 0})
+	Dash(&p, q, []Fix32{10 << 8, 5 << 8}, 5<<8)
+	first, last := dashes(p)
+	want := []Fix32{0, 5, 10, 20, 25, 35}
+	if len(first) != len(want)/2 {
+		t.Fatalf("got %d dashes, want %d: %v", len(first), len(want)/2, p)
+	}
+	for i := range first {
+		f, l := Point{want[2*i] << 8, 0}, Point{want[2*i+1] << 8, 0}
+		if first[i] != f || last[i] != l {
+			t.Errorf("dash %d: got %v-%v, want %v-%v", i, first[i], last[i], f, l)
+		}
+	}
+}
+
+func TestDashCircle(t *testing.T) {
+	// The circle has radius 64, and so its circumference is about 402.1. It is
+	// four cubic segments, whose control points are 141/256 of the radius
+	// from their end points.
+	const r, k = 64 << 8, 64 * 141
+	var q, p Path
+	q.Start(Point{r, 0})
+	q.Add3(Point{r, k}, Point{k, r}, Point{0, r})
+	q.Add3(Point{-k, r}, Point{-r, k}, Point{-r, 0})
+	q.Add3(Point{-r, -k}, Point{-k, -r}, Point{0, -r})
+	q.Add3(Point{k, -r}, Point{r, -k}, Point{r, 0})
+	Dash(&p, q, []Fix32{10 << 8, 10 << 8}, 0)
+	first, last := dashes(p)
+	// There are 20 full dashes and a short one, ending at the start point.
+	if len(first) != 21 {
+		t.Fatalf("got %d dashes, want 21", len(first))
+	}
+	for i := range first {
+		if i == 20 {
+			if last[i] != q.firstPoint() {
+				t.Errorf("last dash ends at %v, want %v", last[i], q.firstPoint())
+			}
+			break
+		}
+		// A dash's end points are a chord of the circle, which is slightly
+		// shorter than the dash's arc length.
+		if d := last[i].Sub(first[i]).Len(); d < 2550 || d > 2560 {
+			t.Errorf("dash %d: chord length %v, want slightly less than 10", i, d)
+		}
+		// Each dash starts 20 along the circle from the previous one.
+		if i > 0 {
+			if d := first[i].Sub(first[i-1]).Len(); d < 5070 || d > 5120 {
+				t.Errorf("dash %d: chord length from previous dash %v, want slightly less than 20", i, d)
+			}
+		}
+	}
+}
@@ -113,6 +113,48 @@ func NewAlphaSrcPainter(m *image.Alpha) AlphaSrcPainter {
 	return AlphaSrcPainter{m}
 }
 
+// A Gray16SrcPainter is a Painter that paints Spans onto an image.Gray16
+// using the Src Porter-Duff composition operator. Each pixel's gray value is
+// its coverage, at the full 16-bit precision of the Rasterizer rather than
+// the 8-bit precision of an image.Alpha.
+type Gray16SrcPainter struct {
+	Image *image.Gray16
+}
+
+// Paint satisfies the Painter interface by painting ss onto an image.Gray16.
+func (r Gray16SrcPainter) Paint(ss []Span, done bool) {
+	b := r.Image.Bounds()
+	for _, s := range ss {
+		if s.Y < b.Min.Y {
+			continue
+		}
+		if s.Y >= b.Max.Y {
+			return
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		if s.X0 >= s.X1 {
+			continue
+		}
+		base := (s.Y-r.Image.Rect.Min.Y)*r.Image.Stride - 2*r.Image.Rect.Min.X
+		p := r.Image.Pix[base+2*s.X0 : base+2*s.X1]
+		hi, lo := uint8(s.A>>24), uint8(s.A>>16)
+		for i := 0; i < len(p); i += 2 {
+			p[i+0] = hi
+			p[i+1] = lo
+		}
+	}
+}
+
+// NewGray16SrcPainter creates a new Gray16SrcPainter for the given image.
+func NewGray16SrcPainter(m *image.Gray16) Gray16SrcPainter {
+	return Gray16SrcPainter{m}
+}
+
 type RGBAPainter struct {
 	// The image to compose onto.
 	Image *image.RGBA
@@ -179,6 +221,219 @@ func NewRGBAPainter(m *image.RGBA) *RGBAPainter {
 	return &RGBAPainter{Image: m}
 }
 
+// An NRGBAPainter is a Painter that paints Spans onto an image.NRGBA.
+// Unlike an image.RGBA's, an image.NRGBA's colors are not alpha-premultiplied,
+// and so each painted pixel is composited in premultiplied form and then
+// divided by its resultant alpha.
+type NRGBAPainter struct {
+	// The image to compose onto.
+	Image *image.NRGBA
+	// The Porter-Duff composition operator.
+	Op draw.Op
+	// The 16-bit color to paint the spans.
+	cr, cg, cb, ca uint32
+}
+
+// Paint satisfies the Painter interface by painting ss onto an image.NRGBA.
+func (r *NRGBAPainter) Paint(ss []Span, done bool) {
+	b := r.Image.Bounds()
+	for _, s := range ss {
+		if s.Y < b.Min.Y {
+			continue
+		}
+		if s.Y >= b.Max.Y {
+			return
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		if s.X0 >= s.X1 {
+			continue
+		}
+		ma := s.A >> 16
+		const m = 1<<16 - 1
+		// The source color, premultiplied by its alpha and the span's coverage.
+		sr, sg, sb, sa := r.cr*ma/m, r.cg*ma/m, r.cb*ma/m, r.ca*ma/m
+		i0 := (s.Y-r.Image.Rect.Min.Y)*r.Image.Stride + (s.X0-r.Image.Rect.Min.X)*4
+		i1 := i0 + (s.X1-s.X0)*4
+		for i := i0; i < i1; i += 4 {
+			pr, pg, pb, pa := sr, sg, sb, sa
+			if r.Op == draw.Over {
+				// Premultiply the destination color, and scale it by the
+				// fraction of it that shows through the source.
+				da := uint32(r.Image.Pix[i+3]) * 0x101
+				a := (m - sa) * da / m
+				pr += uint32(r.Image.Pix[i+0]) * 0x101 * a / m
+				pg += uint32(r.Image.Pix[i+1]) * 0x101 * a / m
+				pb += uint32(r.Image.Pix[i+2]) * 0x101 * a / m
+				pa += a
+			}
+			if pa == 0 {
+				r.Image.Pix[i+0] = 0
+				r.Image.Pix[i+1] = 0
+				r.Image.Pix[i+2] = 0
+				r.Image.Pix[i+3] = 0
+				continue
+			}
+			r.Image.Pix[i+0] = uint8(pr * m / pa >> 8)
+			r.Image.Pix[i+1] = uint8(pg * m / pa >> 8)
+			r.Image.Pix[i+2] = uint8(pb * m / pa >> 8)
+			r.Image.Pix[i+3] = uint8(pa >> 8)
+		}
+	}
+}
+
+// SetColor sets the color to paint the spans.
+func (r *NRGBAPainter) SetColor(c color.Color) {
+	r.cr, r.cg, r.cb, r.ca = c.RGBA()
+}
+
+// NewNRGBAPainter creates a new NRGBAPainter for the given image.
+func NewNRGBAPainter(m *image.NRGBA) *NRGBAPainter {
+	return &NRGBAPainter{Image: m}
+}
+
+// DefaultLCDFilter is a five-tap FIR filter, the same as FreeType's default
+// LCD filter, that reduces the color fringes of subpixel rendering.
+var DefaultLCDFilter = [5]uint8{0x08, 0x4d, 0x56, 0x4d, 0x08}
+
+// An LCDPainter is a Painter that paints Spans onto an image.RGBA using
+// subpixel anti-aliasing for LCD displays with horizontal RGB (or BGR)
+// stripes. The Spans' X co-ordinates are measured in subpixels, three per
+// pixel of the image, and so the Rasterizer should be three times as wide
+// as the image, and the painted paths' X co-ordinates should be tripled.
+// Each of a pixel's red, green and blue channels is composited, using the
+// Over Porter-Duff composition operator, with its own subpixel's coverage.
+type LCDPainter struct {
+	// The image to compose onto.
+	Image *image.RGBA
+	// Whether the display's subpixels are in BGR order instead of RGB.
+	BGR bool
+	// The filter applied to each row of subpixel coverage, whose weights
+	// should sum to 256. If it is the zero value, no filtering is done.
+	Filter [5]uint8
+	// The 16-bit color to paint the spans.
+	cr, cg, cb, ca uint32
+	// y is the row being accumulated, and cov and tmp hold its subpixels'
+	// 16-bit coverage before and after filtering. The subpixels in
+	// cov[x0:x1] may be non-zero.
+	y      int
+	cov    []uint32
+	tmp    []uint32
+	x0, x1 int
+}
+
+// Paint satisfies the Painter interface by painting ss onto an image.RGBA.
+func (r *LCDPainter) Paint(ss []Span, done bool) {
+	b := r.Image.Bounds()
+	if n := 3 * b.Dx(); len(r.cov) != n {
+		r.cov = make([]uint32, n)
+		r.tmp = make([]uint32, n)
+		r.x0, r.x1 = n, 0
+	}
+	for _, s := range ss {
+		if s.Y != r.y {
+			r.flush()
+			r.y = s.Y
+		}
+		if s.Y < b.Min.Y || s.Y >= b.Max.Y {
+			continue
+		}
+		x0, x1 := s.X0-3*b.Min.X, s.X1-3*b.Min.X
+		if x0 < 0 {
+			x0 = 0
+		}
+		if x1 > len(r.cov) {
+			x1 = len(r.cov)
+		}
+		if x0 >= x1 {
+			continue
+		}
+		a := s.A >> 16
+		for i := x0; i < x1; i++ {
+			r.cov[i] = a
+		}
+		if r.x0 > x0 {
+			r.x0 = x0
+		}
+		if r.x1 < x1 {
+			r.x1 = x1
+		}
+	}
+	if done {
+		r.flush()
+	}
+}
+
+// flush composites the accumulated row of subpixel coverage onto the image,
+// and then clears it.
+func (r *LCDPainter) flush() {
+	if r.x0 >= r.x1 {
+		return
+	}
+	cov, x0, x1 := r.cov, r.x0, r.x1
+	if r.Filter != [5]uint8{} {
+		// Filtering spreads each subpixel's coverage to its neighbors. The
+		// filtered range is rounded out to whole pixels, so that every
+		// subpixel that is composited is filtered for this row, rather than
+		// left over in tmp from an earlier one.
+		x0, x1 = x0-2, x1+2
+		if x0 < 0 {
+			x0 = 0
+		}
+		x0, x1 = x0-x0%3, (x1+2)/3*3
+		if x1 > len(cov) {
+			x1 = len(cov)
+		}
+		for i := x0; i < x1; i++ {
+			a := uint32(0)
+			for k, w := range r.Filter {
+				if j := i + k - 2; 0 <= j && j < len(cov) {
+					a += uint32(w) * cov[j]
+				}
+			}
+			if a >>= 8; a > 0xffff {
+				a = 0xffff
+			}
+			r.tmp[i] = a
+		}
+		cov = r.tmp
+	}
+	const m = 1<<16 - 1
+	b := r.Image.Bounds()
+	base := (r.y-r.Image.Rect.Min.Y)*r.Image.Stride + (b.Min.X-r.Image.Rect.Min.X)*4
+	for x := x0 / 3; x < (x1+2)/3; x++ {
+		mr, mg, mb := cov[3*x], cov[3*x+1], cov[3*x+2]
+		if r.BGR {
+			mr, mb = mb, mr
+		}
+		ma := (mr + mg + mb) / 3
+		p := r.Image.Pix[base+4*x : base+4*x+4]
+		p[0] = uint8((uint32(p[0])*(m-r.ca*mr/m)*0x101 + r.cr*mr) / m >> 8)
+		p[1] = uint8((uint32(p[1])*(m-r.ca*mg/m)*0x101 + r.cg*mg) / m >> 8)
+		p[2] = uint8((uint32(p[2])*(m-r.ca*mb/m)*0x101 + r.cb*mb) / m >> 8)
+		p[3] = uint8((uint32(p[3])*(m-r.ca*ma/m)*0x101 + r.ca*ma) / m >> 8)
+	}
+	for i := r.x0; i < r.x1; i++ {
+		r.cov[i] = 0
+	}
+	r.x0, r.x1 = len(r.cov), 0
+}
+
+// SetColor sets the color to paint the spans.
+func (r *LCDPainter) SetColor(c color.Color) {
+	r.cr, r.cg, r.cb, r.ca = c.RGBA()
+}
+
+// NewLCDPainter creates a new LCDPainter for the given image, which filters
+// with the DefaultLCDFilter.
+func NewLCDPainter(m *image.RGBA) *LCDPainter {
+	return &LCDPainter{Image: m, Filter: DefaultLCDFilter}
+}
+
 // A MonochromePainter wraps another Painter, quantizing each Span's alpha to
 // be either fully opaque or fully transparent.
 type MonochromePainter struct {
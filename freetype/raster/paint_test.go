@@ -0,0 +1,137 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package raster
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestNRGBAPainter(t *testing.T) {
+	bg := color.NRGBA{0x40, 0x80, 0xc0, 0x80}
+	src := color.NRGBA{0xff, 0x20, 0x00, 0xc0}
+	for _, op := range []draw.Op{draw.Over, draw.Src} {
+		got := image.NewNRGBA(image.Rect(0, 0, 256, 1))
+		want := image.NewNRGBA(got.Rect)
+		draw.Draw(got, got.Rect, image.NewUniform(bg), image.ZP, draw.Src)
+		draw.Draw(want, want.Rect, image.NewUniform(bg), image.ZP, draw.Src)
+		// Paint one pixel for each coverage value, and compare with the
+		// image/draw package's compositing through an equivalent mask.
+		mask := image.NewAlpha(got.Rect)
+		ss := make([]Span, 256)
+		for x := range ss {
+			mask.Pix[x] = uint8(x)
+			ss[x] = Span{Y: 0, X0: x, X1: x + 1, A: uint32(x) * 0x1010101}
+		}
+		p := NewNRGBAPainter(got)
+		p.Op = op
+		p.SetColor(src)
+		p.Paint(ss, true)
+		draw.DrawMask(want, want.Rect, image.NewUniform(src), image.ZP, mask, image.ZP, op)
+		for i := range got.Pix {
+			if d := int(got.Pix[i]) - int(want.Pix[i]); d < -1 || d > 1 {
+				t.Errorf("op %v, x=%d, channel %d: got %#02x, want %#02x",
+					op, i/4, i%4, got.Pix[i], want.Pix[i])
+			}
+		}
+	}
+}
+
+func TestGray16SrcPainter(t *testing.T) {
+	// A long, thin wedge has edges at many different sub-pixel angles and
+	// positions, and so covers pixels by many different fractions.
+	r := image.Rect(0, 0, 64, 8)
+	z := NewRasterizer(r.Dx(), r.Dy())
+	z.Start(Point{0, 0})
+	z.Add1(Point{64 << 8, 3 << 8})
+	z.Add1(Point{64 << 8, 8 << 8})
+	z.Add1(Point{0, 0})
+	gray := image.NewGray16(r)
+	z.Rasterize(NewGray16SrcPainter(gray))
+	alpha := image.NewAlpha(r)
+	z.Rasterize(NewAlphaSrcPainter(alpha))
+
+	levels := map[uint16]bool{}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			g, a := gray.Gray16At(x, y).Y, alpha.AlphaAt(x, y).A
+			if uint8(g>>8) != a {
+				t.Errorf("(%d, %d): gray %#04x, alpha %#02x", x, y, g, a)
+			}
+			levels[g] = true
+		}
+	}
+	// Quantizing to 8 bits would merge some of the wedge's levels.
+	quantized := map[uint16]bool{}
+	for g := range levels {
+		quantized[g>>8] = true
+	}
+	if len(levels) <= len(quantized) {
+		t.Errorf("got %d distinct 16-bit levels, want more than their %d 8-bit levels",
+			len(levels), len(quantized))
+	}
+}
+
+func TestLCDPainter(t *testing.T) {
+	// newDst returns a white 4x3 pixel image.
+	newDst := func() *image.RGBA {
+		m := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		draw.Draw(m, m.Rect, image.White, image.ZP, draw.Src)
+		return m
+	}
+	// Without filtering, each subpixel's coverage applies to only its own
+	// channel. Subpixel 4 is pixel 1's green, or with BGR order, still its
+	// green, and subpixel 6 is pixel 2's red, or its blue.
+	for _, bgr := range []bool{false, true} {
+		m := newDst()
+		p := &LCDPainter{Image: m, BGR: bgr}
+		p.SetColor(color.Black)
+		p.Paint([]Span{{Y: 0, X0: 4, X1: 5, A: 0xffffffff}, {Y: 0, X0: 6, X1: 7, A: 0xffffffff}}, true)
+		want := []color.RGBA{
+			{0xff, 0xff, 0xff, 0xff},
+			{0xff, 0x00, 0xff, 0xff},
+			{0x00, 0xff, 0xff, 0xff},
+			{0xff, 0xff, 0xff, 0xff},
+		}
+		if bgr {
+			want[2] = color.RGBA{0xff, 0xff, 0x00, 0xff}
+		}
+		for x, w := range want {
+			if got := m.RGBAAt(x, 0); got != w {
+				t.Errorf("bgr=%t: pixel %d: got %v, want %v", bgr, x, got, w)
+			}
+		}
+	}
+
+	// With filtering, a row's pixels depend only on that row's spans, and
+	// not on those of the rows painted before it.
+	lone := Span{Y: 2, X0: 7, X1: 8, A: 0xffffffff}
+	want := newDst()
+	p := NewLCDPainter(want)
+	p.SetColor(color.Black)
+	p.Paint([]Span{lone}, true)
+	got := newDst()
+	p = NewLCDPainter(got)
+	p.SetColor(color.Black)
+	p.Paint([]Span{{Y: 0, X0: 0, X1: 12, A: 0xffffffff}, lone}, true)
+	for x := 0; x < 4; x++ {
+		if g, w := got.RGBAAt(x, 2), want.RGBAAt(x, 2); g != w {
+			t.Errorf("row 2, pixel %d: got %v, want %v", x, g, w)
+		}
+	}
+	// The lone subpixel's coverage spreads to two subpixels on each side,
+	// which are in pixels 1, 2 and 3, but not pixel 0.
+	if g := want.RGBAAt(0, 2); g != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("pixel 0: got %v, want white", g)
+	}
+	for x := 1; x < 4; x++ {
+		if g := want.RGBAAt(x, 2); g == (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+			t.Errorf("pixel %d: got white, want a filtered fringe", x)
+		}
+	}
+}
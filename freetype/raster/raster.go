@@ -33,6 +33,12 @@ type Rasterizer struct {
 	UseNonZeroWinding bool
 	// An offset (in pixels) to the painted spans.
 	Dx, Dy int
+	// Tolerance is the maximum distance between a quadratic or cubic segment
+	// and the linear segments that approximate it. Curves are subdivided
+	// adaptively, into more linear segments the more curved they are. If
+	// Tolerance is zero, the default, then it is chosen from the
+	// Rasterizer's bounds, in the same way as the C Freetype implementation.
+	Tolerance Fix32
 
 	// The width of the Rasterizer. The height is implicit in len(cellIndex).
 	width int
@@ -298,16 +304,57 @@ func (r *Rasterizer) Add1(b Point) {
 	r.a = b
 }
 
-// Add2 adds a quadratic segment to the current curve.
-func (r *Rasterizer) Add2(b, c Point) {
-	// Calculate nSplit (the number of recursive decompositions) based on how `curvy' it is.
-	// Specifically, how much the middle point b deviates from (a+c)/2.
-	dev := maxAbs(r.a.X-2*b.X+c.X, r.a.Y-2*b.Y+c.Y) / Fix32(r.splitScale2)
+// splitScales returns the scaling factors used to determine how many times
+// to decompose a quadratic or cubic segment, for r.Tolerance.
+func (r *Rasterizer) splitScales() (ss2, ss3 Fix32) {
+	if r.Tolerance <= 0 {
+		return Fix32(r.splitScale2), Fix32(r.splitScale3)
+	}
+	// A quadratic segment whose middle point deviates by dev from its ends'
+	// midpoint is at most dev/16 from its two-linear-piece approximation.
+	// The cubic's scale has the same ratio to the quadratic's as C Freetype.
+	const maxTolerance = 1 << 26
+	tol := r.Tolerance
+	if tol > maxTolerance {
+		tol = maxTolerance
+	}
+	return 16 * tol, 8 * tol
+}
+
+// quadSplits returns nSplit, the number of recursive decompositions of the
+// quadratic segment from a to c with control point b, based on how `curvy'
+// it is. Specifically, how much the middle point b deviates from (a+c)/2.
+// The segment is approximated by 2<<nSplit linear segments.
+func (r *Rasterizer) quadSplits(a, b, c Point) int {
+	ss2, _ := r.splitScales()
+	dev := maxAbs(a.X-2*b.X+c.X, a.Y-2*b.Y+c.Y) / ss2
 	nsplit := 0
 	for dev > 0 {
 		dev /= 4
 		nsplit++
 	}
+	return nsplit
+}
+
+// cubeSplits returns nSplit, the number of recursive decompositions of the
+// cubic segment from a to d with control points b and c, based on how
+// `curvy' it is. The segment is approximated by 2<<nSplit linear segments.
+func (r *Rasterizer) cubeSplits(a, b, c, d Point) int {
+	ss2, ss3 := r.splitScales()
+	dev2 := maxAbs(a.X-3*(b.X+c.X)+d.X, a.Y-3*(b.Y+c.Y)+d.Y) / ss2
+	dev3 := maxAbs(a.X-2*b.X+d.X, a.Y-2*b.Y+d.Y) / ss3
+	nsplit := 0
+	for dev2 > 0 || dev3 > 0 {
+		dev2 /= 8
+		dev3 /= 4
+		nsplit++
+	}
+	return nsplit
+}
+
+// Add2 adds a quadratic segment to the current curve.
+func (r *Rasterizer) Add2(b, c Point) {
+	nsplit := r.quadSplits(r.a, b, c)
 	// dev is 32-bit, and nsplit++ every time we shift off 2 bits, so maxNsplit is 16.
 	const maxNsplit = 16
 	if nsplit > maxNsplit {
@@ -356,15 +403,7 @@ func (r *Rasterizer) Add2(b, c Point) {
 
 // Add3 adds a cubic segment to the current curve.
 func (r *Rasterizer) Add3(b, c, d Point) {
-	// Calculate nSplit (the number of recursive decompositions) based on how `curvy' it is.
-	dev2 := maxAbs(r.a.X-3*(b.X+c.X)+d.X, r.a.Y-3*(b.Y+c.Y)+d.Y) / Fix32(r.splitScale2)
-	dev3 := maxAbs(r.a.X-2*b.X+d.X, r.a.Y-2*b.Y+d.Y) / Fix32(r.splitScale3)
-	nsplit := 0
-	for dev2 > 0 || dev3 > 0 {
-		dev2 /= 8
-		dev3 /= 4
-		nsplit++
-	}
+	nsplit := r.cubeSplits(r.a, b, c, d)
 	// devN is 32-bit, and nsplit++ every time we shift off 2 bits, so maxNsplit is 16.
 	const maxNsplit = 16
 	if nsplit > maxNsplit {
@@ -478,8 +517,12 @@ func (r *Rasterizer) areaToAlpha(area int) uint32 {
 
 // Rasterize converts r's accumulated curves into Spans for p. The Spans
 // passed to p are non-overlapping, and sorted by Y and then X. They all
-// have non-zero width (and 0 <= X0 < X1 <= r.width) and non-zero A, except
-// for the final Span, which has Y, X0, X1 and A all equal to zero.
+// have non-zero width (and r.Dx <= X0 < X1 <= r.Dx+r.width) and non-zero A,
+// except for the final Span, which has Y, X0, X1 and A all equal to zero.
+//
+// p need not paint an image: a PainterFunc receives the raw coverage Spans,
+// for compositing them some other way. The slice of Spans is re-used, so a
+// Painter that keeps Spans after its Paint call returns must copy them.
 func (r *Rasterizer) Rasterize(p Painter) {
 	r.saveCell()
 	s := 0
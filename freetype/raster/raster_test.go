@@ -0,0 +1,54 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package raster
+
+import (
+	"testing"
+)
+
+func TestTolerance(t *testing.T) {
+	r := NewRasterizer(200, 200)
+	// segments returns how many linear segments approximate the quadratic
+	// segment from a to c with control point b, and the cubic segment from a
+	// to c with control points b and b.
+	segments := func(tol Fix32, a, b, c Point) (quad, cube int) {
+		r.Tolerance = tol
+		return 2 << uint(r.quadSplits(a, b, c)), 2 << uint(r.cubeSplits(a, b, b, c))
+	}
+	a, c := Point{0, 0}, Point{100 << 8, 100 << 8}
+	tight, flat := Point{100 << 8, 0}, Point{51 << 8, 49 << 8}
+
+	q0, c0 := segments(0, a, tight, c)
+	q1, c1 := segments(1<<8/4, a, tight, c)
+	q2, c2 := segments(1<<8/64, a, tight, c)
+	if q1 >= q2 || c1 >= c2 {
+		t.Errorf("tight curve: got %d, %d segments at 1/4 pixel and %d, %d at 1/64 pixel, want more at 1/64",
+			q1, c1, q2, c2)
+	}
+	// A nearly straight curve needs fewer segments.
+	if q, c := segments(1<<8/64, a, flat, c); q >= q2 || c >= c2 {
+		t.Errorf("flat curve: got %d, %d segments, want fewer than %d, %d", q, c, q2, c2)
+	}
+	// The default tolerance for a 200x200 Rasterizer is 1/8 pixel.
+	if q, c := segments(1<<8/8, a, tight, c); q != q0 || c != c0 {
+		t.Errorf("default: got %d, %d segments, want %d, %d", q, c, q0, c0)
+	}
+
+	// The quadratic's approximation is within the tolerance, with as few
+	// segments as possible. Its middle point deviates from its ends'
+	// midpoint by dev, and so each of its n segments deviates from the
+	// curve by at most dev/(4*n*n).
+	const dev = 100 << 8
+	for _, tol := range []Fix32{1, 4, 16, 64, 256, 1024} {
+		n, _ := segments(tol, a, tight, c)
+		if dev > 4*n*n*int(tol) {
+			t.Errorf("tolerance %d: %d segments are not within it", tol, n)
+		}
+		if m := n / 2; dev <= 4*m*m*int(tol) {
+			t.Errorf("tolerance %d: %d segments are within it, but so are %d", tol, n, m)
+		}
+	}
+}
@@ -89,8 +89,49 @@ func roundJoiner(lhs, rhs Adder, haflWidth Fix32, pivot, n0, n1 Point) {
 var BevelJoiner Joiner = JoinerFunc(bevelJoiner)
 
 func bevelJoiner(lhs, rhs Adder, haflWidth Fix32, pivot, n0, n1 Point) {
-	lhs.Add1(pivot.Add(n1))
-	rhs.Add1(pivot.Sub(n1))
+	dot := n0.Rot90CW().Dot(n1)
+	if dot >= 0 {
+		lhs.Add1(pivot.Add(n1))
+		rhs.Add1(pivot.Sub(n1))
+	} else {
+		lhs.Add1(pivot.Add(n1))
+		rhs.Add1(pivot.Sub(n1))
+	}
+}
+
+// A MiterJoiner adds miter joins to a stroked path. A miter join extends the
+// outer edges of the two segments until they meet, but a join whose miter
+// length, the distance from its inner corner to its outer corner, is more
+// than Limit times the stroke width is beveled instead, as for the SVG
+// stroke-miterlimit property.
+type MiterJoiner struct {
+	Limit float64
+}
+
+// DefaultMiterJoiner adds miter joins with the same limit as SVG's default.
+var DefaultMiterJoiner Joiner = MiterJoiner{4}
+
+func (m MiterJoiner) Join(lhs, rhs Adder, halfWidth Fix32, pivot, n0, n1 Point) {
+	// The miter's corner is along the bisector n0+n1, and the ratio of the
+	// miter length to the stroke width is 2*halfWidth / |n0+n1|.
+	bisector := n0.Add(n1)
+	d := float64(bisector.Len())
+	if d == 0 || 2*float64(halfWidth) > m.Limit*d {
+		bevelJoiner(lhs, rhs, halfWidth, pivot, n0, n1)
+		return
+	}
+	u := int64(halfWidth)
+	corner := bisector.Norm(Fix32(2 * u * u / int64(d)))
+	dot := n0.Rot90CW().Dot(n1)
+	if dot >= 0 {
+		lhs.Add1(pivot.Add(corner))
+		lhs.Add1(pivot.Add(n1))
+		rhs.Add1(pivot.Sub(n1))
+	} else {
+		lhs.Add1(pivot.Add(n1))
+		rhs.Add1(pivot.Sub(corner))
+		rhs.Add1(pivot.Sub(n1))
+	}
 }
 
 // addArc adds a circular arc from pivot+n0 to pivot+n1 to p. The shorter of
@@ -392,7 +433,33 @@ func (k *stroker) Add2(b, c Point) {
 
 // Add3 adds a cubic segment to the stroker.
 func (k *stroker) Add3(b, c, d Point) {
-	panic("freetype/raster: stroke unimplemented for cubic segments")
+	// We approximate the cubic segment by four quadratic segments, dividing
+	// it at its middle and then dividing each half at its middle.
+	a := k.a
+	b0, c0, m, b1, c1 := splitCubic(a, b, c, d)
+	for _, q := range [2][4]Point{{a, b0, c0, m}, {m, b1, c1, d}} {
+		b0, c0, m, b1, c1 := splitCubic(q[0], q[1], q[2], q[3])
+		k.Add2(quadControl(q[0], b0, c0, m), m)
+		k.Add2(quadControl(m, b1, c1, q[3]), q[3])
+	}
+}
+
+// splitCubic performs a de Casteljau decomposition of the cubic segment
+// (a, b, c, d) at its middle, into (a, b0, c0, m) and (m, b1, c1, d).
+func splitCubic(a, b, c, d Point) (b0, c0, m, b1, c1 Point) {
+	mbc := midpoint(b, c)
+	b0, c1 = midpoint(a, b), midpoint(c, d)
+	c0, b1 = midpoint(b0, mbc), midpoint(mbc, c1)
+	return b0, c0, midpoint(c0, b1), b1, c1
+}
+
+// quadControl returns the middle control point of the quadratic segment that
+// best approximates the cubic segment (a, b, c, d), which is (3*(b+c)-(a+d))/4.
+func quadControl(a, b, c, d Point) Point {
+	return Point{
+		(3*(b.X+c.X) - (a.X + d.X)) / 4,
+		(3*(b.Y+c.Y) - (a.Y + d.Y)) / 4,
+	}
 }
 
 // stroke adds the stroked Path q to p, where q consists of exactly one curve.
@@ -421,17 +488,26 @@ func (k *stroker) stroke(q Path) {
 	if len(k.r) == 0 {
 		return
 	}
-	// TODO(nigeltao): if q is a closed curve then we should join the first and
-	// last segments instead of capping them.
+	pivot := q.firstPoint()
+	if pivot == q.lastPoint() {
+		// q is a closed curve, so we join its last segment to its first
+		// instead of capping them. The stroke's two sides are then separate
+		// closed curves, which wind in opposite directions.
+		k.jr.Join(k.p, &k.r, k.u, pivot, k.anorm, pivot.Sub(Point{k.r[1], k.r[2]}))
+		k.p.Start(k.r.lastPoint())
+		addPathReversed(k.p, k.r)
+		return
+	}
 	k.cr.Cap(k.p, k.u, q.lastPoint(), k.anorm.Neg())
 	addPathReversed(k.p, k.r)
-	pivot := q.firstPoint()
 	k.cr.Cap(k.p, k.u, pivot, pivot.Sub(Point{k.r[1], k.r[2]}))
 }
 
 // Stroke adds q stroked with the given width to p. The result is typically
 // self-intersecting and should be rasterized with UseNonZeroWinding.
 // cr and jr may be nil, which defaults to a RoundCapper or RoundJoiner.
+// A curve in q that ends at its start point, such as a glyph's contour, is
+// closed: its ends are joined instead of capped.
 func Stroke(p Adder, q Path, width Fix32, cr Capper, jr Joiner) {
 	if len(q) == 0 {
 		return
@@ -0,0 +1,191 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package raster
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// pt returns the Point at (x, y) pixels.
+func pt(x, y float64) Point {
+	return Point{Fix32(x * 256), Fix32(y * 256)}
+}
+
+// strokeMask rasterizes q stroked with the given width, in pixels, by the
+// non-zero winding rule.
+func strokeMask(q Path, width float64, cr Capper, jr Joiner) *image.Alpha {
+	m := image.NewAlpha(image.Rect(0, 0, 120, 120))
+	r := NewRasterizer(120, 120)
+	r.UseNonZeroWinding = true
+	r.AddStroke(q, Fix32(width*256), cr, jr)
+	r.Rasterize(NewAlphaSrcPainter(m))
+	return m
+}
+
+// distance returns the distance from (x, y) to the nearest of the line
+// segments between consecutive points of ps.
+func distance(ps [][2]float64, x, y float64) float64 {
+	d := math.Inf(1)
+	for i := 1; i < len(ps); i++ {
+		ax, ay, bx, by := ps[i-1][0], ps[i-1][1], ps[i][0], ps[i][1]
+		dx, dy := bx-ax, by-ay
+		t := ((x-ax)*dx + (y-ay)*dy) / (dx*dx + dy*dy)
+		t = math.Max(0, math.Min(1, t))
+		d = math.Min(d, math.Hypot(x-ax-t*dx, y-ay-t*dy))
+	}
+	return d
+}
+
+// testJoiners are the Joiners that the stroke tests join segments with.
+var testJoiners = []struct {
+	desc string
+	jr   Joiner
+}{
+	{"round", RoundJoiner},
+	{"bevel", BevelJoiner},
+	{"miter", DefaultMiterJoiner},
+}
+
+// checkStroke checks that every pixel whose center is within 4 pixels of
+// the polyline ps is fully covered by the width 10 stroke in m, and that
+// every pixel whose center is more than 6 pixels from it is not covered at
+// all. Pixels for which skip returns true, such as those near the path's
+// ends or outer corners, where the caps and joins differ, are not checked.
+func checkStroke(t *testing.T, desc string, m *image.Alpha, ps [][2]float64, skip func(x, y float64) bool) {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx, cy := float64(x)+0.5, float64(y)+0.5
+			if skip != nil && skip(cx, cy) {
+				continue
+			}
+			a, d := m.AlphaAt(x, y).A, distance(ps, cx, cy)
+			if d <= 4 && a != 0xff {
+				t.Fatalf("%s: pixel (%d, %d), %.2f from the path: got %#x, want 0xff", desc, x, y, d, a)
+			}
+			if d > 6 && a != 0 {
+				t.Fatalf("%s: pixel (%d, %d), %.2f from the path: got %#x, want 0", desc, x, y, d, a)
+			}
+		}
+	}
+}
+
+func TestStrokeClosed(t *testing.T) {
+	// The square's inner corners are where its stroke's sides overlap.
+	square := [][2]float64{{20, 20}, {80, 20}, {80, 80}, {20, 80}, {20, 20}}
+	// outerCorner is whether (x, y) is beyond one of the square's corners,
+	// where the joins differ.
+	outerCorner := func(x, y float64) bool {
+		return (x < 20 || x > 80) && (y < 20 || y > 80)
+	}
+	for _, j := range testJoiners {
+		for _, reverse := range []bool{false, true} {
+			ps := square
+			if reverse {
+				ps = [][2]float64{{20, 20}, {20, 80}, {80, 80}, {80, 20}, {20, 20}}
+			}
+			var q Path
+			q.Start(pt(ps[0][0], ps[0][1]))
+			for _, p := range ps[1:] {
+				q.Add1(pt(p[0], p[1]))
+			}
+			m := strokeMask(q, 10, nil, j.jr)
+			desc := j.desc
+			if reverse {
+				desc += ", reversed"
+			}
+			checkStroke(t, desc, m, ps, outerCorner)
+			// Only a miter join fills the outer corners.
+			if got, want := m.AlphaAt(16, 16).A == 0xff, j.jr == DefaultMiterJoiner; got != want {
+				t.Errorf("%s: outer corner filled: got %t, want %t", desc, got, want)
+			}
+		}
+	}
+}
+
+func TestStrokeOpen(t *testing.T) {
+	// L-shaped paths that turn each way, with butt caps, which do not extend
+	// beyond their ends, and so the pixels near the ends are skipped.
+	testCases := []struct {
+		desc string
+		ps   [][2]float64
+		skip func(x, y float64) bool
+	}{
+		{
+			desc: "clockwise",
+			ps:   [][2]float64{{20, 100}, {20, 20}, {100, 20}},
+			skip: func(x, y float64) bool {
+				return y > 99 || x > 99 || (x < 20 && y < 20)
+			},
+		},
+		{
+			desc: "counter-clockwise",
+			ps:   [][2]float64{{100, 100}, {100, 20}, {20, 20}},
+			skip: func(x, y float64) bool {
+				return y > 99 || x < 21 || (x > 100 && y < 20)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		for _, j := range testJoiners {
+			var q Path
+			q.Start(pt(tc.ps[0][0], tc.ps[0][1]))
+			for _, p := range tc.ps[1:] {
+				q.Add1(pt(p[0], p[1]))
+			}
+			m := strokeMask(q, 10, ButtCapper, j.jr)
+			checkStroke(t, tc.desc+", "+j.desc, m, tc.ps, tc.skip)
+		}
+	}
+}
+
+func TestStrokeCubic(t *testing.T) {
+	// A circle of radius 40, centered at (60, 60), is four cubic segments.
+	const c, r, k = 60, 40, 40 * 141.0 / 256
+	var q Path
+	q.Start(pt(c+r, c))
+	q.Add3(pt(c+r, c+k), pt(c+k, c+r), pt(c, c+r))
+	q.Add3(pt(c-k, c+r), pt(c-r, c+k), pt(c-r, c))
+	q.Add3(pt(c-r, c-k), pt(c-k, c-r), pt(c, c-r))
+	q.Add3(pt(c+k, c-r), pt(c+r, c-k), pt(c+r, c))
+	var ps [][2]float64
+	for i := 0; i <= 360; i++ {
+		s, c0 := math.Sincos(float64(i) * math.Pi / 180)
+		ps = append(ps, [2]float64{c + r*c0, c + r*s})
+	}
+	checkStroke(t, "circle", strokeMask(q, 10, nil, nil), ps, nil)
+}
+
+func TestStrokeMiterLimit(t *testing.T) {
+	// The path turns back by 150 degrees at (80, 50), and so its miter
+	// length is 1/sin(15°), about 3.86, times the stroke width. The miter's
+	// tip is 19.3 pixels from the corner, towards (98.6, 45.0).
+	var q Path
+	q.Start(pt(20, 50))
+	q.Add1(pt(80, 50))
+	q.Add1(pt(80-60*math.Cos(math.Pi/6), 50+60*math.Sin(math.Pi/6)))
+	testCases := []struct {
+		limit float64
+		want  uint8
+	}{
+		{4, 0xff},
+		{3.8, 0},
+		{1, 0},
+	}
+	for _, tc := range testCases {
+		m := strokeMask(q, 10, nil, MiterJoiner{tc.limit})
+		// (93, 46) is 14 pixels from the corner, within the miter.
+		if got := m.AlphaAt(93, 46).A; got != tc.want {
+			t.Errorf("limit %v: got %#x, want %#x", tc.limit, got, tc.want)
+		}
+		// The inner corner is filled, whether or not it is mitered.
+		if got := m.AlphaAt(75, 54).A; got != 0xff {
+			t.Errorf("limit %v: inner corner: got %#x, want 0xff", tc.limit, got)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements embedded bitmap glyphs, from the EBLC and EBDT
+// tables, and embedded color bitmap glyphs, from the CBLC and CBDT tables
+// and from the sbix table. These tables are documented at
+// http://www.microsoft.com/typography/otspec/eblc.htm,
+// http://www.microsoft.com/typography/otspec/ebdt.htm,
+// http://www.microsoft.com/typography/otspec/cblc.htm,
+// http://www.microsoft.com/typography/otspec/cbdt.htm and
+// http://www.microsoft.com/typography/otspec/sbix.htm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+)
+
+// ErrNoBitmap is returned by Font.BitmapGlyph and Font.BitmapImage when the
+// font has no embedded bitmap for the given glyph at the given size. Callers
+// should fall back to rendering the glyph's outline.
+var ErrNoBitmap = errors.New("truetype: no embedded bitmap")
+
+// BitmapMetrics holds the placement of an embedded bitmap glyph, in pixels.
+type BitmapMetrics struct {
+	// BearingX is the horizontal distance from the glyph's origin to the
+	// bitmap's left edge. BearingY is the vertical distance from the
+	// glyph's origin up to the bitmap's top edge.
+	BearingX, BearingY int32
+	// Advance is the glyph's horizontal advance width.
+	Advance int32
+	// PPEM is the size, in pixels per em, of the strike that the bitmap is
+	// from. The other metrics are in that strike's pixels.
+	PPEM int32
+}
+
+// A bitmapStrike is an EBLC or CBLC BitmapSize record, which describes the
+// bitmaps for one size.
+type bitmapStrike struct {
+	// offset is the offset in the EBLC or CBLC table of the strike's
+	// IndexSubTableArray, and n is the number of its elements.
+	offset, n int
+	// first and last are the first and last glyphs in the strike.
+	first, last Index
+	// ppem is the strike's vertical size, in pixels per em.
+	ppem int
+	// bitDepth is the number of bits per pixel: 1, 2, 4 or 8, or 32 for a
+	// color strike.
+	bitDepth int
+}
+
+// An sbixStrike is one of the sbix table's strikes.
+type sbixStrike struct {
+	// offset is the offset of the strike in the sbix table.
+	offset int
+	// ppem is the strike's size, in pixels per em.
+	ppem int
+}
+
+func (f *Font) parseBitmaps() (err error) {
+	if f.bitmapStrikes, err = parseBitmapStrikes(f.eblc, f.tableLen("EBDT", f.ebdt), 2, "EBLC", "EBDT"); err != nil {
+		return err
+	}
+	if f.colorStrikes, err = parseBitmapStrikes(f.cblc, f.tableLen("CBDT", f.cbdt), 3, "CBLC", "CBDT"); err != nil {
+		return err
+	}
+	return f.parseSbix()
+}
+
+// parseBitmapStrikes parses the strikes of an EBLC or CBLC table, loc, whose
+// major version is major. dataLen is the length of the corresponding EBDT or
+// CBDT table.
+func parseBitmapStrikes(loc []byte, dataLen int, major uint16, locTag, dataTag string) ([]bitmapStrike, error) {
+	// The tables are optional, but if one is present then the other must
+	// be too.
+	if len(loc) == 0 && dataLen == 0 {
+		return nil, nil
+	}
+	if len(loc) == 0 || dataLen == 0 {
+		return nil, FormatError(fmt.Sprintf("%s table without a %s table, or vice versa", locTag, dataTag))
+	}
+	if len(loc) < 8 {
+		return nil, FormatError(fmt.Sprintf("%s data too short", locTag))
+	}
+	if v := u16(loc, 0); v != major {
+		return nil, UnsupportedError(fmt.Sprintf("%s version: %d.%d", locTag, v, u16(loc, 2)))
+	}
+	n := int(u32(loc, 4))
+	if n < 0 || n > (len(loc)-8)/48 {
+		return nil, FormatError(fmt.Sprintf("%s data too short", locTag))
+	}
+	strikes := make([]bitmapStrike, n)
+	for i := range strikes {
+		x := 8 + 48*i
+		s := bitmapStrike{
+			offset:   int(u32(loc, x)),
+			n:        int(u32(loc, x+8)),
+			first:    Index(u16(loc, x+40)),
+			last:     Index(u16(loc, x+42)),
+			ppem:     int(loc[x+45]),
+			bitDepth: int(loc[x+46]),
+		}
+		if s.offset < 0 || s.offset > len(loc) || s.n < 0 || s.n > (len(loc)-s.offset)/8 {
+			return nil, FormatError(fmt.Sprintf("bad %s index subtable array", locTag))
+		}
+		// Color bitmaps are always 32 bits per pixel.
+		switch {
+		case major == 2 && (s.bitDepth == 1 || s.bitDepth == 2 || s.bitDepth == 4 || s.bitDepth == 8):
+		case major == 3 && s.bitDepth == 32:
+		default:
+			return nil, FormatError(fmt.Sprintf("bad %s bit depth: %d", locTag, s.bitDepth))
+		}
+		strikes[i] = s
+	}
+	return strikes, nil
+}
+
+// BitmapGlyph returns the embedded bitmap for the i'th glyph, from the strike
+// whose size is ppem pixels per em, and the bitmap's placement. The bitmap's
+// pixel values are coverage, where 0xff is fully inked, rather than
+// luminance. If the font has no such bitmap, then the error is ErrNoBitmap.
+func (f *Font) BitmapGlyph(i Index, ppem int) (*image.Gray, BitmapMetrics, error) {
+	for _, s := range f.bitmapStrikes {
+		if s.ppem != ppem || i < s.first || s.last < i {
+			continue
+		}
+		start, end, imageFormat, metrics, err := locateBitmap(f.eblc, f.tableLen("EBDT", f.ebdt), s, i)
+		if err == ErrNoBitmap {
+			continue
+		}
+		if err != nil {
+			return nil, BitmapMetrics{}, err
+		}
+		data, err := f.tableData("EBDT", f.ebdt, start, end)
+		if err != nil {
+			return nil, BitmapMetrics{}, err
+		}
+		m, bm, err := decodeBitmap(data, imageFormat, metrics, s.bitDepth)
+		bm.PPEM = int32(s.ppem)
+		return m, bm, err
+	}
+	return nil, BitmapMetrics{}, ErrNoBitmap
+}
+
+// locateBitmap returns the start and end offsets of the data for the i'th
+// glyph in the strike s of the EBLC or CBLC table loc, whose bitmaps are in
+// an EBDT or CBDT table of length dataLen.
+func locateBitmap(loc []byte, dataLen int, s bitmapStrike, i Index) (int, int, int, []byte, error) {
+	for j := 0; j < s.n; j++ {
+		x := s.offset + 8*j
+		if i < Index(u16(loc, x)) || Index(u16(loc, x+2)) < i {
+			continue
+		}
+		sub := s.offset + int(u32(loc, x+4))
+		return bitmapData(loc, dataLen, sub, Index(u16(loc, x)), i)
+	}
+	return 0, 0, 0, nil, ErrNoBitmap
+}
+
+// bitmapData returns the start and end offsets, in an EBDT or CBDT table of
+// length dataLen, of the data for the i'th glyph, as given by the EBLC or
+// CBLC IndexSubTable at offset sub in b, whose first glyph is first. It also
+// returns the data's image format and, for those index formats that hold
+// them, the glyphs' big metrics.
+func bitmapData(b []byte, dataLen, sub int, first, i Index) (start, end, imageFormat int, metrics []byte, err error) {
+	if sub < 0 || sub+8 > len(b) {
+		return 0, 0, 0, nil, FormatError("bad bitmap index subtable offset")
+	}
+	indexFormat, imageFormat := u16(b, sub), int(u16(b, sub+2))
+	imageDataOffset := int(u32(b, sub+4))
+	k, x := int(i-first), sub+8
+	// o0 and o1 are the start and end offsets of the glyph's data, relative
+	// to imageDataOffset.
+	var o0, o1 int
+	switch indexFormat {
+	case 1:
+		if x+4*k+8 > len(b) {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		o0, o1 = int(u32(b, x+4*k)), int(u32(b, x+4*k+4))
+	case 2:
+		if x+12 > len(b) {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		size := int(u32(b, x))
+		o0, o1, metrics = size*k, size*(k+1), b[x+4:x+12]
+	case 3:
+		if x+2*k+4 > len(b) {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		o0, o1 = int(u16(b, x+2*k)), int(u16(b, x+2*k+2))
+	case 4:
+		// A sorted array of glyph IDs and offsets, with a sentinel entry
+		// that gives the end of the last glyph's data.
+		if x+4 > len(b) {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		n := int(u32(b, x))
+		if n < 0 || n > (len(b)-x-8)/4 {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		found := false
+		for lo, hi := 0, n; lo < hi; {
+			j := (lo + hi) / 2
+			y := x + 4 + 4*j
+			if g := Index(u16(b, y)); g < i {
+				lo = j + 1
+			} else if g > i {
+				hi = j
+			} else {
+				o0, o1, found = int(u16(b, y+2)), int(u16(b, y+6)), true
+				break
+			}
+		}
+		if !found {
+			return 0, 0, 0, nil, ErrNoBitmap
+		}
+	case 5:
+		// A sorted array of glyph IDs, whose images all have the same size
+		// and metrics.
+		if x+16 > len(b) {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		size, n := int(u32(b, x)), int(u32(b, x+12))
+		if n < 0 || n > (len(b)-x-16)/2 {
+			return 0, 0, 0, nil, FormatError("bitmap index subtable too short")
+		}
+		metrics = b[x+4 : x+12]
+		found := false
+		for lo, hi := 0, n; lo < hi; {
+			j := (lo + hi) / 2
+			if g := Index(u16(b, x+16+2*j)); g < i {
+				lo = j + 1
+			} else if g > i {
+				hi = j
+			} else {
+				o0, o1, found = size*j, size*(j+1), true
+				break
+			}
+		}
+		if !found {
+			return 0, 0, 0, nil, ErrNoBitmap
+		}
+	default:
+		return 0, 0, 0, nil, UnsupportedError(fmt.Sprintf("bitmap index format: %d", indexFormat))
+	}
+	if o0 == o1 {
+		// A glyph with no data has no bitmap.
+		return 0, 0, 0, nil, ErrNoBitmap
+	}
+	start, end = imageDataOffset+o0, imageDataOffset+o1
+	if o0 < 0 || o1 < o0 || start < 0 || end > dataLen {
+		return 0, 0, 0, nil, FormatError("bad bitmap image data offset")
+	}
+	return start, end, imageFormat, metrics, nil
+}
+
+// decodeBitmap decodes a glyph's EBDT data, of the given image format. For
+// image format 5, metrics holds the glyph's big metrics from the EBLC table.
+func decodeBitmap(data []byte, imageFormat int, metrics []byte, bitDepth int) (*image.Gray, BitmapMetrics, error) {
+	// The small metrics are height, width, bearingX, bearingY and advance.
+	// The big metrics are the same, except that the horizontal bearings
+	// and advance are followed by the vertical ones.
+	byteAligned := false
+	switch imageFormat {
+	case 1, 2:
+		if len(data) < 5 {
+			return nil, BitmapMetrics{}, FormatError("EBDT data too short")
+		}
+		metrics, data = data[:5], data[5:]
+		byteAligned = imageFormat == 1
+	case 5:
+		if metrics == nil {
+			return nil, BitmapMetrics{}, FormatError("EBDT image format 5 has no metrics")
+		}
+	case 6, 7:
+		if len(data) < 8 {
+			return nil, BitmapMetrics{}, FormatError("EBDT data too short")
+		}
+		metrics, data = data[:8], data[8:]
+		byteAligned = imageFormat == 6
+	default:
+		// Formats 8 and 9 are composed of other bitmaps.
+		return nil, BitmapMetrics{}, UnsupportedError(fmt.Sprintf("EBDT image format: %d", imageFormat))
+	}
+	height, width := int(metrics[0]), int(metrics[1])
+	bm := BitmapMetrics{
+		BearingX: int32(int8(metrics[2])),
+		BearingY: int32(int8(metrics[3])),
+		Advance:  int32(metrics[4]),
+	}
+
+	// stride is the number of bits per row.
+	stride := width * bitDepth
+	if byteAligned {
+		stride = (stride + 7) &^ 7
+	}
+	if (stride*height+7)/8 > len(data) {
+		return nil, BitmapMetrics{}, FormatError("EBDT data too short")
+	}
+	m := image.NewGray(image.Rect(0, 0, width, height))
+	max := 1<<uint(bitDepth) - 1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// The bit depth divides 8, so a pixel never spans two bytes.
+			bit := y*stride + x*bitDepth
+			v := int(data[bit/8]>>uint(8-bitDepth-bit%8)) & max
+			m.Pix[y*m.Stride+x] = uint8(v * 0xff / max)
+		}
+	}
+	return m, bm, nil
+}
+
+// parseSbix checks the sbix table's header and strike offsets, and reads its
+// strikes' sizes.
+func (f *Font) parseSbix() error {
+	length := f.tableLen("sbix", f.sbix)
+	if length == 0 {
+		return nil
+	}
+	if length < 8 {
+		return FormatError("sbix data too short")
+	}
+	header, err := f.tableData("sbix", f.sbix, 0, 8)
+	if err != nil {
+		return err
+	}
+	if v := u16(header, 0); v != 1 {
+		return UnsupportedError(fmt.Sprintf("sbix version: %d", v))
+	}
+	n := int(u32(header, 4))
+	if n < 0 || n > (length-8)/4 {
+		return FormatError("sbix data too short")
+	}
+	offsets, err := f.tableData("sbix", f.sbix, 8, 8+4*n)
+	if err != nil {
+		return err
+	}
+	f.sbixStrikes = make([]sbixStrike, n)
+	for i := range f.sbixStrikes {
+		// Each strike has a ppem, a ppi and an offset for each glyph, plus
+		// one for the end of the last glyph's data.
+		x := int(u32(offsets, 4*i))
+		if x < 0 || x > length || f.nGlyph+1 > (length-x-4)/4 {
+			return FormatError("bad sbix strike offset")
+		}
+		ppem, err := f.tableData("sbix", f.sbix, x, x+2)
+		if err != nil {
+			return err
+		}
+		f.sbixStrikes[i] = sbixStrike{offset: x, ppem: int(u16(ppem, 0))}
+	}
+	return nil
+}
+
+// BitmapImage returns the embedded color bitmap for the i'th glyph, from the
+// strike whose size best matches ppem pixels per em, and the bitmap's
+// placement. The best match is the smallest strike that is no smaller than
+// ppem or, if there is no such strike, the largest strike. The image is
+// not scaled, so callers should scale it by ppem / metrics.PPEM. Both the
+// sbix table and the CBLC and CBDT tables are supported, and only PNG
+// images are supported. If the font has no such bitmap, then the error is
+// ErrNoBitmap.
+func (f *Font) BitmapImage(i Index, ppem int) (image.Image, BitmapMetrics, error) {
+	if int(i) >= f.nGlyph {
+		return nil, BitmapMetrics{}, ErrNoBitmap
+	}
+	if len(f.sbixStrikes) != 0 {
+		best := 0
+		for j, s := range f.sbixStrikes {
+			if betterStrike(s.ppem, f.sbixStrikes[best].ppem, ppem) {
+				best = j
+			}
+		}
+		return f.sbixImage(f.sbixStrikes[best], i, true)
+	}
+	best := -1
+	for j, s := range f.colorStrikes {
+		if i < s.first || s.last < i {
+			continue
+		}
+		if best < 0 || betterStrike(s.ppem, f.colorStrikes[best].ppem, ppem) {
+			best = j
+		}
+	}
+	if best < 0 {
+		return nil, BitmapMetrics{}, ErrNoBitmap
+	}
+	s := f.colorStrikes[best]
+	start, end, imageFormat, metrics, err := locateBitmap(f.cblc, f.tableLen("CBDT", f.cbdt), s, i)
+	if err != nil {
+		return nil, BitmapMetrics{}, err
+	}
+	data, err := f.tableData("CBDT", f.cbdt, start, end)
+	if err != nil {
+		return nil, BitmapMetrics{}, err
+	}
+	m, bm, err := decodeColorBitmap(data, imageFormat, metrics)
+	bm.PPEM = int32(s.ppem)
+	return m, bm, err
+}
+
+// betterStrike returns whether a strike of size p is a better match than one
+// of size q, for the size ppem.
+func betterStrike(p, q, ppem int) bool {
+	if q < ppem {
+		return p > q
+	}
+	return ppem <= p && p < q
+}
+
+// sbixImage returns the i'th glyph's image from the sbix strike s. If
+// followDupe is true then a 'dupe' record, which refers to another glyph's
+// record in the same strike, is followed.
+func (f *Font) sbixImage(s sbixStrike, i Index, followDupe bool) (image.Image, BitmapMetrics, error) {
+	x, ppem := s.offset, int32(s.ppem)
+	y := x + 4 + 4*int(i)
+	offsets, err := f.tableData("sbix", f.sbix, y, y+8)
+	if err != nil {
+		return nil, BitmapMetrics{}, err
+	}
+	start, end := x+int(u32(offsets, 0)), x+int(u32(offsets, 4))
+	if start == end {
+		return nil, BitmapMetrics{}, ErrNoBitmap
+	}
+	if start < x || end < start+8 || end > f.tableLen("sbix", f.sbix) {
+		return nil, BitmapMetrics{}, FormatError("bad sbix glyph data offset")
+	}
+	data, err := f.tableData("sbix", f.sbix, start, end)
+	if err != nil {
+		return nil, BitmapMetrics{}, err
+	}
+	switch tag := string(data[4:8]); tag {
+	case "png ":
+	case "dupe":
+		if !followDupe || len(data) < 10 {
+			return nil, BitmapMetrics{}, FormatError("bad sbix dupe record")
+		}
+		j := Index(u16(data, 8))
+		if int(j) >= f.nGlyph {
+			return nil, BitmapMetrics{}, FormatError("bad sbix dupe record")
+		}
+		return f.sbixImage(s, j, false)
+	default:
+		return nil, BitmapMetrics{}, UnsupportedError(fmt.Sprintf("sbix graphic type: %q", tag))
+	}
+	m, err := png.Decode(bytes.NewReader(data[8:]))
+	if err != nil {
+		return nil, BitmapMetrics{}, err
+	}
+	// The origin offsets give the position of the image's bottom left
+	// corner. The advance is scaled from the hmtx table.
+	bm := BitmapMetrics{
+		BearingX: int32(int16(u16(data, 0))),
+		BearingY: int32(int16(u16(data, 2))) + int32(m.Bounds().Dy()),
+		Advance:  (f.HMetric(ppem*64, i).AdvanceWidth + 32) >> 6,
+		PPEM:     ppem,
+	}
+	return m, bm, nil
+}
+
+// decodeColorBitmap decodes a glyph's CBDT data, of the given image format.
+// For image format 19, metrics holds the glyph's big metrics from the CBLC
+// table.
+func decodeColorBitmap(data []byte, imageFormat int, metrics []byte) (image.Image, BitmapMetrics, error) {
+	// The image formats are like EBDT formats 1, 6 and 5, except that the
+	// metrics are followed by the length of a PNG image.
+	switch imageFormat {
+	case 17:
+		if len(data) < 5 {
+			return nil, BitmapMetrics{}, FormatError("CBDT data too short")
+		}
+		metrics, data = data[:5], data[5:]
+	case 18:
+		if len(data) < 8 {
+			return nil, BitmapMetrics{}, FormatError("CBDT data too short")
+		}
+		metrics, data = data[:8], data[8:]
+	case 19:
+		if metrics == nil {
+			return nil, BitmapMetrics{}, FormatError("CBDT image format 19 has no metrics")
+		}
+	default:
+		return nil, BitmapMetrics{}, UnsupportedError(fmt.Sprintf("CBDT image format: %d", imageFormat))
+	}
+	if len(data) < 4 || u32(data, 0) > uint32(len(data)-4) {
+		return nil, BitmapMetrics{}, FormatError("CBDT data too short")
+	}
+	m, err := png.Decode(bytes.NewReader(data[4 : 4+u32(data, 0)]))
+	if err != nil {
+		return nil, BitmapMetrics{}, err
+	}
+	bm := BitmapMetrics{
+		BearingX: int32(int8(metrics[2])),
+		BearingY: int32(int8(metrics[3])),
+		Advance:  int32(metrics[4]),
+	}
+	return m, bm, nil
+}
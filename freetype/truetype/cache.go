@@ -0,0 +1,225 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// DefaultPathTolerance is the GlyphCache's default path tolerance, in 26.6
+// fixed point units: a sixteenth of a pixel.
+const DefaultPathTolerance = 4
+
+// A glyphCacheKey identifies a loaded glyph. Hinting changes the loaded
+// points, so whether the glyph was hinted is part of the key.
+type glyphCacheKey struct {
+	i      Index
+	scale  int32
+	hinted bool
+}
+
+type glyphCacheEntry struct {
+	key glyphCacheKey
+	g   *GlyphBuf
+	// path is g's contours as a flattened path, as returned by Path.
+	path []Segment
+}
+
+// A GlyphCache holds a bounded number of a Font's loaded glyphs, evicting
+// the least recently used glyph when it is full. It is safe to call Get
+// and Path from multiple goroutines.
+type GlyphCache struct {
+	font     *Font
+	capacity int
+	// hinters holds the *Hinter values that hinted glyphs are loaded with.
+	// Each is used by one goroutine at a time.
+	hinters sync.Pool
+
+	mu sync.Mutex
+	// tolerance is the path tolerance, as set by SetPathTolerance.
+	tolerance int32
+	// lru holds *glyphCacheEntry values, most recently used first.
+	lru     list.List
+	entries map[glyphCacheKey]*list.Element
+}
+
+// NewGlyphCache returns a new GlyphCache for the given Font that holds at
+// most capacity glyphs.
+func NewGlyphCache(f *Font, capacity int) *GlyphCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	c := &GlyphCache{
+		font:      f,
+		capacity:  capacity,
+		tolerance: DefaultPathTolerance,
+		entries:   make(map[glyphCacheKey]*list.Element, capacity),
+	}
+	c.hinters.New = func() interface{} {
+		return &Hinter{}
+	}
+	return c
+}
+
+// SetPathTolerance sets the maximum distance, in 26.6 fixed point units,
+// between a glyph's curved segments and the linear segments that Path
+// approximates them by. A tolerance less than 1 is treated as 1. Setting
+// the tolerance empties the cache.
+func (c *GlyphCache) SetPathTolerance(tolerance int32) {
+	if tolerance < 1 {
+		tolerance = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tolerance = tolerance
+	c.lru.Init()
+	c.entries = make(map[glyphCacheKey]*list.Element, c.capacity)
+}
+
+// Get returns the i'th glyph, loaded as by GlyphBuf.Load with the given
+// scale, and with a Hinter if hinting is true. The returned GlyphBuf may be
+// shared with other callers and must not be modified.
+func (c *GlyphCache) Get(i Index, scale int32, hinting bool) (*GlyphBuf, error) {
+	e, err := c.get(i, scale, hinting)
+	if err != nil {
+		return nil, err
+	}
+	return e.g, nil
+}
+
+// Path returns the i'th glyph's contours as a flattened path, after loading
+// the glyph as by Get. The path is that of GlyphBuf.AppendPath, except that
+// each quadratic or cubic segment is replaced by LineTo segments that are no
+// further from it than the cache's path tolerance, give or take the rounding
+// of their end points to whole 26.6 fixed point units, and so the path has
+// only MoveTo and LineTo segments. The path is computed once, when the glyph is
+// loaded, so drawing a cached glyph only has to replay its lines, and not
+// load, scale, hint or flatten it again. The returned slice may be shared
+// with other callers and must not be modified.
+func (c *GlyphCache) Path(i Index, scale int32, hinting bool) ([]Segment, error) {
+	e, err := c.get(i, scale, hinting)
+	if err != nil {
+		return nil, err
+	}
+	return e.path, nil
+}
+
+// get returns the cache entry for the i'th glyph, loading it if necessary.
+func (c *GlyphCache) get(i Index, scale int32, hinting bool) (*glyphCacheEntry, error) {
+	key := glyphCacheKey{i, scale, hinting}
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*glyphCacheEntry), nil
+	}
+	tolerance := c.tolerance
+	c.mu.Unlock()
+
+	// Load the glyph without holding the lock, so that a slow load does not
+	// block other goroutines' cache hits.
+	var h *Hinter
+	if hinting {
+		h = c.hinters.Get().(*Hinter)
+	}
+	g := NewGlyphBuf()
+	err := g.Load(c.font, scale, i, h)
+	if h != nil {
+		c.hinters.Put(h)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &glyphCacheEntry{key, g, flattenPath(g.AppendPath(nil), tolerance)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tolerance != c.tolerance {
+		// The tolerance was changed in the meantime, and so the path is
+		// stale. It is still returned, but not cached.
+		return entry, nil
+	}
+	if e, ok := c.entries[key]; ok {
+		// Another goroutine loaded the same glyph in the meantime.
+		c.lru.MoveToFront(e)
+		return e.Value.(*glyphCacheEntry), nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.capacity {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*glyphCacheEntry).key)
+	}
+	return entry, nil
+}
+
+// Len returns the number of glyphs in the cache.
+func (c *GlyphCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// flattenPath returns a copy of the path segs in which each quadratic or
+// cubic segment is replaced by LineTo segments that are at most tolerance
+// from it, before their end points are rounded.
+func flattenPath(segs []Segment, tolerance int32) []Segment {
+	flat := make([]Segment, 0, len(segs))
+	lineTo := func(x, y float64) {
+		p := Point{X: int32(math.Floor(x + 0.5)), Y: int32(math.Floor(y + 0.5))}
+		flat = append(flat, Segment{Op: SegmentOpLineTo, Args: [3]Point{p}})
+	}
+	tol := float64(tolerance)
+	// a is the current point.
+	var a Point
+	for _, seg := range segs {
+		switch seg.Op {
+		case SegmentOpMoveTo, SegmentOpLineTo:
+			flat = append(flat, seg)
+			a = seg.Args[0]
+		case SegmentOpQuadTo:
+			ax, ay := float64(a.X), float64(a.Y)
+			bx, by := float64(seg.Args[0].X), float64(seg.Args[0].Y)
+			cx, cy := float64(seg.Args[1].X), float64(seg.Args[1].Y)
+			// The distance between a quadratic segment and its approximation
+			// by n linear segments is at most dev/(4*n*n).
+			dev := math.Hypot(ax-2*bx+cx, ay-2*by+cy)
+			n := int(math.Ceil(math.Sqrt(dev / (4 * tol))))
+			for i := 1; i < n; i++ {
+				t := float64(i) / float64(n)
+				s := 1 - t
+				lineTo(s*s*ax+2*s*t*bx+t*t*cx, s*s*ay+2*s*t*by+t*t*cy)
+			}
+			a = seg.Args[1]
+			flat = append(flat, Segment{Op: SegmentOpLineTo, Args: [3]Point{a}})
+		case SegmentOpCubeTo:
+			ax, ay := float64(a.X), float64(a.Y)
+			bx, by := float64(seg.Args[0].X), float64(seg.Args[0].Y)
+			cx, cy := float64(seg.Args[1].X), float64(seg.Args[1].Y)
+			dx, dy := float64(seg.Args[2].X), float64(seg.Args[2].Y)
+			// The distance between a cubic segment and its approximation by
+			// n linear segments is at most 3*dev/(4*n*n).
+			dev := math.Max(
+				math.Hypot(ax-2*bx+cx, ay-2*by+cy),
+				math.Hypot(bx-2*cx+dx, by-2*cy+dy),
+			)
+			n := int(math.Ceil(math.Sqrt(3 * dev / (4 * tol))))
+			for i := 1; i < n; i++ {
+				t := float64(i) / float64(n)
+				s := 1 - t
+				lineTo(
+					s*s*s*ax+3*s*s*t*bx+3*s*t*t*cx+t*t*t*dx,
+					s*s*s*ay+3*s*s*t*by+3*s*t*t*cy+t*t*t*dy,
+				)
+			}
+			a = seg.Args[2]
+			flat = append(flat, Segment{Op: SegmentOpLineTo, Args: [3]Point{a}})
+		}
+	}
+	return flat
+}
@@ -0,0 +1,784 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements PostScript outlines, from the CFF table of an
+// OpenType font. The CFF format is documented at
+// http://partners.adobe.com/public/developer/en/font/5176.CFF.pdf and its
+// Type 2 charstrings are documented at
+// http://partners.adobe.com/public/developer/en/font/5177.Type2.pdf
+
+import (
+	"fmt"
+)
+
+// A cffIndex is a CFF INDEX, which is an array of variable length objects.
+type cffIndex struct {
+	// data holds the INDEX's offset array followed by its objects.
+	data           []byte
+	count, offSize int
+}
+
+// parseCFFIndex parses the INDEX at b[offset:]. It also returns the offset
+// of the first byte after the INDEX.
+func parseCFFIndex(b []byte, offset int) (x cffIndex, end int, err error) {
+	if offset < 0 || offset+2 > len(b) {
+		return cffIndex{}, 0, FormatError("CFF INDEX too short")
+	}
+	x.count = int(u16(b, offset))
+	if x.count == 0 {
+		return x, offset + 2, nil
+	}
+	if offset+3 > len(b) {
+		return cffIndex{}, 0, FormatError("CFF INDEX too short")
+	}
+	x.offSize = int(b[offset+2])
+	if x.offSize < 1 || x.offSize > 4 {
+		return cffIndex{}, 0, FormatError(fmt.Sprintf("bad CFF INDEX offset size: %d", x.offSize))
+	}
+	if (x.count+1)*x.offSize > len(b)-offset-3 {
+		return cffIndex{}, 0, FormatError("CFF INDEX too short")
+	}
+	x.data = b[offset+3:]
+	// The offsets start at 1, and must be increasing.
+	prev := 1
+	for i := 0; i <= x.count; i++ {
+		o := x.offset(i)
+		if i == 0 && o != 1 || o < prev {
+			return cffIndex{}, 0, FormatError("bad CFF INDEX offset")
+		}
+		prev = o
+	}
+	end = (x.count+1)*x.offSize + prev - 1
+	if end > len(x.data) {
+		return cffIndex{}, 0, FormatError("CFF INDEX too short")
+	}
+	x.data = x.data[:end]
+	return x, offset + 3 + end, nil
+}
+
+// offset returns the i'th entry of the INDEX's offset array.
+func (x cffIndex) offset(i int) int {
+	o := 0
+	for _, c := range x.data[i*x.offSize : (i+1)*x.offSize] {
+		o = o<<8 | int(c)
+	}
+	return o
+}
+
+// get returns the i'th object in the INDEX.
+func (x cffIndex) get(i int) []byte {
+	// The offsets are relative to the byte before the first object.
+	base := (x.count+1)*x.offSize - 1
+	return x.data[base+x.offset(i) : base+x.offset(i+1)]
+}
+
+// parseCFFDict calls fn for each operator in the DICT data b, with that
+// operator's operands. The two byte operator 12 x is passed as 1200+x. A
+// real number operand is passed as zero, since none of the operators that
+// this package uses take real numbers.
+func parseCFFDict(b []byte, fn func(op int, operands []int32) error) error {
+	var operands [48]int32
+	n := 0
+	for i := 0; i < len(b); {
+		c := b[i]
+		var v int32
+		switch {
+		case c <= 21:
+			op := int(c)
+			i++
+			if c == 12 {
+				if i >= len(b) {
+					return FormatError("CFF DICT too short")
+				}
+				op = 1200 + int(b[i])
+				i++
+			}
+			if err := fn(op, operands[:n]); err != nil {
+				return err
+			}
+			n = 0
+			continue
+		case c == 28:
+			if i+3 > len(b) {
+				return FormatError("CFF DICT too short")
+			}
+			v = int32(int16(u16(b, i+1)))
+			i += 3
+		case c == 29:
+			if i+5 > len(b) {
+				return FormatError("CFF DICT too short")
+			}
+			v = int32(u32(b, i+1))
+			i += 5
+		case c == 30:
+			// A real number's nibbles end with 0xf.
+			for i++; ; i++ {
+				if i >= len(b) {
+					return FormatError("CFF DICT too short")
+				}
+				if b[i]>>4 == 0xf || b[i]&0xf == 0xf {
+					i++
+					break
+				}
+			}
+		case 32 <= c && c <= 246:
+			v = int32(c) - 139
+			i++
+		case 247 <= c && c <= 254:
+			if i+2 > len(b) {
+				return FormatError("CFF DICT too short")
+			}
+			if c <= 250 {
+				v = (int32(c)-247)*256 + int32(b[i+1]) + 108
+			} else {
+				v = -(int32(c)-251)*256 - int32(b[i+1]) - 108
+			}
+			i += 2
+		default:
+			return FormatError(fmt.Sprintf("bad CFF DICT operand: %d", c))
+		}
+		if n == len(operands) {
+			return FormatError("too many CFF DICT operands")
+		}
+		operands[n] = v
+		n++
+	}
+	return nil
+}
+
+// parseCFF parses the CFF table's header and the first font in it, which
+// is the only font in an OpenType font's CFF table.
+func (f *Font) parseCFF() error {
+	b := f.cff
+	if len(b) < 4 {
+		return FormatError("CFF data too short")
+	}
+	if b[0] != 1 {
+		return UnsupportedError(fmt.Sprintf("CFF version: %d", b[0]))
+	}
+	// The header is followed by the Name, Top DICT, String and Global Subr
+	// INDEXes.
+	_, x, err := parseCFFIndex(b, int(b[2]))
+	if err != nil {
+		return err
+	}
+	topDicts, x, err := parseCFFIndex(b, x)
+	if err != nil {
+		return err
+	}
+	if topDicts.count == 0 {
+		return FormatError("no CFF Top DICT")
+	}
+	_, x, err = parseCFFIndex(b, x)
+	if err != nil {
+		return err
+	}
+	f.cffGlobalSubrs, _, err = parseCFFIndex(b, x)
+	if err != nil {
+		return err
+	}
+
+	charStrings, fdArray, fdSelect := -1, -1, -1
+	var private []int32
+	err = parseCFFDict(topDicts.get(0), func(op int, operands []int32) error {
+		switch op {
+		case 17: // CharStrings.
+			if len(operands) != 1 {
+				return FormatError("bad CFF CharStrings offset")
+			}
+			charStrings = int(operands[0])
+		case 18: // Private.
+			private = append([]int32(nil), operands...)
+		case 1206: // CharstringType.
+			if len(operands) != 1 || operands[0] != 2 {
+				return UnsupportedError("CFF charstring type")
+			}
+		case 1236: // FDArray.
+			if len(operands) != 1 {
+				return FormatError("bad CFF FDArray offset")
+			}
+			fdArray = int(operands[0])
+		case 1237: // FDSelect.
+			if len(operands) != 1 {
+				return FormatError("bad CFF FDSelect offset")
+			}
+			fdSelect = int(operands[0])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if charStrings < 0 {
+		return FormatError("no CFF CharStrings")
+	}
+	f.cffCharStrings, _, err = parseCFFIndex(b, charStrings)
+	if err != nil {
+		return err
+	}
+	if f.cffCharStrings.count != f.nGlyph {
+		return FormatError(fmt.Sprintf("bad number of CFF CharStrings: %d", f.cffCharStrings.count))
+	}
+
+	// A CID-keyed font has a Font DICT, each with its own Private DICT, for
+	// each group of glyphs. Other fonts have a single Private DICT.
+	if fdArray < 0 {
+		subrs, err := f.parseCFFPrivate(private)
+		if err != nil {
+			return err
+		}
+		f.cffSubrs = []cffIndex{subrs}
+		return nil
+	}
+	fds, _, err := parseCFFIndex(b, fdArray)
+	if err != nil {
+		return err
+	}
+	f.cffSubrs = make([]cffIndex, fds.count)
+	for i := range f.cffSubrs {
+		private = nil
+		err := parseCFFDict(fds.get(i), func(op int, operands []int32) error {
+			if op == 18 {
+				private = append([]int32(nil), operands...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if f.cffSubrs[i], err = f.parseCFFPrivate(private); err != nil {
+			return err
+		}
+	}
+	return f.parseCFFFDSelect(fdSelect, fds.count)
+}
+
+// parseCFFPrivate parses the Private DICT given by the size and offset
+// operands of a Private operator, and returns its local subroutines.
+func (f *Font) parseCFFPrivate(operands []int32) (cffIndex, error) {
+	if len(operands) != 2 {
+		return cffIndex{}, FormatError("bad CFF Private DICT")
+	}
+	size, offset := int(operands[0]), int(operands[1])
+	if size < 0 || offset < 0 || offset > len(f.cff) || size > len(f.cff)-offset {
+		return cffIndex{}, FormatError("bad CFF Private DICT")
+	}
+	subrs := -1
+	err := parseCFFDict(f.cff[offset:offset+size], func(op int, operands []int32) error {
+		if op == 19 { // Subrs.
+			if len(operands) != 1 || operands[0] < 0 {
+				return FormatError("bad CFF Subrs offset")
+			}
+			subrs = int(operands[0])
+		}
+		return nil
+	})
+	if err != nil || subrs < 0 {
+		return cffIndex{}, err
+	}
+	// The Subrs offset is relative to the Private DICT.
+	x, _, err := parseCFFIndex(f.cff, offset+subrs)
+	return x, err
+}
+
+// parseCFFFDSelect parses the FDSelect at the given offset, which maps each
+// glyph to one of n Font DICTs.
+func (f *Font) parseCFFFDSelect(offset, n int) error {
+	b := f.cff
+	if offset < 0 || offset >= len(b) {
+		return FormatError("bad CFF FDSelect offset")
+	}
+	f.cffFDSelect = make([]byte, f.nGlyph)
+	switch b[offset] {
+	case 0:
+		if f.nGlyph > len(b)-offset-1 {
+			return FormatError("CFF FDSelect too short")
+		}
+		copy(f.cffFDSelect, b[offset+1:])
+	case 3:
+		// An array of ranges, each of which is a first glyph and a Font
+		// DICT, followed by a sentinel glyph.
+		if offset+3 > len(b) {
+			return FormatError("CFF FDSelect too short")
+		}
+		nRanges := int(u16(b, offset+1))
+		x := offset + 3
+		if nRanges == 0 || 3*nRanges+2 > len(b)-x {
+			return FormatError("CFF FDSelect too short")
+		}
+		for i := 0; i < nRanges; i++ {
+			first, last := int(u16(b, x)), int(u16(b, x+3))
+			if i == 0 && first != 0 || last < first || last > f.nGlyph {
+				return FormatError("bad CFF FDSelect range")
+			}
+			for j := first; j < last; j++ {
+				f.cffFDSelect[j] = b[x+2]
+			}
+			x += 3
+		}
+		if int(u16(b, x)) != f.nGlyph {
+			return FormatError("bad CFF FDSelect range")
+		}
+	default:
+		return UnsupportedError(fmt.Sprintf("CFF FDSelect format: %d", b[offset]))
+	}
+	for _, fd := range f.cffFDSelect {
+		if int(fd) >= n {
+			return FormatError(fmt.Sprintf("bad CFF Font DICT index: %d", fd))
+		}
+	}
+	return nil
+}
+
+// The Type 2 charstring limits on the argument stack's depth and on the
+// subroutine nesting depth.
+const (
+	cffMaxStack     = 48
+	cffMaxSubrDepth = 10
+)
+
+// cffSubrBias returns the bias that is added to a subroutine number to give
+// the index of the subroutine in a Subrs INDEX with n subroutines.
+func cffSubrBias(n int) int {
+	if n < 1240 {
+		return 107
+	} else if n < 33900 {
+		return 1131
+	}
+	return 32768
+}
+
+// A cffDecoder decodes a glyph's Type 2 charstring into a GlyphBuf's Points
+// and End, in FUnits. The off-curve points of the glyph's cubic Bézier
+// curves are flagged with flagCubic.
+type cffDecoder struct {
+	f *Font
+	g *GlyphBuf
+	// subrs are the glyph's local subroutines.
+	subrs cffIndex
+	// stack is the argument stack, in 16.16 fixed point.
+	stack [cffMaxStack]int32
+	n     int
+	// nStems is the number of stem hints so far, which gives the length of
+	// a hintmask or cntrmask operator's mask.
+	nStems int
+	// seenWidth is whether the first stack-clearing operator, whose
+	// arguments may start with the glyph's width, has been seen.
+	seenWidth bool
+	// x and y are the current point, in 16.16 fixed point.
+	x, y int32
+	// start is the index in g.Point of the current contour's first point,
+	// or -1 if there is no current contour.
+	start int
+}
+
+// decodeCFF appends the i'th glyph's contours, from the CFF table, to g.
+// The points are in FUnits.
+func (f *Font) decodeCFF(g *GlyphBuf, i Index) error {
+	if int(i) >= f.nGlyph {
+		return FormatError("bad glyph index")
+	}
+	d := cffDecoder{f: f, g: g, start: -1}
+	if f.cffFDSelect != nil {
+		d.subrs = f.cffSubrs[f.cffFDSelect[i]]
+	} else {
+		d.subrs = f.cffSubrs[0]
+	}
+	if _, err := d.run(f.cffCharStrings.get(int(i)), 0); err != nil {
+		return err
+	}
+	d.closeContour()
+	return nil
+}
+
+// cffBounds returns the bounds, in FUnits, of the i'th glyph's points. ok
+// is false if the glyph has no contours.
+func (f *Font) cffBounds(i Index) (b Bounds, ok bool, err error) {
+	var g GlyphBuf
+	if err := f.decodeCFF(&g, i); err != nil {
+		return Bounds{}, false, err
+	}
+	if len(g.Point) == 0 {
+		return Bounds{}, false, nil
+	}
+	return pointBounds(g.Point), true, nil
+}
+
+// pointBounds returns the bounds of the non-empty ps.
+func pointBounds(ps []Point) Bounds {
+	b := Bounds{ps[0].X, ps[0].Y, ps[0].X, ps[0].Y}
+	for _, p := range ps[1:] {
+		if b.XMin > p.X {
+			b.XMin = p.X
+		}
+		if b.YMin > p.Y {
+			b.YMin = p.Y
+		}
+		if b.XMax < p.X {
+			b.XMax = p.X
+		}
+		if b.YMax < p.Y {
+			b.YMax = p.Y
+		}
+	}
+	return b
+}
+
+// loadCFF appends the i'th glyph's contours, from the CFF table, to this
+// GlyphBuf, scaled. A PostScript glyph has no TrueType instructions, so if
+// h is non-nil then the glyph is not hinted, other than that LoadPhase
+// rounds its advance width.
+func (g *GlyphBuf) loadCFF(f *Font, scale int32, i Index, h *Hinter) error {
+	np0 := len(g.Point)
+	if err := f.decodeCFF(g, i); err != nil {
+		return err
+	}
+	if len(g.Point) > np0 {
+		g.B = pointBounds(g.Point[np0:])
+	}
+	if h != nil {
+		g.InFontUnits = append(g.InFontUnits, g.Point[np0:]...)
+		g.phantom = f.scaledPhantomPoints(scale, i, g.B)
+	}
+	for j := np0; j < len(g.Point); j++ {
+		g.Point[j].X = f.scale(scale * g.Point[j].X)
+		g.Point[j].Y = f.scale(scale * g.Point[j].Y)
+	}
+	if h != nil {
+		g.Unhinted = append(g.Unhinted, g.Point[np0:]...)
+	}
+	return nil
+}
+
+// run runs the charstring cs, which is a subroutine if depth is positive.
+// It returns whether the charstring ended with an endchar operator, rather
+// than a return operator.
+func (d *cffDecoder) run(cs []byte, depth int) (ended bool, err error) {
+	if depth > cffMaxSubrDepth {
+		return false, FormatError("CFF subroutines nested too deeply")
+	}
+	for i := 0; i < len(cs); {
+		c := cs[i]
+		i++
+		if c == 28 || c >= 32 {
+			// Push an operand. All but the 255 operand are integers.
+			var v int32
+			switch {
+			case c == 28:
+				if i+2 > len(cs) {
+					return false, FormatError("CFF charstring too short")
+				}
+				v = int32(int16(u16(cs, i))) << 16
+				i += 2
+			case c <= 246:
+				v = (int32(c) - 139) << 16
+			case c <= 254:
+				if i >= len(cs) {
+					return false, FormatError("CFF charstring too short")
+				}
+				if c <= 250 {
+					v = ((int32(c)-247)*256 + int32(cs[i]) + 108) << 16
+				} else {
+					v = (-(int32(c)-251)*256 - int32(cs[i]) - 108) << 16
+				}
+				i++
+			default:
+				if i+4 > len(cs) {
+					return false, FormatError("CFF charstring too short")
+				}
+				v = int32(u32(cs, i))
+				i += 4
+			}
+			if d.n == cffMaxStack {
+				return false, FormatError("CFF charstring stack overflow")
+			}
+			d.stack[d.n] = v
+			d.n++
+			continue
+		}
+
+		op := int(c)
+		if c == 12 {
+			if i >= len(cs) {
+				return false, FormatError("CFF charstring too short")
+			}
+			op = 1200 + int(cs[i])
+			i++
+		}
+		a := d.stack[:d.n]
+		switch op {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm.
+			d.nStems += len(d.args(0)) / 2
+		case 19, 20: // hintmask, cntrmask.
+			// Any arguments are for an implied vstem.
+			d.nStems += len(d.args(0)) / 2
+			n := (d.nStems + 7) / 8
+			if i+n > len(cs) {
+				return false, FormatError("CFF charstring too short")
+			}
+			i += n
+		case 21: // rmoveto.
+			if a = d.args(2); len(a) != 2 {
+				return false, errCFFArgs(op)
+			}
+			d.moveTo(a[0], a[1])
+		case 22: // hmoveto.
+			if a = d.args(1); len(a) != 1 {
+				return false, errCFFArgs(op)
+			}
+			d.moveTo(a[0], 0)
+		case 4: // vmoveto.
+			if a = d.args(1); len(a) != 1 {
+				return false, errCFFArgs(op)
+			}
+			d.moveTo(0, a[0])
+		case 5: // rlineto.
+			if len(a) == 0 || len(a)%2 != 0 {
+				return false, errCFFArgs(op)
+			}
+			for j := 0; j < len(a); j += 2 {
+				d.lineTo(a[j], a[j+1])
+			}
+		case 6, 7: // hlineto, vlineto.
+			if len(a) == 0 {
+				return false, errCFFArgs(op)
+			}
+			// The lines alternate between horizontal and vertical.
+			horizontal := op == 6
+			for _, v := range a {
+				if horizontal {
+					d.lineTo(v, 0)
+				} else {
+					d.lineTo(0, v)
+				}
+				horizontal = !horizontal
+			}
+		case 8: // rrcurveto.
+			if len(a) == 0 || len(a)%6 != 0 {
+				return false, errCFFArgs(op)
+			}
+			for j := 0; j < len(a); j += 6 {
+				d.curveTo(a[j], a[j+1], a[j+2], a[j+3], a[j+4], a[j+5])
+			}
+		case 24: // rcurveline.
+			if len(a) < 8 || (len(a)-2)%6 != 0 {
+				return false, errCFFArgs(op)
+			}
+			j := 0
+			for ; j+2 < len(a); j += 6 {
+				d.curveTo(a[j], a[j+1], a[j+2], a[j+3], a[j+4], a[j+5])
+			}
+			d.lineTo(a[j], a[j+1])
+		case 25: // rlinecurve.
+			if len(a) < 8 || len(a)%2 != 0 {
+				return false, errCFFArgs(op)
+			}
+			j := 0
+			for ; j+6 < len(a); j += 2 {
+				d.lineTo(a[j], a[j+1])
+			}
+			d.curveTo(a[j], a[j+1], a[j+2], a[j+3], a[j+4], a[j+5])
+		case 26, 27: // vvcurveto, hhcurveto.
+			if len(a) < 4 || len(a)%4 > 1 {
+				return false, errCFFArgs(op)
+			}
+			// An odd argument is the first curve's other initial delta.
+			var d1 int32
+			if len(a)%4 == 1 {
+				d1, a = a[0], a[1:]
+			}
+			for j := 0; j < len(a); j += 4 {
+				if op == 26 {
+					d.curveTo(d1, a[j], a[j+1], a[j+2], 0, a[j+3])
+				} else {
+					d.curveTo(a[j], d1, a[j+1], a[j+2], a[j+3], 0)
+				}
+				d1 = 0
+			}
+		case 30, 31: // vhcurveto, hvcurveto.
+			if len(a) < 4 || len(a)%4 > 1 {
+				return false, errCFFArgs(op)
+			}
+			// The curves' tangents alternate between horizontal and
+			// vertical. An odd argument is the last curve's final delta.
+			horizontal := op == 31
+			for j := 0; j+4 <= len(a); j += 4 {
+				var last int32
+				if j+5 == len(a) {
+					last = a[j+4]
+				}
+				if horizontal {
+					d.curveTo(a[j], 0, a[j+1], a[j+2], last, a[j+3])
+				} else {
+					d.curveTo(0, a[j], a[j+1], a[j+2], a[j+3], last)
+				}
+				horizontal = !horizontal
+			}
+		case 1234: // hflex.
+			if len(a) != 7 {
+				return false, errCFFArgs(op)
+			}
+			d.curveTo(a[0], 0, a[1], a[2], a[3], 0)
+			d.curveTo(a[4], 0, a[5], -a[2], a[6], 0)
+		case 1235: // flex.
+			if len(a) != 13 {
+				return false, errCFFArgs(op)
+			}
+			d.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			d.curveTo(a[6], a[7], a[8], a[9], a[10], a[11])
+		case 1236: // hflex1.
+			if len(a) != 9 {
+				return false, errCFFArgs(op)
+			}
+			d.curveTo(a[0], a[1], a[2], a[3], a[4], 0)
+			d.curveTo(a[5], 0, a[6], a[7], a[8], -(a[1] + a[3] + a[7]))
+		case 1237: // flex1.
+			if len(a) != 11 {
+				return false, errCFFArgs(op)
+			}
+			// The last argument is the last point's delta in whichever of
+			// x and y the curves move further, and they end at their
+			// starting co-ordinate in the other.
+			dx := a[0] + a[2] + a[4] + a[6] + a[8]
+			dy := a[1] + a[3] + a[5] + a[7] + a[9]
+			d.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			adx, ady := dx, dy
+			if adx < 0 {
+				adx = -adx
+			}
+			if ady < 0 {
+				ady = -ady
+			}
+			if adx > ady {
+				d.curveTo(a[6], a[7], a[8], a[9], a[10], -dy)
+			} else {
+				d.curveTo(a[6], a[7], a[8], a[9], -dx, a[10])
+			}
+		case 10, 29: // callsubr, callgsubr.
+			if d.n == 0 {
+				return false, errCFFArgs(op)
+			}
+			d.n--
+			subrs := d.subrs
+			if op == 29 {
+				subrs = d.f.cffGlobalSubrs
+			}
+			j := int(d.stack[d.n]>>16) + cffSubrBias(subrs.count)
+			if j < 0 || j >= subrs.count {
+				return false, FormatError(fmt.Sprintf("bad CFF subroutine index: %d", j))
+			}
+			if ended, err := d.run(subrs.get(j), depth+1); ended || err != nil {
+				return ended, err
+			}
+			// The subroutine's arguments are left on the stack.
+			continue
+		case 11: // return.
+			if depth == 0 {
+				return false, FormatError("CFF return outside a subroutine")
+			}
+			return false, nil
+		case 14: // endchar.
+			if len(d.args(0)) != 0 {
+				// The seac-like form of endchar is deprecated.
+				return false, UnsupportedError("CFF endchar accented character")
+			}
+			return true, nil
+		default:
+			return false, UnsupportedError(fmt.Sprintf("CFF charstring operator: %d", op))
+		}
+		d.n = 0
+	}
+	return false, nil
+}
+
+// errCFFArgs returns the error for a charstring operator with the wrong
+// number of arguments.
+func errCFFArgs(op int) error {
+	return FormatError(fmt.Sprintf("bad CFF charstring arguments for operator %d", op))
+}
+
+// args returns the arguments of a stack-clearing operator that takes n
+// arguments or, if n is zero, an even number of arguments. The first such
+// operator's arguments may start with an extra argument, the glyph's
+// width, which is discarded, since the hmtx table gives the glyph's
+// advance width.
+func (d *cffDecoder) args(n int) []int32 {
+	a := d.stack[:d.n]
+	if !d.seenWidth {
+		d.seenWidth = true
+		if n == 0 && len(a)%2 == 1 || n != 0 && len(a) > n {
+			a = a[1:]
+		}
+	}
+	return a
+}
+
+// appendPoint appends the current point, with the given flags.
+func (d *cffDecoder) appendPoint(flags uint32) {
+	// Round the 16.16 fixed point co-ordinates to FUnits.
+	d.g.Point = append(d.g.Point, Point{
+		X:     (d.x + 0x8000) >> 16,
+		Y:     (d.y + 0x8000) >> 16,
+		Flags: flags,
+	})
+}
+
+// moveTo starts a new contour, at the current point moved by (dx, dy).
+func (d *cffDecoder) moveTo(dx, dy int32) {
+	d.closeContour()
+	d.x += dx
+	d.y += dy
+	d.start = len(d.g.Point)
+	d.appendPoint(flagOnCurve)
+}
+
+// lineTo adds a line from the current point to the current point moved by
+// (dx, dy).
+func (d *cffDecoder) lineTo(dx, dy int32) {
+	if d.start < 0 {
+		d.moveTo(0, 0)
+	}
+	d.x += dx
+	d.y += dy
+	d.appendPoint(flagOnCurve)
+}
+
+// curveTo adds a cubic Bézier curve from the current point. Each of its
+// control points and its end point is relative to the previous point.
+func (d *cffDecoder) curveTo(dx1, dy1, dx2, dy2, dx3, dy3 int32) {
+	if d.start < 0 {
+		d.moveTo(0, 0)
+	}
+	d.x += dx1
+	d.y += dy1
+	d.appendPoint(flagCubic)
+	d.x += dx2
+	d.y += dy2
+	d.appendPoint(flagCubic)
+	d.x += dx3
+	d.y += dy3
+	d.appendPoint(flagOnCurve)
+}
+
+// closeContour ends the current contour, if there is one. A contour is
+// implicitly closed, so if its last point is the same as its first, then
+// the last point is dropped. A contour with only one point is dropped.
+func (d *cffDecoder) closeContour() {
+	if d.start < 0 {
+		return
+	}
+	g := d.g
+	if n := len(g.Point); n-d.start > 1 && g.Point[n-1].X == g.Point[d.start].X && g.Point[n-1].Y == g.Point[d.start].Y {
+		g.Point = g.Point[:n-1]
+	}
+	if len(g.Point)-d.start > 1 {
+		g.End = append(g.End, len(g.Point))
+	} else {
+		g.Point = g.Point[:d.start]
+	}
+	d.start = -1
+}
@@ -0,0 +1,137 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements color glyphs, from the COLR and CPAL tables, which
+// are documented at http://www.microsoft.com/typography/otspec/colr.htm and
+// http://www.microsoft.com/typography/otspec/cpal.htm
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// A ColorLayer is one layer of a color glyph. A color glyph is rendered by
+// rendering each of its layers' glyphs' outlines, in order, each filled
+// with that layer's color.
+type ColorLayer struct {
+	// Glyph is the glyph whose outline is the layer's shape.
+	Glyph Index
+	// Color is the layer's color, from the font's first palette.
+	Color color.NRGBA
+	// Foreground is whether the layer should instead be filled with the
+	// text's foreground color, in which case Color is ignored.
+	Foreground bool
+}
+
+// foregroundPaletteIndex is the COLR palette index that means the text's
+// foreground color.
+const foregroundPaletteIndex = 0xffff
+
+func (f *Font) parseCOLR() error {
+	// The COLR and CPAL tables are optional, but a COLR table needs a CPAL
+	// table for its colors.
+	if len(f.colr) == 0 {
+		return nil
+	}
+	if len(f.cpal) == 0 {
+		return FormatError("COLR table without a CPAL table")
+	}
+	if len(f.cpal) < 12 {
+		return FormatError("CPAL data too short")
+	}
+	nEntries, nPalettes := int(u16(f.cpal, 2)), int(u16(f.cpal, 4))
+	nRecords, records := int(u16(f.cpal, 6)), int(u32(f.cpal, 8))
+	if nPalettes == 0 || len(f.cpal) < 12+2*nPalettes {
+		return FormatError("CPAL data too short")
+	}
+	if records < 0 || records > len(f.cpal) || nRecords > (len(f.cpal)-records)/4 {
+		return FormatError("bad CPAL color records")
+	}
+	for i := 0; i < nPalettes; i++ {
+		if int(u16(f.cpal, 12+2*i))+nEntries > nRecords {
+			return FormatError("bad CPAL palette")
+		}
+	}
+
+	// Version 1 of the COLR table adds fields after the version 0 ones,
+	// which we ignore.
+	if len(f.colr) < 14 {
+		return FormatError("COLR data too short")
+	}
+	if v := u16(f.colr, 0); v > 1 {
+		return UnsupportedError(fmt.Sprintf("COLR version: %d", v))
+	}
+	nBase, base := int(u16(f.colr, 2)), int(u32(f.colr, 4))
+	nLayer, layer := int(u16(f.colr, 12)), int(u32(f.colr, 8))
+	if base < 0 || base > len(f.colr) || nBase > (len(f.colr)-base)/6 {
+		return FormatError("bad COLR base glyph records")
+	}
+	if layer < 0 || layer > len(f.colr) || nLayer > (len(f.colr)-layer)/4 {
+		return FormatError("bad COLR layer records")
+	}
+	for i := 0; i < nBase; i++ {
+		x := base + 6*i
+		if int(u16(f.colr, x+2))+int(u16(f.colr, x+4)) > nLayer {
+			return FormatError("bad COLR base glyph record")
+		}
+	}
+	for i := 0; i < nLayer; i++ {
+		x := layer + 4*i
+		if int(u16(f.colr, x)) >= f.nGlyph {
+			return FormatError("bad COLR layer glyph")
+		}
+		if p := int(u16(f.colr, x+2)); p != foregroundPaletteIndex && p >= nEntries {
+			return FormatError("bad COLR palette index")
+		}
+	}
+	return nil
+}
+
+// ColorLayers returns the layers of the i'th glyph, if it is a color glyph.
+// The boolean result reports whether it is. If it is not, then the glyph
+// should be rendered from its own outline, in the text's foreground color.
+func (f *Font) ColorLayers(i Index) ([]ColorLayer, bool) {
+	if len(f.colr) == 0 {
+		return nil, false
+	}
+	nBase, base := int(u16(f.colr, 2)), int(u32(f.colr, 4))
+	// The base glyph records are sorted by glyph.
+	for lo, hi := 0, nBase; lo < hi; {
+		j := (lo + hi) / 2
+		x := base + 6*j
+		if g := Index(u16(f.colr, x)); g < i {
+			lo = j + 1
+		} else if g > i {
+			hi = j
+		} else {
+			first, n := int(u16(f.colr, x+2)), int(u16(f.colr, x+4))
+			return f.colorLayers(first, n), true
+		}
+	}
+	return nil, false
+}
+
+// colorLayers returns the n layers starting at the first'th layer record.
+func (f *Font) colorLayers(first, n int) []ColorLayer {
+	layer := int(u32(f.colr, 8))
+	// The first palette's color records start at palette0.
+	palette0 := int(u32(f.cpal, 8)) + 4*int(u16(f.cpal, 12))
+	layers := make([]ColorLayer, n)
+	for k := range layers {
+		x := layer + 4*(first+k)
+		layers[k].Glyph = Index(u16(f.colr, x))
+		p := int(u16(f.colr, x+2))
+		if p == foregroundPaletteIndex {
+			layers[k].Foreground = true
+			continue
+		}
+		// The color records are in BGRA order.
+		y := palette0 + 4*p
+		layers[k].Color = color.NRGBA{f.cpal[y+2], f.cpal[y+1], f.cpal[y], f.cpal[y+3]}
+	}
+	return layers
+}
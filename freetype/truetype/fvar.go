@@ -0,0 +1,215 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements parsing the fvar table, which holds a variable font's
+// axes of variation and its named instances, and the avar table, which
+// modifies how the axes' values are normalized. The tables are documented at
+// http://www.microsoft.com/typography/otspec/fvar.htm and
+// http://www.microsoft.com/typography/otspec/avar.htm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// An Axis is one of a variable font's axes of variation, such as its weight
+// or its width.
+type Axis struct {
+	// Tag is the axis's four byte tag, such as "wght" or "wdth".
+	Tag string
+	// Min, Default and Max are the axis's range of values, and its value
+	// for the font's default instance.
+	Min, Default, Max float64
+	// Name is the axis's name, from the name table.
+	Name string
+	// Hidden is whether the font suggests that the axis not be shown in a
+	// user interface.
+	Hidden bool
+}
+
+// A NamedInstance is one of a variable font's predefined instances, such as
+// "Bold" or "Condensed Light".
+type NamedInstance struct {
+	// Name is the instance's subfamily name, from the name table.
+	Name string
+	// PostscriptName is the instance's PostScript name, from the name
+	// table, or empty if the font does not give one.
+	PostscriptName string
+	// Coords are the instance's values for each of the font's Axes.
+	Coords []float64
+}
+
+// The sizes of an fvar axis record and of an fvar instance record's fields
+// other than its co-ordinates.
+const (
+	fvarAxisSize     = 20
+	fvarInstanceSize = 4
+)
+
+func (f *Font) parseFvar() error {
+	if len(f.fvar) == 0 {
+		return nil
+	}
+	if len(f.fvar) < 16 {
+		return FormatError(fmt.Sprintf("bad fvar length: %d", len(f.fvar)))
+	}
+	if v := u16(f.fvar, 0); v != 1 {
+		return UnsupportedError(fmt.Sprintf("fvar version: %d", v))
+	}
+	offset, nAxis := int(u16(f.fvar, 4)), int(u16(f.fvar, 8))
+	axisSize, nInstance := int(u16(f.fvar, 10)), int(u16(f.fvar, 12))
+	instanceSize := int(u16(f.fvar, 14))
+	if axisSize != fvarAxisSize {
+		return FormatError(fmt.Sprintf("bad fvar axis size: %d", axisSize))
+	}
+	// An instance's PostScript name ID is optional.
+	if n := fvarInstanceSize + 4*nAxis; instanceSize != n && instanceSize != n+2 {
+		return FormatError(fmt.Sprintf("bad fvar instance size: %d", instanceSize))
+	}
+	if offset+axisSize*nAxis+instanceSize*nInstance > len(f.fvar) {
+		return FormatError("fvar table too short")
+	}
+	return nil
+}
+
+// fixed returns the 16.16 fixed point number at b[i:] as a float64.
+func fixed(b []byte, i int) float64 {
+	return float64(int32(u32(b, i))) / 0x10000
+}
+
+// Axes returns the font's axes of variation. It returns nil if the font is
+// not a variable font.
+func (f *Font) Axes() []Axis {
+	if len(f.fvar) == 0 {
+		return nil
+	}
+	offset, nAxis := int(u16(f.fvar, 4)), int(u16(f.fvar, 8))
+	axes := make([]Axis, nAxis)
+	for i := range axes {
+		x := offset + fvarAxisSize*i
+		axes[i] = Axis{
+			Tag:     string(f.fvar[x : x+4]),
+			Min:     fixed(f.fvar, x+4),
+			Default: fixed(f.fvar, x+8),
+			Max:     fixed(f.fvar, x+12),
+			Name:    f.Name(NameID(u16(f.fvar, x+18))),
+			Hidden:  u16(f.fvar, x+16)&0x0001 != 0,
+		}
+	}
+	return axes
+}
+
+// NamedInstances returns the font's predefined instances. It returns nil if
+// the font is not a variable font.
+func (f *Font) NamedInstances() []NamedInstance {
+	if len(f.fvar) == 0 {
+		return nil
+	}
+	offset, nAxis := int(u16(f.fvar, 4)), int(u16(f.fvar, 8))
+	nInstance, instanceSize := int(u16(f.fvar, 12)), int(u16(f.fvar, 14))
+	instances := make([]NamedInstance, nInstance)
+	for i := range instances {
+		x := offset + fvarAxisSize*nAxis + instanceSize*i
+		instances[i].Name = f.Name(NameID(u16(f.fvar, x)))
+		instances[i].Coords = make([]float64, nAxis)
+		for j := range instances[i].Coords {
+			instances[i].Coords[j] = fixed(f.fvar, x+fvarInstanceSize+4*j)
+		}
+		if instanceSize > fvarInstanceSize+4*nAxis {
+			// The name ID 0xffff means that there is no PostScript name.
+			if id := u16(f.fvar, x+instanceSize-2); id != 0xffff {
+				instances[i].PostscriptName = f.Name(NameID(id))
+			}
+		}
+	}
+	return instances
+}
+
+func (f *Font) parseAvar() error {
+	if len(f.avar) == 0 {
+		return nil
+	}
+	if len(f.avar) < 8 {
+		return FormatError(fmt.Sprintf("bad avar length: %d", len(f.avar)))
+	}
+	if v := u16(f.avar, 0); v != 1 {
+		return UnsupportedError(fmt.Sprintf("avar version: %d", v))
+	}
+	nAxis := int(u16(f.avar, 6))
+	if len(f.fvar) == 0 || nAxis != int(u16(f.fvar, 8)) {
+		return FormatError("avar axis count does not match fvar")
+	}
+	// Each axis has a segment map, which is a count and then that many
+	// pairs of 2.14 fixed point numbers.
+	f.avarSegments = make([][]byte, nAxis)
+	x := 8
+	for i := range f.avarSegments {
+		if x+2 > len(f.avar) {
+			return FormatError("avar table too short")
+		}
+		n := int(u16(f.avar, x))
+		if 4*n > len(f.avar)-x-2 {
+			return FormatError("avar table too short")
+		}
+		f.avarSegments[i] = f.avar[x+2 : x+2+4*n]
+		x += 2 + 4*n
+	}
+	return nil
+}
+
+// NormalizeCoords converts co-ordinates in the font's design space, one for
+// each of the font's Axes, such as a weight of 650, to the normalized 2.14
+// fixed point co-ordinates that LoadVar takes. Each co-ordinate is clamped
+// to its axis's range, and then mapped linearly so that the axis's default,
+// minimum and maximum values are 0, -1 and +1. If the font has an avar
+// table, then that further modifies the mapping.
+func (f *Font) NormalizeCoords(coords []float64) ([]int16, error) {
+	axes := f.Axes()
+	if len(coords) != len(axes) {
+		return nil, errors.New("truetype: wrong number of variation co-ordinates")
+	}
+	normalized := make([]int16, len(coords))
+	for i, a := range axes {
+		v := math.Max(a.Min, math.Min(a.Max, coords[i]))
+		switch {
+		case v < a.Default:
+			v = (v - a.Default) / (a.Default - a.Min)
+		case v > a.Default:
+			v = (v - a.Default) / (a.Max - a.Default)
+		default:
+			v = 0
+		}
+		v = math.Floor(v*0x4000 + 0.5)
+		if f.avarSegments != nil {
+			v = math.Floor(avarMap(f.avarSegments[i], v) + 0.5)
+		}
+		normalized[i] = int16(v)
+	}
+	return normalized, nil
+}
+
+// avarMap maps the 2.14 fixed point co-ordinate v, which is in the range
+// [-0x4000, 0x4000], by the avar segment map b. The map is piecewise
+// linear between its pairs of co-ordinates, which are sorted.
+func avarMap(b []byte, v float64) float64 {
+	n := len(b) / 4
+	if n == 0 {
+		return v
+	}
+	from := func(k int) float64 { return float64(int16(u16(b, 4*k))) }
+	to := func(k int) float64 { return float64(int16(u16(b, 4*k+2))) }
+	if v <= from(0) {
+		return to(0)
+	}
+	for k := 1; k < n; k++ {
+		if v < from(k) {
+			return to(k-1) + (v-from(k-1))*(to(k)-to(k-1))/(from(k)-from(k-1))
+		}
+	}
+	return to(n - 1)
+}
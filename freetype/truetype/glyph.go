@@ -5,31 +5,135 @@
 
 package truetype
 
+import (
+	"fmt"
+)
+
 // A Point is a co-ordinate pair plus whether it is ``on'' a contour or an
 // ``off'' control point.
 type Point struct {
 	X, Y int32
 	// The Flags' LSB means whether or not this Point is ``on'' the contour.
-	// Other bits are reserved for internal use.
+	// For an ``off'' Point, the 0x100 bit means whether it is one of the two
+	// control points of a cubic Bézier curve, as in a glyph from a CFF
+	// table, rather than the control point of a quadratic one. Other bits
+	// are reserved for internal use. The OnCurve and Cubic methods test
+	// these bits.
 	Flags uint32
 }
 
+// OnCurve returns whether p is ``on'' the contour, rather than an ``off''
+// control point. Unlike testing p.Flags directly, it is not affected by the
+// Flags' bits that are reserved for internal use.
+func (p Point) OnCurve() bool {
+	return p.Flags&flagOnCurve != 0
+}
+
+// Cubic returns whether p is one of the two ``off'' control points of a cubic
+// Bézier curve, rather than the control point of a quadratic one, or an ``on''
+// point.
+func (p Point) Cubic() bool {
+	return p.Flags&flagCubic != 0
+}
+
+// Coord returns p's X and Y co-ordinates.
+func (p Point) Coord() (x, y int32) {
+	return p.X, p.Y
+}
+
 // A GlyphBuf holds a glyph's contours. A GlyphBuf can be re-used to load a
-// series of glyphs from a Font.
+// series of glyphs from a Font, and does not allocate when doing so: loading
+// a glyph first grows the GlyphBuf's slices to the capacities that the Font's
+// largest glyph needs, as given by the maxp table's maximum numbers of points
+// and contours in simple and compound glyphs, plus four phantom points. A
+// GlyphBuf must not be used by multiple goroutines concurrently.
 type GlyphBuf struct {
 	// The glyph's bounding box.
 	B Bounds
+	// AdvanceWidth is the glyph's advance width, in 26.6 fixed point units.
+	// If a Hinter was used to load the glyph then it may have been adjusted
+	// by the glyph's instructions, and it is rounded to the grid.
+	AdvanceWidth int32
 	// Point contains all Points from all contours of the glyph. If a
 	// Hinter was used to load a glyph then Unhinted contains those
 	// Points before they were hinted, and InFontUnits contains those
 	// Points before they were hinted and scaled. Twilight is those
 	// Points created in the 'twilight zone' by the truetype hinting
-	// process.
+	// process. Its length is the font's maximum number of twilight points,
+	// as given by the maxp table, and it holds the twilight zone as it was
+	// after the glyph's instructions ran. Like the other slices, it is
+	// valid until the next call to Load, and is empty if no Hinter was
+	// used.
 	Point, Unhinted, InFontUnits, Twilight []Point
 	// The length of End is the number of contours in the glyph. The i'th
 	// contour consists of points Point[End[i-1]:End[i]], where End[-1]
 	// is interpreted to mean zero.
 	End []int
+	// Overlap is whether the glyph is a compound glyph whose components are
+	// flagged as overlapping. Overlapping components must be filled by the
+	// non-zero winding rule, so that where they overlap is not a hole.
+	Overlap bool
+	// Rounding is how the scaled offsets of a compound glyph's components
+	// are rounded, for those components with the ROUND_XY_TO_GRID flag.
+	// Unlike the other fields, it is not reset by Load.
+	Rounding RoundingMode
+	// IntegerPPEM is whether, for a font whose head table has the
+	// HeadFlagIntegerPPEM flag, the scale passed to Load is rounded to a
+	// whole number of pixels per em, as a bitmap-era rasterizer would, so
+	// that the glyph is scaled exactly as it would be at that size. Like
+	// Rounding, it is not reset by Load.
+	IntegerPPEM bool
+
+	// phantom holds the phantom points of the most recently loaded glyph,
+	// or hinted compound glyph component: its horizontal origin and
+	// advance, and its vertical origin and advance.
+	phantom [4]Point
+	// tmp is scratch space for hinting a compound glyph.
+	tmp []Point
+	// coords holds the normalized variation co-ordinates of the glyph that
+	// LoadVar is loading, and is nil otherwise. dAdvance is the variation
+	// delta, in FUnits, of the most recently loaded glyph's advance width.
+	coords   []int16
+	dAdvance int32
+	// path holds, while a glyph is being loaded, the indexes of the glyphs
+	// that enclose the glyph or component being loaded, outermost first.
+	path []Index
+}
+
+// A RoundingMode is a way of rounding a 26.6 fixed point number, as per the
+// TrueType hinting instructions that set the rounding state, such as RTG.
+type RoundingMode int
+
+const (
+	// RoundToGrid rounds to the nearest integer, as per RTG.
+	RoundToGrid RoundingMode = iota
+	// RoundToHalfGrid rounds to the nearest half-integer, as per RTHG.
+	RoundToHalfGrid
+	// RoundToDoubleGrid rounds to the nearest multiple of 1/2, as per RTDG.
+	RoundToDoubleGrid
+	// RoundDownToGrid rounds down to an integer, as per RDTG.
+	RoundDownToGrid
+	// RoundUpToGrid rounds up to an integer, as per RUTG.
+	RoundUpToGrid
+	// RoundOff does not round, as per ROFF.
+	RoundOff
+)
+
+// round returns the 26.6 fixed point number x rounded by m.
+func (m RoundingMode) round(x int32) int32 {
+	switch m {
+	case RoundToHalfGrid:
+		return x&^63 + 32
+	case RoundToDoubleGrid:
+		return (x + 16) &^ 31
+	case RoundDownToGrid:
+		return x &^ 63
+	case RoundUpToGrid:
+		return (x + 63) &^ 63
+	case RoundOff:
+		return x
+	}
+	return (x + 32) &^ 63
 }
 
 // Flags for decoding a glyph's contours. These flags are documented at
@@ -42,9 +146,11 @@ const (
 	flagPositiveXShortVector
 	flagPositiveYShortVector
 
-	// The remaining flags are for internal use.
+	// The remaining flags are for internal use, other than flagCubic,
+	// which is documented by Point.
 	flagTouchedX
 	flagTouchedY
+	flagCubic
 )
 
 // The same flag bits (0x10 and 0x20) are overloaded to have two meanings,
@@ -56,30 +162,42 @@ const (
 
 // decodeFlags decodes a glyph's run-length encoded flags,
 // and returns the remaining data.
-func (g *GlyphBuf) decodeFlags(d []byte, offset int, np0 int) (offset1 int) {
+func (g *GlyphBuf) decodeFlags(d []byte, offset int, np0 int) (offset1 int, err error) {
 	for i := np0; i < len(g.Point); {
+		if offset >= len(d) {
+			return 0, FormatError("glyph flags too short")
+		}
 		c := uint32(d[offset])
 		offset++
 		g.Point[i].Flags = c
 		i++
 		if c&flagRepeat != 0 {
-			count := d[offset]
+			if offset >= len(d) {
+				return 0, FormatError("glyph flags too short")
+			}
+			count := int(d[offset])
 			offset++
+			if count > len(g.Point)-i {
+				return 0, FormatError("bad glyph flag repeat count")
+			}
 			for ; count > 0; count-- {
 				g.Point[i].Flags = c
 				i++
 			}
 		}
 	}
-	return offset
+	return offset, nil
 }
 
 // decodeCoords decodes a glyph's delta encoded co-ordinates.
-func (g *GlyphBuf) decodeCoords(d []byte, offset int, np0 int) int {
+func (g *GlyphBuf) decodeCoords(d []byte, offset int, np0 int) (int, error) {
 	var x int16
 	for i := np0; i < len(g.Point); i++ {
 		f := g.Point[i].Flags
 		if f&flagXShortVector != 0 {
+			if offset >= len(d) {
+				return 0, FormatError("glyph co-ordinates too short")
+			}
 			dx := int16(d[offset])
 			offset++
 			if f&flagPositiveXShortVector == 0 {
@@ -88,6 +206,9 @@ func (g *GlyphBuf) decodeCoords(d []byte, offset int, np0 int) int {
 				x += dx
 			}
 		} else if f&flagThisXIsSame == 0 {
+			if offset+2 > len(d) {
+				return 0, FormatError("glyph co-ordinates too short")
+			}
 			x += int16(u16(d, offset))
 			offset += 2
 		}
@@ -97,6 +218,9 @@ func (g *GlyphBuf) decodeCoords(d []byte, offset int, np0 int) int {
 	for i := np0; i < len(g.Point); i++ {
 		f := g.Point[i].Flags
 		if f&flagYShortVector != 0 {
+			if offset >= len(d) {
+				return 0, FormatError("glyph co-ordinates too short")
+			}
 			dy := int16(d[offset])
 			offset++
 			if f&flagPositiveYShortVector == 0 {
@@ -105,111 +229,833 @@ func (g *GlyphBuf) decodeCoords(d []byte, offset int, np0 int) int {
 				y += dy
 			}
 		} else if f&flagThisYIsSame == 0 {
+			if offset+2 > len(d) {
+				return 0, FormatError("glyph co-ordinates too short")
+			}
 			y += int16(u16(d, offset))
 			offset += 2
 		}
 		g.Point[i].Y = int32(y)
 	}
-	return offset
+	return offset, nil
 }
 
 // Load loads a glyph's contours from a Font, overwriting any previously
 // loaded contours for this GlyphBuf. scale is the number of 26.6 fixed point
 // units in 1 em. The Hinter is optional; if non-nil, then the resulting glyph
 // will be hinted by the Font's bytecode instructions.
+//
+// A glyph with no contours, such as a space, is loaded as a glyph with empty
+// Point and End slices and a zero B, but its AdvanceWidth is still set.
 func (g *GlyphBuf) Load(f *Font, scale int32, i Index, h *Hinter) error {
+	return g.LoadPhase(f, scale, i, h, 0, 0)
+}
+
+// LoadPhase is like Load, except that the glyph's origin is placed at the
+// 26.6 fixed point co-ordinates (px, py) instead of at (0, 0). The phase is
+// typically the fractional part of a pen position, in the range [0, 64), so
+// that glyphs can be positioned at sub-pixel precision. The phase is applied
+// after scaling, rounding and hinting, so that it is not snapped to the grid,
+// and it offsets both the Points (and, if hinted, the Unhinted and Twilight
+// points) and the bounding box.
+func (g *GlyphBuf) LoadPhase(f *Font, scale int32, i Index, h *Hinter, px, py int32) error {
+	if g.IntegerPPEM && f.Flags()&HeadFlagIntegerPPEM != 0 {
+		scale = (scale + 32) &^ 63
+	}
 	// Reset the GlyphBuf.
 	g.B = Bounds{}
+	g.AdvanceWidth = 0
+	g.dAdvance = 0
 	g.Point = g.Point[:0]
 	g.Unhinted = g.Unhinted[:0]
 	g.InFontUnits = g.InFontUnits[:0]
 	g.Twilight = g.Twilight[:0]
 	g.End = g.End[:0]
+	g.Overlap = false
+	g.reserve(f, h != nil)
 	if h != nil {
-		if err := h.init(g, f, scale); err != nil {
+		if err := h.init(f, scale); err != nil {
 			return err
 		}
 	}
-	if err := g.load(f, scale, i, h, 0, 0, false, 0); err != nil {
+	err := g.load(f, scale, i, h, 0, 0, identity, false, 0)
+	g.path = g.path[:0]
+	if err != nil {
 		return err
 	}
-	g.B.XMin = f.scale(scale * g.B.XMin)
-	g.B.YMin = f.scale(scale * g.B.YMin)
-	g.B.XMax = f.scale(scale * g.B.XMax)
-	g.B.YMax = f.scale(scale * g.B.YMax)
+	if h != nil {
+		// The Hinter's twilight zone has extra points, for its phantom
+		// points, that are not exposed.
+		g.Twilight = append(g.Twilight, h.points[twilightZone][current][:f.maxTwilightPoints]...)
+		// As per C Freetype, a hinted glyph's advance width is rounded to
+		// the grid, even if the glyph has no instructions to hint it, such
+		// as for an empty glyph or for some compound glyphs.
+		g.AdvanceWidth = (g.phantom[1].X - g.phantom[0].X + 32) &^ 63
+		g.phantom[1].X = g.phantom[0].X + g.AdvanceWidth
+	} else {
+		// The advance is scaled directly, rather than being the difference
+		// of two scaled phantom points, which may be off by one.
+		g.AdvanceWidth = f.scale(scale * (f.HMetric(f.fUnitsPerEm, i).AdvanceWidth + g.dAdvance))
+		g.phantom = f.scaledPhantomPoints(scale, i, g.B)
+		g.phantom[1].X = g.phantom[0].X + g.AdvanceWidth
+	}
+	g.B.XMin = px + f.scale(scale*g.B.XMin)
+	g.B.YMin = py + f.scale(scale*g.B.YMin)
+	g.B.XMax = px + f.scale(scale*g.B.XMax)
+	g.B.YMax = py + f.scale(scale*g.B.YMax)
+	if px != 0 || py != 0 {
+		for i := range g.Point {
+			g.Point[i].X += px
+			g.Point[i].Y += py
+		}
+		for i := range g.Unhinted {
+			g.Unhinted[i].X += px
+			g.Unhinted[i].Y += py
+		}
+		for i := range g.Twilight {
+			g.Twilight[i].X += px
+			g.Twilight[i].Y += py
+		}
+	}
 	return nil
 }
 
-// loadCompound loads a glyph that is composed of other glyphs.
-func (g *GlyphBuf) loadCompound(f *Font, scale int32, h *Hinter, glyf []byte, offset int,
-	dx, dy int32, recursion int) error {
-
-	// Flags for decoding a compound glyph. These flags are documented at
-	// http://developer.apple.com/fonts/TTRefMan/RM06/Chap6glyf.html.
-	const (
-		flagArg1And2AreWords = 1 << iota
-		flagArgsAreXYValues
-		flagRoundXYToGrid
-		flagWeHaveAScale
-		flagUnused
-		flagMoreComponents
-		flagWeHaveAnXAndYScale
-		flagWeHaveATwoByTwo
-		flagWeHaveInstructions
-		flagUseMyMetrics
-		flagOverlapCompound
-	)
-	for {
-		flags := u16(glyf, offset)
-		component := Index(u16(glyf, offset+2))
-		dx1, dy1 := dx, dy
-		if flags&flagArg1And2AreWords != 0 {
-			dx1 += int32(int16(u16(glyf, offset+4)))
-			dy1 += int32(int16(u16(glyf, offset+6)))
-			offset += 8
-		} else {
-			dx1 += int32(int16(int8(glyf[offset+4])))
-			dy1 += int32(int16(int8(glyf[offset+5])))
-			offset += 6
+// reserve grows the capacities of g's slices, if necessary, so that loading
+// any of f's glyphs does not grow them. The Unhinted, InFontUnits, Twilight
+// and tmp slices are only used when hinting.
+func (g *GlyphBuf) reserve(f *Font, hinted bool) {
+	np, ne := int(f.maxPoints), int(f.maxContours)
+	if n := int(f.maxCompositePoints); np < n {
+		np = n
+	}
+	if n := int(f.maxCompositeContours); ne < n {
+		ne = n
+	}
+	// A glyph's points are followed by its phantom points while it is being
+	// loaded.
+	np += 4
+	if cap(g.Point) < np {
+		g.Point = make([]Point, 0, np)
+	}
+	if cap(g.End) < ne {
+		g.End = make([]int, 0, ne)
+	}
+	// Since a glyph cannot be its own component, the path to a component
+	// holds at most every glyph once, however lax the nesting limit.
+	nPath := f.maxComponentDepth + 1
+	if nPath > f.nGlyph+1 {
+		nPath = f.nGlyph + 1
+	}
+	if cap(g.path) < nPath {
+		g.path = make([]Index, 0, nPath)
+	}
+	if !hinted {
+		return
+	}
+	if cap(g.Unhinted) < np {
+		g.Unhinted = make([]Point, 0, np)
+	}
+	if cap(g.InFontUnits) < np {
+		g.InFontUnits = make([]Point, 0, np)
+	}
+	if cap(g.tmp) < np {
+		g.tmp = make([]Point, 0, np)
+	}
+	if cap(g.Twilight) < int(f.maxTwilightPoints) {
+		g.Twilight = make([]Point, 0, f.maxTwilightPoints)
+	}
+}
+
+// checkNesting returns an error if the i'th glyph, which is a component of
+// the glyphs in path, outermost first, is nested more deeply than the Font
+// allows, or is one of the glyphs in path. A glyph that is its own component,
+// directly or indirectly, would otherwise be loaded repeatedly until the
+// nesting limit was reached.
+func (f *Font) checkNesting(i Index, path []Index) error {
+	if len(path) > f.maxComponentDepth {
+		return UnsupportedError(fmt.Sprintf(
+			"excessive compound glyph recursion: glyph %d is nested %d deep in glyph %d", i, len(path), path[0]))
+	}
+	for _, j := range path {
+		if j == i {
+			return FormatError(fmt.Sprintf("compound glyph %d is its own component", i))
+		}
+	}
+	return nil
+}
+
+// Advance returns the advance width, in 26.6 fixed point units, of the most
+// recently loaded glyph. If the glyph was hinted, then this is the distance
+// between its horizontal phantom points after hinting, which the glyph's
+// instructions may have adjusted, rounded to the grid. Otherwise, it is the
+// glyph's scaled advance width, as given by the hmtx table. It is the same
+// as g.AdvanceWidth.
+func (g *GlyphBuf) Advance() int32 {
+	return g.AdvanceWidth
+}
+
+// ContourIsClockwise returns whether the i'th contour of the glyph in this
+// GlyphBuf winds clockwise, which is whether the signed area of the polygon
+// through its points, both on and off the curve, is negative. The glyph's
+// Y axis points up. TrueType fonts fill the area to the right of a contour,
+// so that an outer contour is clockwise and a hole is counter-clockwise;
+// CFF fonts use the opposite convention.
+func (g *GlyphBuf) ContourIsClockwise(i int) bool {
+	e0 := 0
+	if i > 0 {
+		e0 = g.End[i-1]
+	}
+	ps := g.Point[e0:g.End[i]]
+	area := int64(0)
+	for j, p := range ps {
+		q := ps[(j+1)%len(ps)]
+		area += int64(p.X)*int64(q.Y) - int64(q.X)*int64(p.Y)
+	}
+	return area < 0
+}
+
+// GlyphBounds returns the bounding box of the i'th glyph. scale is the
+// number of 26.6 fixed point units in 1 em. Unlike GlyphBuf.Load, it does
+// not decode the glyph's points, and the bounds are not hinted. For a
+// compound glyph, the bounds are the union of its components' bounds.
+func (f *Font) GlyphBounds(scale int32, i Index) (Bounds, error) {
+	b, _, err := f.glyphBounds(i, identity, nil)
+	if err != nil {
+		return Bounds{}, err
+	}
+	return f.scaleBounds(scale, b), nil
+}
+
+// StringBounds returns the bounding box of the glyphs of s, laid out left to
+// right from an origin at (0, 0), and the advance from that origin to the
+// pen position after the last glyph. scale is the number of 26.6 fixed point
+// units in 1 em. Each glyph's origin is advanced from the previous glyph's
+// by that glyph's advance width and by the kerning between them. Like
+// GlyphBounds, the bounds are not hinted, and they include any part of a
+// glyph that lies beyond its advance, such as a negative left side bearing.
+// Glyphs with no contours, such as spaces, advance the pen but do not affect
+// the bounds, which are zero if no glyph has contours.
+func (f *Font) StringBounds(scale int32, s string) (b Bounds, advance int32, err error) {
+	ok := false
+	prev, hasPrev := Index(0), false
+	for _, r := range s {
+		i := f.Index(r)
+		if hasPrev {
+			advance += f.Kerning(scale, prev, i)
+		}
+		gb, gok, err := f.glyphBounds(i, identity, nil)
+		if err != nil {
+			return Bounds{}, 0, err
+		}
+		if gok {
+			gb = f.scaleBounds(scale, gb)
+			gb.XMin += advance
+			gb.XMax += advance
+			if !ok {
+				b, ok = gb, true
+			} else {
+				b = b.Union(gb)
+			}
+		}
+		advance += f.HMetric(scale, i).AdvanceWidth
+		prev, hasPrev = i, true
+	}
+	return b, advance, nil
+}
+
+// scaleBounds returns the bounds b, in FUnits, scaled so that there are scale
+// units in 1 em.
+func (f *Font) scaleBounds(scale int32, b Bounds) Bounds {
+	b.XMin = f.scale(scale * b.XMin)
+	b.YMin = f.scale(scale * b.YMin)
+	b.XMax = f.scale(scale * b.XMax)
+	b.YMax = f.scale(scale * b.YMax)
+	return b
+}
+
+// glyphBounds returns the bounds, in FUnits, of the i'th glyph transformed
+// by t. ok is false if the glyph has no contours. path holds the indexes of
+// the compound glyphs, if any, of which the glyph is a component.
+func (f *Font) glyphBounds(i Index, t transform, path []Index) (b Bounds, ok bool, err error) {
+	if err := f.checkNesting(i, path); err != nil {
+		return Bounds{}, false, err
+	}
+	if int(i) >= f.nGlyph {
+		return Bounds{}, false, FormatError("bad glyph index")
+	}
+	if len(f.cff) != 0 {
+		b, ok, err = f.cffBounds(i)
+		return t.applyBounds(b), ok, err
+	}
+	if len(f.loca) == 0 {
+		return Bounds{}, false, ErrNoOutlines
+	}
+	glyf, err := f.glyphData(i)
+	if err != nil {
+		return Bounds{}, false, err
+	}
+	if len(glyf) == 0 {
+		return Bounds{}, false, nil
+	}
+	if len(glyf) < 10 {
+		return Bounds{}, false, FormatError("glyph data too short")
+	}
+	ne := int(int16(u16(glyf, 0)))
+	b = Bounds{
+		int32(int16(u16(glyf, 2))),
+		int32(int16(u16(glyf, 4))),
+		int32(int16(u16(glyf, 6))),
+		int32(int16(u16(glyf, 8))),
+	}
+	if ne != -1 {
+		return t.applyBounds(b), true, nil
+	}
+	var u Bounds
+	for offset := 10; ; {
+		c, offset1, err := decodeComponent(glyf, offset)
+		if err != nil {
+			return Bounds{}, false, err
+		}
+		offset = offset1
+		if c.flags&flagArgsAreXYValues == 0 {
+			// Finding the offset of a point-matched component means
+			// decoding the points, so settle for the compound glyph's own
+			// bounds.
+			return t.applyBounds(b), true, nil
+		}
+		cb, cok, err := f.glyphBounds(c.glyph, t.compose(c.t), append(path, i))
+		if err != nil {
+			return Bounds{}, false, err
+		}
+		if cok {
+			dx, dy := t.apply(c.offset())
+			cb.XMin += dx
+			cb.YMin += dy
+			cb.XMax += dx
+			cb.YMax += dy
+			if !ok {
+				u, ok = cb, true
+			} else {
+				u = u.Union(cb)
+			}
+		}
+		if c.flags&flagMoreComponents == 0 {
+			break
+		}
+	}
+	return u, ok, nil
+}
+
+// A transform is a 2x2 matrix of 2.14 fixed point numbers that is applied
+// to a compound glyph's component. Its elements are xx, xy, yx and yy, in
+// the order that they appear in the glyf table, and the point (x, y) is
+// transformed to (xx*x + yx*y, xy*x + yy*y).
+type transform [4]int32
+
+// identity is the transform that leaves all points unchanged.
+var identity = transform{1 << 14, 0, 0, 1 << 14}
+
+// mul2dot14 returns x*y, where y is a 2.14 fixed point number, rounded to
+// the nearest integer.
+func mul2dot14(x, y int32) int32 {
+	return int32((int64(x)*int64(y) + 1<<13) >> 14)
+}
+
+// apply returns the point (x, y) transformed by t.
+func (t transform) apply(x, y int32) (int32, int32) {
+	return mul2dot14(x, t[0]) + mul2dot14(y, t[2]), mul2dot14(x, t[1]) + mul2dot14(y, t[3])
+}
+
+// applyBounds returns the bounding box of the bounding box b transformed
+// by t.
+func (t transform) applyBounds(b Bounds) Bounds {
+	if t == identity {
+		return b
+	}
+	x, y := t.apply(b.XMin, b.YMin)
+	r := Bounds{x, y, x, y}
+	for _, p := range [3][2]int32{{b.XMax, b.YMin}, {b.XMin, b.YMax}, {b.XMax, b.YMax}} {
+		x, y = t.apply(p[0], p[1])
+		r = r.Union(Bounds{x, y, x, y})
+	}
+	return r
+}
+
+// compose returns the transform that is equivalent to applying u and then t.
+func (t transform) compose(u transform) transform {
+	return transform{
+		mul2dot14(t[0], u[0]) + mul2dot14(t[2], u[1]),
+		mul2dot14(t[1], u[0]) + mul2dot14(t[3], u[1]),
+		mul2dot14(t[0], u[2]) + mul2dot14(t[2], u[3]),
+		mul2dot14(t[1], u[2]) + mul2dot14(t[3], u[3]),
+	}
+}
+
+// Flags for decoding a compound glyph. These flags are documented at
+// http://developer.apple.com/fonts/TTRefMan/RM06/Chap6glyf.html.
+const (
+	flagArg1And2AreWords = 1 << iota
+	flagArgsAreXYValues
+	flagRoundXYToGrid
+	flagWeHaveAScale
+	flagUnused
+	flagMoreComponents
+	flagWeHaveAnXAndYScale
+	flagWeHaveATwoByTwo
+	flagWeHaveInstructions
+	flagUseMyMetrics
+	flagOverlapCompound
+	flagScaledComponentOffset
+	flagUnscaledComponentOffset
+)
+
+// A component is one of a compound glyph's components.
+type component struct {
+	flags uint16
+	glyph Index
+	// ax and ay are either an x and y offset, or a pair of point numbers,
+	// depending on whether flagArgsAreXYValues is set.
+	ax, ay int32
+	// t is the component's own transform.
+	t transform
+}
+
+// decodeComponent decodes the compound glyph component that starts at
+// glyf[offset:], and returns the offset of the next component.
+func decodeComponent(glyf []byte, offset int) (c component, offset1 int, err error) {
+	if offset+4 > len(glyf) {
+		return component{}, 0, FormatError("compound glyph component too short")
+	}
+	c.flags = u16(glyf, offset)
+	c.glyph = Index(u16(glyf, offset+2))
+	n := 8
+	if c.flags&flagArg1And2AreWords == 0 {
+		n = 6
+	}
+	if c.flags&flagWeHaveAScale != 0 {
+		n += 2
+	} else if c.flags&flagWeHaveAnXAndYScale != 0 {
+		n += 4
+	} else if c.flags&flagWeHaveATwoByTwo != 0 {
+		n += 8
+	}
+	if offset+n > len(glyf) {
+		return component{}, 0, FormatError("compound glyph component too short")
+	}
+	// The two arguments are either an x and y offset, which are signed,
+	// or a pair of point numbers, which are unsigned.
+	if c.flags&flagArg1And2AreWords != 0 {
+		c.ax = int32(u16(glyf, offset+4))
+		c.ay = int32(u16(glyf, offset+6))
+		if c.flags&flagArgsAreXYValues != 0 {
+			c.ax, c.ay = int32(int16(c.ax)), int32(int16(c.ay))
+		}
+		offset += 8
+	} else {
+		c.ax = int32(glyf[offset+4])
+		c.ay = int32(glyf[offset+5])
+		if c.flags&flagArgsAreXYValues != 0 {
+			c.ax, c.ay = int32(int8(c.ax)), int32(int8(c.ay))
+		}
+		offset += 6
+	}
+	c.t = identity
+	if c.flags&flagWeHaveAScale != 0 {
+		s := int32(int16(u16(glyf, offset)))
+		c.t = transform{s, 0, 0, s}
+		offset += 2
+	} else if c.flags&flagWeHaveAnXAndYScale != 0 {
+		c.t[0] = int32(int16(u16(glyf, offset+0)))
+		c.t[3] = int32(int16(u16(glyf, offset+2)))
+		offset += 4
+	} else if c.flags&flagWeHaveATwoByTwo != 0 {
+		c.t[0] = int32(int16(u16(glyf, offset+0)))
+		c.t[1] = int32(int16(u16(glyf, offset+2)))
+		c.t[2] = int32(int16(u16(glyf, offset+4)))
+		c.t[3] = int32(int16(u16(glyf, offset+6)))
+		offset += 8
+	}
+	return c, offset, nil
+}
+
+// offset returns the component's x and y offset, in the co-ordinate space
+// of its compound glyph. It is only meaningful if flagArgsAreXYValues is set.
+//
+// Apple's rasterizer also applies the component's own transform to the
+// offset, unless told otherwise, but Microsoft's rasterizer only does so if
+// explicitly asked to. We follow Microsoft.
+func (c *component) offset() (int32, int32) {
+	if c.flags&(flagScaledComponentOffset|flagUnscaledComponentOffset) == flagScaledComponentOffset {
+		return c.t.apply(c.ax, c.ay)
+	}
+	return c.ax, c.ay
+}
+
+// loadCompound loads a glyph that is composed of other glyphs. Without a
+// Hinter, the components' offsets and transforms are applied in FUnit space,
+// before scaling, and are combined with dx, dy and t, which are the offset and
+// transform of the compound glyph itself. With a Hinter, see
+// loadHintedCompound.
+func (g *GlyphBuf) loadCompound(f *Font, scale int32, i Index, h *Hinter, glyf []byte, offset int,
+	dx, dy int32, t transform, recursion int) error {
+
+	if h != nil {
+		return g.loadHintedCompound(f, scale, i, h, glyf, offset, recursion)
+	}
+	np0 := len(g.Point)
+	deltas, err := g.componentDeltas(f, i, glyf, offset, recursion)
+	if err != nil {
+		return err
+	}
+	for k := 0; ; k++ {
+		c, offset1, err := decodeComponent(glyf, offset)
+		if err != nil {
+			return err
 		}
-		if flags&flagArgsAreXYValues == 0 {
-			return UnsupportedError("compound glyph transform vector")
+		offset = offset1
+		if deltas != nil && c.flags&flagArgsAreXYValues != 0 {
+			c.ax += deltas[k].X
+			c.ay += deltas[k].Y
 		}
-		if flags&(flagWeHaveAScale|flagWeHaveAnXAndYScale|flagWeHaveATwoByTwo) != 0 {
-			return UnsupportedError("compound glyph scale/transform")
+		b0, np1 := g.B, len(g.Point)
+		if c.flags&flagArgsAreXYValues != 0 {
+			// The component's offset is in the compound glyph's co-ordinate
+			// space, so it is subject to t. Any rounding of the offset to
+			// the grid happens after the offset is transformed and scaled.
+			dx1, dy1 := t.apply(c.offset())
+			dx1, dy1 = dx+dx1, dy+dy1
+			err := g.load(f, scale, c.glyph, h, dx1, dy1, t.compose(c.t),
+				c.flags&flagRoundXYToGrid != 0, recursion+1)
+			if err != nil {
+				return err
+			}
+		} else {
+			// The component is positioned so that its ay'th point matches
+			// the ax'th point of the compound glyph so far. The point
+			// numbers are relative to np0 and np1, and the points are
+			// matched after loading the component.
+			err := g.load(f, scale, c.glyph, h, dx, dy, t.compose(c.t), false, recursion+1)
+			if err != nil {
+				return err
+			}
+			i0, i1 := np0+int(c.ax), np1+int(c.ay)
+			if i0 >= np1 || i1 >= len(g.Point) {
+				return FormatError("bad compound glyph point number")
+			}
+			matchPoints(g.Point, i0, i1, np1)
 		}
-		b0 := g.B
-		g.load(f, scale, component, h, dx1, dy1, flags&flagRoundXYToGrid != 0, recursion+1)
-		if flags&flagUseMyMetrics == 0 {
+		if c.flags&flagUseMyMetrics == 0 {
 			g.B = b0
 		}
-		if flags&flagMoreComponents == 0 {
+		if c.flags&flagOverlapCompound != 0 {
+			g.Overlap = true
+		}
+		if c.flags&flagMoreComponents == 0 {
 			break
 		}
 	}
 	return nil
 }
 
-// load appends a glyph's contours to this GlyphBuf.
-func (g *GlyphBuf) load(f *Font, scale int32, i Index, h *Hinter,
-	dx, dy int32, roundDxDy bool, recursion int) error {
+// loadHintedCompound loads and hints a glyph that is composed of other
+// glyphs. As per C Freetype, each component is scaled and hinted on its own,
+// and then transformed and offset. The compound glyph's own instructions, if
+// any, are then run on the combined, already hinted, points.
+func (g *GlyphBuf) loadHintedCompound(f *Font, scale int32, i Index, h *Hinter, glyf []byte, offset int,
+	recursion int) error {
+
+	np0, ne0 := len(g.Point), len(g.End)
+	deltas, err := g.componentDeltas(f, i, glyf, offset, recursion)
+	if err != nil {
+		return err
+	}
+	// The compound glyph's own phantom points are scaled but not rounded.
+	g.phantom = f.scaledPhantomPoints(scale, i, g.B)
+	if deltas != nil {
+		// The phantom points' deltas follow the components' deltas.
+		pp := f.phantomPoints(i, g.B)
+		for j := range pp {
+			d := deltas[len(deltas)-4+j]
+			g.phantom[j].X = f.scale(scale * (pp[j].X + d.X))
+			g.phantom[j].Y = f.scale(scale * (pp[j].Y + d.Y))
+		}
+	}
+	var c component
+	for k := 0; ; k++ {
+		c, offset, err = decodeComponent(glyf, offset)
+		if err != nil {
+			return err
+		}
+		if deltas != nil && c.flags&flagArgsAreXYValues != 0 {
+			c.ax += deltas[k].X
+			c.ay += deltas[k].Y
+		}
+		b0, pp0, np1 := g.B, g.phantom, len(g.Point)
+		if err := g.load(f, scale, c.glyph, h, 0, 0, identity, false, recursion+1); err != nil {
+			return err
+		}
+		if c.t != identity {
+			for j := np1; j < len(g.Point); j++ {
+				g.Point[j].X, g.Point[j].Y = c.t.apply(g.Point[j].X, g.Point[j].Y)
+				g.Unhinted[j].X, g.Unhinted[j].Y = c.t.apply(g.Unhinted[j].X, g.Unhinted[j].Y)
+				g.InFontUnits[j].X, g.InFontUnits[j].Y = c.t.apply(g.InFontUnits[j].X, g.InFontUnits[j].Y)
+			}
+		}
+		if c.flags&flagArgsAreXYValues != 0 {
+			ax, ay := c.offset()
+			dx, dy := f.scale(scale*ax), f.scale(scale*ay)
+			if c.flags&flagRoundXYToGrid != 0 {
+				dx = g.Rounding.round(dx)
+				dy = g.Rounding.round(dy)
+			}
+			for j := np1; j < len(g.Point); j++ {
+				g.Point[j].X += dx
+				g.Point[j].Y += dy
+				g.Unhinted[j].X += dx
+				g.Unhinted[j].Y += dy
+				g.InFontUnits[j].X += ax
+				g.InFontUnits[j].Y += ay
+			}
+		} else {
+			// The points are matched in each of the hinted, unhinted and
+			// FUnit co-ordinate spaces.
+			i0, i1 := np0+int(c.ax), np1+int(c.ay)
+			if i0 >= np1 || i1 >= len(g.Point) {
+				return FormatError("bad compound glyph point number")
+			}
+			matchPoints(g.Point, i0, i1, np1)
+			matchPoints(g.Unhinted, i0, i1, np1)
+			matchPoints(g.InFontUnits, i0, i1, np1)
+		}
+		if c.flags&flagUseMyMetrics == 0 {
+			g.B, g.phantom = b0, pp0
+		}
+		if c.flags&flagOverlapCompound != 0 {
+			g.Overlap = true
+		}
+		if c.flags&flagMoreComponents == 0 {
+			break
+		}
+	}
 
-	if recursion >= 4 {
-		return UnsupportedError("excessive compound glyph recursion")
+	// Only the last component's flags say whether the compound glyph has
+	// instructions.
+	if c.flags&flagWeHaveInstructions == 0 || len(g.Point) == np0 {
+		return nil
+	}
+	if offset+2 > len(glyf) {
+		return FormatError("compound glyph instructions too short")
 	}
-	// Find the relevant slice of f.glyf.
-	var g0, g1 uint32
-	if f.locaOffsetFormat == locaOffsetFormatShort {
-		g0 = 2 * uint32(u16(f.loca, 2*int(i)))
-		g1 = 2 * uint32(u16(f.loca, 2*int(i)+2))
+	instrLen := int(u16(glyf, offset))
+	offset += 2
+	if offset+instrLen > len(glyf) {
+		return FormatError("compound glyph instructions too short")
+	}
+	program := glyf[offset : offset+instrLen]
+	// The components' points were touched when hinting the components, but
+	// they start out untouched for the compound glyph's instructions.
+	for j := np0; j < len(g.Point); j++ {
+		g.Point[j].Flags &^= flagTouchedX | flagTouchedY
+	}
+	g.Point = append(g.Point, g.phantom[:]...)
+	return g.hint(h, program, np0, ne0, true)
+}
+
+// vary applies the i'th glyph's variations to its points g.Point[np0:],
+// whose contours are g.End[ne0:], and to its phantom points pp. The points
+// are in FUnits. If the glyph's points vary, then so does its bounding box.
+func (g *GlyphBuf) vary(f *Font, i Index, np0, ne0 int, pp *[4]Point, recursion int) error {
+	np := len(g.Point) - np0
+	ps := append(append([]Point(nil), g.Point[np0:]...), pp[:]...)
+	ends := make([]int, len(g.End)-ne0)
+	for j := range ends {
+		ends[j] = g.End[ne0+j] - np0
+	}
+	deltas, err := g.gvarDeltas(f, i, ps, ends)
+	if err != nil || deltas == nil {
+		return err
+	}
+	for j, d := range deltas {
+		var p *Point
+		if j < np {
+			p = &g.Point[np0+j]
+		} else {
+			p = &pp[j-np]
+		}
+		p.X += d.X
+		p.Y += d.Y
+	}
+	if np > 0 {
+		g.B = pointBounds(g.Point[np0:])
+	}
+	if recursion == 0 {
+		g.dAdvance = deltas[np+1].X - deltas[np].X
+	}
+	return nil
+}
+
+// componentDeltas returns the variation deltas, in FUnits, of the offsets
+// of the i'th glyph's components, which start at glyf[offset:], followed
+// by the deltas of its phantom points. They are nil if the glyph is not
+// being loaded by LoadVar, or if it has no variations.
+func (g *GlyphBuf) componentDeltas(f *Font, i Index, glyf []byte, offset, recursion int) ([]Point, error) {
+	if g.coords == nil {
+		return nil, nil
+	}
+	n := 0
+	for more := true; more; n++ {
+		c, offset1, err := decodeComponent(glyf, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset, more = offset1, c.flags&flagMoreComponents != 0
+	}
+	pp := f.phantomPoints(i, g.B)
+	ps := append(make([]Point, n), pp[:]...)
+	deltas, err := g.gvarDeltas(f, i, ps, nil)
+	if err != nil || deltas == nil {
+		return nil, err
+	}
+	if recursion == 0 {
+		g.dAdvance = deltas[n+1].X - deltas[n].X
+	}
+	return deltas, nil
+}
+
+// phantomPoints returns the i'th glyph's four phantom points, in FUnits,
+// given its bounding box b. They are the glyph's horizontal origin and
+// advance, and its vertical origin and advance.
+func (f *Font) phantomPoints(i Index, b Bounds) [4]Point {
+	hm := f.HMetric(f.fUnitsPerEm, i)
+	vm := f.VMetric(f.fUnitsPerEm, i)
+	x := b.XMin - hm.LeftSideBearing
+	y := b.YMax + vm.TopSideBearing
+	return [4]Point{
+		{X: x},
+		{X: x + hm.AdvanceWidth},
+		{Y: y},
+		{Y: y - vm.AdvanceHeight},
+	}
+}
+
+// scaledPhantomPoints is like phantomPoints, except that the points are
+// scaled. scale is the number of 26.6 fixed point units in 1 em.
+func (f *Font) scaledPhantomPoints(scale int32, i Index, b Bounds) [4]Point {
+	pp := f.phantomPoints(i, b)
+	for j := range pp {
+		pp[j].X = f.scale(scale * pp[j].X)
+		pp[j].Y = f.scale(scale * pp[j].Y)
+	}
+	return pp
+}
+
+// hint hints the points g.Point[np0:], the last four of which are phantom
+// points, and whose contours are g.End[ne0:]. The points have already been
+// scaled. For a simple glyph, g.InFontUnits[np0:] holds the same points in
+// FUnits. For a compound glyph, the points have also already been hinted,
+// component by component. As per C Freetype, the points are first shifted
+// so that the horizontal origin is on the grid, and the advances are
+// rounded to the grid. Afterwards, the phantom points are saved in g.phantom
+// and removed from g.Point.
+func (g *GlyphBuf) hint(h *Hinter, program []byte, np0, ne0 int, compound bool) error {
+	np := len(g.Point) - 4
+	if dx := (g.Point[np].X+32)&^63 - g.Point[np].X; dx != 0 {
+		for j := np0; j < len(g.Point); j++ {
+			g.Point[j].X += dx
+		}
+	}
+	var unhinted, inFontUnits []Point
+	if compound {
+		g.tmp = append(g.tmp[:0], g.Point[np0:]...)
+		unhinted, inFontUnits = g.tmp, g.tmp
 	} else {
-		g0 = u32(f.loca, 4*int(i))
-		g1 = u32(f.loca, 4*int(i)+4)
+		g.Unhinted = append(g.Unhinted, g.Point[np0:]...)
+		unhinted, inFontUnits = g.Unhinted[np0:], g.InFontUnits[np0:]
 	}
-	if g0 == g1 {
+	g.Point[np+1].X = (g.Point[np+1].X + 32) &^ 63
+	g.Point[np+3].Y = (g.Point[np+3].Y + 32) &^ 63
+
+	if len(program) != 0 {
+		// The Hinter's contour ends are relative to the first point.
+		for j := ne0; j < len(g.End); j++ {
+			g.End[j] -= np0
+		}
+		h.compound = compound
+		err := h.runGlyph(program, g.Point[np0:], unhinted, inFontUnits, g.End[ne0:])
+		for j := ne0; j < len(g.End); j++ {
+			g.End[j] += np0
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	copy(g.phantom[:], g.Point[np:])
+	g.Point = g.Point[:np]
+	if !compound {
+		g.Unhinted = g.Unhinted[:np]
+		g.InFontUnits = g.InFontUnits[:np]
+	}
+	return nil
+}
+
+// matchPoints translates the points ps[j:] so that ps[i1] coincides with
+// ps[i0].
+func matchPoints(ps []Point, i0, i1, j int) {
+	dx, dy := ps[i0].X-ps[i1].X, ps[i0].Y-ps[i1].Y
+	for i := j; i < len(ps); i++ {
+		ps[i].X += dx
+		ps[i].Y += dy
+	}
+}
+
+// load appends a glyph's contours to this GlyphBuf. The glyph's points are
+// transformed by t and then offset by dx and dy, in FUnit space, before
+// being scaled.
+func (g *GlyphBuf) load(f *Font, scale int32, i Index, h *Hinter,
+	dx, dy int32, t transform, roundDxDy bool, recursion int) error {
+
+	if err := f.checkNesting(i, g.path[:recursion]); err != nil {
+		return err
+	}
+	g.path = append(g.path[:recursion], i)
+	if int(i) >= f.nGlyph {
+		return FormatError("bad glyph index")
+	}
+	if len(f.cff) != 0 {
+		return g.loadCFF(f, scale, i, h)
+	}
+	if len(f.loca) == 0 {
+		return ErrNoOutlines
+	}
+	glyf, err := f.glyphData(i)
+	if err != nil {
+		return err
+	}
+	if len(glyf) == 0 {
+		// A glyph with no contours, such as a space, has no points and zero
+		// bounds, which, for a compound glyph's component, only matter if
+		// that component has the USE_MY_METRICS flag.
+		g.B = Bounds{}
+		if g.coords != nil {
+			pp := f.phantomPoints(i, Bounds{})
+			if err := g.vary(f, i, len(g.Point), len(g.End), &pp, recursion); err != nil {
+				return err
+			}
+			if h != nil {
+				for j := range pp {
+					g.phantom[j].X = f.scale(scale * pp[j].X)
+					g.phantom[j].Y = f.scale(scale * pp[j].Y)
+				}
+			}
+		} else if h != nil {
+			g.phantom = f.scaledPhantomPoints(scale, i, Bounds{})
+		}
 		return nil
 	}
-	glyf := f.glyf[g0:g1]
+	if len(glyf) < 10 {
+		return FormatError("glyph data too short")
+	}
 	// Decode the contour end indices.
 	ne := int(int16(u16(glyf, 0)))
 	g.B.XMin = int32(int16(u16(glyf, 2)))
@@ -218,12 +1064,15 @@ func (g *GlyphBuf) load(f *Font, scale int32, i Index, h *Hinter,
 	g.B.YMax = int32(int16(u16(glyf, 8)))
 	offset := 10
 	if ne == -1 {
-		return g.loadCompound(f, scale, h, glyf, offset, dx, dy, recursion)
+		return g.loadCompound(f, scale, i, h, glyf, offset, dx, dy, t, recursion)
 	} else if ne < 0 {
 		// http://developer.apple.com/fonts/TTRefMan/RM06/Chap6glyf.html says that
 		// "the values -2, -3, and so forth, are reserved for future use."
 		return UnsupportedError("negative number of contours")
 	}
+	if offset+2*ne+2 > len(glyf) {
+		return FormatError("glyph data too short")
+	}
 	ne0, np0 := len(g.End), len(g.Point)
 	ne += ne0
 	if ne <= cap(g.End) {
@@ -234,16 +1083,25 @@ func (g *GlyphBuf) load(f *Font, scale int32, i Index, h *Hinter,
 	for i := ne0; i < ne; i++ {
 		g.End[i] = 1 + np0 + int(u16(glyf, offset))
 		offset += 2
+		if i > ne0 && g.End[i] <= g.End[i-1] {
+			return FormatError("bad contour end index")
+		}
 	}
 
 	// Note the TrueType hinting instructions.
 	instrLen := int(u16(glyf, offset))
 	offset += 2
+	if offset+instrLen > len(glyf) {
+		return FormatError("glyph instructions too short")
+	}
 	program := glyf[offset : offset+instrLen]
 	offset += instrLen
 
 	// Decode the points.
-	np := int(g.End[ne-1])
+	np := np0
+	if ne > ne0 {
+		np = g.End[ne-1]
+	}
 	if np <= cap(g.Point) {
 		g.Point = g.Point[:np]
 	} else {
@@ -251,20 +1109,44 @@ func (g *GlyphBuf) load(f *Font, scale int32, i Index, h *Hinter,
 		g.Point = make([]Point, np, np*2)
 		copy(g.Point, p)
 	}
-	offset = g.decodeFlags(glyf, offset, np0)
-	g.decodeCoords(glyf, offset, np0)
+	offset, err = g.decodeFlags(glyf, offset, np0)
+	if err != nil {
+		return err
+	}
+	if _, err := g.decodeCoords(glyf, offset, np0); err != nil {
+		return err
+	}
+	var pp [4]Point
+	if h != nil || g.coords != nil {
+		pp = f.phantomPoints(i, g.B)
+	}
+	if g.coords != nil {
+		if err := g.vary(f, i, np0, ne0, &pp, recursion); err != nil {
+			return err
+		}
+	}
+	if t != identity {
+		for i := np0; i < np; i++ {
+			g.Point[i].X, g.Point[i].Y = t.apply(g.Point[i].X, g.Point[i].Y)
+		}
+	}
 
-	// Delta-adjust, scale and hint.
 	if h != nil {
-		g.InFontUnits = append(g.InFontUnits, g.Point[np0:np]...)
-		for i := np0; i < np; i++ {
-			g.InFontUnits[i].X += dx
-			g.InFontUnits[i].Y += dy
+		// A hinted glyph is always loaded at its own origin, untransformed.
+		// See loadHintedCompound.
+		g.Point = append(g.Point, pp[:]...)
+		g.InFontUnits = append(g.InFontUnits, g.Point[np0:]...)
+		for j := np0; j < len(g.Point); j++ {
+			g.Point[j].X = f.scale(scale * g.Point[j].X)
+			g.Point[j].Y = f.scale(scale * g.Point[j].Y)
 		}
+		return g.hint(h, program, np0, ne0, false)
 	}
+
+	// Delta-adjust and scale.
 	if roundDxDy {
-		dx = (f.scale(scale*dx) + 32) &^ 63
-		dy = (f.scale(scale*dy) + 32) &^ 63
+		dx = g.Rounding.round(f.scale(scale * dx))
+		dy = g.Rounding.round(f.scale(scale * dy))
 		for i := np0; i < np; i++ {
 			g.Point[i].X = dx + f.scale(scale*g.Point[i].X)
 			g.Point[i].Y = dy + f.scale(scale*g.Point[i].Y)
@@ -275,21 +1157,117 @@ func (g *GlyphBuf) load(f *Font, scale int32, i Index, h *Hinter,
 			g.Point[i].Y = f.scale(scale * (g.Point[i].Y + dy))
 		}
 	}
-	if h != nil {
-		g.Unhinted = append(g.Unhinted, g.Point[np0:np]...)
-		if err := h.run(program); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
-func (g *GlyphBuf) points(zonePointer int32) []Point {
-	if zonePointer == 0 {
-		return g.Twilight
+// A SegmentOp is the operation of a path Segment.
+type SegmentOp uint32
+
+const (
+	// SegmentOpMoveTo starts a new contour at Args[0].
+	SegmentOpMoveTo SegmentOp = iota
+	// SegmentOpLineTo draws a straight line to Args[0].
+	SegmentOpLineTo
+	// SegmentOpQuadTo draws a quadratic Bézier curve to Args[1], with
+	// Args[0] as the off-curve control point.
+	SegmentOpQuadTo
+	// SegmentOpCubeTo draws a cubic Bézier curve to Args[2], with Args[0]
+	// and Args[1] as the off-curve control points.
+	SegmentOpCubeTo
+)
+
+// A Segment is a segment of a glyph's outline. The Args' Flags are unused.
+type Segment struct {
+	Op   SegmentOp
+	Args [3]Point
+}
+
+// AppendPath appends the outline of the glyph in this GlyphBuf to segs, as
+// MoveTo, LineTo, QuadTo and CubeTo segments, and returns the extended slice. The
+// co-ordinates are the same as those of g.Point. Each contour starts with a
+// MoveTo and is explicitly closed, so that its last segment ends where its
+// MoveTo started.
+//
+// A TrueType contour is a quadratic B-spline, and two consecutive off-curve
+// points imply an on-curve point at their midpoint. AppendPath makes those
+// implied points explicit, including the wrap-around from a contour's last
+// point to its first. A glyph from a font's CFF table is made of cubic
+// Bézier curves instead, whose pairs of off-curve points become CubeTo
+// segments. The curves are not flattened into lines, and so each segment
+// maps directly to a command of a vector format, such as SVG's path data.
+func (g *GlyphBuf) AppendPath(segs []Segment) []Segment {
+	e0 := 0
+	for _, e1 := range g.End {
+		segs = appendContour(segs, g.Point[e0:e1])
+		e0 = e1
+	}
+	return segs
+}
+
+// appendContour appends the segments of the closed contour ps to segs.
+func appendContour(segs []Segment, ps []Point) []Segment {
+	if len(ps) == 0 {
+		return segs
+	}
+	// Find an on-curve point to start from. If the first point is off-curve,
+	// then start from the last point if that is on-curve, or else from the
+	// implied midpoint of the last and first points.
+	var start Point
+	if ps[0].Flags&flagOnCurve != 0 {
+		start, ps = ps[0], ps[1:]
+	} else if last := ps[len(ps)-1]; last.Flags&flagOnCurve != 0 {
+		start, ps = last, ps[:len(ps)-1]
+	} else {
+		start = midPoint(last, ps[0])
+	}
+	start.Flags = 0
+	segs = append(segs, Segment{Op: SegmentOpMoveTo, Args: [3]Point{start}})
+	var q0 Point
+	on0 := true
+	// c holds the pending control points of a cubic curve, and nc is how
+	// many there are.
+	var c [2]Point
+	nc := 0
+	for _, p := range ps {
+		on := p.Flags&flagOnCurve != 0
+		cubic := p.Flags&flagCubic != 0
+		p.Flags = 0
+		if cubic {
+			c[nc&1] = p
+			nc++
+			continue
+		}
+		if nc != 0 {
+			segs = append(segs, Segment{Op: SegmentOpCubeTo, Args: [3]Point{c[0], c[1], p}})
+			nc = 0
+			q0, on0 = p, true
+			continue
+		}
+		if on {
+			if on0 {
+				segs = append(segs, Segment{Op: SegmentOpLineTo, Args: [3]Point{p}})
+			} else {
+				segs = append(segs, Segment{Op: SegmentOpQuadTo, Args: [3]Point{q0, p}})
+			}
+		} else if !on0 {
+			segs = append(segs, Segment{Op: SegmentOpQuadTo, Args: [3]Point{q0, midPoint(q0, p)}})
+		}
+		q0, on0 = p, on
 	}
-	return g.Point
+	// Close the contour.
+	if nc != 0 {
+		segs = append(segs, Segment{Op: SegmentOpCubeTo, Args: [3]Point{c[0], c[1], start}})
+	} else if on0 {
+		segs = append(segs, Segment{Op: SegmentOpLineTo, Args: [3]Point{start}})
+	} else {
+		segs = append(segs, Segment{Op: SegmentOpQuadTo, Args: [3]Point{q0, start}})
+	}
+	return segs
+}
+
+// midPoint returns the point halfway between p and q, with zero Flags.
+func midPoint(p, q Point) Point {
+	return Point{X: (p.X + q.X) / 2, Y: (p.Y + q.Y) / 2}
 }
 
 // NewGlyphBuf returns a newly allocated GlyphBuf.
@@ -0,0 +1,303 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements pair kerning from the OpenType GPOS table, which is
+// documented at http://www.microsoft.com/typography/otspec/gpos.htm and
+// http://www.microsoft.com/typography/otspec/chapter2.htm
+
+import (
+	"fmt"
+)
+
+// GPOS lookup types.
+const (
+	gposPairAdjustment = 2
+	gposExtension      = 9
+)
+
+// valueFormatXAdvance is the ValueFormat bit for a ValueRecord's XAdvance.
+const valueFormatXAdvance = 0x0004
+
+// parseGPOS finds the pair adjustment subtables of the lookups that are
+// referenced by the GPOS table's 'kern' features. Any other lookups are
+// ignored.
+func (f *Font) parseGPOS() error {
+	f.gposKern = f.gposKern[:0]
+	if len(f.gpos) == 0 {
+		return nil
+	}
+	if len(f.gpos) < 10 {
+		return FormatError("GPOS data too short")
+	}
+	if major := u16(f.gpos, 0); major != 1 {
+		return UnsupportedError(fmt.Sprintf("GPOS version: %d.%d", major, u16(f.gpos, 2)))
+	}
+	featureList := int(u16(f.gpos, 6))
+	lookupList := int(u16(f.gpos, 8))
+	if featureList+2 > len(f.gpos) || lookupList+2 > len(f.gpos) {
+		return FormatError("bad GPOS offset")
+	}
+
+	// Collect the lookup indexes of the 'kern' features, for all scripts
+	// and languages.
+	nLookup := int(u16(f.gpos, lookupList))
+	if lookupList+2+2*nLookup > len(f.gpos) {
+		return FormatError("GPOS lookup list too short")
+	}
+	kern := make([]bool, nLookup)
+	nFeature := int(u16(f.gpos, featureList))
+	if featureList+2+6*nFeature > len(f.gpos) {
+		return FormatError("GPOS feature list too short")
+	}
+	for i := 0; i < nFeature; i++ {
+		x := featureList + 2 + 6*i
+		if string(f.gpos[x:x+4]) != "kern" {
+			continue
+		}
+		feature := featureList + int(u16(f.gpos, x+4))
+		if feature+4 > len(f.gpos) {
+			return FormatError("bad GPOS feature offset")
+		}
+		n := int(u16(f.gpos, feature+2))
+		if feature+4+2*n > len(f.gpos) {
+			return FormatError("GPOS feature too short")
+		}
+		for j := 0; j < n; j++ {
+			k := int(u16(f.gpos, feature+4+2*j))
+			if k >= nLookup {
+				return FormatError("bad GPOS lookup index")
+			}
+			kern[k] = true
+		}
+	}
+
+	// Lookups are applied in the order that they appear in the lookup
+	// list. Within a lookup, only the first subtable that covers a pair
+	// applies.
+	for i := 0; i < nLookup; i++ {
+		if !kern[i] {
+			continue
+		}
+		lookup := lookupList + int(u16(f.gpos, lookupList+2+2*i))
+		if lookup+6 > len(f.gpos) {
+			return FormatError("bad GPOS lookup offset")
+		}
+		lookupType := u16(f.gpos, lookup)
+		n := int(u16(f.gpos, lookup+4))
+		if lookup+6+2*n > len(f.gpos) {
+			return FormatError("GPOS lookup too short")
+		}
+		var subtables []int
+		for j := 0; j < n; j++ {
+			subtable := lookup + int(u16(f.gpos, lookup+6+2*j))
+			t := lookupType
+			if t == gposExtension {
+				if subtable+8 > len(f.gpos) {
+					return FormatError("bad GPOS subtable offset")
+				}
+				t = u16(f.gpos, subtable+2)
+				subtable += int(u32(f.gpos, subtable+4))
+			}
+			if t != gposPairAdjustment {
+				continue
+			}
+			if subtable+10 > len(f.gpos) {
+				return FormatError("bad GPOS subtable offset")
+			}
+			subtables = append(subtables, subtable)
+		}
+		if len(subtables) != 0 {
+			f.gposKern = append(f.gposKern, subtables)
+		}
+	}
+	return nil
+}
+
+// gposKerning returns the sum of the XAdvance adjustments, in FUnits, that
+// the GPOS table's kerning lookups give to the first glyph of the pair.
+func (f *Font) gposKerning(i0, i1 Index) (k int32) {
+	for _, lookup := range f.gposKern {
+		for _, subtable := range lookup {
+			if v, ok := f.pairAdjustment(subtable, i0, i1); ok {
+				k += v
+				break
+			}
+		}
+	}
+	return k
+}
+
+// pairAdjustment returns the XAdvance adjustment of the first glyph of the
+// pair, as given by the pair adjustment subtable at the given offset. ok is
+// whether the subtable covers the pair.
+func (f *Font) pairAdjustment(subtable int, i0, i1 Index) (v int32, ok bool) {
+	b := f.gpos
+	format := u16(b, subtable)
+	coverage := subtable + int(u16(b, subtable+2))
+	valueFormat1 := u16(b, subtable+4)
+	valueFormat2 := u16(b, subtable+6)
+	c, ok := coverageIndex(b, coverage, i0)
+	if !ok {
+		return 0, false
+	}
+	// n1 and n2 are the sizes of the two ValueRecords, in bytes.
+	n1, n2 := valueRecordSize(valueFormat1), valueRecordSize(valueFormat2)
+	switch format {
+	case 1:
+		n := int(u16(b, subtable+8))
+		if c >= n || subtable+10+2*c+2 > len(b) {
+			return 0, false
+		}
+		pairSet := subtable + int(u16(b, subtable+10+2*c))
+		if pairSet+2 > len(b) {
+			return 0, false
+		}
+		n = int(u16(b, pairSet))
+		size := 2 + n1 + n2
+		if pairSet+2+size*n > len(b) {
+			return 0, false
+		}
+		// The PairValueRecords are sorted by their second glyph.
+		lo, hi := 0, n
+		for lo < hi {
+			i := (lo + hi) / 2
+			x := pairSet + 2 + size*i
+			g := Index(u16(b, x))
+			if g < i1 {
+				lo = i + 1
+			} else if g > i1 {
+				hi = i
+			} else {
+				return xAdvance(b, x+2, valueFormat1), true
+			}
+		}
+		return 0, false
+	case 2:
+		if subtable+16 > len(b) {
+			return 0, false
+		}
+		c1 := classDef(b, subtable+int(u16(b, subtable+8)), i0)
+		c2 := classDef(b, subtable+int(u16(b, subtable+10)), i1)
+		nc1, nc2 := int(u16(b, subtable+12)), int(u16(b, subtable+14))
+		if c1 >= nc1 || c2 >= nc2 {
+			return 0, true
+		}
+		x := subtable + 16 + (c1*nc2+c2)*(n1+n2)
+		if x+n1 > len(b) {
+			return 0, true
+		}
+		return xAdvance(b, x, valueFormat1), true
+	}
+	return 0, false
+}
+
+// valueRecordSize returns the size, in bytes, of a ValueRecord with the
+// given ValueFormat. Each set bit corresponds to one 16-bit field.
+func valueRecordSize(format uint16) (n int) {
+	for ; format != 0; format >>= 1 {
+		n += 2 * int(format&1)
+	}
+	return n
+}
+
+// xAdvance returns the XAdvance field of the ValueRecord at b[offset:], or
+// zero if the ValueFormat has no such field.
+func xAdvance(b []byte, offset int, format uint16) int32 {
+	if format&valueFormatXAdvance == 0 {
+		return 0
+	}
+	// The XAdvance field follows the XPlacement and YPlacement fields.
+	offset += valueRecordSize(format & (valueFormatXAdvance - 1))
+	return int32(int16(u16(b, offset)))
+}
+
+// coverageIndex returns the coverage index of the glyph i, as given by the
+// Coverage table at b[offset:]. ok is whether the glyph is covered.
+func coverageIndex(b []byte, offset int, i Index) (c int, ok bool) {
+	if offset+4 > len(b) {
+		return 0, false
+	}
+	format, n := u16(b, offset), int(u16(b, offset+2))
+	switch format {
+	case 1:
+		// A sorted array of glyph indexes.
+		if offset+4+2*n > len(b) {
+			return 0, false
+		}
+		lo, hi := 0, n
+		for lo < hi {
+			j := (lo + hi) / 2
+			g := Index(u16(b, offset+4+2*j))
+			if g < i {
+				lo = j + 1
+			} else if g > i {
+				hi = j
+			} else {
+				return j, true
+			}
+		}
+	case 2:
+		// A sorted array of RangeRecords: start, end and startCoverageIndex.
+		if offset+4+6*n > len(b) {
+			return 0, false
+		}
+		lo, hi := 0, n
+		for lo < hi {
+			j := (lo + hi) / 2
+			x := offset + 4 + 6*j
+			start, end := Index(u16(b, x)), Index(u16(b, x+2))
+			if end < i {
+				lo = j + 1
+			} else if start > i {
+				hi = j
+			} else {
+				return int(u16(b, x+4)) + int(i-start), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// classDef returns the class of the glyph i, as given by the ClassDef table
+// at b[offset:]. Glyphs that are not assigned a class are in class zero.
+func classDef(b []byte, offset int, i Index) int {
+	if offset+4 > len(b) {
+		return 0
+	}
+	switch u16(b, offset) {
+	case 1:
+		// A start glyph and an array of classes.
+		if offset+6 > len(b) {
+			return 0
+		}
+		start, n := Index(u16(b, offset+2)), int(u16(b, offset+4))
+		if i < start || int(i-start) >= n || offset+6+2*n > len(b) {
+			return 0
+		}
+		return int(u16(b, offset+6+2*int(i-start)))
+	case 2:
+		// A sorted array of ClassRangeRecords: start, end and class.
+		n := int(u16(b, offset+2))
+		if offset+4+6*n > len(b) {
+			return 0
+		}
+		lo, hi := 0, n
+		for lo < hi {
+			j := (lo + hi) / 2
+			x := offset + 4 + 6*j
+			start, end := Index(u16(b, x)), Index(u16(b, x+2))
+			if end < i {
+				lo = j + 1
+			} else if start > i {
+				hi = j
+			} else {
+				return int(u16(b, x+4))
+			}
+		}
+	}
+	return 0
+}
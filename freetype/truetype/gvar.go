@@ -0,0 +1,423 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements applying the glyph variations in a variable font's
+// gvar table. The table is documented at
+// http://www.microsoft.com/typography/otspec/gvar.htm and its tuple
+// variation data is documented at
+// http://www.microsoft.com/typography/otspec/otvarcommonformats.htm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The gvar tuple variation flags.
+const (
+	gvarSharedPointNumbers = 0x8000
+	gvarTupleCountMask     = 0x0fff
+
+	gvarEmbeddedPeakTuple   = 0x8000
+	gvarIntermediateRegion  = 0x4000
+	gvarPrivatePointNumbers = 0x2000
+	gvarTupleIndexMask      = 0x0fff
+)
+
+func (f *Font) parseGvar() error {
+	if len(f.gvar) == 0 {
+		return nil
+	}
+	if len(f.gvar) < 20 {
+		return FormatError(fmt.Sprintf("bad gvar length: %d", len(f.gvar)))
+	}
+	if v := u16(f.gvar, 0); v != 1 {
+		return UnsupportedError(fmt.Sprintf("gvar version: %d", v))
+	}
+	nAxis := int(u16(f.gvar, 4))
+	if len(f.fvar) == 0 || nAxis != int(u16(f.fvar, 8)) {
+		return FormatError("gvar axis count does not match fvar")
+	}
+	nShared, shared := int(u16(f.gvar, 6)), int(u32(f.gvar, 8))
+	if shared < 0 || shared > len(f.gvar) || 2*nAxis*nShared > len(f.gvar)-shared {
+		return FormatError("bad gvar shared tuples")
+	}
+	if n := int(u16(f.gvar, 12)); n != f.nGlyph {
+		return FormatError(fmt.Sprintf("bad gvar glyph count: %d", n))
+	}
+	size := 2
+	if u16(f.gvar, 14)&0x0001 != 0 {
+		size = 4
+	}
+	if 20+size*(f.nGlyph+1) > len(f.gvar) {
+		return FormatError("gvar table too short")
+	}
+	// The glyphs' variation data offsets must be increasing.
+	data, prev := int(u32(f.gvar, 16)), 0
+	for j := 0; j <= f.nGlyph; j++ {
+		o := f.gvarOffset(j)
+		if o < prev || data < 0 || data > len(f.gvar) || o > len(f.gvar)-data {
+			return FormatError(fmt.Sprintf("bad gvar offset for glyph %d: %d", j, o))
+		}
+		prev = o
+	}
+	return nil
+}
+
+// gvarOffset returns the offset of the j'th glyph's variation data,
+// relative to the start of the glyphs' variation data.
+func (f *Font) gvarOffset(j int) int {
+	if u16(f.gvar, 14)&0x0001 == 0 {
+		return 2 * int(u16(f.gvar, 20+2*j))
+	}
+	return int(u32(f.gvar, 20+4*j))
+}
+
+// gvarData returns the i'th glyph's variation data. It is empty if the
+// glyph has no variations.
+func (f *Font) gvarData(i Index) []byte {
+	data := int(u32(f.gvar, 16))
+	return f.gvar[data+f.gvarOffset(int(i)) : data+f.gvarOffset(int(i)+1)]
+}
+
+// LoadVar is like Load, except that the glyph is loaded at the given
+// position in the font's design space, by applying its variations from the
+// gvar table. coords holds one co-ordinate for each of the font's Axes, in
+// 2.14 fixed point, and normalized so that the default, minimum and maximum
+// values of each axis are 0, -1 and +1. The variations are applied before
+// scaling and hinting. If the font has no gvar table, then the glyph is the
+// same as for Load.
+func (g *GlyphBuf) LoadVar(f *Font, scale int32, i Index, coords []int16, h *Hinter) error {
+	if len(f.fvar) != 0 && len(coords) != int(u16(f.fvar, 8)) {
+		return errors.New("truetype: wrong number of variation co-ordinates")
+	}
+	if len(f.gvar) != 0 {
+		g.coords = coords
+		defer func() { g.coords = nil }()
+	}
+	return g.LoadPhase(f, scale, i, h, 0, 0)
+}
+
+// gvarDeltas returns the deltas, in FUnits, for the points ps of the i'th
+// glyph, at the normalized co-ordinates g.coords. The last four points are
+// the glyph's phantom points. For a simple glyph, ps are its points, in
+// FUnits, and ends holds their contour ends, which are used to infer the
+// deltas of points that a variation does not give deltas for. For a
+// compound glyph, ps are its components' offsets and ends is nil. The
+// deltas are nil if the glyph has no variations.
+func (g *GlyphBuf) gvarDeltas(f *Font, i Index, ps []Point, ends []int) ([]Point, error) {
+	b := f.gvarData(i)
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < 4 {
+		return nil, FormatError("gvar data too short")
+	}
+	nAxis, nShared := int(u16(f.gvar, 4)), int(u16(f.gvar, 6))
+	n, offset := int(u16(b, 0)), int(u16(b, 2))
+	var shared []int
+	if n&gvarSharedPointNumbers != 0 {
+		var err error
+		if shared, offset, err = unpackPointNumbers(b, offset); err != nil {
+			return nil, err
+		}
+	}
+	dx := make([]float64, len(ps))
+	dy := make([]float64, len(ps))
+	// tx, ty and touched are one tuple's deltas, when they are inferred.
+	var tx, ty []float64
+	var touched []bool
+	h := 4
+	for n &= gvarTupleCountMask; n > 0; n-- {
+		if h+4 > len(b) {
+			return nil, FormatError("gvar data too short")
+		}
+		size, index := int(u16(b, h+0)), u16(b, h+2)
+		h += 4
+		var peak, start, end []byte
+		if index&gvarEmbeddedPeakTuple != 0 {
+			if h+2*nAxis > len(b) {
+				return nil, FormatError("gvar data too short")
+			}
+			peak = b[h : h+2*nAxis]
+			h += 2 * nAxis
+		} else {
+			j := int(index & gvarTupleIndexMask)
+			if j >= nShared {
+				return nil, FormatError(fmt.Sprintf("bad gvar shared tuple index: %d", j))
+			}
+			x := int(u32(f.gvar, 8)) + 2*nAxis*j
+			peak = f.gvar[x : x+2*nAxis]
+		}
+		if index&gvarIntermediateRegion != 0 {
+			if h+4*nAxis > len(b) {
+				return nil, FormatError("gvar data too short")
+			}
+			start, end = b[h:h+2*nAxis], b[h+2*nAxis:h+4*nAxis]
+			h += 4 * nAxis
+		}
+		if offset+size > len(b) {
+			return nil, FormatError("gvar data too short")
+		}
+		data := b[offset : offset+size]
+		offset += size
+		s := tupleScalar(g.coords, peak, start, end)
+		if s == 0 {
+			continue
+		}
+
+		// A nil slice of point numbers means all of the points.
+		points, x := shared, 0
+		if index&gvarPrivatePointNumbers != 0 {
+			var err error
+			if points, x, err = unpackPointNumbers(data, 0); err != nil {
+				return nil, err
+			}
+		}
+		m := len(points)
+		if points == nil {
+			m = len(ps)
+		}
+		xs, x, err := unpackDeltas(data, x, m)
+		if err != nil {
+			return nil, err
+		}
+		ys, _, err := unpackDeltas(data, x, m)
+		if err != nil {
+			return nil, err
+		}
+		if points == nil {
+			for j := range ps {
+				dx[j] += s * float64(xs[j])
+				dy[j] += s * float64(ys[j])
+			}
+			continue
+		}
+		for _, p := range points {
+			if p >= len(ps) {
+				return nil, FormatError(fmt.Sprintf("bad gvar point number: %d", p))
+			}
+		}
+		if ends == nil {
+			for k, p := range points {
+				dx[p] += s * float64(xs[k])
+				dy[p] += s * float64(ys[k])
+			}
+			continue
+		}
+		if tx == nil {
+			tx = make([]float64, len(ps))
+			ty = make([]float64, len(ps))
+			touched = make([]bool, len(ps))
+		} else {
+			for j := range ps {
+				tx[j], ty[j], touched[j] = 0, 0, false
+			}
+		}
+		for k, p := range points {
+			tx[p], ty[p], touched[p] = float64(xs[k]), float64(ys[k]), true
+		}
+		inferDeltas(tx, ps, touched, ends, func(p Point) int32 { return p.X })
+		inferDeltas(ty, ps, touched, ends, func(p Point) int32 { return p.Y })
+		for j := range ps {
+			dx[j] += s * tx[j]
+			dy[j] += s * ty[j]
+		}
+	}
+	deltas := make([]Point, len(ps))
+	for j := range deltas {
+		deltas[j].X = int32(math.Floor(dx[j] + 0.5))
+		deltas[j].Y = int32(math.Floor(dy[j] + 0.5))
+	}
+	return deltas, nil
+}
+
+// tupleScalar returns how much a tuple variation applies at the normalized
+// co-ordinates coords. peak, start and end are the tuple's peak and, if it
+// has an intermediate region, the region's start and end, as arrays of 2.14
+// fixed point numbers. start and end are nil if it has no intermediate
+// region.
+func tupleScalar(coords []int16, peak, start, end []byte) float64 {
+	s := 1.0
+	for k, c := range coords {
+		p := float64(int16(u16(peak, 2*k)))
+		if p == 0 {
+			continue
+		}
+		v := float64(c)
+		if v == 0 {
+			return 0
+		}
+		if start != nil {
+			s0, s1 := float64(int16(u16(start, 2*k))), float64(int16(u16(end, 2*k)))
+			if v < s0 || v > s1 {
+				return 0
+			}
+			if v < p {
+				s *= (v - s0) / (p - s0)
+			} else if v > p {
+				s *= (s1 - v) / (s1 - p)
+			}
+			continue
+		}
+		// Without an intermediate region, the tuple applies between zero
+		// and the peak.
+		if v < math.Min(0, p) || v > math.Max(0, p) {
+			return 0
+		}
+		s *= v / p
+	}
+	return s
+}
+
+// unpackPointNumbers unpacks the packed point numbers at b[offset:]. It also
+// returns the offset of the first byte after them. The point numbers are
+// nil if they mean all of the points.
+func unpackPointNumbers(b []byte, offset int) (points []int, offset1 int, err error) {
+	if offset >= len(b) {
+		return nil, 0, FormatError("gvar point numbers too short")
+	}
+	n := int(b[offset])
+	offset++
+	if n == 0 {
+		return nil, offset, nil
+	}
+	if n&0x80 != 0 {
+		if offset >= len(b) {
+			return nil, 0, FormatError("gvar point numbers too short")
+		}
+		n = (n&0x7f)<<8 | int(b[offset])
+		offset++
+	}
+	// The point numbers are in runs, each of which is a control byte and
+	// then either bytes or 16-bit words, which are deltas from the previous
+	// point number.
+	points = make([]int, 0, n)
+	p := 0
+	for len(points) < n {
+		if offset >= len(b) {
+			return nil, 0, FormatError("gvar point numbers too short")
+		}
+		c := b[offset]
+		offset++
+		for run := int(c&0x7f) + 1; run > 0 && len(points) < n; run-- {
+			if c&0x80 != 0 {
+				if offset+2 > len(b) {
+					return nil, 0, FormatError("gvar point numbers too short")
+				}
+				p += int(u16(b, offset))
+				offset += 2
+			} else {
+				if offset >= len(b) {
+					return nil, 0, FormatError("gvar point numbers too short")
+				}
+				p += int(b[offset])
+				offset++
+			}
+			points = append(points, p)
+		}
+	}
+	return points, offset, nil
+}
+
+// unpackDeltas unpacks n packed deltas at b[offset:]. It also returns the
+// offset of the first byte after them.
+func unpackDeltas(b []byte, offset, n int) (deltas []int32, offset1 int, err error) {
+	// The deltas are in runs, each of which is a control byte and then
+	// either nothing, for zeroes, or signed bytes or 16-bit words.
+	deltas = make([]int32, 0, n)
+	for len(deltas) < n {
+		if offset >= len(b) {
+			return nil, 0, FormatError("gvar deltas too short")
+		}
+		c := b[offset]
+		offset++
+		for run := int(c&0x3f) + 1; run > 0 && len(deltas) < n; run-- {
+			switch {
+			case c&0x80 != 0:
+				deltas = append(deltas, 0)
+			case c&0x40 != 0:
+				if offset+2 > len(b) {
+					return nil, 0, FormatError("gvar deltas too short")
+				}
+				deltas = append(deltas, int32(int16(u16(b, offset))))
+				offset += 2
+			default:
+				if offset >= len(b) {
+					return nil, 0, FormatError("gvar deltas too short")
+				}
+				deltas = append(deltas, int32(int8(b[offset])))
+				offset++
+			}
+		}
+	}
+	return deltas, offset, nil
+}
+
+// inferDeltas infers the deltas d of the points ps that are not touched,
+// along one axis, from the deltas of the touched points on the same
+// contour, similarly to the IUP instruction. The contours' ends are given
+// by ends, and the points' co-ordinates along the axis are given by c.
+// Points that are not on any contour, such as phantom points, are not
+// inferred.
+func inferDeltas(d []float64, ps []Point, touched []bool, ends []int, c func(Point) int32) {
+	e0 := 0
+	for _, e1 := range ends {
+		first := -1
+		for j := e0; j < e1; j++ {
+			if touched[j] {
+				first = j
+				break
+			}
+		}
+		if first < 0 {
+			e0 = e1
+			continue
+		}
+		// next returns the point after j on the contour.
+		next := func(j int) int {
+			if j+1 == e1 {
+				return e0
+			}
+			return j + 1
+		}
+		// Fill in the untouched points between each touched point and the
+		// next. If there is only one touched point, then that is all of the
+		// other points, and they are all shifted by the same delta.
+		for p0 := first; ; {
+			p1 := next(p0)
+			for !touched[p1] {
+				p1 = next(p1)
+			}
+			c0, c1, d0, d1 := c(ps[p0]), c(ps[p1]), d[p0], d[p1]
+			if c0 > c1 {
+				c0, c1, d0, d1 = c1, c0, d1, d0
+			}
+			for j := next(p0); j != p1; j = next(j) {
+				switch cj := c(ps[j]); {
+				case c0 == c1:
+					if d0 == d1 {
+						d[j] = d0
+					} else {
+						d[j] = 0
+					}
+				case cj <= c0:
+					d[j] = d0
+				case cj >= c1:
+					d[j] = d1
+				default:
+					d[j] = d0 + (d1-d0)*float64(cj-c0)/float64(c1-c0)
+				}
+			}
+			if p1 == first {
+				break
+			}
+			p0 = p1
+		}
+		e0 = e1
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements the flags and style bits of the head table, which is
+// documented at http://www.microsoft.com/typography/otspec/head.htm
+
+// HeadFlags are the flags of a font's head table.
+type HeadFlags uint16
+
+// The head table's flags.
+const (
+	// HeadFlagBaselineAtZero means that the font's baseline is at y = 0.
+	HeadFlagBaselineAtZero HeadFlags = 1 << 0
+	// HeadFlagLeftSideBearingAtZero means that every glyph's left side
+	// bearing point is at x = 0.
+	HeadFlagLeftSideBearingAtZero HeadFlags = 1 << 1
+	// HeadFlagInstructionsDependOnSize means that the font's hinting
+	// instructions may behave differently at different sizes.
+	HeadFlagInstructionsDependOnSize HeadFlags = 1 << 2
+	// HeadFlagIntegerPPEM means that the font expects to be scaled to a
+	// whole number of pixels per em, so that a scale passed to a Font's
+	// methods should be a multiple of 64.
+	HeadFlagIntegerPPEM HeadFlags = 1 << 3
+	// HeadFlagInstructionsAlterAdvance means that the font's hinting
+	// instructions may change a glyph's advance width.
+	HeadFlagInstructionsAlterAdvance HeadFlags = 1 << 4
+	// HeadFlagLossless means that the font's data has been compressed and
+	// decompressed losslessly, for example by MicroType Express.
+	HeadFlagLossless HeadFlags = 1 << 11
+	// HeadFlagConverted means that the font has been converted to produce
+	// compatible metrics.
+	HeadFlagConverted HeadFlags = 1 << 12
+	// HeadFlagClearType means that the font is optimized for ClearType.
+	HeadFlagClearType HeadFlags = 1 << 13
+	// HeadFlagLastResort means that the font's glyphs are generic symbols
+	// for code point ranges, rather than glyphs for the code points.
+	HeadFlagLastResort HeadFlags = 1 << 14
+)
+
+// MacStyle is the macStyle bits of a font's head table.
+type MacStyle uint16
+
+// The head table's macStyle bits.
+const (
+	MacStyleBold      MacStyle = 1 << 0
+	MacStyleItalic    MacStyle = 1 << 1
+	MacStyleUnderline MacStyle = 1 << 2
+	MacStyleOutline   MacStyle = 1 << 3
+	MacStyleShadow    MacStyle = 1 << 4
+	MacStyleCondensed MacStyle = 1 << 5
+	MacStyleExtended  MacStyle = 1 << 6
+)
+
+// Flags returns the flags of the font's head table.
+func (f *Font) Flags() HeadFlags {
+	return HeadFlags(u16(f.head, 16))
+}
+
+// MacStyle returns the macStyle bits of the font's head table.
+func (f *Font) MacStyle() MacStyle {
+	return MacStyle(u16(f.head, 44))
+}
+
+// IndexToLocFormat returns the indexToLocFormat of the font's head table,
+// which is 0 if the loca table holds 16-bit offsets and 1 if it holds 32-bit
+// offsets.
+func (f *Font) IndexToLocFormat() int {
+	if f.locaOffsetFormat == locaOffsetFormatLong {
+		return 1
+	}
+	return 0
+}
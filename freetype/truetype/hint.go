@@ -10,6 +10,23 @@ package truetype
 
 import (
 	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	twilightZone = 0
+	glyphZone    = 1
+	numZone      = 2
+)
+
+type pointType uint32
+
+const (
+	current      pointType = 0
+	unhinted     pointType = 1
+	inFontUnits  pointType = 2
+	numPointType           = 3
 )
 
 // callStackEntry is a bytecode call stack entry.
@@ -21,18 +38,21 @@ type callStackEntry struct {
 
 // Hinter implements bytecode hinting. Pass a Hinter to GlyphBuf.Load to hint
 // the resulting glyph. A Hinter can be re-used to hint a series of glyphs from
-// a Font.
+// a Font. The zero value is ready to use, and Font.Hinter returns a Hinter
+// that has already run the font's fpgm bytecode.
+//
+// A Hinter holds all of the interpreter's state, such as its stack, storage
+// area and function definitions, so it must not be used by multiple
+// goroutines concurrently. Each goroutine should have its own Hinter.
 type Hinter struct {
 	stack, store []int32
 
 	// functions is a map from function number to bytecode.
 	functions map[int32][]byte
 
-	// g, font and scale are the glyph buffer, font and scale last used for
-	// this Hinter. Changing the font will require running the new font's
-	// fpgm bytecode. Changing either will require running the font's prep
-	// bytecode.
-	g     *GlyphBuf
+	// font and scale are the font and scale last used for this Hinter.
+	// Changing the font will require running the new font's fpgm bytecode.
+	// Changing either will require running the font's prep bytecode.
 	font  *Font
 	scale int32
 
@@ -40,6 +60,24 @@ type Hinter struct {
 	// default graphics state is the global default graphics state after
 	// the font's fpgm and prep programs have been run.
 	gs, defaultGS graphicsState
+
+	// points and ends are the twilight zone's points, the glyph's points
+	// and the glyph's contour boundaries, as used by the bytecode. The
+	// twilight zone's points persist from one glyph to the next, and are
+	// reset whenever the prep bytecode is run. The glyph zone holds the
+	// points of the glyph, or compound glyph component, being hinted,
+	// followed by its four phantom points.
+	points [numZone][numPointType][]Point
+	ends   []int
+
+	// compound is whether the glyph being hinted is a compound glyph. A
+	// compound glyph's instructions apply to its already scaled and hinted
+	// components, so its "in font units" points are not in FUnits.
+	compound bool
+
+	// scaledCVT is the lazily initialized scaled Control Value Table.
+	scaledCVTInitialized bool
+	scaledCVT            []f26dot6
 }
 
 // graphicsState is described at https://developer.apple.com/fonts/TTRefMan/RM04/Chap4.html
@@ -60,6 +98,8 @@ type graphicsState struct {
 	roundPeriod, roundPhase, roundThreshold f26dot6
 	// Auto-flip.
 	autoFlip bool
+	// Instruction control, as set by INSTCTRL in the prep bytecode.
+	instructControl int32
 }
 
 var globalDefaultGS = graphicsState{
@@ -77,44 +117,94 @@ var globalDefaultGS = graphicsState{
 	autoFlip:          true,
 }
 
-func (h *Hinter) init(g *GlyphBuf, f *Font, scale int32) error {
-	h.g = g
+// Hinter returns a Hinter for hinting the font's glyphs, which has already
+// run the font's fpgm bytecode, the font program. The Hinter runs the prep
+// bytecode, the control value program, once for each scale at which glyphs
+// are then loaded, so that re-using it for a series of glyphs at one scale
+// runs neither program again. Like any Hinter, the returned Hinter must not
+// be used by multiple goroutines concurrently.
+func (f *Font) Hinter() (*Hinter, error) {
+	h := &Hinter{}
+	if err := h.setFont(f); err != nil {
+		return nil, err
+	}
+	// No scale is valid yet, so that loading a glyph at any scale, even
+	// zero, runs the prep bytecode.
+	h.scale = -1
+	return h, nil
+}
 
-	rescale := h.scale != scale
-	if h.font != f {
-		h.font, rescale = f, true
-		if h.functions == nil {
-			h.functions = make(map[int32][]byte)
-		} else {
-			for k := range h.functions {
-				delete(h.functions, k)
-			}
+// setFont sets the font used by this Hinter, and runs its fpgm bytecode.
+func (h *Hinter) setFont(f *Font) error {
+	h.font = f
+	if h.functions == nil {
+		h.functions = make(map[int32][]byte)
+	} else {
+		for k := range h.functions {
+			delete(h.functions, k)
 		}
+	}
 
-		if x := int(f.maxStackElements); x > len(h.stack) {
-			x += 255
-			x &^= 255
-			h.stack = make([]int32, x)
+	if x := int(f.maxStackElements); x > len(h.stack) {
+		x += 255
+		x &^= 255
+		h.stack = make([]int32, x)
+	}
+	if x := int(f.maxStorage); x > len(h.store) {
+		x += 15
+		x &^= 15
+		h.store = make([]int32, x)
+	}
+	// As per the C Freetype code, the twilight zone has four more points
+	// than the maxp table asks for, for its phantom points.
+	n := int(f.maxTwilightPoints) + 4
+	for i := range h.points[twilightZone] {
+		if n <= cap(h.points[twilightZone][i]) {
+			h.points[twilightZone][i] = h.points[twilightZone][i][:n]
+		} else {
+			h.points[twilightZone][i] = make([]Point, n)
 		}
-		if x := int(f.maxStorage); x > len(h.store) {
-			x += 15
-			x &^= 15
-			h.store = make([]int32, x)
+	}
+	if len(f.fpgm) != 0 {
+		if err := h.run(f.fpgm, nil, nil, nil, nil); err != nil {
+			return err
 		}
-		if len(f.fpgm) != 0 {
-			if err := h.run(f.fpgm); err != nil {
-				return err
-			}
+	}
+	return nil
+}
+
+// init prepares the Hinter to hint f's glyphs at the given scale. The fpgm
+// bytecode is run when the font changes, and the prep bytecode, which may
+// adjust the scaled Control Value Table, is run when either the font or the
+// scale changes. Otherwise, the state left by the last run is re-used.
+func (h *Hinter) init(f *Font, scale int32) error {
+	rescale := h.scale != scale
+	if h.font != f {
+		rescale = true
+		if err := h.setFont(f); err != nil {
+			return err
 		}
 	}
 
 	if rescale {
 		h.scale = scale
+		h.scaledCVTInitialized = false
+
+		// The storage area and the twilight zone's points start out as
+		// zero for each new scale.
+		for i := range h.store {
+			h.store[i] = 0
+		}
+		for i := range h.points[twilightZone] {
+			for j := range h.points[twilightZone][i] {
+				h.points[twilightZone][i][j] = Point{}
+			}
+		}
 
 		h.defaultGS = globalDefaultGS
 
 		if len(f.prep) != 0 {
-			if err := h.run(f.prep); err != nil {
+			if err := h.run(f.prep, nil, nil, nil, nil); err != nil {
 				return err
 			}
 			h.defaultGS = h.gs
@@ -126,13 +216,25 @@ func (h *Hinter) init(g *GlyphBuf, f *Font, scale int32) error {
 			h.defaultGS.rp = globalDefaultGS.rp
 			h.defaultGS.zp = globalDefaultGS.zp
 			h.defaultGS.loop = globalDefaultGS.loop
+			// As per the C Freetype code, each glyph's bytecode starts
+			// out rounding to the grid.
+			h.defaultGS.roundPeriod = globalDefaultGS.roundPeriod
+			h.defaultGS.roundPhase = globalDefaultGS.roundPhase
+			h.defaultGS.roundThreshold = globalDefaultGS.roundThreshold
 		}
 	}
 	return nil
 }
 
-func (h *Hinter) run(program []byte) error {
+// run runs the given bytecode program. The pCurrent, pUnhinted and
+// pInFontUnits points, and the ends contour boundaries, make up the glyph
+// zone. They are nil when running the fpgm or prep bytecode.
+func (h *Hinter) run(program []byte, pCurrent, pUnhinted, pInFontUnits []Point, ends []int) error {
 	h.gs = h.defaultGS
+	h.points[glyphZone][current] = pCurrent
+	h.points[glyphZone][unhinted] = pUnhinted
+	h.points[glyphZone][inFontUnits] = pInFontUnits
+	h.ends = ends
 
 	if len(program) > 50000 {
 		return errors.New("truetype: hinting: too many instructions")
@@ -152,7 +254,7 @@ func (h *Hinter) run(program []byte) error {
 		}
 		opcode = program[pc]
 		if popCount[opcode] == q {
-			return errors.New("truetype: hinting: unimplemented instruction")
+			return fmt.Errorf("truetype: hinting: unimplemented instruction 0x%02x", opcode)
 		}
 		if top < int(popCount[opcode]) {
 			return errors.New("truetype: hinting: stack underflow")
@@ -183,18 +285,41 @@ func (h *Hinter) run(program []byte) error {
 		case opSFVTCA1:
 			h.gs.fv = [2]f2dot14{0x4000, 0}
 
+		case opSPVTL0, opSPVTL1, opSFVTL0, opSFVTL1:
+			top -= 2
+			p1 := h.point(1, current, h.stack[top+0])
+			p2 := h.point(2, current, h.stack[top+1])
+			if p1 == nil || p2 == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			dx := p1.X - p2.X
+			dy := p1.Y - p2.Y
+			if dx == 0 && dy == 0 {
+				dx = 0x4000
+			} else if opcode&1 != 0 {
+				// Counter-clockwise rotation.
+				dx, dy = -dy, dx
+			}
+			v := normalize(dx, dy)
+			if opcode < opSFVTL0 {
+				h.gs.pv = v
+				h.gs.dv = v
+			} else {
+				h.gs.fv = v
+			}
+
 		case opSPVFS:
 			top -= 2
-			h.gs.pv[0] = f2dot14(h.stack[top+0])
-			h.gs.pv[1] = f2dot14(h.stack[top+1])
-			// TODO: normalize h.gs.pv ??
-			// TODO: h.gs.dv = h.gs.pv ??
+			if v, ok := normalizeOK(int32(int16(h.stack[top])), int32(int16(h.stack[top+1]))); ok {
+				h.gs.pv = v
+				h.gs.dv = v
+			}
 
 		case opSFVFS:
 			top -= 2
-			h.gs.fv[0] = f2dot14(h.stack[top+0])
-			h.gs.fv[1] = f2dot14(h.stack[top+1])
-			// TODO: normalize h.gs.fv ??
+			if v, ok := normalizeOK(int32(int16(h.stack[top])), int32(int16(h.stack[top+1]))); ok {
+				h.gs.fv = v
+			}
 
 		case opGPV:
 			if top+1 >= len(h.stack) {
@@ -215,16 +340,53 @@ func (h *Hinter) run(program []byte) error {
 		case opSFVTPV:
 			h.gs.fv = h.gs.pv
 
+		case opISECT:
+			top -= 5
+			p := h.point(2, current, h.stack[top+0])
+			a0 := h.point(1, current, h.stack[top+1])
+			a1 := h.point(1, current, h.stack[top+2])
+			b0 := h.point(0, current, h.stack[top+3])
+			b1 := h.point(0, current, h.stack[top+4])
+			if p == nil || a0 == nil || a1 == nil || b0 == nil || b1 == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+
+			dbx := b1.X - b0.X
+			dby := b1.Y - b0.Y
+			dax := a1.X - a0.X
+			day := a1.Y - a0.Y
+			dx := b0.X - a0.X
+			dy := b0.Y - a0.Y
+			discriminant := mulDiv(int64(dax), int64(-dby), 0x40) +
+				mulDiv(int64(day), int64(dbx), 0x40)
+			if discriminant >= 0x40 || discriminant <= -0x40 {
+				val := mulDiv(int64(dx), int64(-dby), 0x40) + mulDiv(int64(dy), int64(dbx), 0x40)
+				p.X = a0.X + int32(mulDiv(val, int64(dax), discriminant))
+				p.Y = a0.Y + int32(mulDiv(val, int64(day), discriminant))
+			} else {
+				// The lines are (nearly) parallel, so take the middle of
+				// the middles of A and B.
+				p.X = (a0.X + a1.X + b0.X + b1.X) / 4
+				p.Y = (a0.Y + a1.Y + b0.Y + b1.Y) / 4
+			}
+			p.Flags |= flagTouchedX | flagTouchedY
+
 		case opSRP0, opSRP1, opSRP2:
 			top--
 			h.gs.rp[opcode-opSRP0] = h.stack[top]
 
 		case opSZP0, opSZP1, opSZP2:
 			top--
+			if h.stack[top] != twilightZone && h.stack[top] != glyphZone {
+				return errors.New("truetype: hinting: invalid data")
+			}
 			h.gs.zp[opcode-opSZP0] = h.stack[top]
 
 		case opSZPS:
 			top--
+			if h.stack[top] != twilightZone && h.stack[top] != glyphZone {
+				return errors.New("truetype: hinting: invalid data")
+			}
 			h.gs.zp[0] = h.stack[top]
 			h.gs.zp[1] = h.stack[top]
 			h.gs.zp[2] = h.stack[top]
@@ -268,8 +430,9 @@ func (h *Hinter) run(program []byte) error {
 			h.gs.singleWidthCutIn = f26dot6(h.stack[top])
 
 		case opSSW:
+			// The single width value is given in FUnits.
 			top--
-			h.gs.singleWidth = f26dot6(h.stack[top])
+			h.gs.singleWidth = f26dot6(h.font.scale(h.scale * h.stack[top]))
 
 		case opDUP:
 			if top >= len(h.stack) {
@@ -305,6 +468,30 @@ func (h *Hinter) run(program []byte) error {
 				top--
 			}
 
+		case opALIGNPTS:
+			top -= 2
+			p := h.point(1, current, h.stack[top])
+			q := h.point(0, current, h.stack[top+1])
+			if p == nil || q == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			d := dotProduct(f26dot6(q.X-p.X), f26dot6(q.Y-p.Y), h.gs.pv) / 2
+			h.move(p, +d, true)
+			h.move(q, -d, true)
+
+		case opUTP:
+			top--
+			p := h.point(0, current, h.stack[top])
+			if p == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			if h.gs.fv[0] != 0 {
+				p.Flags &^= flagTouchedX
+			}
+			if h.gs.fv[1] != 0 {
+				p.Flags &^= flagTouchedY
+			}
+
 		case opLOOPCALL, opCALL:
 			if callStackTop >= len(callStack) {
 				return errors.New("truetype: hinting: call stack overflow")
@@ -365,41 +552,224 @@ func (h *Hinter) run(program []byte) error {
 			program, pc = callStack[callStackTop].program, callStack[callStackTop].pc
 
 		case opMDAP0, opMDAP1:
-			points := h.g.points(h.gs.zp[0])
 			top--
-			i := int(h.stack[top])
-			if i < 0 || len(points) <= i {
+			i := h.stack[top]
+			p := h.point(0, current, i)
+			if p == nil {
 				return errors.New("truetype: hinting: point out of range")
 			}
-			p := &points[i]
 			distance := f26dot6(0)
 			if opcode == opMDAP1 {
 				distance = dotProduct(f26dot6(p.X), f26dot6(p.Y), h.gs.pv)
 				// TODO: metrics compensation.
 				distance = h.round(distance) - distance
 			}
-			h.move(p, distance)
-			h.gs.rp[0] = int32(i)
-			h.gs.rp[1] = int32(i)
+			h.move(p, distance, true)
+			h.gs.rp[0] = i
+			h.gs.rp[1] = i
+
+		case opIUP0, opIUP1:
+			interpY, mask := opcode == opIUP0, uint32(flagTouchedX)
+			if interpY {
+				mask = flagTouchedY
+			}
+			points := h.points[glyphZone][current]
+			prevEnd := 0
+			for _, end := range h.ends {
+				// Find the contour's first touched point. A contour with no
+				// touched points is left unchanged.
+				i := prevEnd
+				for i < end && points[i].Flags&mask == 0 {
+					i++
+				}
+				if i == end {
+					prevEnd = end
+					continue
+				}
+				firstTouched, curTouched := i, i
+				for i++; i < end; i++ {
+					if points[i].Flags&mask != 0 {
+						h.iupInterp(interpY, curTouched+1, i-1, curTouched, i)
+						curTouched = i
+					}
+				}
+				if curTouched == firstTouched {
+					h.iupShift(interpY, prevEnd, end, curTouched)
+				} else {
+					// Wrap around from the last touched point to the first.
+					h.iupInterp(interpY, curTouched+1, end-1, curTouched, firstTouched)
+					h.iupInterp(interpY, prevEnd, firstTouched-1, curTouched, firstTouched)
+				}
+				prevEnd = end
+			}
+
+		case opSHP0, opSHP1:
+			if top < int(h.gs.loop) {
+				return errors.New("truetype: hinting: stack underflow")
+			}
+			_, _, d, ok := h.displacement(opcode&1 == 0)
+			if !ok {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			for ; h.gs.loop != 0; h.gs.loop-- {
+				top--
+				p := h.point(2, current, h.stack[top])
+				if p == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				h.move(p, d, true)
+			}
+			h.gs.loop = 1
+
+		case opSHC0, opSHC1:
+			top--
+			zonePointer, i, d, ok := h.displacement(opcode&1 == 0)
+			if !ok {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			contour := h.stack[top]
+			if contour < 0 || len(h.ends) <= int(contour) {
+				return errors.New("truetype: hinting: contour out of range")
+			}
+			j0, j1 := int32(0), int32(h.ends[contour])
+			if contour > 0 {
+				j0 = int32(h.ends[contour-1])
+			}
+			// The contour is always one of the glyph zone's, but, as per C
+			// Freetype, its points are moved in the zone pointed to by zp2.
+			if n := int32(len(h.points[h.gs.zp[2]][current])); j1 > n {
+				j1 = n
+			}
+			move := h.gs.zp[zonePointer] != h.gs.zp[2]
+			for j := j0; j < j1; j++ {
+				if move || j != i {
+					h.move(h.point(2, current, j), d, true)
+				}
+			}
+
+		case opSHZ0, opSHZ1:
+			top--
+			zonePointer, i, d, ok := h.displacement(opcode&1 == 0)
+			if !ok {
+				return errors.New("truetype: hinting: point out of range")
+			}
+
+			// As per C Freetype, SHZ doesn't move the phantom points, or
+			// mark moved points as touched.
+			limit := int32(len(h.points[h.gs.zp[2]][current]))
+			if h.gs.zp[2] == glyphZone && limit >= 4 {
+				limit -= 4
+			}
+			for j := int32(0); j < limit; j++ {
+				if i != j || h.gs.zp[zonePointer] != h.gs.zp[2] {
+					h.move(h.point(2, current, j), d, false)
+				}
+			}
+
+		case opSHPIX:
+			top--
+			d := f26dot6(h.stack[top])
+			if top < int(h.gs.loop) {
+				return errors.New("truetype: hinting: stack underflow")
+			}
+			for ; h.gs.loop != 0; h.gs.loop-- {
+				top--
+				p := h.point(2, current, h.stack[top])
+				if p == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				p.X += int32(mulFix14(d, h.gs.fv[0]))
+				p.Y += int32(mulFix14(d, h.gs.fv[1]))
+				p.Flags |= touchedFlags(h.gs.fv)
+			}
+			h.gs.loop = 1
+
+		case opIP:
+			if top < int(h.gs.loop) {
+				return errors.New("truetype: hinting: stack underflow")
+			}
+			pointType := inFontUnits
+			twilight := h.gs.zp[0] == 0 || h.gs.zp[1] == 0 || h.gs.zp[2] == 0
+			if twilight {
+				pointType = unhinted
+			}
+			ref1 := h.point(0, current, h.gs.rp[1])
+			ref2 := h.point(1, current, h.gs.rp[2])
+			orig1 := h.point(0, pointType, h.gs.rp[1])
+			orig2 := h.point(1, pointType, h.gs.rp[2])
+			if ref1 == nil || ref2 == nil || orig1 == nil || orig2 == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			oldRange := dotProduct(f26dot6(orig2.X-orig1.X), f26dot6(orig2.Y-orig1.Y), h.gs.dv)
+			curRange := dotProduct(f26dot6(ref2.X-ref1.X), f26dot6(ref2.Y-ref1.Y), h.gs.pv)
+			for ; h.gs.loop != 0; h.gs.loop-- {
+				top--
+				i := h.stack[top]
+				p := h.point(2, current, i)
+				orig := h.point(2, pointType, i)
+				if p == nil || orig == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				origDist := dotProduct(f26dot6(orig.X-orig1.X), f26dot6(orig.Y-orig1.Y), h.gs.dv)
+				curDist := dotProduct(f26dot6(p.X-ref1.X), f26dot6(p.Y-ref1.Y), h.gs.pv)
+				newDist := f26dot6(0)
+				if origDist != 0 {
+					if oldRange != 0 {
+						newDist = f26dot6(mulDiv(int64(origDist), int64(curRange), int64(oldRange)))
+					} else {
+						newDist = curDist
+					}
+				}
+				h.move(p, newDist-curDist, true)
+			}
+			h.gs.loop = 1
+
+		case opMSIRP0, opMSIRP1:
+			top -= 2
+			i := h.stack[top]
+			distance := f26dot6(h.stack[top+1])
+
+			ref := h.point(0, current, h.gs.rp[0])
+			p := h.point(1, current, i)
+			if ref == nil || p == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			if h.gs.zp[1] == twilightZone {
+				// As per C Freetype, a twilight point starts out at the
+				// unhinted reference point, moved by distance along the
+				// freedom vector.
+				orig := h.point(1, unhinted, i)
+				*orig = *h.point(0, unhinted, h.gs.rp[0])
+				h.move(orig, distance, false)
+				*p = *orig
+			}
+			curDist := dotProduct(f26dot6(p.X-ref.X), f26dot6(p.Y-ref.Y), h.gs.pv)
+
+			// Set-RP0 bit.
+			h.gs.rp[1] = h.gs.rp[0]
+			h.gs.rp[2] = i
+			if opcode == opMSIRP1 {
+				h.gs.rp[0] = i
+			}
+
+			// Move the point.
+			h.move(p, distance-curDist, true)
 
 		case opALIGNRP:
 			if top < int(h.gs.loop) {
 				return errors.New("truetype: hinting: stack underflow")
 			}
-			i, points := int(h.gs.rp[0]), h.g.points(h.gs.zp[0])
-			if i < 0 || len(points) <= i {
+			ref := h.point(0, current, h.gs.rp[0])
+			if ref == nil {
 				return errors.New("truetype: hinting: point out of range")
 			}
-			ref := &points[i]
-			points = h.g.points(h.gs.zp[1])
 			for ; h.gs.loop != 0; h.gs.loop-- {
 				top--
-				i = int(h.stack[top])
-				if i < 0 || len(points) <= i {
+				p := h.point(1, current, h.stack[top])
+				if p == nil {
 					return errors.New("truetype: hinting: point out of range")
 				}
-				p := &points[i]
-				h.move(p, -dotProduct(f26dot6(p.X-ref.X), f26dot6(p.Y-ref.Y), h.gs.pv))
+				h.move(p, -dotProduct(f26dot6(p.X-ref.X), f26dot6(p.Y-ref.Y), h.gs.pv), true)
 			}
 			h.gs.loop = 1
 
@@ -408,6 +778,37 @@ func (h *Hinter) run(program []byte) error {
 			h.gs.roundPhase = 0
 			h.gs.roundThreshold = 1 << 4
 
+		case opMIAP0, opMIAP1:
+			top -= 2
+			i := h.stack[top]
+			distance, ok := h.getScaledCVT(h.stack[top+1])
+			if !ok {
+				return errors.New("truetype: hinting: CVT entry out of range")
+			}
+			p := h.point(0, current, i)
+			if p == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			if h.gs.zp[0] == twilightZone {
+				// As per C Freetype, a twilight point is first placed at
+				// the CVT distance along the freedom vector.
+				orig := h.point(0, unhinted, i)
+				orig.X = int32(mulFix14(distance, h.gs.fv[0]))
+				orig.Y = int32(mulFix14(distance, h.gs.fv[1]))
+				*p = *orig
+			}
+			curDist := dotProduct(f26dot6(p.X), f26dot6(p.Y), h.gs.pv)
+			if opcode == opMIAP1 {
+				if (distance - curDist).abs() > h.gs.controlValueCutIn {
+					distance = curDist
+				}
+				// TODO: metrics compensation.
+				distance = h.round(distance)
+			}
+			h.move(p, distance-curDist, true)
+			h.gs.rp[0] = i
+			h.gs.rp[1] = i
+
 		case opNPUSHB:
 			opcode = 0
 			goto push
@@ -431,6 +832,81 @@ func (h *Hinter) run(program []byte) error {
 			}
 			h.stack[top-1] = h.store[i]
 
+		case opWCVTP:
+			top -= 2
+			if !h.setScaledCVT(h.stack[top], f26dot6(h.stack[top+1])) {
+				return errors.New("truetype: hinting: CVT entry out of range")
+			}
+
+		case opRCVT:
+			x, ok := h.getScaledCVT(h.stack[top-1])
+			if !ok {
+				return errors.New("truetype: hinting: CVT entry out of range")
+			}
+			h.stack[top-1] = int32(x)
+
+		case opGC0, opGC1:
+			i := h.stack[top-1]
+			if opcode == opGC0 {
+				p := h.point(2, current, i)
+				if p == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				h.stack[top-1] = int32(dotProduct(f26dot6(p.X), f26dot6(p.Y), h.gs.pv))
+			} else {
+				p := h.point(2, unhinted, i)
+				if p == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				// Using dv as per C Freetype.
+				h.stack[top-1] = int32(dotProduct(f26dot6(p.X), f26dot6(p.Y), h.gs.dv))
+			}
+
+		case opSCFS:
+			top -= 2
+			i := h.stack[top]
+			p := h.point(2, current, i)
+			if p == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			c := dotProduct(f26dot6(p.X), f26dot6(p.Y), h.gs.pv)
+			h.move(p, f26dot6(h.stack[top+1])-c, true)
+			if h.gs.zp[2] == twilightZone {
+				// As per C Freetype, SCFS also sets a twilight point's
+				// unhinted position.
+				*h.point(2, unhinted, i) = *p
+			}
+
+		case opMD0, opMD1:
+			top--
+			i, j := h.stack[top-1], h.stack[top]
+			// As per C Freetype, the flag's meaning is inverted from the
+			// spec: MD[1] measures the grid-fitted outline, and MD[0]
+			// measures the original outline.
+			if opcode == opMD1 {
+				p := h.point(0, current, i)
+				q := h.point(1, current, j)
+				if p == nil || q == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				h.stack[top-1] = int32(dotProduct(f26dot6(p.X-q.X), f26dot6(p.Y-q.Y), h.gs.pv))
+			} else if h.gs.zp[0] == twilightZone || h.gs.zp[1] == twilightZone {
+				p := h.point(0, unhinted, i)
+				q := h.point(1, unhinted, j)
+				if p == nil || q == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				h.stack[top-1] = int32(dotProduct(f26dot6(p.X-q.X), f26dot6(p.Y-q.Y), h.gs.dv))
+			} else {
+				p := h.point(0, inFontUnits, i)
+				q := h.point(1, inFontUnits, j)
+				if p == nil || q == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				d := dotProduct(f26dot6(p.X-q.X), f26dot6(p.Y-q.Y), h.gs.dv)
+				h.stack[top-1] = int32(h.scaleFUnits(d))
+			}
+
 		case opMPPEM, opMPS:
 			if top >= len(h.stack) {
 				return errors.New("truetype: hinting: stack overflow")
@@ -494,6 +970,9 @@ func (h *Hinter) run(program []byte) error {
 		case opNOT:
 			h.stack[top-1] = bool2int32(h.stack[top-1] == 0)
 
+		case opDELTAP1:
+			goto delta
+
 		case opSDB:
 			top--
 			h.gs.deltaBase = h.stack[top]
@@ -548,21 +1027,34 @@ func (h *Hinter) run(program []byte) error {
 			// This code does not implement engine compensation, as we don't expect to
 			// be used to output on dot-matrix printers.
 
+		case opWCVTF:
+			top -= 2
+			// The CVT value is given in FUnits.
+			x := f26dot6(h.font.scale(h.scale * h.stack[top+1]))
+			if !h.setScaledCVT(h.stack[top], x) {
+				return errors.New("truetype: hinting: CVT entry out of range")
+			}
+
+		case opDELTAP2, opDELTAP3, opDELTAC1, opDELTAC2, opDELTAC3:
+			goto delta
+
 		case opSROUND, opS45ROUND:
 			top--
+			// The period, phase and threshold are calculated as 2.14 fixed
+			// point numbers, as per C Freetype, and then converted to 26.6.
+			gridPeriod := f26dot6(0x4000)
+			if opcode == opS45ROUND {
+				// The spec says to multiply by √2, but the C Freetype code says 1/√2.
+				// We go with 1/√2.
+				gridPeriod = 0x2d41
+			}
 			switch (h.stack[top] >> 6) & 0x03 {
 			case 0:
-				h.gs.roundPeriod = 1 << 5
+				h.gs.roundPeriod = gridPeriod / 2
 			case 1, 3:
-				h.gs.roundPeriod = 1 << 6
+				h.gs.roundPeriod = gridPeriod
 			case 2:
-				h.gs.roundPeriod = 1 << 7
-			}
-			if opcode == opS45ROUND {
-				// The spec says to multiply by √2, but the C Freetype code says 1/√2.
-				// We go with 1/√2.
-				h.gs.roundPeriod *= 46341
-				h.gs.roundPeriod /= 65536
+				h.gs.roundPeriod = gridPeriod * 2
 			}
 			h.gs.roundPhase = h.gs.roundPeriod * f26dot6((h.stack[top]>>4)&0x03) / 4
 			if x := h.stack[top] & 0x0f; x != 0 {
@@ -570,6 +1062,9 @@ func (h *Hinter) run(program []byte) error {
 			} else {
 				h.gs.roundThreshold = h.gs.roundPeriod - 1
 			}
+			h.gs.roundPeriod /= 256
+			h.gs.roundPhase /= 256
+			h.gs.roundThreshold /= 256
 
 		case opJROT:
 			top -= 2
@@ -604,10 +1099,68 @@ func (h *Hinter) run(program []byte) error {
 			// These ops are "anachronistic" and no longer used.
 			top--
 
+		case opFLIPPT:
+			if top < int(h.gs.loop) {
+				return errors.New("truetype: hinting: stack underflow")
+			}
+			// As per C Freetype, FLIPPT always works on the glyph zone.
+			points := h.points[glyphZone][current]
+			for ; h.gs.loop != 0; h.gs.loop-- {
+				top--
+				i := int(h.stack[top])
+				if i < 0 || len(points) <= i {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				points[i].Flags ^= flagOnCurve
+			}
+			h.gs.loop = 1
+
+		case opFLIPRGON, opFLIPRGOFF:
+			top -= 2
+			i, j := int(h.stack[top]), int(h.stack[top+1])
+			points := h.points[glyphZone][current]
+			if i < 0 || len(points) <= i || j < 0 || len(points) <= j {
+				return errors.New("truetype: hinting: point out of range")
+			}
+			for ; i <= j; i++ {
+				if opcode == opFLIPRGON {
+					points[i].Flags |= flagOnCurve
+				} else {
+					points[i].Flags &^= flagOnCurve
+				}
+			}
+
 		case opSCANCTRL:
 			// We do not support dropout control, as we always rasterize grayscale glyphs.
 			top--
 
+		case opSDPVTL0, opSDPVTL1:
+			top -= 2
+			for i := 0; i < 2; i++ {
+				pt := unhinted
+				if i != 0 {
+					pt = current
+				}
+				p := h.point(1, pt, h.stack[top])
+				q := h.point(2, pt, h.stack[top+1])
+				if p == nil || q == nil {
+					return errors.New("truetype: hinting: point out of range")
+				}
+				dx := p.X - q.X
+				dy := p.Y - q.Y
+				if dx == 0 && dy == 0 {
+					dx = 0x4000
+				} else if opcode&1 != 0 {
+					// Counter-clockwise rotation.
+					dx, dy = -dy, dx
+				}
+				if i == 0 {
+					h.gs.dv = normalize(dx, dy)
+				} else {
+					h.gs.pv = normalize(dx, dy)
+				}
+			}
+
 		case opGETINFO:
 			res := int32(0)
 			if h.stack[top-1]&(1<<0) != 0 {
@@ -647,6 +1200,19 @@ func (h *Hinter) run(program []byte) error {
 			// We do not support dropout control, as we always rasterize grayscale glyphs.
 			top--
 
+		case opINSTCTRL:
+			// Only the prep bytecode's instruction control has any effect.
+			// See runGlyph.
+			top -= 2
+			selector, value := h.stack[top+1], h.stack[top]
+			if selector < 1 || 2 < selector {
+				return errors.New("truetype: hinting: invalid data")
+			}
+			if value != 0 {
+				value = selector
+			}
+			h.gs.instructControl = h.gs.instructControl&^selector | value
+
 		case opPUSHB000, opPUSHB001, opPUSHB010, opPUSHB011,
 			opPUSHB100, opPUSHB101, opPUSHB110, opPUSHB111:
 
@@ -669,37 +1235,32 @@ func (h *Hinter) run(program []byte) error {
 			opMDRP11000, opMDRP11001, opMDRP11010, opMDRP11011,
 			opMDRP11100, opMDRP11101, opMDRP11110, opMDRP11111:
 
-			i, points := int(h.gs.rp[0]), h.g.points(h.gs.zp[0])
-			if i < 0 || len(points) <= i {
-				return errors.New("truetype: hinting: point out of range")
-			}
-			ref := &points[i]
 			top--
-			i = int(h.stack[top])
-			points = h.g.points(h.gs.zp[1])
-			if i < 0 || len(points) <= i {
+			i := h.stack[top]
+			ref := h.point(0, current, h.gs.rp[0])
+			p := h.point(1, current, i)
+			if ref == nil || p == nil {
 				return errors.New("truetype: hinting: point out of range")
 			}
-			p := &points[i]
 
 			origDist := f26dot6(0)
-			if h.gs.zp[0] == 0 && h.gs.zp[1] == 0 {
-				p0 := &h.g.Unhinted[i]
-				p1 := &h.g.Unhinted[h.gs.rp[0]]
+			if h.gs.zp[0] == twilightZone || h.gs.zp[1] == twilightZone {
+				p0 := h.point(1, unhinted, i)
+				p1 := h.point(0, unhinted, h.gs.rp[0])
 				origDist = dotProduct(f26dot6(p0.X-p1.X), f26dot6(p0.Y-p1.Y), h.gs.dv)
 			} else {
-				p0 := &h.g.InFontUnits[i]
-				p1 := &h.g.InFontUnits[h.gs.rp[0]]
+				p0 := h.point(1, inFontUnits, i)
+				p1 := h.point(0, inFontUnits, h.gs.rp[0])
 				origDist = dotProduct(f26dot6(p0.X-p1.X), f26dot6(p0.Y-p1.Y), h.gs.dv)
-				origDist = f26dot6(h.font.scale(h.scale * int32(origDist)))
+				origDist = h.scaleFUnits(origDist)
 			}
 
 			// Single-width cut-in test.
 			if x := (origDist - h.gs.singleWidth).abs(); x < h.gs.singleWidthCutIn {
 				if origDist >= 0 {
-					origDist = h.gs.singleWidthCutIn
+					origDist = h.gs.singleWidth
 				} else {
-					origDist = -h.gs.singleWidthCutIn
+					origDist = -h.gs.singleWidth
 				}
 			}
 
@@ -724,15 +1285,103 @@ func (h *Hinter) run(program []byte) error {
 			}
 
 			// Set-RP0 bit.
+			h.gs.rp[1] = h.gs.rp[0]
+			h.gs.rp[2] = i
 			if opcode&0x10 != 0 {
-				h.gs.rp[0] = int32(i)
+				h.gs.rp[0] = i
 			}
-			h.gs.rp[1] = h.gs.rp[0]
-			h.gs.rp[2] = int32(i)
 
 			// Move the point.
 			origDist = dotProduct(f26dot6(p.X-ref.X), f26dot6(p.Y-ref.Y), h.gs.pv)
-			h.move(p, distance-origDist)
+			h.move(p, distance-origDist, true)
+
+		case opMIRP00000, opMIRP00001, opMIRP00010, opMIRP00011,
+			opMIRP00100, opMIRP00101, opMIRP00110, opMIRP00111,
+			opMIRP01000, opMIRP01001, opMIRP01010, opMIRP01011,
+			opMIRP01100, opMIRP01101, opMIRP01110, opMIRP01111,
+			opMIRP10000, opMIRP10001, opMIRP10010, opMIRP10011,
+			opMIRP10100, opMIRP10101, opMIRP10110, opMIRP10111,
+			opMIRP11000, opMIRP11001, opMIRP11010, opMIRP11011,
+			opMIRP11100, opMIRP11101, opMIRP11110, opMIRP11111:
+
+			top -= 2
+			i := h.stack[top]
+			cvtDist := f26dot6(0)
+			// As per C Freetype, CVT entry -1 is an implicit zero.
+			if h.stack[top+1] != -1 {
+				var ok bool
+				cvtDist, ok = h.getScaledCVT(h.stack[top+1])
+				if !ok {
+					return errors.New("truetype: hinting: CVT entry out of range")
+				}
+			}
+			ref := h.point(0, current, h.gs.rp[0])
+			p := h.point(1, current, i)
+			if ref == nil || p == nil {
+				return errors.New("truetype: hinting: point out of range")
+			}
+
+			// Single-width cut-in test.
+			if (cvtDist - h.gs.singleWidth).abs() < h.gs.singleWidthCutIn {
+				if cvtDist >= 0 {
+					cvtDist = +h.gs.singleWidth
+				} else {
+					cvtDist = -h.gs.singleWidth
+				}
+			}
+
+			refOrig := h.point(0, unhinted, h.gs.rp[0])
+			pOrig := h.point(1, unhinted, i)
+			if h.gs.zp[1] == twilightZone {
+				// As per C Freetype, a twilight point starts out at the
+				// unhinted reference point, moved by the CVT distance
+				// along the freedom vector.
+				pOrig.X = refOrig.X + int32(mulFix14(cvtDist, h.gs.fv[0]))
+				pOrig.Y = refOrig.Y + int32(mulFix14(cvtDist, h.gs.fv[1]))
+				*p = *pOrig
+			}
+			origDist := dotProduct(f26dot6(pOrig.X-refOrig.X), f26dot6(pOrig.Y-refOrig.Y), h.gs.dv)
+			curDist := dotProduct(f26dot6(p.X-ref.X), f26dot6(p.Y-ref.Y), h.gs.pv)
+
+			// Auto-flip test.
+			if h.gs.autoFlip && (origDist^cvtDist) < 0 {
+				cvtDist = -cvtDist
+			}
+
+			// Rounding bit.
+			// TODO: metrics compensation.
+			distance := cvtDist
+			if opcode&0x04 != 0 {
+				// As per C Freetype, only apply the control value cut-in
+				// test when both points are in the same zone.
+				if h.gs.zp[0] == h.gs.zp[1] && (cvtDist-origDist).abs() > h.gs.controlValueCutIn {
+					distance = origDist
+				}
+				distance = h.round(distance)
+			}
+
+			// Minimum distance bit.
+			if opcode&0x08 != 0 {
+				if origDist >= 0 {
+					if distance < h.gs.minDist {
+						distance = h.gs.minDist
+					}
+				} else {
+					if distance > -h.gs.minDist {
+						distance = -h.gs.minDist
+					}
+				}
+			}
+
+			// Set-RP0 bit.
+			h.gs.rp[1] = h.gs.rp[0]
+			h.gs.rp[2] = i
+			if opcode&0x10 != 0 {
+				h.gs.rp[0] = i
+			}
+
+			// Move the point.
+			h.move(p, distance-curDist, true)
 
 		default:
 			return errors.New("truetype: hinting: unrecognized instruction")
@@ -811,29 +1460,340 @@ func (h *Hinter) run(program []byte) error {
 			}
 			continue
 		}
+
+	delta:
+		// Apply the n delta exceptions on the stack, each of which is a pair
+		// of a point number (or CVT entry) and an argument. The argument's
+		// high four bits select the PPEM to apply the exception at, and its
+		// low four bits select the amount to move by.
+		{
+			if opcode >= opDELTAC1 && !h.scaledCVTInitialized {
+				h.initializeScaledCVT()
+			}
+			top--
+			n := h.stack[top]
+			if n < 0 || int32(top) < 2*n {
+				return errors.New("truetype: hinting: stack underflow")
+			}
+			for ; n > 0; n-- {
+				top -= 2
+				b := h.stack[top]
+				c := (b & 0xf0) >> 4
+				switch opcode {
+				case opDELTAP2, opDELTAC2:
+					c += 16
+				case opDELTAP3, opDELTAC3:
+					c += 32
+				}
+				c += h.gs.deltaBase
+				if ppem := h.scale >> 6; ppem != c {
+					continue
+				}
+				b = (b & 0x0f) - 8
+				if b >= 0 {
+					b++
+				}
+				b = b * 64 / (1 << uint32(h.gs.deltaShift))
+				if opcode >= opDELTAC1 {
+					a := h.stack[top+1]
+					if a < 0 || len(h.scaledCVT) <= int(a) {
+						return errors.New("truetype: hinting: CVT entry out of range")
+					}
+					h.scaledCVT[a] += f26dot6(b)
+				} else {
+					p := h.point(0, current, h.stack[top+1])
+					if p == nil {
+						return errors.New("truetype: hinting: point out of range")
+					}
+					h.move(p, f26dot6(b), true)
+				}
+			}
+			pc++
+			continue
+		}
 	}
 	return nil
 }
 
-func (h *Hinter) move(p *Point, distance f26dot6) {
-	if h.gs.fv[0] == 0 {
-		p.Y += int32(distance)
-		p.Flags |= flagTouchedY
+// iupInterp interpolates the untouched points p1 to p2 inclusive along the x
+// or y axis, between the touched reference points ref1 and ref2. A point that
+// was, in font units, outside the range spanned by the reference points is
+// shifted by the nearer reference point's movement. A point inside that range
+// keeps its relative position.
+func (h *Hinter) iupInterp(interpY bool, p1, p2, ref1, ref2 int) {
+	if p1 > p2 {
 		return
 	}
-	if h.gs.fv[1] == 0 {
-		p.X += int32(distance)
-		p.Flags |= flagTouchedX
+	if ref1 >= len(h.points[glyphZone][current]) || ref2 >= len(h.points[glyphZone][current]) {
 		return
 	}
+
+	var ifu1, ifu2 int32
+	if interpY {
+		ifu1 = h.points[glyphZone][inFontUnits][ref1].Y
+		ifu2 = h.points[glyphZone][inFontUnits][ref2].Y
+	} else {
+		ifu1 = h.points[glyphZone][inFontUnits][ref1].X
+		ifu2 = h.points[glyphZone][inFontUnits][ref2].X
+	}
+	if ifu1 > ifu2 {
+		ifu1, ifu2 = ifu2, ifu1
+		ref1, ref2 = ref2, ref1
+	}
+
+	var unh1, unh2, delta1, delta2 int32
+	if interpY {
+		unh1 = h.points[glyphZone][unhinted][ref1].Y
+		unh2 = h.points[glyphZone][unhinted][ref2].Y
+		delta1 = h.points[glyphZone][current][ref1].Y - unh1
+		delta2 = h.points[glyphZone][current][ref2].Y - unh2
+	} else {
+		unh1 = h.points[glyphZone][unhinted][ref1].X
+		unh2 = h.points[glyphZone][unhinted][ref2].X
+		delta1 = h.points[glyphZone][current][ref1].X - unh1
+		delta2 = h.points[glyphZone][current][ref2].X - unh2
+	}
+
+	var xy, ifuXY int32
+	if ifu1 == ifu2 {
+		for i := p1; i <= p2; i++ {
+			if interpY {
+				xy = h.points[glyphZone][unhinted][i].Y
+			} else {
+				xy = h.points[glyphZone][unhinted][i].X
+			}
+
+			if xy <= unh1 {
+				xy += delta1
+			} else {
+				xy += delta2
+			}
+
+			if interpY {
+				h.points[glyphZone][current][i].Y = xy
+			} else {
+				h.points[glyphZone][current][i].X = xy
+			}
+		}
+		return
+	}
+
+	scale, scaleOK := int64(0), false
+	for i := p1; i <= p2; i++ {
+		if interpY {
+			xy = h.points[glyphZone][unhinted][i].Y
+			ifuXY = h.points[glyphZone][inFontUnits][i].Y
+		} else {
+			xy = h.points[glyphZone][unhinted][i].X
+			ifuXY = h.points[glyphZone][inFontUnits][i].X
+		}
+
+		if xy <= unh1 {
+			xy += delta1
+		} else if xy >= unh2 {
+			xy += delta2
+		} else {
+			if !scaleOK {
+				scaleOK = true
+				scale = divFix(int64(unh2+delta2-unh1-delta1), int64(ifu2-ifu1))
+			}
+			xy = unh1 + delta1 + int32(mulFix(int64(ifuXY-ifu1), scale))
+		}
+
+		if interpY {
+			h.points[glyphZone][current][i].Y = xy
+		} else {
+			h.points[glyphZone][current][i].X = xy
+		}
+	}
+}
+
+// iupShift shifts the points p1 to p2 exclusive, other than p itself, along
+// the x or y axis by the movement of the touched point p. It is used for a
+// contour that has only one touched point.
+func (h *Hinter) iupShift(interpY bool, p1, p2, p int) {
+	var delta int32
+	if interpY {
+		delta = h.points[glyphZone][current][p].Y - h.points[glyphZone][unhinted][p].Y
+	} else {
+		delta = h.points[glyphZone][current][p].X - h.points[glyphZone][unhinted][p].X
+	}
+	if delta == 0 {
+		return
+	}
+	for i := p1; i < p2; i++ {
+		if i == p {
+			continue
+		}
+		if interpY {
+			h.points[glyphZone][current][i].Y += delta
+		} else {
+			h.points[glyphZone][current][i].X += delta
+		}
+	}
+}
+
+// divFix returns x/y as a 16.16 fixed point number.
+func divFix(x, y int64) int64 {
+	return mulDiv(x, 1<<16, y)
+}
+
+// mulFix returns x*y, where y is a 16.16 fixed point number.
+func mulFix(x, y int64) int64 {
+	return mulDiv(x, y, 1<<16)
+}
+
+// runGlyph runs a glyph's bytecode program. As per C Freetype, the prep
+// bytecode can use INSTCTRL to turn off glyph bytecode, or to make glyph
+// bytecode start with the global default graphics state.
+func (h *Hinter) runGlyph(program []byte, pCurrent, pUnhinted, pInFontUnits []Point, ends []int) error {
+	ic := h.defaultGS.instructControl
+	if ic&1 != 0 {
+		return nil
+	}
+	if ic&2 != 0 {
+		defaultGS := h.defaultGS
+		h.defaultGS = globalDefaultGS
+		err := h.run(program, pCurrent, pUnhinted, pInFontUnits, ends)
+		h.defaultGS = defaultGS
+		return err
+	}
+	return h.run(program, pCurrent, pUnhinted, pInFontUnits, ends)
+}
+
+// initializeScaledCVT scales the Font's Control Value Table to the Hinter's
+// scale.
+func (h *Hinter) initializeScaledCVT() {
+	h.scaledCVTInitialized = true
+	if n := len(h.font.cvt) / 2; n <= cap(h.scaledCVT) {
+		h.scaledCVT = h.scaledCVT[:n]
+	} else {
+		if n < 32 {
+			n = 32
+		}
+		h.scaledCVT = make([]f26dot6, len(h.font.cvt)/2, n)
+	}
+	for i := range h.scaledCVT {
+		unscaled := int32(int16(u16(h.font.cvt, 2*i)))
+		h.scaledCVT[i] = f26dot6(h.font.scale(h.scale * unscaled))
+	}
+}
+
+// ControlValues returns a copy of the scaled Control Value Table that the
+// Hinter is using, in 26.6 fixed point units. It reflects the scale at which
+// a glyph was last loaded with the Hinter, and any changes that the font's
+// prep bytecode or the glyphs' bytecode made to it. It returns nil if the
+// Hinter has not yet been used.
+func (h *Hinter) ControlValues() []int32 {
+	if h.font == nil || h.scale < 0 {
+		return nil
+	}
+	if !h.scaledCVTInitialized {
+		h.initializeScaledCVT()
+	}
+	cv := make([]int32, len(h.scaledCVT))
+	for i, x := range h.scaledCVT {
+		cv[i] = int32(x)
+	}
+	return cv
+}
+
+// getScaledCVT returns the scaled value from the font's Control Value Table.
+func (h *Hinter) getScaledCVT(i int32) (x f26dot6, ok bool) {
+	if !h.scaledCVTInitialized {
+		h.initializeScaledCVT()
+	}
+	if i < 0 || len(h.scaledCVT) <= int(i) {
+		return 0, false
+	}
+	return h.scaledCVT[i], true
+}
+
+// setScaledCVT overrides the scaled value from the font's Control Value Table.
+func (h *Hinter) setScaledCVT(i int32, x f26dot6) (ok bool) {
+	if !h.scaledCVTInitialized {
+		h.initializeScaledCVT()
+	}
+	if i < 0 || len(h.scaledCVT) <= int(i) {
+		return false
+	}
+	h.scaledCVT[i] = x
+	return true
+}
+
+// point returns the i'th point of the given type in the zone that the given
+// zone pointer refers to, or nil if there is no such point.
+func (h *Hinter) point(zonePointer uint32, pt pointType, i int32) *Point {
+	points := h.points[h.gs.zp[zonePointer]][pt]
+	if i < 0 || len(points) <= int(i) {
+		return nil
+	}
+	return &points[i]
+}
+
+// scaleFUnits scales a distance between two "in font units" points. For a
+// compound glyph, those points are already scaled.
+func (h *Hinter) scaleFUnits(d f26dot6) f26dot6 {
+	if h.compound {
+		return d
+	}
+	return f26dot6(h.font.scale(h.scale * int32(d)))
+}
+
+// displacement returns the zone pointer and point number of the reference
+// point used by SHP, SHC and SHZ, and the distance, along the projection
+// vector, that that reference point has moved. The reference point is rp2 in
+// the zone pointed to by zp1 if useRP2 is true, or else rp1 in the zone
+// pointed to by zp0.
+func (h *Hinter) displacement(useRP2 bool) (zonePointer uint32, i int32, d f26dot6, ok bool) {
+	zonePointer, i = uint32(0), h.gs.rp[1]
+	if useRP2 {
+		zonePointer, i = 1, h.gs.rp[2]
+	}
+	p := h.point(zonePointer, current, i)
+	q := h.point(zonePointer, unhinted, i)
+	if p == nil || q == nil {
+		return 0, 0, 0, false
+	}
+	d = dotProduct(f26dot6(p.X-q.X), f26dot6(p.Y-q.Y), h.gs.pv)
+	return zonePointer, i, d, true
+}
+
+// move moves the point p along the freedom vector, such that its projection
+// onto the projection vector changes by the given distance. If touch is
+// true, then p is marked as touched along the freedom vector's axes.
+func (h *Hinter) move(p *Point, distance f26dot6, touch bool) {
 	fvx := int64(h.gs.fv[0])
 	fvy := int64(h.gs.fv[1])
-	pvx := int64(h.gs.pv[0])
-	pvy := int64(h.gs.pv[1])
-	fvDotPv := (fvx*pvx + fvy*pvy) >> 14
-	p.X += int32(int64(distance) * fvx / fvDotPv)
-	p.Y += int32(int64(distance) * fvy / fvDotPv)
-	p.Flags |= flagTouchedX | flagTouchedY
+	// fDotP is the dot product of the freedom and projection vectors, as a
+	// 2.30 fixed point number. As per C Freetype, it is clamped away from
+	// zero, which would otherwise cause overflows and spikes at small sizes.
+	fDotP := (fvx*int64(h.gs.pv[0]) + fvy*int64(h.gs.pv[1])) << 2
+	if -0x400000 < fDotP && fDotP < 0x400000 {
+		fDotP = 0x40000000
+	}
+	if fvx != 0 {
+		p.X += int32(mulDiv(int64(distance), fvx<<16, fDotP))
+	}
+	if fvy != 0 {
+		p.Y += int32(mulDiv(int64(distance), fvy<<16, fDotP))
+	}
+	if touch {
+		p.Flags |= touchedFlags(h.gs.fv)
+	}
+}
+
+// touchedFlags returns the flags that mark a point as touched after it is
+// moved along the freedom vector fv.
+func touchedFlags(fv [2]f2dot14) uint32 {
+	flags := uint32(0)
+	if fv[0] != 0 {
+		flags |= flagTouchedX
+	}
+	if fv[1] != 0 {
+		flags |= flagTouchedY
+	}
+	return flags
 }
 
 // skipInstructionPayload increments pc by the extra data that follows a
@@ -865,6 +1825,35 @@ func skipInstructionPayload(program []byte, pc int) (newPC int, ok bool) {
 // f2dot14 is a 2.14 fixed point number.
 type f2dot14 int16
 
+// normalize returns the unit vector in the direction of (x, y), as 2.14
+// fixed point numbers. (x, y) must not be the zero vector.
+func normalize(x, y int32) [2]f2dot14 {
+	fx, fy := float64(x), float64(y)
+	l := 0x4000 / math.Hypot(fx, fy)
+	fx *= l
+	if fx >= 0 {
+		fx += 0.5
+	} else {
+		fx -= 0.5
+	}
+	fy *= l
+	if fy >= 0 {
+		fy += 0.5
+	} else {
+		fy -= 0.5
+	}
+	return [2]f2dot14{f2dot14(fx), f2dot14(fy)}
+}
+
+// normalizeOK is like normalize, except that, as per C Freetype, the zero
+// vector cannot be normalized, and ok is false.
+func normalizeOK(x, y int32) (v [2]f2dot14, ok bool) {
+	if x == 0 && y == 0 {
+		return [2]f2dot14{}, false
+	}
+	return normalize(x, y), true
+}
+
 // f26dot6 is a 26.6 fixed point number.
 type f26dot6 int32
 
@@ -886,39 +1875,73 @@ func (x f26dot6) mul(y f26dot6) f26dot6 {
 	return f26dot6(int64(x) * int64(y) >> 6)
 }
 
+// dotProduct returns the dot product of [x, y] and q, rounded to the nearest
+// integer. As per C Freetype, halves are rounded towards positive infinity,
+// except for negative numbers, which are rounded towards negative infinity.
 func dotProduct(x, y f26dot6, q [2]f2dot14) f26dot6 {
-	px := int64(x)
-	py := int64(y)
-	qx := int64(q[0])
-	qy := int64(q[1])
-	return f26dot6((px*qx + py*qy) >> 14)
+	v := int64(x)*int64(q[0]) + int64(y)*int64(q[1])
+	if v < 0 {
+		v--
+	}
+	return f26dot6((v + 0x2000) >> 14)
+}
+
+// mulFix14 returns x*y, where y is a 2.14 fixed point number, rounded to the
+// nearest integer, with halves rounded away from zero.
+func mulFix14(x f26dot6, y f2dot14) f26dot6 {
+	v := int64(x) * int64(y)
+	if v < 0 {
+		return -f26dot6((-v + 0x2000) >> 14)
+	}
+	return f26dot6((v + 0x2000) >> 14)
+}
+
+// mulDiv returns x*y/z, rounded to the nearest integer, with halves rounded
+// away from zero.
+func mulDiv(x, y, z int64) int64 {
+	xy := x * y
+	if z < 0 {
+		xy, z = -xy, -z
+	}
+	if xy >= 0 {
+		xy += z / 2
+	} else {
+		xy -= z / 2
+	}
+	return xy / z
 }
 
 // round rounds the given number. The rounding algorithm is described at
 // https://developer.apple.com/fonts/TTRefMan/RM02/Chap2.html#rounding
+//
+// As per C Freetype, rather than the spec, negative numbers are rounded
+// symmetrically to positive numbers, and rounding never changes the sign of
+// a number, although it can change a number to zero.
 func (h *Hinter) round(x f26dot6) f26dot6 {
 	if h.gs.roundPeriod == 0 {
+		// Rounding is off.
 		return x
 	}
-	neg := x < 0
-	x -= h.gs.roundPhase
-	x += h.gs.roundThreshold
 	if x >= 0 {
-		x = (x / h.gs.roundPeriod) * h.gs.roundPeriod
-	} else {
-		x -= h.gs.roundPeriod
-		x += 1
-		x = (x / h.gs.roundPeriod) * h.gs.roundPeriod
-	}
-	x += h.gs.roundPhase
-	if neg {
-		if x >= 0 {
-			x = h.gs.roundPhase - h.gs.roundPeriod
+		ret := floorTo(x-h.gs.roundPhase+h.gs.roundThreshold, h.gs.roundPeriod)
+		if x != 0 && ret < 0 {
+			ret = 0
 		}
-	} else if x < 0 {
-		x = h.gs.roundPhase
+		return ret + h.gs.roundPhase
 	}
-	return x
+	ret := -floorTo(h.gs.roundThreshold-h.gs.roundPhase-x, h.gs.roundPeriod)
+	if ret > 0 {
+		ret = 0
+	}
+	return ret - h.gs.roundPhase
+}
+
+// floorTo returns the largest multiple of period that is no more than x.
+func floorTo(x, period f26dot6) f26dot6 {
+	if x < 0 {
+		x -= period - 1
+	}
+	return x / period * period
 }
 
 func bool2int32(b bool) int32 {
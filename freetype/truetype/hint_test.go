@@ -67,6 +67,28 @@ func TestBytecode(t *testing.T) {
 			[]int32{0x4000, 0, 1, 0, -0x4000, 2},
 			"",
 		},
+		{
+			"normalized vector",
+			[]byte{
+				opPUSHW001, // [0x2000, 0x2000]
+				0x20,
+				0x00,
+				0x20,
+				0x00,
+				opSPVFS, // []
+				opGPV,   // [0x2d41, 0x2d41]
+			},
+			[]int32{0x2d41, 0x2d41},
+			"",
+		},
+		{
+			"unimplemented instruction",
+			[]byte{
+				op_0x28,
+			},
+			nil,
+			"unimplemented instruction 0x28",
+		},
 		{
 			"jumps",
 			[]byte{
@@ -438,6 +460,8 @@ func TestBytecode(t *testing.T) {
 			"super-rounding",
 			// See figure 20 of https://developer.apple.com/fonts/TTRefMan/RM02/Chap2.html#rounding
 			// and the sign preservation steps of the "Order of rounding operations" section.
+			// As per C Freetype, negative numbers are rounded symmetrically to
+			// positive numbers, which differs from the spec's figure.
 			[]byte{
 				opPUSHB000, // [0x58]
 				0x58,
@@ -445,33 +469,33 @@ func TestBytecode(t *testing.T) {
 				opPUSHW000, // [-81]
 				0xff,
 				0xaf,
-				opROUND00,  // [-112]
-				opPUSHW000, // [-112, -80]
+				opROUND00,  // [-80]
+				opPUSHW000, // [-80, -80]
 				0xff,
 				0xb0,
-				opROUND00,  // [-112, -48]
-				opPUSHW000, // [-112, -48, -17]
+				opROUND00,  // [-80, -80]
+				opPUSHW000, // [-80, -80, -17]
 				0xff,
 				0xef,
-				opROUND00,  // [-112, -48, -48]
-				opPUSHW000, // [-112, -48, -48, -16]
+				opROUND00,  // [-80, -80, -16]
+				opPUSHW000, // [-80, -80, -16, -16]
 				0xff,
 				0xf0,
-				opROUND00,  // [-112, -48, -48, -48]
-				opPUSHB000, // [-112, -48, -48, -48, 0]
+				opROUND00,  // [-80, -80, -16, -16]
+				opPUSHB000, // [-80, -80, -16, -16, 0]
 				0,
-				opROUND00,  // [-112, -48, -48, -48, 16]
-				opPUSHB000, // [-112, -48, -48, -48, 16, 16]
+				opROUND00,  // [-80, -80, -16, -16, 16]
+				opPUSHB000, // [-80, -80, -16, -16, 16, 16]
 				16,
-				opROUND00,  // [-112, -48, -48, -48, 16, 16]
-				opPUSHB000, // [-112, -48, -48, -48, 16, 16, 47]
+				opROUND00,  // [-80, -80, -16, -16, 16, 16]
+				opPUSHB000, // [-80, -80, -16, -16, 16, 16, 47]
 				47,
-				opROUND00,  // [-112, -48, -48, -48, 16, 16, 16]
-				opPUSHB000, // [-112, -48, -48, -48, 16, 16, 16, 48]
+				opROUND00,  // [-80, -80, -16, -16, 16, 16, 16]
+				opPUSHB000, // [-80, -80, -16, -16, 16, 16, 16, 48]
 				48,
-				opROUND00, // [-112, -48, -48, -48, 16, 16, 16, 80]
+				opROUND00, // [-80, -80, -16, -16, 16, 16, 16, 80]
 			},
-			[]int32{-112, -48, -48, -48, 16, 16, 16, 80},
+			[]int32{-80, -80, -16, -16, 16, 16, 16, 80},
 			"",
 		},
 		{
@@ -553,14 +577,13 @@ func TestBytecode(t *testing.T) {
 		},
 	}
 
-	var g GlyphBuf
 	for _, tc := range testCases {
 		h := &Hinter{}
-		h.init(&g, &Font{
+		h.init(&Font{
 			maxStorage:       32,
 			maxStackElements: 100,
 		}, 768)
-		err, errStr := h.run(tc.prog), ""
+		err, errStr := h.run(tc.prog, nil, nil, nil, nil), ""
 		if err != nil {
 			errStr = err.Error()
 		}
@@ -583,3 +606,193 @@ func TestBytecode(t *testing.T) {
 		}
 	}
 }
+
+func TestIUP(t *testing.T) {
+	// There are three contours. The first has two touched points, and its
+	// untouched points are interpolated, including one that wraps around
+	// from the last touched point to the first. The second has one touched
+	// point, and its untouched point is shifted. The third has no touched
+	// points, and is left unchanged.
+	unhinted := []Point{
+		{X: 0}, {X: 100}, {X: 200}, {X: 300},
+		{X: 0}, {X: 64},
+		{X: 50},
+	}
+	inFontUnits := []Point{
+		{X: 0}, {X: 50}, {X: 100}, {X: 150},
+		{X: 0}, {X: 32},
+		{X: 25},
+	}
+	current := []Point{
+		{X: 10, Flags: flagTouchedX}, {X: 100}, {X: 230, Flags: flagTouchedX}, {X: 300},
+		{X: 32, Flags: flagTouchedX}, {X: 64},
+		{X: 50},
+	}
+	ends := []int{4, 6, 7}
+
+	h := &Hinter{}
+	h.init(&Font{
+		maxStorage:       32,
+		maxStackElements: 100,
+	}, 768)
+	if err := h.run([]byte{opIUP1}, current, unhinted, inFontUnits, ends); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int32, len(current))
+	for i, p := range current {
+		got[i] = p.X
+	}
+	want := []int32{10, 120, 230, 330, 32, 96, 50}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFontHinter(t *testing.T) {
+	f := &Font{
+		maxStorage:       32,
+		maxStackElements: 100,
+		fpgm: []byte{
+			opPUSHB000, 7,
+			opFDEF,
+			opPOP,
+			opENDF,
+		},
+	}
+	h, err := f.Hinter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.functions[7]; !ok || h.font != f {
+		t.Errorf("the fpgm bytecode was not run")
+	}
+	// The prep bytecode has not yet run, and runs for the first scale that
+	// the Hinter is used at, even zero.
+	f.prep = []byte{opPUSHB001, 0, 5, opWS}
+	if err := h.init(f, 0); err != nil {
+		t.Fatal(err)
+	}
+	if h.store[0] != 5 {
+		t.Errorf("the prep bytecode was not run")
+	}
+
+	// A font program that underflows the stack is an error.
+	f.fpgm = []byte{opPOP}
+	if _, err := f.Hinter(); err == nil {
+		t.Errorf("bad fpgm: got no error, want one")
+	}
+
+	// Glyphs hinted by a Font's Hinter are the same as those hinted by the
+	// zero Hinter.
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	h, err = font.Hinter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g0, g1 := NewGlyphBuf(), NewGlyphBuf()
+	for _, scale := range []int32{12 << 6, 24 << 6} {
+		for i := Index(0); i < 100; i++ {
+			if err := g0.Load(font, scale, i, &Hinter{}); err != nil {
+				t.Fatalf("scale %d, glyph %d: %v", scale, i, err)
+			}
+			if err := g1.Load(font, scale, i, h); err != nil {
+				t.Fatalf("scale %d, glyph %d: %v", scale, i, err)
+			}
+			if !reflect.DeepEqual(g0.Point, g1.Point) {
+				t.Errorf("scale %d, glyph %d: points differ", scale, i)
+			}
+		}
+	}
+}
+
+func TestPrepRescale(t *testing.T) {
+	// The prep bytecode writes the scaled value of the first CVT entry,
+	// half an em, to the first storage location.
+	f := &Font{
+		fUnitsPerEm:      2048,
+		maxStorage:       32,
+		maxStackElements: 100,
+		cvt:              []byte{0x04, 0x00},
+		prep:             []byte{opPUSHB001, 0, 0, opRCVT, opWS},
+	}
+	h := &Hinter{}
+	testCases := []struct {
+		scale int32
+		want  int32
+	}{
+		{12 << 6, 6 << 6},
+		{24 << 6, 12 << 6},
+		{12 << 6, 6 << 6},
+	}
+	for _, tc := range testCases {
+		if err := h.init(f, tc.scale); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.store[0]; got != tc.want {
+			t.Errorf("scale %d: got %d, want %d", tc.scale, got, tc.want)
+		}
+		// The prep bytecode is not run again at an unchanged scale.
+		h.store[0] = -1
+		if err := h.init(f, tc.scale); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.store[0]; got != -1 {
+			t.Errorf("scale %d: prep bytecode was run again", tc.scale)
+		}
+	}
+
+	// Re-using a Hinter at alternating sizes hints a glyph the same as a
+	// new Hinter does at each size.
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g0, g1 := NewGlyphBuf(), NewGlyphBuf()
+	h = &Hinter{}
+	var prev []Point
+	for _, scale := range []int32{12 << 6, 24 << 6, 12 << 6, 24 << 6} {
+		if err := g0.Load(font, scale, 36, &Hinter{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := g1.Load(font, scale, 36, h); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g0.Point, g1.Point) {
+			t.Errorf("scale %d: re-used Hinter: got %v, want %v", scale, g1.Point, g0.Point)
+		}
+		if reflect.DeepEqual(g1.Point, prev) {
+			t.Errorf("scale %d: got the same points as the previous scale", scale)
+		}
+		prev = append(prev[:0], g1.Point...)
+	}
+}
+
+func TestControlValues(t *testing.T) {
+	// The prep bytecode overrides the second CVT entry with 100 in 26.6
+	// fixed point units, but leaves the first, half an em, as scaled.
+	f := &Font{
+		fUnitsPerEm:      2048,
+		maxStorage:       32,
+		maxStackElements: 100,
+		cvt:              []byte{0x04, 0x00, 0x08, 0x00},
+		prep:             []byte{opPUSHB001, 1, 100, opWCVTP},
+	}
+	h := &Hinter{}
+	if got := h.ControlValues(); got != nil {
+		t.Errorf("unused Hinter: got %v, want nil", got)
+	}
+	if h, err := f.Hinter(); err != nil {
+		t.Fatal(err)
+	} else if got := h.ControlValues(); got != nil {
+		t.Errorf("Font.Hinter: got %v, want nil", got)
+	}
+	if err := h.init(f, 12<<6); err != nil {
+		t.Fatal(err)
+	}
+	want := []int32{6 << 6, 100}
+	if got := h.ControlValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The returned values are a copy.
+	h.ControlValues()[0] = 0
+	if got := h.ControlValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after modifying a copy: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"image"
+
+	"github.com/Bitnick2002/freetype-go/freetype/raster"
+)
+
+// A FillRule determines which parts of a glyph's outline are inside it.
+type FillRule int
+
+const (
+	// FillNonZero fills every point around which the glyph's contours wind
+	// a non-zero number of times. It is the rule that TrueType fonts use.
+	FillNonZero FillRule = iota
+	// FillEvenOdd fills every point around which the glyph's contours wind
+	// an odd number of times.
+	FillEvenOdd
+)
+
+// Mask rasterizes the glyph in this GlyphBuf, and returns its anti-aliased
+// coverage mask. The glyph's origin is placed at the 26.6 fixed point
+// position (x, y) in the mask's co-ordinate space, in which, unlike the
+// glyph's, Y increases downwards. The mask's bounds are the smallest
+// rectangle of whole pixels that contains the glyph, and can be passed
+// directly to draw.DrawMask. The glyph's contours are filled by the
+// non-zero winding rule; use MaskFill to choose another rule. The mask is
+// rasterized from g.Point, so it is hinted if and only if the glyph was
+// loaded with a Hinter.
+func (g *GlyphBuf) Mask(x, y int32) *image.Alpha {
+	return g.MaskFill(x, y, FillNonZero)
+}
+
+// MaskFill is like Mask, but fills the glyph's contours by the given rule,
+// unless g.Overlap is set, in which case the rule is always FillNonZero.
+func (g *GlyphBuf) MaskFill(x, y int32, rule FillRule) *image.Alpha {
+	if len(g.End) == 0 {
+		return image.NewAlpha(image.Rectangle{})
+	}
+	// The bounds of a contour's points also bound its curves.
+	b := pointBounds(g.Point)
+	r := image.Rect(
+		int(x+b.XMin)>>6,
+		int(y-b.YMax)>>6,
+		int(x+b.XMax+63)>>6,
+		int(y-b.YMin+63)>>6,
+	)
+	z := raster.NewRasterizer(r.Dx(), r.Dy())
+	z.UseNonZeroWinding = rule == FillNonZero || g.Overlap
+	z.Dx, z.Dy = r.Min.X, r.Min.Y
+	// pt converts a glyph Point to the 24.8 fixed point co-ordinates of the
+	// Rasterizer, whose origin is r.Min.
+	dx, dy := x-int32(r.Min.X)<<6, y-int32(r.Min.Y)<<6
+	pt := func(p Point) raster.Point {
+		return raster.Point{
+			X: raster.Fix32(dx+p.X) << 2,
+			Y: raster.Fix32(dy-p.Y) << 2,
+		}
+	}
+	for _, s := range g.AppendPath(nil) {
+		switch s.Op {
+		case SegmentOpMoveTo:
+			z.Start(pt(s.Args[0]))
+		case SegmentOpLineTo:
+			z.Add1(pt(s.Args[0]))
+		case SegmentOpQuadTo:
+			z.Add2(pt(s.Args[0]), pt(s.Args[1]))
+		case SegmentOpCubeTo:
+			z.Add3(pt(s.Args[0]), pt(s.Args[1]), pt(s.Args[2]))
+		}
+	}
+	m := image.NewAlpha(r)
+	z.Rasterize(raster.NewAlphaSrcPainter(m))
+	return m
+}
@@ -0,0 +1,143 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements parsing the name table, which holds a font's
+// human-readable names. The table is documented at
+// http://developer.apple.com/fonts/TTRefMan/RM06/Chap6name.html
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// A NameID identifies a name table entry.
+type NameID uint16
+
+// The name table entries. These IDs are documented at
+// http://www.microsoft.com/typography/otspec/name.htm
+const (
+	NameIDCopyright         NameID = 0
+	NameIDFontFamily        NameID = 1
+	NameIDFontSubfamily     NameID = 2
+	NameIDUniqueSubfamilyID NameID = 3
+	NameIDFontFullName      NameID = 4
+	NameIDVersion           NameID = 5
+	NameIDPostscriptName    NameID = 6
+	NameIDTrademark         NameID = 7
+	NameIDManufacturer      NameID = 8
+	NameIDDesigner          NameID = 9
+	NameIDDescription       NameID = 10
+	NameIDVendorURL         NameID = 11
+	NameIDDesignerURL       NameID = 12
+	NameIDLicense           NameID = 13
+	NameIDLicenseURL        NameID = 14
+)
+
+func (f *Font) parseName() error {
+	if len(f.name) == 0 {
+		return nil
+	}
+	if len(f.name) < 6 {
+		return FormatError(fmt.Sprintf("bad name length: %d", len(f.name)))
+	}
+	if n := int(u16(f.name, 2)); len(f.name) < 6+12*n {
+		return FormatError("name table too short")
+	}
+	return nil
+}
+
+// Name returns the name table entry with the given ID, or an empty string if
+// there is no such entry. Windows Unicode entries are preferred, US English
+// above any other language, and then Unicode platform entries, and then
+// Macintosh Roman entries.
+func (f *Font) Name(id NameID) string {
+	if len(f.name) == 0 {
+		return ""
+	}
+	n := int(u16(f.name, 2))
+	stringOffset := int(u16(f.name, 4))
+	bestRank, best := 0, []byte(nil)
+	for i := 0; i < n; i++ {
+		x := 6 + 12*i
+		if NameID(u16(f.name, x+6)) != id {
+			continue
+		}
+		pid, psid, lang := u16(f.name, x), u16(f.name, x+2), u16(f.name, x+4)
+		rank := 0
+		switch {
+		case pid == 3 && (psid == 1 || psid == 10) && lang == 0x0409:
+			rank = 5
+		case pid == 3 && (psid == 1 || psid == 10):
+			rank = 4
+		case pid == 0:
+			rank = 3
+		case pid == 1 && psid == 0 && lang == 0:
+			rank = 2
+		case pid == 1 && psid == 0:
+			rank = 1
+		}
+		if rank <= bestRank {
+			continue
+		}
+		offset := stringOffset + int(u16(f.name, x+10))
+		length := int(u16(f.name, x+8))
+		if offset+length > len(f.name) {
+			continue
+		}
+		bestRank, best = rank, f.name[offset:offset+length]
+	}
+	switch {
+	case bestRank == 0:
+		return ""
+	case bestRank <= 2:
+		return decodeMacRoman(best)
+	}
+	return decodeUTF16(best)
+}
+
+// decodeUTF16 decodes the big-endian UTF-16 encoded string b.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = u16(b, 2*i)
+	}
+	return string(utf16.Decode(u))
+}
+
+// decodeMacRoman decodes the Macintosh Roman encoded string b.
+func decodeMacRoman(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		if c < 0x80 {
+			r[i] = rune(c)
+		} else {
+			r[i] = macRoman[c-0x80]
+		}
+	}
+	return string(r)
+}
+
+// macRoman holds the runes for the upper half of the Macintosh Roman
+// encoding. The lower half is ASCII.
+var macRoman = [128]rune{
+	0x00c4, 0x00c5, 0x00c7, 0x00c9, 0x00d1, 0x00d6, 0x00dc, 0x00e1,
+	0x00e0, 0x00e2, 0x00e4, 0x00e3, 0x00e5, 0x00e7, 0x00e9, 0x00e8,
+	0x00ea, 0x00eb, 0x00ed, 0x00ec, 0x00ee, 0x00ef, 0x00f1, 0x00f3,
+	0x00f2, 0x00f4, 0x00f6, 0x00f5, 0x00fa, 0x00f9, 0x00fb, 0x00fc,
+	0x2020, 0x00b0, 0x00a2, 0x00a3, 0x00a7, 0x2022, 0x00b6, 0x00df,
+	0x00ae, 0x00a9, 0x2122, 0x00b4, 0x00a8, 0x2260, 0x00c6, 0x00d8,
+	0x221e, 0x00b1, 0x2264, 0x2265, 0x00a5, 0x00b5, 0x2202, 0x2211,
+	0x220f, 0x03c0, 0x222b, 0x00aa, 0x00ba, 0x03a9, 0x00e6, 0x00f8,
+	0x00bf, 0x00a1, 0x00ac, 0x221a, 0x0192, 0x2248, 0x2206, 0x00ab,
+	0x00bb, 0x2026, 0x00a0, 0x00c0, 0x00c3, 0x00d5, 0x0152, 0x0153,
+	0x2013, 0x2014, 0x201c, 0x201d, 0x2018, 0x2019, 0x00f7, 0x25ca,
+	0x00ff, 0x0178, 0x2044, 0x20ac, 0x2039, 0x203a, 0xfb01, 0xfb02,
+	0x2021, 0x00b7, 0x201a, 0x201e, 0x2030, 0x00c2, 0x00ca, 0x00c1,
+	0x00cb, 0x00c8, 0x00cd, 0x00ce, 0x00cf, 0x00cc, 0x00d3, 0x00d4,
+	0xf8ff, 0x00d2, 0x00da, 0x00db, 0x00d9, 0x0131, 0x02c6, 0x02dc,
+	0x00af, 0x02d8, 0x02d9, 0x02da, 0x00b8, 0x02dd, 0x02db, 0x02c7,
+}
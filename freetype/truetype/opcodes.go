@@ -16,16 +16,16 @@ const (
 	opSPVTCA1   = 0x03 // .
 	opSFVTCA0   = 0x04 // Set Freedom Vector to Coordinate Axis
 	opSFVTCA1   = 0x05 // .
-	opSPVTL0    = 0x06
-	opSPVTL1    = 0x07
-	opSFVTL0    = 0x08
-	opSFVTL1    = 0x09
+	opSPVTL0    = 0x06 // Set Projection Vector To Line
+	opSPVTL1    = 0x07 // .
+	opSFVTL0    = 0x08 // Set Freedom Vector To Line
+	opSFVTL1    = 0x09 // .
 	opSPVFS     = 0x0a // Set Projection Vector From Stack
 	opSFVFS     = 0x0b // Set Freedom Vector From Stack
 	opGPV       = 0x0c // Get Projection Vector
 	opGFV       = 0x0d // Get Freedom Vector
 	opSFVTPV    = 0x0e // Set Freedom Vector To Projection Vector
-	opISECT     = 0x0f
+	opISECT     = 0x0f // moves point p to the InterSECTion of two lines
 	opSRP0      = 0x10 // Set Reference Point 0
 	opSRP1      = 0x11 // Set Reference Point 1
 	opSRP2      = 0x12 // Set Reference Point 2
@@ -49,42 +49,42 @@ const (
 	opDEPTH     = 0x24 // DEPTH of the stack
 	opCINDEX    = 0x25 // Copy the INDEXed element to the top of the stack
 	opMINDEX    = 0x26 // Move the INDEXed element to the top of the stack
-	opALIGNPTS  = 0x27
+	opALIGNPTS  = 0x27 // ALIGN Points
 	op_0x28     = 0x28
-	opUTP       = 0x29
+	opUTP       = 0x29 // UnTouch Point
 	opLOOPCALL  = 0x2a // LOOP and CALL function
 	opCALL      = 0x2b // CALL function
 	opFDEF      = 0x2c // Function DEFinition
 	opENDF      = 0x2d // END Function definition
 	opMDAP0     = 0x2e // Move Direct Absolute Point
 	opMDAP1     = 0x2f // .
-	opIUP0      = 0x30
-	opIUP1      = 0x31
-	opSHP0      = 0x32
-	opSHP1      = 0x33
-	opSHC0      = 0x34
-	opSHC1      = 0x35
-	opSHZ0      = 0x36
-	opSHZ1      = 0x37
-	opSHPIX     = 0x38
-	opIP        = 0x39
-	opMSIRP0    = 0x3a
-	opMSIRP1    = 0x3b
+	opIUP0      = 0x30 // Interpolate Untouched Points through the outline
+	opIUP1      = 0x31 // .
+	opSHP0      = 0x32 // SHift Point using reference point
+	opSHP1      = 0x33 // .
+	opSHC0      = 0x34 // SHift Contour using reference point
+	opSHC1      = 0x35 // .
+	opSHZ0      = 0x36 // SHift Zone using reference point
+	opSHZ1      = 0x37 // .
+	opSHPIX     = 0x38 // SHift point by a PIXel amount
+	opIP        = 0x39 // Interpolate Point
+	opMSIRP0    = 0x3a // Move Stack Indirect Relative Point
+	opMSIRP1    = 0x3b // .
 	opALIGNRP   = 0x3c // ALIGN to Reference Point
 	opRTDG      = 0x3d // Round To Double Grid
-	opMIAP0     = 0x3e
-	opMIAP1     = 0x3f
+	opMIAP0     = 0x3e // Move Indirect Absolute Point
+	opMIAP1     = 0x3f // .
 	opNPUSHB    = 0x40 // PUSH N Bytes
 	opNPUSHW    = 0x41 // PUSH N Words
 	opWS        = 0x42 // Write Store
 	opRS        = 0x43 // Read Store
-	opWCVTP     = 0x44
-	opRCVT      = 0x45
-	opGC0       = 0x46
-	opGC1       = 0x47
-	opSCFS      = 0x48
-	opMD0       = 0x49
-	opMD1       = 0x4a
+	opWCVTP     = 0x44 // Write Control Value Table in Pixel units
+	opRCVT      = 0x45 // Read Control Value Table entry
+	opGC0       = 0x46 // Get Coordinate projected onto the projection vector
+	opGC1       = 0x47 // .
+	opSCFS      = 0x48 // Sets Coordinate From the Stack using projection vector and freedom vector
+	opMD0       = 0x49 // Measure Distance
+	opMD1       = 0x4a // .
 	opMPPEM     = 0x4b // Measure Pixels Per EM
 	opMPS       = 0x4c // Measure Point Size
 	opFLIPON    = 0x4d // set the auto FLIP Boolean to ON
@@ -103,7 +103,7 @@ const (
 	opAND       = 0x5a // logical AND
 	opOR        = 0x5b // logical OR
 	opNOT       = 0x5c // logical NOT
-	opDELTAP1   = 0x5d
+	opDELTAP1   = 0x5d // DELTA exception P1
 	opSDB       = 0x5e // Set Delta Base in the graphics state
 	opSDS       = 0x5f // Set Delta Shift in the graphics state
 	opADD       = 0x60 // ADD
@@ -122,12 +122,12 @@ const (
 	opNROUND01  = 0x6d // .
 	opNROUND10  = 0x6e // .
 	opNROUND11  = 0x6f // .
-	opWCVTF     = 0x70
-	opDELTAP2   = 0x71
-	opDELTAP3   = 0x72
-	opDELTAC1   = 0x73
-	opDELTAC2   = 0x74
-	opDELTAC3   = 0x75
+	opWCVTF     = 0x70 // Write Control Value Table in Funits
+	opDELTAP2   = 0x71 // DELTA exception P2
+	opDELTAP3   = 0x72 // DELTA exception P3
+	opDELTAC1   = 0x73 // DELTA exception C1
+	opDELTAC2   = 0x74 // DELTA exception C2
+	opDELTAC3   = 0x75 // DELTA exception C3
 	opSROUND    = 0x76 // Super ROUND
 	opS45ROUND  = 0x77 // Super ROUND 45 degrees
 	opJROT      = 0x78 // Jump Relative On True
@@ -138,21 +138,21 @@ const (
 	opRDTG      = 0x7d // Round Down To Grid
 	opSANGW     = 0x7e // Set ANGle Weight
 	opAA        = 0x7f // Adjust Angle
-	opFLIPPT    = 0x80
-	opFLIPRGON  = 0x81
-	opFLIPRGOFF = 0x82
+	opFLIPPT    = 0x80 // FLIP PoinT
+	opFLIPRGON  = 0x81 // FLIP RanGe ON
+	opFLIPRGOFF = 0x82 // FLIP RanGe OFF
 	op_0x83     = 0x83
 	op_0x84     = 0x84
 	opSCANCTRL  = 0x85 // SCAN conversion ConTRoL
-	opSDPVTL0   = 0x86
-	opSDPVTL1   = 0x87
+	opSDPVTL0   = 0x86 // Set Dual Projection Vector To Line
+	opSDPVTL1   = 0x87 // .
 	opGETINFO   = 0x88 // GET INFOrmation
 	opIDEF      = 0x89 // Instruction DEFinition
 	opROLL      = 0x8a // ROLL the top three stack elements
 	opMAX       = 0x8b // MAXimum of top two stack elements
 	opMIN       = 0x8c // MINimum of top two stack elements
 	opSCANTYPE  = 0x8d // SCANTYPE
-	opINSTCTRL  = 0x8e
+	opINSTCTRL  = 0x8e // INSTRuction execution ConTRoL
 	op_0x8f     = 0x8f
 	op_0x90     = 0x90
 	op_0x91     = 0x91
@@ -234,60 +234,61 @@ const (
 	opMDRP11101 = 0xdd // .
 	opMDRP11110 = 0xde // .
 	opMDRP11111 = 0xdf // .
-	opMIRP00000 = 0xe0
-	opMIRP00001 = 0xe1
-	opMIRP00010 = 0xe2
-	opMIRP00011 = 0xe3
-	opMIRP00100 = 0xe4
-	opMIRP00101 = 0xe5
-	opMIRP00110 = 0xe6
-	opMIRP00111 = 0xe7
-	opMIRP01000 = 0xe8
-	opMIRP01001 = 0xe9
-	opMIRP01010 = 0xea
-	opMIRP01011 = 0xeb
-	opMIRP01100 = 0xec
-	opMIRP01101 = 0xed
-	opMIRP01110 = 0xee
-	opMIRP01111 = 0xef
-	opMIRP10000 = 0xf0
-	opMIRP10001 = 0xf1
-	opMIRP10010 = 0xf2
-	opMIRP10011 = 0xf3
-	opMIRP10100 = 0xf4
-	opMIRP10101 = 0xf5
-	opMIRP10110 = 0xf6
-	opMIRP10111 = 0xf7
-	opMIRP11000 = 0xf8
-	opMIRP11001 = 0xf9
-	opMIRP11010 = 0xfa
-	opMIRP11011 = 0xfb
-	opMIRP11100 = 0xfc
-	opMIRP11101 = 0xfd
-	opMIRP11110 = 0xfe
-	opMIRP11111 = 0xff
+	opMIRP00000 = 0xe0 // Move Indirect Relative Point
+	opMIRP00001 = 0xe1 // .
+	opMIRP00010 = 0xe2 // .
+	opMIRP00011 = 0xe3 // .
+	opMIRP00100 = 0xe4 // .
+	opMIRP00101 = 0xe5 // .
+	opMIRP00110 = 0xe6 // .
+	opMIRP00111 = 0xe7 // .
+	opMIRP01000 = 0xe8 // .
+	opMIRP01001 = 0xe9 // .
+	opMIRP01010 = 0xea // .
+	opMIRP01011 = 0xeb // .
+	opMIRP01100 = 0xec // .
+	opMIRP01101 = 0xed // .
+	opMIRP01110 = 0xee // .
+	opMIRP01111 = 0xef // .
+	opMIRP10000 = 0xf0 // .
+	opMIRP10001 = 0xf1 // .
+	opMIRP10010 = 0xf2 // .
+	opMIRP10011 = 0xf3 // .
+	opMIRP10100 = 0xf4 // .
+	opMIRP10101 = 0xf5 // .
+	opMIRP10110 = 0xf6 // .
+	opMIRP10111 = 0xf7 // .
+	opMIRP11000 = 0xf8 // .
+	opMIRP11001 = 0xf9 // .
+	opMIRP11010 = 0xfa // .
+	opMIRP11011 = 0xfb // .
+	opMIRP11100 = 0xfc // .
+	opMIRP11101 = 0xfd // .
+	opMIRP11110 = 0xfe // .
+	opMIRP11111 = 0xff // .
 )
 
 // popCount is the number of stack elements that each opcode pops.
 var popCount = [256]uint8{
 	// 1, 2, 3, 4, 5, 6, 7, 8, 9, a, b, c, d, e, f
-	0, 0, 0, 0, 0, 0, q, q, q, q, 2, 2, 0, 0, 0, q, // 0x00 - 0x0f
+	0, 0, 0, 0, 0, 0, 2, 2, 2, 2, 2, 2, 0, 0, 0, 5, // 0x00 - 0x0f
 	1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 1, 0, 1, 1, 1, 1, // 0x10 - 0x1f
-	1, 1, 0, 2, 0, 1, 1, q, q, q, 2, 1, 1, 0, 1, 1, // 0x20 - 0x2f
-	q, q, q, q, q, q, q, q, q, q, q, q, 0, 0, q, q, // 0x30 - 0x3f
-	0, 0, 2, 1, q, q, q, q, q, q, q, 0, 0, 0, 0, 0, // 0x40 - 0x4f
-	2, 2, 2, 2, 2, 2, 1, 1, 1, 0, 2, 2, 1, q, 1, 1, // 0x50 - 0x5f
+	1, 1, 0, 2, 0, 1, 1, 2, q, 1, 2, 1, 1, 0, 1, 1, // 0x20 - 0x2f
+	0, 0, 0, 0, 1, 1, 1, 1, 1, 0, 2, 2, 0, 0, 2, 2, // 0x30 - 0x3f
+	0, 0, 2, 1, 2, 1, 1, 1, 2, 2, 2, 0, 0, 0, 0, 0, // 0x40 - 0x4f
+	2, 2, 2, 2, 2, 2, 1, 1, 1, 0, 2, 2, 1, 1, 1, 1, // 0x50 - 0x5f
 	2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 0x60 - 0x6f
-	q, q, q, q, q, q, 1, 1, 2, 2, 0, q, 0, 0, 1, 1, // 0x70 - 0x7f
-	q, q, q, q, q, 1, q, q, 1, 1, 3, 2, 2, 1, q, q, // 0x80 - 0x8f
+	2, 1, 1, 1, 1, 1, 1, 1, 2, 2, 0, q, 0, 0, 1, 1, // 0x70 - 0x7f
+	0, 2, 2, q, q, 1, 2, 2, 1, 1, 3, 2, 2, 1, 2, q, // 0x80 - 0x8f
 	q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, // 0x90 - 0x9f
 	q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, // 0xa0 - 0xaf
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // 0xb0 - 0xbf
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 0xc0 - 0xcf
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 0xd0 - 0xdf
-	q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, // 0xe0 - 0xef
-	q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, q, // 0xf0 - 0xff
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, // 0xe0 - 0xef
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, // 0xf0 - 0xff
 }
 
-// popCount[opcode] == q means that that opcode is not yet implemented.
+// popCount[opcode] == q means that that opcode is not yet implemented, or is
+// not a valid opcode at all.
 const q = 255
@@ -0,0 +1,199 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+// This file implements parsing the post table, which holds the PostScript
+// names of a font's glyphs. The table is documented at
+// http://developer.apple.com/fonts/TTRefMan/RM06/Chap6post.html
+
+import (
+	"fmt"
+)
+
+const (
+	postVersion1 = 0x00010000
+	postVersion2 = 0x00020000
+)
+
+func (f *Font) parsePost() error {
+	if len(f.post) == 0 {
+		return nil
+	}
+	if len(f.post) < 32 {
+		return FormatError(fmt.Sprintf("bad post length: %d", len(f.post)))
+	}
+	f.postVersion = u32(f.post, 0)
+	f.italicAngle = int32(u32(f.post, 4))
+	f.underlinePosition = int32(int16(u16(f.post, 8)))
+	f.underlineThickness = int32(int16(u16(f.post, 10)))
+	f.postFixedPitch = u32(f.post, 12) != 0
+	f.fixedPitch = f.postFixedPitch && f.uniformAdvances()
+	if f.postVersion != postVersion2 {
+		// Version 1.0 fonts use the standard Macintosh glyph order. Versions
+		// 2.5 and 3.0 provide no names that we use. Version 2.5 is
+		// deprecated and version 3.0 deliberately omits the names.
+		return nil
+	}
+	if len(f.post) < 34 {
+		return FormatError("post table too short")
+	}
+	n := int(u16(f.post, 32))
+	if len(f.post) < 34+2*n {
+		return FormatError("post table too short")
+	}
+	f.postNameIndexes = f.post[34 : 34+2*n]
+	// The names that aren't in the standard set are stored as a sequence of
+	// Pascal strings. We record where each of those strings start.
+	f.postStrings = f.postStrings[:0]
+	for offset := 34 + 2*n; offset < len(f.post); {
+		end := offset + 1 + int(f.post[offset])
+		if end > len(f.post) {
+			return FormatError("post table too short")
+		}
+		f.postStrings = append(f.postStrings, offset)
+		offset = end
+	}
+	return nil
+}
+
+// GlyphName returns the PostScript name of the glyph with the given index,
+// as given by the font's post table. It returns an empty string if the font
+// does not name its glyphs, as is the case for post table version 3.0.
+func (f *Font) GlyphName(i Index) string {
+	j := int(i)
+	switch f.postVersion {
+	case postVersion1:
+		if j < len(standardGlyphNames) {
+			return standardGlyphNames[j]
+		}
+	case postVersion2:
+		if 2*j+2 > len(f.postNameIndexes) {
+			return ""
+		}
+		k := int(u16(f.postNameIndexes, 2*j))
+		if k < len(standardGlyphNames) {
+			return standardGlyphNames[k]
+		}
+		k -= len(standardGlyphNames)
+		if k < len(f.postStrings) {
+			offset := f.postStrings[k]
+			return string(f.post[offset+1 : offset+1+int(f.post[offset])])
+		}
+	}
+	return ""
+}
+
+// IndexByName returns the index of the glyph with the given PostScript name,
+// such as "Aacute" or "uni0041". The boolean result is false if the font has
+// no glyph with that name, which distinguishes an unknown name from the name
+// of glyph 0, typically ".notdef". If more than one glyph has the given
+// name, then the lowest such index is returned.
+func (f *Font) IndexByName(name string) (Index, bool) {
+	f.postMapOnce.Do(func() {
+		f.postMap = make(map[string]Index)
+		for i := f.nGlyph - 1; i >= 0; i-- {
+			if s := f.GlyphName(Index(i)); s != "" {
+				f.postMap[s] = Index(i)
+			}
+		}
+	})
+	i, ok := f.postMap[name]
+	return i, ok
+}
+
+// ItalicAngle returns the font's italic angle, in counter-clockwise degrees
+// from the vertical. It is zero for upright fonts, and negative for fonts
+// that lean to the right.
+func (f *Font) ItalicAngle() float64 {
+	return float64(f.italicAngle) / 65536
+}
+
+// UnderlinePosition returns the suggested distance from the baseline to the
+// top of an underline. It is negative if the underline is below the baseline.
+func (f *Font) UnderlinePosition(scale int32) int32 {
+	return f.scale(scale * f.underlinePosition)
+}
+
+// UnderlineThickness returns the suggested thickness of an underline.
+func (f *Font) UnderlineThickness(scale int32) int32 {
+	return f.scale(scale * f.underlineThickness)
+}
+
+// FixedPitchFlag returns the post table's isFixedPitch field, which is
+// whether the font says that it is monospaced. It is false if there is no
+// post table. Use IsFixedPitch to check that the font really is monospaced.
+func (f *Font) FixedPitchFlag() bool {
+	return f.postFixedPitch
+}
+
+// IsFixedPitch returns whether the font is monospaced. It is true if the post
+// table's isFixedPitch field is set and every glyph with a non-zero advance
+// width, such as every glyph other than a combining mark, has the same
+// advance width.
+func (f *Font) IsFixedPitch() bool {
+	return f.fixedPitch
+}
+
+// uniformAdvances returns whether every glyph with a non-zero advance width
+// has the same advance width. The glyphs after the last of the hmtx table's
+// metrics have that metric's advance width, and so need not be checked.
+func (f *Font) uniformAdvances() bool {
+	w := uint16(0)
+	for j := 0; j < f.nHMetric; j++ {
+		a := u16(f.hmtx, 4*j)
+		if a == 0 {
+			continue
+		}
+		if w != 0 && a != w {
+			return false
+		}
+		w = a
+	}
+	return true
+}
+
+// standardGlyphNames are the names of the 258 glyphs in the standard
+// Macintosh glyph order.
+var standardGlyphNames = [...]string{
+	".notdef", ".null", "nonmarkingreturn", "space", "exclam", "quotedbl",
+	"numbersign", "dollar", "percent", "ampersand", "quotesingle",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen",
+	"period", "slash", "zero", "one", "two", "three", "four", "five", "six",
+	"seven", "eight", "nine", "colon", "semicolon", "less", "equal",
+	"greater", "question", "at", "A", "B", "C", "D", "E", "F", "G", "H", "I",
+	"J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X",
+	"Y", "Z", "bracketleft", "backslash", "bracketright", "asciicircum",
+	"underscore", "grave", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j",
+	"k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y",
+	"z", "braceleft", "bar", "braceright", "asciitilde", "Adieresis", "Aring",
+	"Ccedilla", "Eacute", "Ntilde", "Odieresis", "Udieresis", "aacute",
+	"agrave", "acircumflex", "adieresis", "atilde", "aring", "ccedilla",
+	"eacute", "egrave", "ecircumflex", "edieresis", "iacute", "igrave",
+	"icircumflex", "idieresis", "ntilde", "oacute", "ograve", "ocircumflex",
+	"odieresis", "otilde", "uacute", "ugrave", "ucircumflex", "udieresis",
+	"dagger", "degree", "cent", "sterling", "section", "bullet", "paragraph",
+	"germandbls", "registered", "copyright", "trademark", "acute", "dieresis",
+	"notequal", "AE", "Oslash", "infinity", "plusminus", "lessequal",
+	"greaterequal", "yen", "mu", "partialdiff", "summation", "product", "pi",
+	"integral", "ordfeminine", "ordmasculine", "Omega", "ae", "oslash",
+	"questiondown", "exclamdown", "logicalnot", "radical", "florin",
+	"approxequal", "Delta", "guillemotleft", "guillemotright", "ellipsis",
+	"nonbreakingspace", "Agrave", "Atilde", "Otilde", "OE", "oe", "endash",
+	"emdash", "quotedblleft", "quotedblright", "quoteleft", "quoteright",
+	"divide", "lozenge", "ydieresis", "Ydieresis", "fraction", "currency",
+	"guilsinglleft", "guilsinglright", "fi", "fl", "daggerdbl",
+	"periodcentered", "quotesinglbase", "quotedblbase", "perthousand",
+	"Acircumflex", "Ecircumflex", "Aacute", "Edieresis", "Egrave", "Iacute",
+	"Icircumflex", "Idieresis", "Igrave", "Oacute", "Ocircumflex", "apple",
+	"Ograve", "Uacute", "Ucircumflex", "Ugrave", "dotlessi", "circumflex",
+	"tilde", "macron", "breve", "dotaccent", "ring", "cedilla",
+	"hungarumlaut", "ogonek", "caron", "Lslash", "lslash", "Scaron", "scaron",
+	"Zcaron", "zcaron", "brokenbar", "Eth", "eth", "Yacute", "yacute",
+	"Thorn", "thorn", "minus", "multiply", "onesuperior", "twosuperior",
+	"threesuperior", "onehalf", "onequarter", "threequarters", "franc",
+	"Gbreve", "gbreve", "Idotaccent", "Scedilla", "scedilla", "Cacute",
+	"cacute", "Ccaron", "ccaron", "dcroat",
+}
@@ -0,0 +1,159 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"image"
+	"math"
+)
+
+// sdfFlatness is the maximum distance, in pixels, between a curved segment
+// and the linear segments that approximate it when computing a signed
+// distance field.
+const sdfFlatness = 1.0 / 16
+
+// An sdfEdge is a linear segment of a glyph's flattened outline, in the
+// pixel co-ordinate space of a signed distance field.
+type sdfEdge struct {
+	x0, y0, x1, y1 float64
+}
+
+// SDF computes the signed distance field of the glyph in this GlyphBuf. Each
+// pixel's gray value encodes the distance from the pixel's center to the
+// nearest point of the glyph's outline: 0x80 is on the outline, and values
+// increase linearly inside the glyph and decrease outside it, saturating at
+// a distance of spread pixels. Whether a pixel is inside the glyph is
+// decided by the non-zero winding rule, the same as for Mask.
+//
+// The glyph's origin is placed at the 26.6 fixed point position (x, y), as
+// for Mask, and so the field's resolution is the scale at which the glyph
+// was loaded. The field's bounds are those of Mask, outset by spread pixels
+// on each side so that the field falls off to zero. A spread less than 1 is
+// treated as 1.
+func (g *GlyphBuf) SDF(x, y int32, spread int) *image.Gray {
+	if len(g.End) == 0 {
+		return image.NewGray(image.Rectangle{})
+	}
+	if spread < 1 {
+		spread = 1
+	}
+	b := pointBounds(g.Point)
+	r := image.Rect(
+		int(x+b.XMin)>>6-spread,
+		int(y-b.YMax)>>6-spread,
+		int(x+b.XMax+63)>>6+spread,
+		int(y-b.YMin+63)>>6+spread,
+	)
+	edges := g.sdfEdges(x, y)
+	m := image.NewGray(r)
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			cx, cy := float64(px)+0.5, float64(py)+0.5
+			d2, winding := math.Inf(1), 0
+			for _, e := range edges {
+				if v := sdfDist2(e, cx, cy); v < d2 {
+					d2 = v
+				}
+				winding += sdfWinding(e, cx, cy)
+			}
+			d := math.Sqrt(d2)
+			if winding == 0 {
+				d = -d
+			}
+			v := math.Floor(0x80 + d*0x80/float64(spread))
+			m.Pix[(py-r.Min.Y)*m.Stride+(px-r.Min.X)] = uint8(math.Max(0, math.Min(0xff, v)))
+		}
+	}
+	return m
+}
+
+// sdfEdges returns the glyph's outline, with its origin at the 26.6 fixed
+// point position (x, y), as linear segments in pixel co-ordinates in which
+// Y increases downwards.
+func (g *GlyphBuf) sdfEdges(x, y int32) []sdfEdge {
+	var edges []sdfEdge
+	pt := func(p Point) (float64, float64) {
+		return float64(x+p.X) / 64, float64(y-p.Y) / 64
+	}
+	var x0, y0 float64
+	lineTo := func(x1, y1 float64) {
+		if x0 != x1 || y0 != y1 {
+			edges = append(edges, sdfEdge{x0, y0, x1, y1})
+		}
+		x0, y0 = x1, y1
+	}
+	for _, seg := range g.AppendPath(nil) {
+		switch seg.Op {
+		case SegmentOpMoveTo:
+			x0, y0 = pt(seg.Args[0])
+		case SegmentOpLineTo:
+			lineTo(pt(seg.Args[0]))
+		case SegmentOpQuadTo:
+			ax, ay := x0, y0
+			bx, by := pt(seg.Args[0])
+			cx, cy := pt(seg.Args[1])
+			// The distance between a quadratic segment and its approximation
+			// by n linear segments is at most dev/(4*n*n).
+			dev := math.Hypot(ax-2*bx+cx, ay-2*by+cy)
+			n := int(math.Ceil(math.Sqrt(dev / (4 * sdfFlatness))))
+			for i := 1; i < n; i++ {
+				t := float64(i) / float64(n)
+				s := 1 - t
+				lineTo(s*s*ax+2*s*t*bx+t*t*cx, s*s*ay+2*s*t*by+t*t*cy)
+			}
+			lineTo(cx, cy)
+		case SegmentOpCubeTo:
+			ax, ay := x0, y0
+			bx, by := pt(seg.Args[0])
+			cx, cy := pt(seg.Args[1])
+			ex, ey := pt(seg.Args[2])
+			// The distance between a cubic segment and its approximation by
+			// n linear segments is at most 3*dev/(4*n*n).
+			dev := math.Max(
+				math.Hypot(ax-2*bx+cx, ay-2*by+cy),
+				math.Hypot(bx-2*cx+ex, by-2*cy+ey),
+			)
+			n := int(math.Ceil(math.Sqrt(3 * dev / (4 * sdfFlatness))))
+			for i := 1; i < n; i++ {
+				t := float64(i) / float64(n)
+				s := 1 - t
+				lineTo(
+					s*s*s*ax+3*s*s*t*bx+3*s*t*t*cx+t*t*t*ex,
+					s*s*s*ay+3*s*s*t*by+3*s*t*t*cy+t*t*t*ey,
+				)
+			}
+			lineTo(ex, ey)
+		}
+	}
+	return edges
+}
+
+// sdfDist2 returns the square of the distance from (x, y) to the edge e.
+func sdfDist2(e sdfEdge, x, y float64) float64 {
+	dx, dy := e.x1-e.x0, e.y1-e.y0
+	t := ((x-e.x0)*dx + (y-e.y0)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	px, py := e.x0+t*dx-x, e.y0+t*dy-y
+	return px*px + py*py
+}
+
+// sdfWinding returns the contribution of the edge e to the winding number of
+// its outline around (x, y): +1 or -1 if e crosses the horizontal ray that
+// goes rightwards from (x, y), depending on e's direction, and 0 otherwise.
+func sdfWinding(e sdfEdge, x, y float64) int {
+	// The crossing test is half-open in y, so that a ray through a vertex
+	// counts exactly one of the vertex's edges.
+	if (e.y0 <= y) == (e.y1 <= y) {
+		return 0
+	}
+	if e.x0+(y-e.y0)*(e.x1-e.x0)/(e.y1-e.y0) <= x {
+		return 0
+	}
+	if e.y1 > e.y0 {
+		return 1
+	}
+	return -1
+}
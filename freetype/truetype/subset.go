@@ -0,0 +1,315 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"sort"
+)
+
+// subsetTables are the tables that Subset copies unchanged, as they do not
+// depend on glyph indexes.
+var subsetTables = []string{"OS/2", "cvt ", "fpgm", "gasp", "name", "prep"}
+
+// Subset returns the TTF data for a font that contains only the given glyphs
+// of this Font, such as to embed only those glyphs that a document uses. The
+// glyphs are renumbered: the subset's glyph 0 is this Font's glyph 0, the
+// .notdef glyph, which is always included, and it is followed by the given
+// glyphs, in the given order and without duplicates, and then by any other
+// glyphs that the given glyphs use as compound glyph components.
+//
+// The subset's glyf, loca, hmtx, maxp and hhea tables are rebuilt for its
+// glyphs, and its cmap maps every rune that this Font maps to one of the
+// subset's glyphs. The glyph names of the post table are kept. The hinting
+// programs and the OS/2, gasp and name tables are copied unchanged. Other
+// tables, such as those for kerning, bitmaps and font variations, are
+// dropped, and so a variable font's subset has its default outlines.
+//
+// Subsetting a font with CFF outlines, or one that was parsed without its
+// glyph outlines, is not supported.
+func (f *Font) Subset(glyphs []Index) ([]byte, error) {
+	if len(f.cff) != 0 {
+		return nil, UnsupportedError("subsetting CFF outlines")
+	}
+	if len(f.loca) == 0 {
+		return nil, ErrNoOutlines
+	}
+	if f.cmapFormat == 2 {
+		return nil, UnsupportedError("subsetting a font with a legacy CJK cmap")
+	}
+
+	// Choose the subset's glyphs. newIndex maps each of this Font's glyphs
+	// to its subset glyph, plus one, or zero if it is not in the subset.
+	newIndex := make([]int, f.nGlyph)
+	order := []Index{0}
+	newIndex[0] = 1
+	add := func(i Index) error {
+		if int(i) >= f.nGlyph {
+			return FormatError("bad glyph index")
+		}
+		if newIndex[i] == 0 {
+			order = append(order, i)
+			newIndex[i] = len(order)
+		}
+		return nil
+	}
+	for _, i := range glyphs {
+		if err := add(i); err != nil {
+			return nil, err
+		}
+	}
+	// Add the components of the compound glyphs, and of their components,
+	// and so on, and renumber the glyph indexes of their references.
+	glyfs := make([][]byte, 0, len(order))
+	for j := 0; j < len(order); j++ {
+		glyf, err := f.glyphData(order[j])
+		if err != nil {
+			return nil, err
+		}
+		if len(glyf) >= 10 && int16(u16(glyf, 0)) < 0 {
+			glyf = append([]byte(nil), glyf...)
+			for offset := 10; ; {
+				c, offset1, err := decodeComponent(glyf, offset)
+				if err != nil {
+					return nil, err
+				}
+				if err := add(c.glyph); err != nil {
+					return nil, err
+				}
+				// The component's index is patched below, once every glyph
+				// has its subset index.
+				if c.flags&flagMoreComponents == 0 {
+					break
+				}
+				offset = offset1
+			}
+		}
+		glyfs = append(glyfs, glyf)
+	}
+	for _, glyf := range glyfs {
+		if len(glyf) < 10 || int16(u16(glyf, 0)) >= 0 {
+			continue
+		}
+		for offset := 10; ; {
+			c, offset1, _ := decodeComponent(glyf, offset)
+			i := newIndex[c.glyph] - 1
+			glyf[offset+2], glyf[offset+3] = uint8(i>>8), uint8(i)
+			if c.flags&flagMoreComponents == 0 {
+				break
+			}
+			offset = offset1
+		}
+	}
+
+	tables := map[string][]byte{}
+	for _, tag := range subsetTables {
+		if t := *f.table(tag); len(t) != 0 {
+			tables[tag] = t
+		}
+	}
+
+	// Rebuild the glyph tables. Each glyph is padded to a multiple of 4
+	// bytes, and the loca table is in the long format.
+	var glyf, loca, hmtx []byte
+	for j, i := range order {
+		loca = appendUint32(loca, uint32(len(glyf)))
+		glyf = append(glyf, glyfs[j]...)
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+		h := int(i)
+		if h >= f.nHMetric {
+			h = f.nHMetric - 1
+		}
+		hmtx = appendU16s(hmtx, u16(f.hmtx, 4*h), uint16(f.lsb(int(i))))
+	}
+	loca = appendUint32(loca, uint32(len(glyf)))
+	tables["glyf"], tables["loca"], tables["hmtx"] = glyf, loca, hmtx
+
+	head := append([]byte(nil), f.head...)
+	head[50], head[51] = 0, 1
+	copy(head[8:12], []byte{0, 0, 0, 0})
+	tables["head"] = head
+	hhea := append([]byte(nil), f.hhea...)
+	hhea[34], hhea[35] = uint8(len(order)>>8), uint8(len(order))
+	tables["hhea"] = hhea
+	maxp := append([]byte(nil), f.maxp...)
+	maxp[4], maxp[5] = uint8(len(order)>>8), uint8(len(order))
+	tables["maxp"] = maxp
+	tables["cmap"] = f.subsetCmap(newIndex)
+	if len(f.post) != 0 {
+		tables["post"] = f.subsetPost(order)
+	}
+
+	ttf := sfnt(tables)
+	adjustment, err := CheckSumAdjustment(ttf)
+	if err != nil {
+		return nil, err
+	}
+	x := 12
+	for string(ttf[x:x+4]) != "head" {
+		x += 16
+	}
+	copy(ttf[u32(ttf, x+8)+8:], appendUint32(nil, adjustment))
+	return ttf, nil
+}
+
+// subsetCmap returns a cmap table that maps every rune that f maps to a glyph
+// in a subset, whose glyphs are given by newIndex as per Subset. It has a
+// format 4 subtable for the Basic Multilingual Plane, and, if any of the
+// runes are outside that plane, a format 12 subtable for all of them.
+func (f *Font) subsetCmap(newIndex []int) []byte {
+	// runes and indexes are the mapped runes, in increasing order, and
+	// their subset glyphs.
+	var runes []uint32
+	var indexes []uint16
+	for h, cm := range f.cm {
+		for c := uint64(cm.start); c <= uint64(cm.end); c++ {
+			if c == 0xffff {
+				continue
+			}
+			if i := f.cmIndex(h, uint32(c)); int(i) < len(newIndex) && newIndex[i] > 1 {
+				runes = append(runes, uint32(c))
+				indexes = append(indexes, uint16(newIndex[i]-1))
+			}
+		}
+	}
+
+	// Group the runes into runs of consecutive runes that map to consecutive
+	// glyphs.
+	type group struct {
+		start, end uint32
+		glyph      uint16
+	}
+	var groups, bmp []group
+	for j, c := range runes {
+		if n := len(groups); n != 0 && groups[n-1].end+1 == c &&
+			uint32(groups[n-1].glyph)+c-groups[n-1].start == uint32(indexes[j]) &&
+			(c <= 0xffff) == (groups[n-1].start <= 0xffff) {
+			groups[n-1].end = c
+			continue
+		}
+		groups = append(groups, group{c, c, indexes[j]})
+	}
+	for _, g := range groups {
+		if g.start <= 0xffff {
+			bmp = append(bmp, g)
+		}
+	}
+	// A format 4 subtable must end with a segment for 0xFFFF.
+	bmp = append(bmp, group{0xffff, 0xffff, 0})
+
+	segCount := len(bmp)
+	searchRange, entrySelector := 2, 0
+	for searchRange*2 <= 2*segCount {
+		searchRange, entrySelector = searchRange*2, entrySelector+1
+	}
+	format4 := appendU16s(nil, 4, uint16(16+8*segCount), 0, uint16(2*segCount),
+		uint16(searchRange), uint16(entrySelector), uint16(2*segCount-searchRange))
+	for _, g := range bmp {
+		format4 = appendU16s(format4, uint16(g.end))
+	}
+	format4 = appendU16s(format4, 0)
+	for _, g := range bmp {
+		format4 = appendU16s(format4, uint16(g.start))
+	}
+	for _, g := range bmp {
+		// The last segment's delta maps 0xFFFF to glyph 0.
+		format4 = appendU16s(format4, g.glyph-uint16(g.start))
+	}
+	for range bmp {
+		format4 = appendU16s(format4, 0)
+	}
+
+	subtables := [][]byte{format4}
+	encodings := []uint32{0x00030001} // PID = 3 (Microsoft), PSID = 1 (UCS-2).
+	if len(runes) != 0 && runes[len(runes)-1] > 0xffff {
+		format12 := appendU16s(nil, 12, 0)
+		format12 = appendUint32(format12, uint32(16+12*len(groups)))
+		format12 = appendUint32(format12, 0)
+		format12 = appendUint32(format12, uint32(len(groups)))
+		for _, g := range groups {
+			format12 = appendUint32(format12, g.start)
+			format12 = appendUint32(format12, g.end)
+			format12 = appendUint32(format12, uint32(g.glyph))
+		}
+		subtables = append(subtables, format12)
+		encodings = append(encodings, 0x0003000a) // PID = 3 (Microsoft), PSID = 10 (UCS-4).
+	}
+	cmap := appendU16s(nil, 0, uint16(len(subtables)))
+	offset := 4 + 8*len(subtables)
+	for k, s := range subtables {
+		cmap = appendUint32(cmap, encodings[k])
+		cmap = appendUint32(cmap, uint32(offset))
+		offset += len(s)
+	}
+	for _, s := range subtables {
+		cmap = append(cmap, s...)
+	}
+	return cmap
+}
+
+// subsetPost returns a post table for a subset whose glyphs are the given
+// glyphs of f. If f names its glyphs, then the subset's glyphs keep their
+// names, as a version 2.0 table. Otherwise it is a version 3.0 table, which
+// has no names.
+func (f *Font) subsetPost(order []Index) []byte {
+	post := append([]byte(nil), f.post[:32]...)
+	names := make([]string, len(order))
+	named := false
+	for j, i := range order {
+		names[j] = f.GlyphName(i)
+		named = named || names[j] != ""
+	}
+	if !named {
+		copy(post, appendUint32(nil, 0x00030000))
+		return post
+	}
+	copy(post, appendUint32(nil, postVersion2))
+	// Each name is a Pascal string that follows the 258 standard Macintosh
+	// glyph names.
+	post = appendU16s(post, uint16(len(order)))
+	var strs []byte
+	for j, name := range names {
+		post = appendU16s(post, uint16(258+j))
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		strs = append(append(strs, uint8(len(name))), name...)
+	}
+	return append(post, strs...)
+}
+
+// sfnt returns the TTF data for the given tables, keyed by tag.
+func sfnt(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	n := len(tags)
+	searchRange, entrySelector := 16, 0
+	for searchRange*2 <= 16*n {
+		searchRange, entrySelector = searchRange*2, entrySelector+1
+	}
+	ttf := appendUint32(nil, 0x00010000)
+	ttf = appendU16s(ttf, uint16(n), uint16(searchRange), uint16(entrySelector), uint16(16*n-searchRange))
+	offset := 12 + 16*n
+	for _, tag := range tags {
+		t := tables[tag]
+		ttf = append(ttf, tag...)
+		ttf = appendUint32(ttf, TableChecksum(tag, t))
+		ttf = appendUint32(ttf, uint32(offset))
+		ttf = appendUint32(ttf, uint32(len(t)))
+		offset += (len(t) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		ttf = append(ttf, tables[tag]...)
+		for len(ttf)%4 != 0 {
+			ttf = append(ttf, 0)
+		}
+	}
+	return ttf
+}
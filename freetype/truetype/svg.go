@@ -0,0 +1,50 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"strconv"
+)
+
+// SVGPath returns the glyph in this GlyphBuf as SVG path data, suitable for
+// a path element's d attribute. The glyph's origin is placed at the 26.6
+// fixed point position (x, y) in SVG's co-ordinate space, in which, unlike
+// the glyph's, Y increases downwards, and the path's co-ordinates are in
+// pixels. Each of the glyph's contours is a closed subpath, whose curves are
+// not flattened. The contours keep their relative directions, and so the
+// path should be drawn with fill-rule="nonzero", like Mask, so that the
+// glyph's holes are not filled.
+func (g *GlyphBuf) SVGPath(x, y int32) string {
+	var b []byte
+	// pt appends a glyph Point, in SVG's co-ordinates.
+	pt := func(b []byte, p Point) []byte {
+		b = strconv.AppendFloat(b, float64(x+p.X)/64, 'f', -1, 64)
+		b = append(b, ' ')
+		return strconv.AppendFloat(b, float64(y-p.Y)/64, 'f', -1, 64)
+	}
+	for i, s := range g.AppendPath(nil) {
+		switch s.Op {
+		case SegmentOpMoveTo:
+			if i != 0 {
+				b = append(b, 'Z')
+			}
+			b = pt(append(b, 'M'), s.Args[0])
+		case SegmentOpLineTo:
+			b = pt(append(b, 'L'), s.Args[0])
+		case SegmentOpQuadTo:
+			b = pt(append(b, 'Q'), s.Args[0])
+			b = pt(append(b, ' '), s.Args[1])
+		case SegmentOpCubeTo:
+			b = pt(append(b, 'C'), s.Args[0])
+			b = pt(append(b, ' '), s.Args[1])
+			b = pt(append(b, ' '), s.Args[2])
+		}
+	}
+	if len(b) != 0 {
+		b = append(b, 'Z')
+	}
+	return string(b)
+}
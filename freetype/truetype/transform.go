@@ -0,0 +1,119 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"math"
+)
+
+// Oblique slants the glyph in this GlyphBuf by shearing its points, such as
+// to synthesize an oblique style for a font that lacks one. Each point moves
+// horizontally in proportion to its height above the baseline, so that
+// vertical lines lean to the right by the given angle, in radians, or to
+// the left if the angle is negative. A typical oblique angle is 12 degrees.
+// Only g.Point is transformed, and g.B is set to the bounds of the new
+// points.
+func (g *GlyphBuf) Oblique(angle float64) {
+	t := math.Tan(angle)
+	for i, p := range g.Point {
+		g.Point[i].X = p.X + round(float64(p.Y)*t)
+	}
+	g.updateBounds()
+}
+
+// Embolden thickens the glyph in this GlyphBuf, such as to synthesize a bold
+// style for a font that lacks one. Each contour is offset outwards, or
+// inwards for a hole, by half of the given strength, in 26.6 fixed point
+// units, so that the glyph's strokes become that much wider, and each point
+// moves along the bisector of the normals of the two contour segments that
+// meet at it. The glyph's advance width is also increased by the strength.
+// Only g.Point is transformed, and g.B is set to the bounds of the new
+// points. g.End and the points' flags are unchanged.
+func (g *GlyphBuf) Embolden(strength int32) {
+	if strength == 0 || len(g.End) == 0 {
+		return
+	}
+	// TrueType contours fill the area to their right, and CFF contours the
+	// area to their left, and so the glyph's overall orientation decides
+	// which side of a contour is outwards.
+	area, e0 := int64(0), 0
+	for _, e1 := range g.End {
+		ps := g.Point[e0:e1]
+		for j, p := range ps {
+			q := ps[(j+1)%len(ps)]
+			area += int64(p.X)*int64(q.Y) - int64(q.X)*int64(p.Y)
+		}
+		e0 = e1
+	}
+	s := float64(strength) / 2
+	if area > 0 {
+		s = -s
+	}
+	e0 = 0
+	for _, e1 := range g.End {
+		emboldenContour(g.Point[e0:e1], s)
+		e0 = e1
+	}
+	g.AdvanceWidth += strength
+	g.updateBounds()
+}
+
+// emboldenContour offsets the closed contour ps by s to the left of its
+// direction, in the glyph's co-ordinate space whose Y axis points up.
+func emboldenContour(ps []Point, s float64) {
+	n := len(ps)
+	// unit returns the unit vector from p to the next point after p, in the
+	// direction d, that is distinct from p, and false if there is none.
+	unit := func(j, d int) (x, y float64, ok bool) {
+		p := ps[j]
+		for k := 1; k < n; k++ {
+			q := ps[((j+d*k)%n+n)%n]
+			if q.X != p.X || q.Y != p.Y {
+				x, y = float64(q.X-p.X), float64(q.Y-p.Y)
+				l := math.Hypot(x, y)
+				return float64(d) * x / l, float64(d) * y / l, true
+			}
+		}
+		return 0, 0, false
+	}
+	shift := make([]Point, n)
+	for j := range ps {
+		// (ix, iy) is the direction into the point, and (ox, oy) out of it.
+		ix, iy, ok0 := unit(j, -1)
+		ox, oy, ok1 := unit(j, +1)
+		if !ok0 || !ok1 {
+			continue
+		}
+		// The point moves by s along both segments' left normals,
+		// (-iy, ix) and (-oy, ox), which is s/(1+d) along their sum, where
+		// d is the cosine of the angle between the segments. As per the C
+		// Freetype code, a point at a spike, where the contour almost
+		// reverses, is not moved.
+		d := ix*ox + iy*oy
+		if d <= -0.9375 {
+			continue
+		}
+		k := s / (1 + d)
+		shift[j] = Point{X: round(-(iy + oy) * k), Y: round((ix + ox) * k)}
+	}
+	for j := range ps {
+		ps[j].X += shift[j].X
+		ps[j].Y += shift[j].Y
+	}
+}
+
+// round returns x rounded to the nearest integer.
+func round(x float64) int32 {
+	return int32(math.Floor(x + 0.5))
+}
+
+// updateBounds sets g.B to the bounds of g.Point.
+func (g *GlyphBuf) updateBounds() {
+	g.B = Bounds{}
+	if len(g.Point) != 0 {
+		g.B = pointBounds(g.Point)
+	}
+}
@@ -19,7 +19,13 @@
 package truetype
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 // An Index is a Font's index of a rune.
@@ -31,12 +37,53 @@ type Bounds struct {
 	XMin, YMin, XMax, YMax int32
 }
 
+// Union returns the smallest Bounds that contains both b and c.
+func (b Bounds) Union(c Bounds) Bounds {
+	if b.XMin > c.XMin {
+		b.XMin = c.XMin
+	}
+	if b.YMin > c.YMin {
+		b.YMin = c.YMin
+	}
+	if b.XMax < c.XMax {
+		b.XMax = c.XMax
+	}
+	if b.YMax < c.YMax {
+		b.YMax = c.YMax
+	}
+	return b
+}
+
 // An HMetric holds the horizontal metrics of a single glyph.
 type HMetric struct {
 	AdvanceWidth    int32
 	LeftSideBearing int32
 }
 
+// A VMetric holds the vertical metrics of a single glyph.
+type VMetric struct {
+	AdvanceHeight  int32
+	TopSideBearing int32
+}
+
+// A Metrics holds the metrics of a Font that are common to all of its glyphs,
+// such as for laying out lines of text.
+type Metrics struct {
+	// Ascent is the distance from the baseline to the top of a line of
+	// text, and Descent the distance from the baseline to its bottom.
+	// Both are usually positive.
+	Ascent, Descent int32
+	// LineGap is the recommended space between one line's bottom and the
+	// next line's top.
+	LineGap int32
+	// Height is the recommended distance between the baselines of
+	// consecutive lines, Ascent plus Descent plus LineGap.
+	Height int32
+	// XHeight is the height of the font's lower case letters, and
+	// CapHeight the height of its upper case letters.
+	XHeight, CapHeight int32
+}
+
 // A FormatError reports that the input is not a valid TrueType font.
 type FormatError string
 
@@ -57,6 +104,11 @@ func u32(b []byte, i int) uint32 {
 	return uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])
 }
 
+// u24 returns the big-endian 24-bit unsigned integer at b[i:].
+func u24(b []byte, i int) uint32 {
+	return uint32(b[i])<<16 | uint32(b[i+1])<<8 | uint32(b[i+2])
+}
+
 // u16 returns the big-endian uint16 at b[i:].
 func u16(b []byte, i int) uint16 {
 	return uint16(b[i])<<8 | uint16(b[i+1])
@@ -79,44 +131,185 @@ func readTable(ttf []byte, offsetLength []byte) ([]byte, error) {
 	return ttf[offset:end], nil
 }
 
+// TableChecksum returns the checksum of the table with the given tag and
+// data, as recorded in a font's table directory: the sum of the table's
+// big-endian uint32s, as if it were padded with zeroes to a multiple of 4
+// bytes long. A head table's checkSumAdjustment field is treated as zero.
+func TableChecksum(tag string, b []byte) (sum uint32) {
+	for i := 0; i < len(b); i += 4 {
+		var v uint32
+		for j := 0; j < 4; j++ {
+			v <<= 8
+			if i+j < len(b) {
+				v |= uint32(b[i+j])
+			}
+		}
+		if tag == "head" && i == 8 {
+			v = 0
+		}
+		sum += v
+	}
+	return sum
+}
+
+// CheckSumAdjustment returns the value of the head table's checkSumAdjustment
+// field for the given TTF data, which is such that the checksum of the whole
+// data, with that field in place, is 0xB1B0AFBA. The data's current value of
+// the field is ignored, and so the result can be copied into the head table
+// of data that has been modified. The data's tables must be 4-byte aligned,
+// as the TrueType specification requires.
+func CheckSumAdjustment(ttf []byte) (uint32, error) {
+	if len(ttf) < 12 {
+		return 0, FormatError("TTF data is too short")
+	}
+	n := int(u16(ttf, 4))
+	if len(ttf) < 16*n+12 {
+		return 0, FormatError("TTF data is too short")
+	}
+	for i := 0; i < n; i++ {
+		x := 16*i + 12
+		if string(ttf[x:x+4]) != "head" {
+			continue
+		}
+		head, err := readTable(ttf, ttf[x+8:x+16])
+		if err != nil {
+			return 0, err
+		}
+		if len(head) < 12 || u32(ttf, x+8)%4 != 0 {
+			return 0, FormatError("bad head table")
+		}
+		// Subtracting the field's current value is the same as treating it
+		// as zero.
+		return 0xb1b0afba - TableChecksum("", ttf) + u32(head, 8), nil
+	}
+	return 0, FormatError("missing head table")
+}
+
 const (
 	locaOffsetFormatUnknown int = iota
 	locaOffsetFormatShort
 	locaOffsetFormatLong
 )
 
-// A cm holds a parsed cmap entry.
+// A cm holds a parsed cmap entry. For a format 4 cmap, a non-zero offset is
+// the offset into the cmap's glyphIdArray. For a format 12 cmap, offset is
+// always zero.
 type cm struct {
-	start, end, delta, offset uint16
+	start, end, delta, offset uint32
 }
 
-// A Font represents a Truetype font.
+// A Font represents a Truetype font. A Font is not modified after it is
+// parsed, other than by lazily built caches that are guarded against
+// concurrent access, so its methods are safe to call from multiple
+// goroutines, and multiple goroutines can load glyphs from the one Font
+// concurrently, provided that each uses its own GlyphBuf and Hinter.
+//
+// Any state that is specific to loading or hinting a glyph belongs in a
+// GlyphBuf or a Hinter, not in a Font.
 type Font struct {
 	// Tables sliced from the TTF data. The different tables are documented
 	// at http://developer.apple.com/fonts/TTRefMan/RM06/Chap6.html
-	cmap, cvt, fpgm, glyf, head, hhea, hmtx, kern, loca, maxp, prep []byte
+	avar, cbdt, cblc, cff, cmap, colr, cpal, cvt, ebdt, eblc, fpgm, fvar, gasp, glyf, gpos, gvar, hdmx, head, hhea, hmtx, kern, loca, ltsh, maxp, name, os2, post, prep, sbix, vhea, vmtx, vorg []byte
 
 	cmapIndexes []byte
 
+	// cmapFormat is the format of the cmap subtable that Index uses.
+	cmapFormat int
+	// cmapUVS is the format 14 cmap subtable, which maps Unicode variation
+	// sequences to glyphs. It is empty if the font has no such subtable.
+	cmapUVS []byte
+
 	// Cached values derived from the raw ttf data.
-	cm                      []cm
-	locaOffsetFormat        int
-	nGlyph, nHMetric, nKern int
-	fUnitsPerEm             int32
-	bounds                  Bounds
+	cm                         []cm
+	locaOffsetFormat           int
+	nGlyph, nHMetric, nVMetric int
+	fUnitsPerEm                int32
+	bounds                     Bounds
+	// The ascent, descent and line gap from the hhea table, and the
+	// typographic ascent, descent and line gap from the OS/2 table (or the
+	// hhea values if there is no OS/2 table, or it is too short to have
+	// them).
+	ascent, descent, lineGap             int32
+	typoAscent, typoDescent, typoLineGap int32
+	// Other values from the OS/2 table. They are zero if there is no OS/2
+	// table, and the heights are also zero for OS/2 versions before 2, or
+	// for a table that is too short to have them.
+	xHeight, capHeight      int32
+	weightClass, widthClass uint16
+	// Values from the post table. postNameIndexes is the glyphNameIndex
+	// array and postStrings holds the offsets of the Pascal strings that
+	// follow it.
+	postVersion                           uint32
+	italicAngle                           int32
+	underlinePosition, underlineThickness int32
+	postNameIndexes                       []byte
+	postStrings                           []int
+	// postFixedPitch is the post table's isFixedPitch field, and fixedPitch
+	// is whether that field is set and the advance widths bear it out.
+	postFixedPitch, fixedPitch bool
+	// postMap maps glyph names to indexes. It is built lazily, the first
+	// time that IndexByName is called.
+	postMap     map[string]Index
+	postMapOnce sync.Once
+	// kernSubtables holds the kern table's subtables of horizontal kerning
+	// pairs, in the order that they are applied.
+	kernSubtables []kernSubtable
+	// gposKern holds, for each of the GPOS table's kerning lookups, the
+	// offsets of that lookup's pair adjustment subtables.
+	gposKern [][]int
+	// bitmapStrikes and colorStrikes hold the EBLC and CBLC tables' strikes
+	// of embedded bitmaps, and sbixStrikes holds the sbix table's strikes.
+	bitmapStrikes, colorStrikes []bitmapStrike
+	sbixStrikes                 []sbixStrike
+	// Values from the CFF table, for a font with PostScript outlines.
+	// cffSubrs holds each Font DICT's local subroutines. cffFDSelect maps
+	// each glyph to its Font DICT, and is nil unless the font is CID-keyed,
+	// as other fonts have only one Font DICT.
+	cffCharStrings, cffGlobalSubrs cffIndex
+	cffSubrs                       []cffIndex
+	cffFDSelect                    []byte
+	// avarSegments holds the avar table's segment map for each axis of a
+	// variable font. It is nil if the font has no avar table.
+	avarSegments [][]byte
 	// Values from the maxp section.
+	maxPoints, maxContours, maxCompositePoints, maxCompositeContours uint16
 	maxTwilightPoints, maxStorage, maxFunctionDefs, maxStackElements uint16
+	// maxComponentDepth is how deeply compound glyphs may nest, as given by
+	// ParseOptions.
+	maxComponentDepth int
+	// otherTables holds the tables that the Font does not use, or that
+	// ParseOptions skipped, keyed by tag, for the Table method.
+	otherTables map[string][]byte
+	// reader is the data that ParseReader parsed the Font from, and
+	// readerTables holds the position in it of each table that is read on
+	// demand. For those tables, the table slices above are nil.
+	reader       io.ReaderAt
+	readerTables map[string]readerTable
 }
 
 func (f *Font) parseCmap() error {
 	const (
-		cmapFormat4         = 4
 		languageIndependent = 0
 
 		// A 32-bit encoding consists of a most-significant 16-bit Platform ID and a
 		// least-significant 16-bit Platform Specific ID.
-		unicodeEncoding   = 0x00000003 // PID = 0 (Unicode), PSID = 3 (Unicode 2.0)
-		microsoftEncoding = 0x00030001 // PID = 3 (Microsoft), PSID = 1 (UCS-2)
+		unicodeEncoding       = 0x00000003 // PID = 0 (Unicode), PSID = 3 (Unicode 2.0 BMP)
+		unicodeFullEncoding   = 0x00000004 // PID = 0 (Unicode), PSID = 4 (Unicode 2.0 full repertoire)
+		unicodeFullEncoding6  = 0x00000006 // PID = 0 (Unicode), PSID = 6 (Unicode full repertoire)
+		microsoftEncoding     = 0x00030001 // PID = 3 (Microsoft), PSID = 1 (UCS-2)
+		microsoftUCS4Encoding = 0x0003000a // PID = 3 (Microsoft), PSID = 10 (UCS-4)
+
+		// The Microsoft platform's legacy CJK encodings, which are typically
+		// used with a format 2 subtable.
+		microsoftShiftJISEncoding = 0x00030002 // PID = 3 (Microsoft), PSID = 2 (ShiftJIS)
+		microsoftJohabEncoding    = 0x00030006 // PID = 3 (Microsoft), PSID = 6 (Johab)
+
+		// The Macintosh Roman encoding, which some old fonts have instead of
+		// a Unicode encoding.
+		macintoshRomanEncoding = 0x00010000 // PID = 1 (Macintosh), PSID = 0 (Roman)
+
+		// The encoding for a format 14 subtable.
+		unicodeVariationEncoding = 0x00000005 // PID = 0 (Unicode), PSID = 5 (Variation Sequences)
 	)
 
 	if len(f.cmap) < 4 {
@@ -126,63 +319,205 @@ func (f *Font) parseCmap() error {
 	if len(f.cmap) < 8*nsubtab+4 {
 		return FormatError("cmap too short")
 	}
-	offset, found, x := 0, false, 4
+	offset, bestRank, x := 0, 0, 4
+	encoding := uint32(0)
+	f.cmapUVS = nil
 	for i := 0; i < nsubtab; i++ {
 		// We read the 16-bit Platform ID and 16-bit Platform Specific ID as a single uint32.
 		// All values are big-endian.
 		pidPsid, o := u32(f.cmap, x), u32(f.cmap, x+4)
 		x += 8
-		// We prefer the Unicode cmap encoding. Failing to find that, we fall
-		// back onto the Microsoft cmap encoding.
-		if pidPsid == unicodeEncoding {
-			offset, found = int(o), true
-			break
-		} else if pidPsid == microsoftEncoding {
-			offset, found = int(o), true
-			// We don't break out of the for loop, so that Unicode can override Microsoft.
+		if pidPsid == unicodeVariationEncoding {
+			if o > uint32(len(f.cmap)-10) || u16(f.cmap, int(o)) != 14 {
+				return FormatError("bad cmap format 14 subtable")
+			}
+			length := u32(f.cmap, int(o)+2)
+			if length > uint32(len(f.cmap))-o {
+				return FormatError("bad cmap format 14 subtable")
+			}
+			f.cmapUVS = f.cmap[o : o+length]
+			continue
+		}
+		// We prefer the encodings that cover the full Unicode repertoire,
+		// since they can map runes outside of the Basic Multilingual Plane.
+		// Failing that, we prefer the Unicode BMP encoding, then the
+		// Microsoft UCS-2 encoding, then the legacy CJK encodings and then
+		// the Macintosh Roman encoding.
+		rank := 0
+		switch {
+		case pidPsid == microsoftUCS4Encoding || pidPsid == unicodeFullEncoding || pidPsid == unicodeFullEncoding6:
+			rank = 5
+		case pidPsid == unicodeEncoding:
+			rank = 4
+		case pidPsid == microsoftEncoding:
+			rank = 3
+		case microsoftShiftJISEncoding <= pidPsid && pidPsid <= microsoftJohabEncoding:
+			rank = 2
+		case pidPsid == macintoshRomanEncoding:
+			rank = 1
+		}
+		if rank > bestRank {
+			offset, bestRank, encoding = int(o), rank, pidPsid
 		}
 	}
-	if !found {
+	if bestRank == 0 {
 		return UnsupportedError("cmap encoding")
 	}
-	if offset <= 0 || offset > len(f.cmap) {
+	if offset <= 0 || offset > len(f.cmap)-8 {
 		return FormatError("bad cmap offset")
 	}
 
-	cmapFormat := u16(f.cmap, offset)
-	if cmapFormat != cmapFormat4 {
-		return UnsupportedError(fmt.Sprintf("cmap format: %d", cmapFormat))
-	}
-	language := u16(f.cmap, offset+4)
-	if language != languageIndependent {
-		return UnsupportedError(fmt.Sprintf("language: %d", language))
-	}
-	segCountX2 := int(u16(f.cmap, offset+6))
-	if segCountX2%2 == 1 {
-		return FormatError(fmt.Sprintf("bad segCountX2: %d", segCountX2))
-	}
-	segCount := segCountX2 / 2
-	offset += 14
-	f.cm = make([]cm, segCount)
-	for i := 0; i < segCount; i++ {
-		f.cm[i].end = u16(f.cmap, offset)
-		offset += 2
-	}
-	offset += 2
-	for i := 0; i < segCount; i++ {
-		f.cm[i].start = u16(f.cmap, offset)
+	f.cmapFormat = int(u16(f.cmap, offset))
+	switch f.cmapFormat {
+	case 0, 6:
+		// These formats map single byte, or, for format 6, 16-bit,
+		// character codes, which are converted to runes.
+		if len(f.cmap) < offset+6 {
+			return FormatError("cmap too short")
+		}
+		language := u16(f.cmap, offset+4)
+		if language != languageIndependent {
+			return UnsupportedError(fmt.Sprintf("language: %d", language))
+		}
+		var glyphs []uint16
+		firstCode := 0
+		if f.cmapFormat == 0 {
+			if len(f.cmap) < offset+6+256 {
+				return FormatError("cmap too short")
+			}
+			for _, g := range f.cmap[offset+6 : offset+6+256] {
+				glyphs = append(glyphs, uint16(g))
+			}
+		} else {
+			if len(f.cmap) < offset+10 {
+				return FormatError("cmap too short")
+			}
+			firstCode = int(u16(f.cmap, offset+6))
+			n := int(u16(f.cmap, offset+8))
+			if len(f.cmap) < offset+10+2*n {
+				return FormatError("cmap too short")
+			}
+			if firstCode+n > 0x10000 {
+				return FormatError("bad cmap format 6 subtable")
+			}
+			for i := 0; i < n; i++ {
+				glyphs = append(glyphs, u16(f.cmap, offset+10+2*i))
+			}
+		}
+		toRune := func(c int) rune { return rune(c) }
+		if encoding == macintoshRomanEncoding {
+			toRune = func(c int) rune {
+				if c >= 0x80 && c < 0x100 {
+					return macRoman[c-0x80]
+				}
+				return rune(c)
+			}
+		}
+		f.cm = byteCM(glyphs, firstCode, toRune)
+		return nil
+
+	case 2:
+		length := int(u16(f.cmap, offset+2))
+		language := u16(f.cmap, offset+4)
+		if language != languageIndependent {
+			return UnsupportedError(fmt.Sprintf("language: %d", language))
+		}
+		if length < 6+512+8 || len(f.cmap) < offset+length {
+			return FormatError("bad cmap length")
+		}
+		f.cmapIndexes = f.cmap[offset : offset+length]
+		return nil
+
+	case 4:
+		language := u16(f.cmap, offset+4)
+		if language != languageIndependent {
+			return UnsupportedError(fmt.Sprintf("language: %d", language))
+		}
+		segCountX2 := int(u16(f.cmap, offset+6))
+		if segCountX2%2 == 1 {
+			return FormatError(fmt.Sprintf("bad segCountX2: %d", segCountX2))
+		}
+		segCount := segCountX2 / 2
+		offset += 14
+		if len(f.cmap) < offset+2+8*segCount {
+			return FormatError("cmap too short")
+		}
+		f.cm = make([]cm, segCount)
+		for i := 0; i < segCount; i++ {
+			f.cm[i].end = uint32(u16(f.cmap, offset))
+			offset += 2
+		}
 		offset += 2
+		for i := 0; i < segCount; i++ {
+			f.cm[i].start = uint32(u16(f.cmap, offset))
+			offset += 2
+		}
+		for i := 0; i < segCount; i++ {
+			f.cm[i].delta = uint32(u16(f.cmap, offset))
+			offset += 2
+		}
+		for i := 0; i < segCount; i++ {
+			f.cm[i].offset = uint32(u16(f.cmap, offset))
+			offset += 2
+		}
+		f.cmapIndexes = f.cmap[offset:]
+		return nil
+
+	case 12:
+		if len(f.cmap) < offset+16 {
+			return FormatError("cmap too short")
+		}
+		if u16(f.cmap, offset+2) != 0 {
+			return FormatError(fmt.Sprintf("cmap format: % x", f.cmap[offset:offset+4]))
+		}
+		length := u32(f.cmap, offset+4)
+		language := u32(f.cmap, offset+8)
+		if language != languageIndependent {
+			return UnsupportedError(fmt.Sprintf("language: %d", language))
+		}
+		nGroups := u32(f.cmap, offset+12)
+		if length != 12*nGroups+16 || uint32(len(f.cmap)-offset) < length {
+			return FormatError("inconsistent cmap length")
+		}
+		offset += 16
+		f.cm = make([]cm, nGroups)
+		for i := uint32(0); i < nGroups; i++ {
+			f.cm[i].start = u32(f.cmap, offset+0)
+			f.cm[i].end = u32(f.cmap, offset+4)
+			f.cm[i].delta = u32(f.cmap, offset+8) - f.cm[i].start
+			offset += 12
+		}
+		return nil
+
+	default:
+		return UnsupportedError(fmt.Sprintf("cmap format: %d", f.cmapFormat))
 	}
-	for i := 0; i < segCount; i++ {
-		f.cm[i].delta = u16(f.cmap, offset)
-		offset += 2
+}
+
+// byteCM returns the cmap entries for a format 0 or format 6 cmap subtable,
+// which map the character codes from firstCode onwards to the given glyphs.
+// The entries map the runes that toRune converts the codes to, and, as Index
+// requires, they are sorted by rune.
+func byteCM(glyphs []uint16, firstCode int, toRune func(c int) rune) []cm {
+	var entries []cm
+	for i, g := range glyphs {
+		if g == 0 {
+			continue
+		}
+		r := uint32(toRune(firstCode + i))
+		entries = append(entries, cm{start: r, end: r, delta: uint32(g) - r})
 	}
-	for i := 0; i < segCount; i++ {
-		f.cm[i].offset = u16(f.cmap, offset)
-		offset += 2
+	sort.Slice(entries, func(i, j int) bool { return entries[i].start < entries[j].start })
+	// Merge consecutive runes that map to consecutive glyphs.
+	merged := entries[:0]
+	for _, e := range entries {
+		if n := len(merged); n != 0 && merged[n-1].end+1 == e.start && merged[n-1].delta == e.delta {
+			merged[n-1].end = e.end
+			continue
+		}
+		merged = append(merged, e)
 	}
-	f.cmapIndexes = f.cmap[offset:]
-	return nil
+	return merged
 }
 
 func (f *Font) parseHead() error {
@@ -190,6 +525,11 @@ func (f *Font) parseHead() error {
 		return FormatError(fmt.Sprintf("bad head length: %d", len(f.head)))
 	}
 	f.fUnitsPerEm = int32(u16(f.head, 18))
+	// The OpenType specification says that unitsPerEm is in the range
+	// [16, 16384].
+	if f.fUnitsPerEm < 16 || f.fUnitsPerEm > 16384 {
+		return FormatError(fmt.Sprintf("bad unitsPerEm: %d", f.fUnitsPerEm))
+	}
 	f.bounds.XMin = int32(int16(u16(f.head, 36)))
 	f.bounds.YMin = int32(int16(u16(f.head, 38)))
 	f.bounds.XMax = int32(int16(u16(f.head, 40)))
@@ -209,13 +549,169 @@ func (f *Font) parseHhea() error {
 	if len(f.hhea) != 36 {
 		return FormatError(fmt.Sprintf("bad hhea length: %d", len(f.hhea)))
 	}
+	f.ascent = int32(int16(u16(f.hhea, 4)))
+	f.descent = int32(int16(u16(f.hhea, 6)))
+	f.lineGap = int32(int16(u16(f.hhea, 8)))
 	f.nHMetric = int(u16(f.hhea, 34))
+	// Glyphs after the last of the hmtx table's metrics re-use its advance
+	// width, so there must be at least one.
+	if f.nHMetric == 0 && f.nGlyph != 0 {
+		return FormatError("bad number of hmtx metrics: 0")
+	}
 	if 4*f.nHMetric+2*(f.nGlyph-f.nHMetric) != len(f.hmtx) {
 		return FormatError(fmt.Sprintf("bad hmtx length: %d", len(f.hmtx)))
 	}
 	return nil
 }
 
+func (f *Font) parseOS2() error {
+	// The OS/2 table has grown with each version, and some fonts have
+	// tables that are shorter than their version implies, such as the
+	// original 68 byte table, which has no typographic metrics. Only the
+	// fields that are present are used, and the typographic metrics
+	// otherwise fall back to the hhea ones.
+	f.typoAscent, f.typoDescent, f.typoLineGap = f.ascent, f.descent, f.lineGap
+	if len(f.os2) >= 8 {
+		f.weightClass = u16(f.os2, 4)
+		f.widthClass = u16(f.os2, 6)
+	}
+	if len(f.os2) >= 74 {
+		f.typoAscent = int32(int16(u16(f.os2, 68)))
+		f.typoDescent = int32(int16(u16(f.os2, 70)))
+		f.typoLineGap = int32(int16(u16(f.os2, 72)))
+	}
+	if len(f.os2) >= 90 && u16(f.os2, 0) >= 2 {
+		f.xHeight = int32(int16(u16(f.os2, 86)))
+		f.capHeight = int32(int16(u16(f.os2, 88)))
+	}
+	return nil
+}
+
+func (f *Font) parseVhea() error {
+	// The vhea and vmtx tables are optional, but if one is present then
+	// the other must be too.
+	if len(f.vhea) == 0 && len(f.vmtx) == 0 {
+		return nil
+	}
+	if len(f.vhea) != 36 {
+		return FormatError(fmt.Sprintf("bad vhea length: %d", len(f.vhea)))
+	}
+	f.nVMetric = int(u16(f.vhea, 34))
+	if f.nVMetric == 0 || 4*f.nVMetric+2*(f.nGlyph-f.nVMetric) != len(f.vmtx) {
+		return FormatError(fmt.Sprintf("bad vmtx length: %d", len(f.vmtx)))
+	}
+	return nil
+}
+
+func (f *Font) parseVORG() error {
+	// The VORG table is documented at
+	// http://www.microsoft.com/typography/otspec/vorg.htm
+	if len(f.vorg) == 0 {
+		return nil
+	}
+	if len(f.vorg) < 8 {
+		return FormatError(fmt.Sprintf("bad VORG length: %d", len(f.vorg)))
+	}
+	if major := u16(f.vorg, 0); major != 1 {
+		return UnsupportedError(fmt.Sprintf("VORG version: %d", major))
+	}
+	if n := int(u16(f.vorg, 6)); 8+4*n > len(f.vorg) {
+		return FormatError("VORG table too short")
+	}
+	return nil
+}
+
+func (f *Font) parseGasp() error {
+	// The gasp table is documented at
+	// http://www.microsoft.com/typography/otspec/gasp.htm
+	if len(f.gasp) == 0 {
+		return nil
+	}
+	if len(f.gasp) < 4 {
+		return FormatError(fmt.Sprintf("bad gasp length: %d", len(f.gasp)))
+	}
+	if v := u16(f.gasp, 0); v > 1 {
+		return UnsupportedError(fmt.Sprintf("gasp version: %d", v))
+	}
+	if n := int(u16(f.gasp, 2)); 4+4*n > len(f.gasp) {
+		return FormatError("gasp table too short")
+	}
+	return nil
+}
+
+func (f *Font) parseHdmx() error {
+	// The hdmx table is documented at
+	// http://www.microsoft.com/typography/otspec/hdmx.htm
+	if len(f.hdmx) == 0 {
+		return nil
+	}
+	if len(f.hdmx) < 8 {
+		return FormatError(fmt.Sprintf("bad hdmx length: %d", len(f.hdmx)))
+	}
+	if v := u16(f.hdmx, 0); v != 0 {
+		return UnsupportedError(fmt.Sprintf("hdmx version: %d", v))
+	}
+	// Each device record is a size, a maximum width and then one width for
+	// each glyph, padded to a multiple of four bytes.
+	n, size := int(int16(u16(f.hdmx, 2))), int(int32(u32(f.hdmx, 4)))
+	if n < 0 || size < 2+f.nGlyph {
+		return FormatError(fmt.Sprintf("bad hdmx record size: %d", size))
+	}
+	if 8+n*size > len(f.hdmx) {
+		return FormatError("hdmx table too short")
+	}
+	return nil
+}
+
+func (f *Font) parseLTSH() error {
+	// The LTSH table is documented at
+	// http://www.microsoft.com/typography/otspec/ltsh.htm
+	if len(f.ltsh) == 0 {
+		return nil
+	}
+	if len(f.ltsh) < 4 {
+		return FormatError(fmt.Sprintf("bad LTSH length: %d", len(f.ltsh)))
+	}
+	if v := u16(f.ltsh, 0); v != 0 {
+		return UnsupportedError(fmt.Sprintf("LTSH version: %d", v))
+	}
+	if n := int(u16(f.ltsh, 2)); n != f.nGlyph {
+		return FormatError(fmt.Sprintf("bad number of LTSH glyphs: %d", n))
+	}
+	if 4+f.nGlyph > len(f.ltsh) {
+		return FormatError("LTSH table too short")
+	}
+	return nil
+}
+
+// A kernSubtable is a format 0 kern subtable, which lists kerning pairs.
+type kernSubtable struct {
+	// pairs holds the kerning pairs, each of which is a 32-bit glyph pair
+	// followed by a 16-bit value, sorted by glyph pair.
+	pairs []byte
+	// override is whether the subtable's values replace, rather than add
+	// to, those of the preceding subtables.
+	override bool
+}
+
+// lookup returns the kerning value for the glyph pair g, and whether the
+// subtable lists that pair.
+func (t *kernSubtable) lookup(g uint32) (int32, bool) {
+	lo, hi := 0, len(t.pairs)/6
+	for lo < hi {
+		i := (lo + hi) / 2
+		ig := u32(t.pairs, 6*i)
+		if ig < g {
+			lo = i + 1
+		} else if ig > g {
+			hi = i
+		} else {
+			return int32(int16(u16(t.pairs, 6*i+4))), true
+		}
+	}
+	return 0, false
+}
+
 func (f *Font) parseKern() error {
 	// Apple's TrueType documentation (http://developer.apple.com/fonts/TTRefMan/RM06/Chap6kern.html) says:
 	// "Previous versions of the 'kern' table defined both the version and nTables fields in the header
@@ -224,44 +720,88 @@ func (f *Font) parseKern() error {
 	// Windows still uses the older format for the 'kern' table and will not recognize the newer one.
 	// Fonts targeted for the Mac OS only should use the new format; fonts targeted for both the Mac OS
 	// and Windows should use the old format."
-	// Since we expect that almost all fonts aim to be Windows-compatible, we only parse the "older" format,
-	// just like the C Freetype implementation.
+	// We parse both formats' headers, but, like the C Freetype implementation, we only use format 0
+	// subtables of horizontal kerning pairs, and ignore the others, such as Apple's format 1 state
+	// machines, cross-stream kerning and Microsoft's minimum values.
+	f.kernSubtables = nil
 	if len(f.kern) == 0 {
-		if f.nKern != 0 {
-			return FormatError("bad kern table length")
-		}
 		return nil
 	}
-	if len(f.kern) < 18 {
+	if len(f.kern) < 4 {
 		return FormatError("kern data too short")
 	}
-	version, offset := u16(f.kern, 0), 2
-	if version != 0 {
+	var n, offset int
+	apple := false
+	switch version := u16(f.kern, 0); version {
+	case 0:
+		n, offset = int(u16(f.kern, 2)), 4
+	case 1:
+		// Apple's version is the 16.16 fixed point number 1.0.
+		if len(f.kern) < 8 || u16(f.kern, 2) != 0 {
+			return UnsupportedError(fmt.Sprintf("kern version: 0x%08x", u32(f.kern, 0)))
+		}
+		n, offset, apple = int(u32(f.kern, 4)), 8, true
+	default:
 		return UnsupportedError(fmt.Sprintf("kern version: %d", version))
 	}
-	n, offset := u16(f.kern, offset), offset+2
-	if n != 1 {
-		return UnsupportedError(fmt.Sprintf("kern nTables: %d", n))
-	}
-	offset += 2
-	length, offset := int(u16(f.kern, offset)), offset+2
-	coverage, offset := u16(f.kern, offset), offset+2
-	if coverage != 0x0001 {
-		// We only support horizontal kerning.
-		return UnsupportedError(fmt.Sprintf("kern coverage: 0x%04x", coverage))
-	}
-	f.nKern, offset = int(u16(f.kern, offset)), offset+2
-	if 6*f.nKern != length-14 {
-		return FormatError("bad kern table length")
+	for i := 0; i < n; i++ {
+		var (
+			length, headerSize, format int
+			use, override              bool
+		)
+		if apple {
+			if offset+8 > len(f.kern) {
+				return FormatError("kern data too short")
+			}
+			if l := u32(f.kern, offset); l > uint32(len(f.kern)-offset) {
+				return FormatError("bad kern table length")
+			}
+			length, headerSize = int(u32(f.kern, offset)), 8
+			// The coverage's high byte holds the vertical, cross-stream and
+			// variation flags, and its low byte is the format.
+			coverage := u16(f.kern, offset+4)
+			use, format = coverage&0xe000 == 0, int(coverage&0xff)
+		} else {
+			if offset+6 > len(f.kern) {
+				return FormatError("kern data too short")
+			}
+			length, headerSize = int(u16(f.kern, offset+2)), 6
+			// The coverage's low byte holds the horizontal, minimum,
+			// cross-stream and override flags, and its high byte is the
+			// format.
+			coverage := u16(f.kern, offset+4)
+			use, override, format = coverage&0x0007 == 0x0001, coverage&0x0008 != 0, int(coverage>>8)
+		}
+		if length < headerSize || length > len(f.kern)-offset {
+			return FormatError("bad kern table length")
+		}
+		if use && format == 0 {
+			b := f.kern[offset+headerSize : offset+length]
+			if len(b) < 8 || 6*int(u16(b, 0)) != len(b)-8 {
+				return FormatError("bad kern table length")
+			}
+			f.kernSubtables = append(f.kernSubtables, kernSubtable{b[8:], override})
+		}
+		offset += length
 	}
 	return nil
 }
 
 func (f *Font) parseMaxp() error {
+	// A font with PostScript outlines has a version 0.5 maxp table, which
+	// only holds the number of glyphs.
+	if len(f.maxp) == 6 && u32(f.maxp, 0) == 0x00005000 {
+		f.nGlyph = int(u16(f.maxp, 4))
+		return nil
+	}
 	if len(f.maxp) != 32 {
 		return FormatError(fmt.Sprintf("bad maxp length: %d", len(f.maxp)))
 	}
 	f.nGlyph = int(u16(f.maxp, 4))
+	f.maxPoints = u16(f.maxp, 6)
+	f.maxContours = u16(f.maxp, 8)
+	f.maxCompositePoints = u16(f.maxp, 10)
+	f.maxCompositeContours = u16(f.maxp, 12)
 	f.maxTwilightPoints = u16(f.maxp, 16)
 	f.maxStorage = u16(f.maxp, 18)
 	f.maxFunctionDefs = u16(f.maxp, 20)
@@ -269,6 +809,38 @@ func (f *Font) parseMaxp() error {
 	return nil
 }
 
+// parseLoca checks that the loca table has an entry for each glyph, plus
+// one for the end of the last glyph, and that those entries are increasing
+// offsets into the glyf table. Any extra entries are ignored.
+func (f *Font) parseLoca() error {
+	n := f.nGlyph + 1
+	if f.locaOffsetFormat == locaOffsetFormatShort {
+		n *= 2
+	} else {
+		n *= 4
+	}
+	if len(f.loca) < n {
+		return FormatError(fmt.Sprintf("bad loca length: %d", len(f.loca)))
+	}
+	prev := uint32(0)
+	for i := 0; i <= f.nGlyph; i++ {
+		var x uint32
+		if f.locaOffsetFormat == locaOffsetFormatShort {
+			x = 2 * uint32(u16(f.loca, 2*i))
+		} else {
+			x = u32(f.loca, 4*i)
+		}
+		if x < prev {
+			return FormatError(fmt.Sprintf("bad loca offset for glyph %d: %d", i, x))
+		}
+		prev = x
+	}
+	if prev > uint32(f.tableLen("glyf", f.glyf)) {
+		return FormatError(fmt.Sprintf("loca offset too large: %d", prev))
+	}
+	return nil
+}
+
 // scale returns x divided by f.fUnitsPerEm, rounded to the nearest integer.
 func (f *Font) scale(x int32) int32 {
 	if x >= 0 {
@@ -281,12 +853,7 @@ func (f *Font) scale(x int32) int32 {
 
 // Bounds returns the union of a Font's glyphs' bounds.
 func (f *Font) Bounds(scale int32) Bounds {
-	b := f.bounds
-	b.XMin = f.scale(scale * b.XMin)
-	b.YMin = f.scale(scale * b.YMin)
-	b.XMax = f.scale(scale * b.XMax)
-	b.YMax = f.scale(scale * b.YMax)
-	return b
+	return f.scaleBounds(scale, f.bounds)
 }
 
 // FUnitsPerEm returns the number of FUnits in a Font's em-square's side.
@@ -294,18 +861,321 @@ func (f *Font) FUnitsPerEm() int32 {
 	return f.fUnitsPerEm
 }
 
+// TypoAscender returns the typographic ascender, the distance from the
+// baseline to the top of the em box, from the font's OS/2 table. If there
+// is no OS/2 table then it returns the hhea table's ascender instead.
+func (f *Font) TypoAscender(scale int32) int32 {
+	return f.scale(scale * f.typoAscent)
+}
+
+// TypoDescender returns the typographic descender, which is usually
+// negative, from the font's OS/2 table. If there is no OS/2 table then it
+// returns the hhea table's descender instead.
+func (f *Font) TypoDescender(scale int32) int32 {
+	return f.scale(scale * f.typoDescent)
+}
+
+// TypoLineGap returns the typographic line gap from the font's OS/2 table.
+// The recommended distance between baselines is the ascender minus the
+// descender plus the line gap. If there is no OS/2 table then it returns the
+// hhea table's line gap instead.
+func (f *Font) TypoLineGap(scale int32) int32 {
+	return f.scale(scale * f.typoLineGap)
+}
+
+// XHeight returns the height of the font's lower case letters, from its OS/2
+// table. It is zero if there is no OS/2 table or if that table's version is
+// less than 2.
+func (f *Font) XHeight(scale int32) int32 {
+	return f.scale(scale * f.xHeight)
+}
+
+// CapHeight returns the height of the font's upper case letters, from its
+// OS/2 table. It is zero if there is no OS/2 table or if that table's
+// version is less than 2.
+func (f *Font) CapHeight(scale int32) int32 {
+	return f.scale(scale * f.capHeight)
+}
+
+// Metrics returns the font's metrics. scale is the number of 26.6 fixed
+// point units in 1 em.
+//
+// The ascent, descent and line gap are the typographic ones from the OS/2
+// table, or from the hhea table if there is no OS/2 table or if its
+// ascender and descender are both zero. The x-height and cap height are
+// those of the OS/2 table, or, if it does not give them, the unhinted
+// heights of the glyphs for 'x' and 'H', or zero if the font has no such
+// glyphs.
+func (f *Font) Metrics(scale int32) Metrics {
+	ascent, descent, lineGap := f.typoAscent, f.typoDescent, f.typoLineGap
+	if ascent == 0 && descent == 0 {
+		ascent, descent, lineGap = f.ascent, f.descent, f.lineGap
+	}
+	m := Metrics{
+		Ascent:    f.scale(scale * ascent),
+		Descent:   -f.scale(scale * descent),
+		LineGap:   f.scale(scale * lineGap),
+		XHeight:   f.XHeight(scale),
+		CapHeight: f.CapHeight(scale),
+	}
+	m.Height = m.Ascent + m.Descent + m.LineGap
+	if m.XHeight == 0 {
+		m.XHeight = f.runeHeight(scale, 'x')
+	}
+	if m.CapHeight == 0 {
+		m.CapHeight = f.runeHeight(scale, 'H')
+	}
+	return m
+}
+
+// runeHeight returns the unhinted height above the baseline of the glyph for
+// r, or zero if the font has no glyph for r.
+func (f *Font) runeHeight(scale int32, r rune) int32 {
+	i, ok := f.IndexOK(r)
+	if !ok {
+		return 0
+	}
+	b, err := f.GlyphBounds(scale, i)
+	if err != nil {
+		return 0
+	}
+	return b.YMax
+}
+
+// WeightClass returns the font's usWeightClass, from 1 to 1000, where 400 is
+// normal and 700 is bold. It is zero if there is no OS/2 table.
+func (f *Font) WeightClass() int {
+	return int(f.weightClass)
+}
+
+// WidthClass returns the font's usWidthClass, from 1 (ultra-condensed) to 9
+// (ultra-expanded), where 5 is normal. It is zero if there is no OS/2 table.
+func (f *Font) WidthClass() int {
+	return int(f.widthClass)
+}
+
+// NumGlyphs returns the number of glyphs in a Font, as given by its maxp
+// table. Valid glyph indexes are in the range [0, NumGlyphs()).
+func (f *Font) NumGlyphs() int {
+	return f.nGlyph
+}
+
 // Index returns a Font's index for the given rune.
+//
+// If the font's only supported cmap subtable is in format 2, then x is
+// instead treated as a character code in the font's legacy CJK encoding,
+// such as ShiftJIS or Big5. A double-byte character's code is its first
+// byte shifted left by 8, plus its second byte. If the font's only supported
+// cmap subtable is a Macintosh Roman one, then x is looked up by its
+// Macintosh Roman character code, and so only the runes of that encoding
+// have glyphs.
 func (f *Font) Index(x rune) Index {
-	c := uint16(x)
-	n := len(f.cm)
-	for i := 0; i < n; i++ {
-		if f.cm[i].start <= c && c <= f.cm[i].end {
-			if f.cm[i].offset == 0 {
-				return Index(c + f.cm[i].delta)
+	c := uint32(x)
+	if f.cmapFormat == 2 {
+		return f.index2(c)
+	}
+	return f.cmIndex(f.findCM(c), c)
+}
+
+// IndexOK is like Index, but also reports whether the font has a glyph for
+// the given rune. A font's cmap maps each rune for which it has no glyph,
+// whether or not the cmap lists that rune, to glyph 0, the .notdef glyph,
+// which is drawn as a box or similar placeholder. The boolean result is
+// false for such runes, so that a caller can fall back to another font.
+func (f *Font) IndexOK(x rune) (Index, bool) {
+	i := f.Index(x)
+	return i, i != 0
+}
+
+// IndexString returns a Font's indexes for the runes of s, as if by calling
+// Index for each rune. It is faster than calling Index for each rune, since
+// runes that are near each other, such as those of one script, tend to share
+// a cmap segment, and each rune is first looked up in the previous rune's
+// segment before searching all of them.
+func (f *Font) IndexString(s string) []Index {
+	indexes := make([]Index, 0, utf8.RuneCountInString(s))
+	if f.cmapFormat == 2 {
+		for _, r := range s {
+			indexes = append(indexes, f.index2(uint32(r)))
+		}
+		return indexes
+	}
+	h := -1
+	for _, r := range s {
+		c := uint32(r)
+		if h < 0 || c < f.cm[h].start || f.cm[h].end < c {
+			h = f.findCM(c)
+		}
+		indexes = append(indexes, f.cmIndex(h, c))
+	}
+	return indexes
+}
+
+// findCM returns the index in f.cm of the segment that contains c, or -1 if
+// no segment contains c.
+func (f *Font) findCM(c uint32) int {
+	for i, j := 0, len(f.cm); i < j; {
+		h := i + (j-i)/2
+		if cm := &f.cm[h]; c < cm.start {
+			j = h
+		} else if cm.end < c {
+			i = h + 1
+		} else {
+			return h
+		}
+	}
+	return -1
+}
+
+// cmIndex returns the index for c in the h'th segment of f.cm, which
+// contains c. It returns 0 if h is -1.
+func (f *Font) cmIndex(h int, c uint32) Index {
+	if h < 0 {
+		return 0
+	}
+	cm := &f.cm[h]
+	if cm.offset == 0 {
+		return Index(c + cm.delta)
+	}
+	offset := int(cm.offset) + 2*(h-len(f.cm)+int(c-cm.start))
+	if offset < 0 || offset+2 > len(f.cmapIndexes) {
+		return 0
+	}
+	return Index(u16(f.cmapIndexes, offset))
+}
+
+// IndexVariation returns a Font's index for the Unicode variation sequence
+// of the rune r followed by the variation selector vs, such as U+FE0E or
+// U+FE0F for emoji. The boolean result reports whether the font's format 14
+// cmap subtable lists that variation sequence. If the sequence is listed as
+// using the default glyph, or if it is not listed at all, then the index is
+// the same as that returned by f.Index(r).
+func (f *Font) IndexVariation(r, vs rune) (Index, bool) {
+	// The format 14 subtable is documented at
+	// http://www.microsoft.com/typography/otspec/cmap.htm
+	const recordSize = 11
+	if len(f.cmapUVS) < 10 {
+		return f.Index(r), false
+	}
+	c, v := uint32(r), uint32(vs)
+	n := int(u32(f.cmapUVS, 6))
+	if n > (len(f.cmapUVS)-10)/recordSize {
+		return f.Index(r), false
+	}
+	// Binary search for the variation selector record.
+	for i, j := 0, n; i < j; {
+		h := i + (j-i)/2
+		x := 10 + recordSize*h
+		if sel := u24(f.cmapUVS, x); v < sel {
+			j = h
+			continue
+		} else if sel < v {
+			i = h + 1
+			continue
+		}
+		if o := int(u32(f.cmapUVS, x+7)); o != 0 {
+			if i, ok := f.nonDefaultUVS(o, c); ok {
+				return i, true
 			}
-			offset := int(f.cm[i].offset) + 2*(i-n+int(c-f.cm[i].start))
-			return Index(u16(f.cmapIndexes, offset))
 		}
+		if o := int(u32(f.cmapUVS, x+3)); o != 0 && f.defaultUVS(o, c) {
+			return f.Index(r), true
+		}
+		break
+	}
+	return f.Index(r), false
+}
+
+// defaultUVS returns whether the Default UVS table at the given offset in
+// f.cmapUVS contains the rune c.
+func (f *Font) defaultUVS(offset int, c uint32) bool {
+	// Each Unicode range is a 24-bit start and an 8-bit additional count.
+	if offset > len(f.cmapUVS)-4 {
+		return false
+	}
+	n := int(u32(f.cmapUVS, offset))
+	offset += 4
+	if n > (len(f.cmapUVS)-offset)/4 {
+		return false
+	}
+	for i, j := 0, n; i < j; {
+		h := i + (j-i)/2
+		x := offset + 4*h
+		start := u24(f.cmapUVS, x)
+		if c < start {
+			j = h
+		} else if start+uint32(f.cmapUVS[x+3]) < c {
+			i = h + 1
+		} else {
+			return true
+		}
+	}
+	return false
+}
+
+// nonDefaultUVS returns the glyph index that the Non-Default UVS table at the
+// given offset in f.cmapUVS maps the rune c to.
+func (f *Font) nonDefaultUVS(offset int, c uint32) (Index, bool) {
+	// Each mapping is a 24-bit rune and a 16-bit glyph index.
+	if offset > len(f.cmapUVS)-4 {
+		return 0, false
+	}
+	n := int(u32(f.cmapUVS, offset))
+	offset += 4
+	if n > (len(f.cmapUVS)-offset)/5 {
+		return 0, false
+	}
+	for i, j := 0, n; i < j; {
+		h := i + (j-i)/2
+		x := offset + 5*h
+		if r := u24(f.cmapUVS, x); c < r {
+			j = h
+		} else if r < c {
+			i = h + 1
+		} else {
+			return Index(u16(f.cmapUVS, x+3)), true
+		}
+	}
+	return 0, false
+}
+
+// index2 returns the index for the given character code, for a format 2
+// cmap subtable. That subtable is documented at
+// http://www.microsoft.com/typography/otspec/cmap.htm
+func (f *Font) index2(c uint32) Index {
+	if c > 0xffff {
+		return 0
+	}
+	// hi is the byte used to select a subHeader and lo is the byte used to
+	// index that subHeader's range. A single-byte character uses
+	// subHeader 0, and a byte that uses subHeader 0 cannot be the first
+	// byte of a double-byte character.
+	hi, lo := c>>8, c&0xff
+	if hi == 0 {
+		hi = lo
+	}
+	k := int(u16(f.cmapIndexes, 6+2*int(hi)))
+	if (k == 0) != (c <= 0xff) {
+		return 0
+	}
+	x := 6 + 512 + k
+	if x+8 > len(f.cmapIndexes) {
+		return 0
+	}
+	firstCode := uint32(u16(f.cmapIndexes, x))
+	entryCount := uint32(u16(f.cmapIndexes, x+2))
+	idDelta := u16(f.cmapIndexes, x+4)
+	idRangeOffset := int(u16(f.cmapIndexes, x+6))
+	if lo < firstCode || lo >= firstCode+entryCount {
+		return 0
+	}
+	// idRangeOffset is relative to the position of the idRangeOffset field.
+	x += 6 + idRangeOffset + 2*int(lo-firstCode)
+	if x+2 > len(f.cmapIndexes) {
+		return 0
+	}
+	if i := u16(f.cmapIndexes, x); i != 0 {
+		return Index(i + idDelta)
 	}
 	return 0
 }
@@ -317,47 +1187,352 @@ func (f *Font) HMetric(scale int32, i Index) (h HMetric) {
 		return HMetric{}
 	}
 	if j >= f.nHMetric {
-		p := 4 * (f.nHMetric - 1)
-		h.AdvanceWidth = int32(u16(f.hmtx, p))
-		h.LeftSideBearing = int32(int16(u16(f.hmtx, p+2*(j-f.nHMetric)+4)))
+		h.AdvanceWidth = int32(u16(f.hmtx, 4*(f.nHMetric-1)))
 	} else {
 		h.AdvanceWidth = int32(u16(f.hmtx, 4*j))
-		h.LeftSideBearing = int32(int16(u16(f.hmtx, 4*j+2)))
 	}
 	h.AdvanceWidth = f.scale(scale * h.AdvanceWidth)
-	h.LeftSideBearing = f.scale(scale * h.LeftSideBearing)
+	h.LeftSideBearing = f.scale(scale * f.lsb(j))
 	return h
 }
 
-// Kerning returns the kerning for the given glyph pair.
-func (f *Font) Kerning(scale int32, i0, i1 Index) int32 {
-	if f.nKern == 0 {
+// LeftSideBearing returns the left side bearing of the glyph with the given
+// index, which is the same as HMetric's LeftSideBearing. Each glyph after the
+// last of the hmtx table's metrics has its own left side bearing, which
+// follows those metrics.
+func (f *Font) LeftSideBearing(scale int32, i Index) int32 {
+	j := int(i)
+	if j >= f.nGlyph {
 		return 0
 	}
-	g := uint32(i0)<<16 | uint32(i1)
-	lo, hi := 0, f.nKern
-	for lo < hi {
-		i := (lo + hi) / 2
-		ig := u32(f.kern, 18+6*i)
-		if ig < g {
-			lo = i + 1
-		} else if ig > g {
-			hi = i
+	return f.scale(scale * f.lsb(j))
+}
+
+// lsb returns the left side bearing, in FUnits, of the j'th glyph, which must
+// be less than f.nGlyph.
+func (f *Font) lsb(j int) int32 {
+	if j >= f.nHMetric {
+		return int32(int16(u16(f.hmtx, 4*f.nHMetric+2*(j-f.nHMetric))))
+	}
+	return int32(int16(u16(f.hmtx, 4*j+2)))
+}
+
+// AdvanceWidths returns the advance width, in FUnits, of each of the font's
+// glyphs, indexed by glyph Index. The glyphs after the last of the hmtx
+// table's metrics all have that last metric's advance width.
+func (f *Font) AdvanceWidths() []int32 {
+	a := make([]int32, f.nGlyph)
+	for j := range a {
+		if j < f.nHMetric {
+			a[j] = int32(u16(f.hmtx, 4*j))
+		} else if j > 0 {
+			a[j] = a[j-1]
+		}
+	}
+	return a
+}
+
+// VMetric returns the vertical metrics for the glyph with the given index.
+//
+// If the font has no vmtx table, then every glyph's advance height is the
+// distance between the font's typographic ascent and descent, and its top
+// side bearing is the distance from that ascent to the top of the glyph's
+// bounding box. The typographic ascent and descent come from the OS/2 table,
+// or from the hhea table if there is no OS/2 table.
+func (f *Font) VMetric(scale int32, i Index) (v VMetric) {
+	j := int(i)
+	if j >= f.nGlyph {
+		return VMetric{}
+	}
+	if f.nVMetric == 0 {
+		v.AdvanceHeight = f.typoAscent - f.typoDescent
+		if len(f.cff) != 0 {
+			if b, ok, err := f.cffBounds(i); ok && err == nil {
+				v.TopSideBearing = f.typoAscent - b.YMax
+			}
+		} else if glyf, err := f.glyphData(i); err == nil && len(glyf) >= 10 {
+			v.TopSideBearing = f.typoAscent - int32(int16(u16(glyf, 8)))
+		}
+	} else if j >= f.nVMetric {
+		p := 4 * (f.nVMetric - 1)
+		v.AdvanceHeight = int32(u16(f.vmtx, p))
+		v.TopSideBearing = int32(int16(u16(f.vmtx, p+2*(j-f.nVMetric)+4)))
+	} else {
+		v.AdvanceHeight = int32(u16(f.vmtx, 4*j))
+		v.TopSideBearing = int32(int16(u16(f.vmtx, 4*j+2)))
+	}
+	v.AdvanceHeight = f.scale(scale * v.AdvanceHeight)
+	v.TopSideBearing = f.scale(scale * v.TopSideBearing)
+	return v
+}
+
+// GaspBehavior returns how the font's author intends its glyphs to be
+// rendered at the given size, in pixels per em: whether they should be
+// grid-fitted, or hinted, and whether they should be drawn in grayscale, or
+// anti-aliased. It comes from the font's gasp table, and both are true if
+// there is no gasp table, or if the table does not cover the size.
+func (f *Font) GaspBehavior(ppem int) (gridfit, doGray bool) {
+	if len(f.gasp) == 0 {
+		return true, true
+	}
+	// The ranges are sorted by their maximum size.
+	for i, n := 0, int(u16(f.gasp, 2)); i < n; i++ {
+		if ppem <= int(u16(f.gasp, 4+4*i)) {
+			behavior := u16(f.gasp, 4+4*i+2)
+			return behavior&0x0001 != 0, behavior&0x0002 != 0
+		}
+	}
+	return true, true
+}
+
+// DeviceAdvance returns the advance width, in whole pixels, of the glyph
+// with the given index at the given size, in pixels per em. It comes from the
+// font's hdmx table, which holds the advance widths of hinted glyphs at some
+// sizes, and ok is whether the table has the size. Otherwise, the advance
+// width is HMetric's, rounded to the nearest pixel.
+func (f *Font) DeviceAdvance(ppem int, i Index) (advance int, ok bool) {
+	if len(f.hdmx) != 0 && int(i) < f.nGlyph {
+		n, size := int(int16(u16(f.hdmx, 2))), int(int32(u32(f.hdmx, 4)))
+		for j := 0; j < n; j++ {
+			if x := 8 + j*size; int(f.hdmx[x]) == ppem {
+				return int(f.hdmx[x+2+int(i)]), true
+			}
+		}
+	}
+	return int(f.HMetric(int32(ppem)<<6, i).AdvanceWidth+32) >> 6, false
+}
+
+// LinearThreshold returns the size, in pixels per em, at and above which the
+// advance width of the glyph with the given index scales linearly, even when
+// the glyph is hinted, and so need not be looked up by DeviceAdvance. It
+// comes from the font's LTSH table, and is 0, which is not a valid size, if
+// there is no LTSH table.
+func (f *Font) LinearThreshold(i Index) uint8 {
+	if len(f.ltsh) == 0 || int(i) >= f.nGlyph {
+		return 0
+	}
+	return f.ltsh[4+int(i)]
+}
+
+// VerticalOrigin returns the y co-ordinate, in FUnits, of the i'th glyph's
+// vertical origin, which is the point on the vertical line of text, at the
+// top of the glyph's advance height, from which the glyph is laid out in
+// top-to-bottom text. It comes from the font's VORG table, which lists the
+// glyphs whose origins differ from the table's default, and is the font's
+// typographic ascent if there is no VORG table.
+func (f *Font) VerticalOrigin(i Index) int32 {
+	if len(f.vorg) == 0 {
+		return f.typoAscent
+	}
+	// Binary search for the glyph's vertical origin record.
+	for lo, hi := 0, int(u16(f.vorg, 6)); lo < hi; {
+		h := lo + (hi-lo)/2
+		if j := Index(u16(f.vorg, 8+4*h)); i < j {
+			hi = h
+		} else if j < i {
+			lo = h + 1
 		} else {
-			return f.scale(scale * int32(int16(u16(f.kern, 22+6*i))))
+			return int32(int16(u16(f.vorg, 8+4*h+2)))
 		}
 	}
-	return 0
+	return int32(int16(u16(f.vorg, 4)))
+}
+
+// glyphData returns the slice of the glyf table that holds the i'th glyph's
+// data. It returns an empty slice for a glyph with no contours, such as a
+// space.
+func (f *Font) glyphData(i Index) ([]byte, error) {
+	if len(f.loca) == 0 {
+		return nil, nil
+	}
+	var g0, g1 uint32
+	if f.locaOffsetFormat == locaOffsetFormatShort {
+		g0 = 2 * uint32(u16(f.loca, 2*int(i)))
+		g1 = 2 * uint32(u16(f.loca, 2*int(i)+2))
+	} else {
+		g0 = u32(f.loca, 4*int(i))
+		g1 = u32(f.loca, 4*int(i)+4)
+	}
+	return f.tableData("glyf", f.glyf, int(g0), int(g1))
+}
+
+// Kerning returns the kerning for the given glyph pair. It uses the pair
+// adjustments of the GPOS table's 'kern' feature, if there is one, and the
+// kern table otherwise. The values of the kern table's subtables that list
+// the pair are added together, except that a subtable with the override flag
+// replaces the sum so far.
+func (f *Font) Kerning(scale int32, i0, i1 Index) int32 {
+	if len(f.gposKern) != 0 {
+		return f.scale(scale * f.gposKerning(i0, i1))
+	}
+	g, k := uint32(i0)<<16|uint32(i1), int32(0)
+	for i := range f.kernSubtables {
+		t := &f.kernSubtables[i]
+		if v, ok := t.lookup(g); ok {
+			if t.override {
+				k = v
+			} else {
+				k += v
+			}
+		}
+	}
+	return f.scale(scale * k)
 }
 
 // Parse returns a new Font for the given TTF or TTC data.
 //
 // For TrueType Collections, the first font in the collection is parsed.
 func Parse(ttf []byte) (font *Font, err error) {
-	return parse(ttf, 0)
+	return parse(ttf, 0, nil)
+}
+
+// ErrNoOutlines is returned when loading a glyph from a Font that was parsed
+// without its glyph outlines.
+var ErrNoOutlines = errors.New("truetype: font was parsed without its glyph outlines")
+
+// ParseOptions control which of a font's tables ParseWithOptions decodes.
+type ParseOptions struct {
+	// Tables lists the tags of the tables to decode, such as "cmap" or
+	// "kern". The head, hhea, hmtx and maxp tables are always decoded, as
+	// are the tables that a listed table works with: listing "glyf" decodes
+	// the glyph outlines, whether they are TrueType ones, with "loca" and
+	// the "cvt ", "fpgm" and "prep" hinting tables, or a "CFF " table;
+	// listing "kern" also decodes "GPOS"; listing "vhea" also decodes
+	// "vmtx"; and so on. If Tables is nil, then every table is decoded.
+	//
+	// A Font behaves as if its skipped tables were absent, except that
+	// loading a glyph whose outlines were skipped returns ErrNoOutlines.
+	// For example, Kerning uses the GPOS table's kerning in preference to
+	// the kern table's, and so it returns the same values for a Font that
+	// was parsed with "kern" as for one that was parsed with every table,
+	// but returns zero for a Font that was parsed without "kern".
+	Tables []string
+	// MaxComponentDepth is how deeply compound glyphs may nest: 1 allows
+	// compound glyphs whose components are simple glyphs, 2 also allows
+	// components that are such compound glyphs, and so on. Loading a glyph
+	// that nests more deeply returns an UnsupportedError. If it is zero,
+	// then DefaultMaxComponentDepth is used.
+	MaxComponentDepth int
+	// VerifyChecksums is whether to check that each table's checksum, and
+	// the head table's checkSumAdjustment, match those that the font's data
+	// records, such as to detect data that was corrupted or truncated. For a
+	// font in a TrueType Collection, only the table checksums are checked.
+	VerifyChecksums bool
+}
+
+// DefaultMaxComponentDepth is how deeply compound glyphs may nest, unless
+// ParseOptions says otherwise. The OpenType specification sets no limit,
+// other than that the maxp table's maxComponentDepth is a 16-bit number, but
+// real fonts rarely nest more than a few levels deep.
+const DefaultMaxComponentDepth = 16
+
+// tableGroups maps each table tag to the first tag of the group of tables
+// that are decoded together.
+var tableGroups = map[string]string{
+	"loca": "glyf",
+	"CFF ": "glyf",
+	"cvt ": "glyf",
+	"fpgm": "glyf",
+	"prep": "glyf",
+	"GPOS": "kern",
+	"vmtx": "vhea",
+	"CPAL": "COLR",
+	"EBDT": "EBLC",
+	"CBDT": "CBLC",
+	"avar": "fvar",
+	"gvar": "fvar",
+}
+
+// decodes returns whether the table with the given tag is to be decoded.
+func (o *ParseOptions) decodes(tag string) bool {
+	if o == nil || o.Tables == nil {
+		return true
+	}
+	switch tag {
+	case "head", "hhea", "hmtx", "maxp":
+		return true
+	}
+	if g, ok := tableGroups[tag]; ok {
+		tag = g
+	}
+	for _, t := range o.Tables {
+		if g, ok := tableGroups[t]; ok {
+			t = g
+		}
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWithOptions is like Parse, but decodes only those tables that opts
+// requests. For example, a caller that only measures text can skip the
+// glyph outlines and hinting programs by requesting only the "cmap" and
+// "kern" tables. A nil opts decodes every table.
+func ParseWithOptions(ttf []byte, opts *ParseOptions) (*Font, error) {
+	return parse(ttf, 0, opts)
+}
+
+// ParseIndex returns a new Font for the i'th font in the given TTC data. The
+// Font shares the underlying data with any other Fonts parsed from ttc.
+func ParseIndex(ttc []byte, i int) (*Font, error) {
+	offsets, err := ttcOffsets(ttc)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(offsets) {
+		return nil, FormatError(fmt.Sprintf("bad TTC font index: %d", i))
+	}
+	return parse(ttc, offsets[i], nil)
+}
+
+// ParseCollection returns a new Font for each of the fonts in the given TTC
+// data, in the order that they appear in the collection.
+func ParseCollection(ttc []byte) ([]*Font, error) {
+	offsets, err := ttcOffsets(ttc)
+	if err != nil {
+		return nil, err
+	}
+	fonts := make([]*Font, len(offsets))
+	for i, offset := range offsets {
+		if fonts[i], err = parse(ttc, offset, nil); err != nil {
+			return nil, err
+		}
+	}
+	return fonts, nil
+}
+
+// ttcOffsets returns the offsets of the fonts in the given TTC data.
+func ttcOffsets(ttc []byte) ([]int, error) {
+	if len(ttc) < 12 {
+		return nil, FormatError("TTC data is too short")
+	}
+	if u32(ttc, 0) != 0x74746366 { // "ttcf" as a big-endian uint32.
+		return nil, FormatError("bad TTC tag")
+	}
+	// Version 2.0 only adds fields after the offset table, which we ignore.
+	if v := u32(ttc, 4); v != 0x00010000 && v != 0x00020000 {
+		return nil, FormatError("bad TTC version")
+	}
+	numFonts := int(u32(ttc, 8))
+	if numFonts <= 0 {
+		return nil, FormatError("bad number of TTC fonts")
+	}
+	if len(ttc[12:])/4 < numFonts {
+		return nil, FormatError("TTC offset table is too short")
+	}
+	offsets := make([]int, numFonts)
+	for i := range offsets {
+		offsets[i] = int(u32(ttc, 12+4*i))
+		if offsets[i] <= 0 || offsets[i] > len(ttc) {
+			return nil, FormatError("bad TTC offset")
+		}
+	}
+	return offsets, nil
 }
 
-func parse(ttf []byte, offset int) (font *Font, err error) {
+func parse(ttf []byte, offset int, opts *ParseOptions) (font *Font, err error) {
 	if len(ttf)-offset < 12 {
 		err = FormatError("TTF data is too short")
 		return
@@ -365,94 +1540,470 @@ func parse(ttf []byte, offset int) (font *Font, err error) {
 	originalOffset := offset
 	magic, offset := u32(ttf, offset), offset+4
 	switch magic {
-	case 0x00010000:
+	case 0x00010000, 0x4f54544f: // "OTTO" as a big-endian uint32, for CFF data.
 		// No-op.
 	case 0x74746366: // "ttcf" as a big-endian uint32.
 		if originalOffset != 0 {
 			err = FormatError("recursive TTC")
 			return
 		}
-		ttcVersion, offset := u32(ttf, offset), offset+4
-		if ttcVersion != 0x00010000 {
-			// TODO: support TTC version 2.0, once I have such a .ttc file to test with.
-			err = FormatError("bad TTC version")
-			return
-		}
-		numFonts, offset := int(u32(ttf, offset)), offset+4
-		if numFonts <= 0 {
-			err = FormatError("bad number of TTC fonts")
-			return
-		}
-		if len(ttf[offset:])/4 < numFonts {
-			err = FormatError("TTC offset table is too short")
-			return
-		}
-		// TODO: provide an API to select which font in a TrueType collection to return,
-		// not just the first one. This may require an API to parse a TTC's name tables,
-		// so users of this package can select the font in a TTC by name.
-		offset = int(u32(ttf, offset))
-		if offset <= 0 || offset > len(ttf) {
-			err = FormatError("bad TTC offset")
-			return
+		offsets, err := ttcOffsets(ttf)
+		if err != nil {
+			return nil, err
 		}
-		return parse(ttf, offset)
+		return parse(ttf, offsets[0], opts)
 	default:
 		err = FormatError("bad TTF version")
 		return
 	}
 	n, offset := int(u16(ttf, offset)), offset+2
-	if len(ttf) < 16*n+12 {
+	if len(ttf)-originalOffset < 16*n+12 {
 		err = FormatError("TTF data is too short")
 		return
 	}
 	f := new(Font)
-	// Assign the table slices.
+	// Assign the table slices. The table directory follows the offset
+	// table, and the table offsets are relative to the start of the data,
+	// even for a font in a TrueType Collection.
 	for i := 0; i < n; i++ {
-		x := 16*i + 12
-		switch string(ttf[x : x+4]) {
-		case "cmap":
-			f.cmap, err = readTable(ttf, ttf[x+8:x+16])
-		case "cvt ":
-			f.cvt, err = readTable(ttf, ttf[x+8:x+16])
-		case "fpgm":
-			f.fpgm, err = readTable(ttf, ttf[x+8:x+16])
-		case "glyf":
-			f.glyf, err = readTable(ttf, ttf[x+8:x+16])
-		case "head":
-			f.head, err = readTable(ttf, ttf[x+8:x+16])
-		case "hhea":
-			f.hhea, err = readTable(ttf, ttf[x+8:x+16])
-		case "hmtx":
-			f.hmtx, err = readTable(ttf, ttf[x+8:x+16])
-		case "kern":
-			f.kern, err = readTable(ttf, ttf[x+8:x+16])
-		case "loca":
-			f.loca, err = readTable(ttf, ttf[x+8:x+16])
-		case "maxp":
-			f.maxp, err = readTable(ttf, ttf[x+8:x+16])
-		case "prep":
-			f.prep, err = readTable(ttf, ttf[x+8:x+16])
+		x := originalOffset + 16*i + 12
+		tag := string(ttf[x : x+4])
+		if t := f.table(tag); t != nil && opts.decodes(tag) {
+			if *t, err = readTable(ttf, ttf[x+8:x+16]); err != nil {
+				return
+			}
+		} else if t, err := readTable(ttf, ttf[x+8:x+16]); err == nil {
+			// A table that the Font does not use is not validated, and so
+			// a bad directory entry for one is not an error.
+			if f.otherTables == nil {
+				f.otherTables = make(map[string][]byte)
+			}
+			f.otherTables[tag] = t
 		}
-		if err != nil {
+	}
+	if opts != nil && opts.VerifyChecksums {
+		if err = verifyChecksums(ttf, originalOffset, n); err != nil {
 			return
 		}
 	}
-	// Parse and sanity-check the TTF data.
+	if err = f.parseTables(opts); err != nil {
+		return
+	}
+	font = f
+	return
+}
+
+// verifyChecksums checks the checksums of the n tables of the font whose
+// table directory is at ttf[offset:], and, unless the font is in a TrueType
+// Collection, the head table's checkSumAdjustment.
+func verifyChecksums(ttf []byte, offset, n int) error {
+	var bad []string
+	for i := 0; i < n; i++ {
+		x := offset + 16*i + 12
+		tag := string(ttf[x : x+4])
+		t, err := readTable(ttf, ttf[x+8:x+16])
+		if err != nil {
+			return err
+		}
+		if TableChecksum(tag, t) != u32(ttf, x+4) {
+			bad = append(bad, fmt.Sprintf("%q", tag))
+		}
+	}
+	if len(bad) != 0 {
+		return FormatError("bad table checksums: " + strings.Join(bad, ", "))
+	}
+	if offset != 0 {
+		return nil
+	}
+	want, err := CheckSumAdjustment(ttf)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		x := 16*i + 12
+		if string(ttf[x:x+4]) == "head" {
+			if got := u32(ttf[u32(ttf, x+8):], 8); got != want {
+				return FormatError(fmt.Sprintf("bad head checkSumAdjustment: got %#08x, want %#08x", got, want))
+			}
+		}
+	}
+	return nil
+}
+
+// ParseReader returns a new Font for the TTF or TTC data of the given size
+// that is read from r. Unlike Parse, it reads only the table directory and
+// the tables that the Font uses, and it does not read the glyph outlines or
+// embedded bitmaps up front: the glyf, EBDT, CBDT and sbix tables are kept
+// in r, and each glyph's part of them is read when that glyph is loaded.
+// The Font therefore holds on to r, which must remain readable for as long
+// as the Font is used.
+//
+// For TrueType Collections, the first font in the collection is parsed.
+func ParseReader(r io.ReaderAt, size int64) (*Font, error) {
+	return parseReader(r, size, 0, nil)
+}
+
+// ParseReaderWithOptions is like ParseReader, but decodes only those tables
+// that opts requests, as per ParseWithOptions, and the tables that it skips
+// are not read at all. A nil opts decodes every table.
+//
+// If opts.VerifyChecksums is set, then only the checksums of the tables
+// that the Font uses are checked, and not the head table's
+// checkSumAdjustment, which covers all of the data. The tables that are
+// read on demand are read once, a piece at a time, to check their
+// checksums.
+func ParseReaderWithOptions(r io.ReaderAt, size int64, opts *ParseOptions) (*Font, error) {
+	return parseReader(r, size, 0, opts)
+}
+
+// readerTables are the tables that ParseReader reads on demand, as they are
+// large and each glyph uses only a small part of them.
+var readerTables = map[string]bool{"CBDT": true, "EBDT": true, "glyf": true, "sbix": true}
+
+// A readerTable is the position in a Font's reader of a table that is read
+// on demand.
+type readerTable struct {
+	offset, length int64
+}
+
+// readAt reads len(b) bytes from r at the given offset. Unlike r.ReadAt, it
+// does not return io.EOF for a read that ends at the end of r's data.
+func readAt(r io.ReaderAt, b []byte, offset int64) error {
+	if n, err := r.ReadAt(b, offset); n < len(b) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// tableLen returns the length of the table t with the given tag, which is
+// not len(t) if the table is read on demand.
+func (f *Font) tableLen(tag string, t []byte) int {
+	if rt, ok := f.readerTables[tag]; ok {
+		return int(rt.length)
+	}
+	return len(t)
+}
+
+// tableData returns the bytes [start, end) of the table t with the given
+// tag, reading them from f.reader if the table is read on demand. The
+// caller must check that the range lies within the table.
+func (f *Font) tableData(tag string, t []byte, start, end int) ([]byte, error) {
+	rt, ok := f.readerTables[tag]
+	if !ok {
+		return t[start:end], nil
+	}
+	b := make([]byte, end-start)
+	if err := readAt(f.reader, b, rt.offset+int64(start)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readerChecksum returns the checksum of the table at rt in r, which it reads
+// a piece at a time.
+func readerChecksum(r io.ReaderAt, tag string, rt readerTable) (uint32, error) {
+	// The pieces' lengths are multiples of 4, so that their checksums add
+	// up to that of the whole table.
+	b := make([]byte, 64*1024)
+	sum := uint32(0)
+	for x := int64(0); x < rt.length; x += int64(len(b)) {
+		if rt.length-x < int64(len(b)) {
+			b = b[:rt.length-x]
+		}
+		if err := readAt(r, b, rt.offset+x); err != nil {
+			return 0, err
+		}
+		sum += TableChecksum(tag, b)
+	}
+	return sum, nil
+}
+
+func parseReader(r io.ReaderAt, size, offset int64, opts *ParseOptions) (*Font, error) {
+	if size-offset < 12 {
+		return nil, FormatError("TTF data is too short")
+	}
+	var header [12]byte
+	if err := readAt(r, header[:], offset); err != nil {
+		return nil, err
+	}
+	switch u32(header[:], 0) {
+	case 0x00010000, 0x4f54544f: // "OTTO" as a big-endian uint32, for CFF data.
+		// No-op.
+	case 0x74746366: // "ttcf" as a big-endian uint32.
+		if offset != 0 {
+			return nil, FormatError("recursive TTC")
+		}
+		if v := u32(header[:], 4); v != 0x00010000 && v != 0x00020000 {
+			return nil, FormatError("bad TTC version")
+		}
+		if int32(u32(header[:], 8)) <= 0 {
+			return nil, FormatError("bad number of TTC fonts")
+		}
+		var b [4]byte
+		if err := readAt(r, b[:], 12); err != nil {
+			return nil, err
+		}
+		offset = int64(u32(b[:], 0))
+		if offset <= 0 || offset > size {
+			return nil, FormatError("bad TTC offset")
+		}
+		return parseReader(r, size, offset, opts)
+	default:
+		return nil, FormatError("bad TTF version")
+	}
+	n := int(u16(header[:], 4))
+	if size-offset < int64(16*n+12) {
+		return nil, FormatError("TTF data is too short")
+	}
+	directory := make([]byte, 16*n)
+	if err := readAt(r, directory, offset+12); err != nil {
+		return nil, err
+	}
+	f := &Font{reader: r}
+	var bad []string
+	for i := 0; i < n; i++ {
+		x := 16 * i
+		tag := string(directory[x : x+4])
+		t := f.table(tag)
+		if t == nil || !opts.decodes(tag) {
+			continue
+		}
+		tableOffset, length := int64(u32(directory, x+8)), int64(u32(directory, x+12))
+		if tableOffset+length > size {
+			return nil, FormatError(fmt.Sprintf("offset + length too large: %d", tableOffset+length))
+		}
+		var sum uint32
+		if readerTables[tag] {
+			if length == 0 {
+				continue
+			}
+			rt := readerTable{tableOffset, length}
+			if f.readerTables == nil {
+				f.readerTables = make(map[string]readerTable)
+			}
+			f.readerTables[tag] = rt
+			if opts != nil && opts.VerifyChecksums {
+				var err error
+				if sum, err = readerChecksum(r, tag, rt); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			*t = make([]byte, length)
+			if err := readAt(r, *t, tableOffset); err != nil {
+				return nil, err
+			}
+			sum = TableChecksum(tag, *t)
+		}
+		if opts != nil && opts.VerifyChecksums && sum != u32(directory, x+4) {
+			bad = append(bad, fmt.Sprintf("%q", tag))
+		}
+	}
+	if len(bad) != 0 {
+		return nil, FormatError("bad table checksums: " + strings.Join(bad, ", "))
+	}
+	if err := f.parseTables(opts); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Table returns the raw data of the table with the given tag, such as
+// [4]byte{'n', 'a', 'm', 'e'} or [4]byte{'C', 'F', 'F', ' '}, and whether
+// the font has that table. Unlike the Font's other methods, it does not
+// decode the data, and so it can return any table in the font's table
+// directory, including those that the Font does not use. A Font that was
+// returned by ParseReader, however, only has the tables that it uses, as
+// ParseReader does not read the others. For the tables that it reads on
+// demand, such as "glyf", each call reads the whole table into a new slice,
+// and Table returns false if that read fails.
+//
+// Otherwise, the returned slice shares memory with the data that the Font
+// was parsed from, rather than being a copy, and so it must not be modified.
+func (f *Font) Table(tag [4]byte) ([]byte, bool) {
+	s := string(tag[:])
+	if rt, ok := f.readerTables[s]; ok {
+		b, err := f.tableData(s, nil, 0, int(rt.length))
+		return b, err == nil
+	}
+	if t := f.table(s); t != nil && *t != nil {
+		return *t, true
+	}
+	t, ok := f.otherTables[s]
+	return t, ok
+}
+
+// ignoreTable makes the Font behave as if it did not have the table with the
+// given tag, which is an optional table that is bad or unsupported. The
+// Table method still returns the table's data.
+func (f *Font) ignoreTable(tag string) {
+	t := f.table(tag)
+	if f.otherTables == nil {
+		f.otherTables = make(map[string][]byte)
+	}
+	f.otherTables[tag], *t = *t, nil
+}
+
+// table returns the Font field that holds the table with the given tag, or
+// nil if the Font does not use that table.
+func (f *Font) table(tag string) *[]byte {
+	switch tag {
+	case "avar":
+		return &f.avar
+	case "CBDT":
+		return &f.cbdt
+	case "CBLC":
+		return &f.cblc
+	case "CFF ":
+		return &f.cff
+	case "cmap":
+		return &f.cmap
+	case "COLR":
+		return &f.colr
+	case "CPAL":
+		return &f.cpal
+	case "cvt ":
+		return &f.cvt
+	case "EBDT":
+		return &f.ebdt
+	case "EBLC":
+		return &f.eblc
+	case "fpgm":
+		return &f.fpgm
+	case "fvar":
+		return &f.fvar
+	case "gasp":
+		return &f.gasp
+	case "glyf":
+		return &f.glyf
+	case "GPOS":
+		return &f.gpos
+	case "gvar":
+		return &f.gvar
+	case "hdmx":
+		return &f.hdmx
+	case "head":
+		return &f.head
+	case "hhea":
+		return &f.hhea
+	case "hmtx":
+		return &f.hmtx
+	case "kern":
+		return &f.kern
+	case "loca":
+		return &f.loca
+	case "LTSH":
+		return &f.ltsh
+	case "maxp":
+		return &f.maxp
+	case "name":
+		return &f.name
+	case "OS/2":
+		return &f.os2
+	case "post":
+		return &f.post
+	case "prep":
+		return &f.prep
+	case "sbix":
+		return &f.sbix
+	case "vhea":
+		return &f.vhea
+	case "vmtx":
+		return &f.vmtx
+	case "VORG":
+		return &f.vorg
+	}
+	return nil
+}
+
+// parseTables parses and sanity-checks the TTF data, once the table slices
+// have been assigned. The glyph outlines and cmap are not required if opts
+// skips them.
+func (f *Font) parseTables(opts *ParseOptions) (err error) {
+	f.maxComponentDepth = DefaultMaxComponentDepth
+	if opts != nil && opts.MaxComponentDepth > 0 {
+		f.maxComponentDepth = opts.MaxComponentDepth
+	}
 	if err = f.parseHead(); err != nil {
 		return
 	}
 	if err = f.parseMaxp(); err != nil {
 		return
 	}
-	if err = f.parseCmap(); err != nil {
-		return
+	if len(f.cff) != 0 {
+		if err = f.parseCFF(); err != nil {
+			return
+		}
+	} else if opts.decodes("glyf") {
+		if err = f.parseLoca(); err != nil {
+			return
+		}
+	}
+	if opts.decodes("cmap") {
+		if err = f.parseCmap(); err != nil {
+			return
+		}
 	}
 	if err = f.parseKern(); err != nil {
 		return
 	}
+	if err = f.parseGPOS(); err != nil {
+		return
+	}
 	if err = f.parseHhea(); err != nil {
 		return
 	}
-	font = f
-	return
+	if err = f.parseOS2(); err != nil {
+		return
+	}
+	if err = f.parseVhea(); err != nil {
+		return
+	}
+	// A bad or unsupported VORG table is ignored, as if the font had none,
+	// and VerticalOrigin falls back to the typographic ascent.
+	if f.parseVORG() != nil {
+		f.ignoreTable("VORG")
+	}
+	// A bad or unsupported gasp table is ignored, as if the font had none,
+	// and GaspBehavior returns its default of grid-fitting and smoothing.
+	if f.parseGasp() != nil {
+		f.ignoreTable("gasp")
+	}
+	// The hdmx table only holds hints, and so a bad or unsupported one is
+	// ignored, rather than being an error, and DeviceAdvance falls back to
+	// the hmtx table's advances.
+	if f.parseHdmx() != nil {
+		f.ignoreTable("hdmx")
+	}
+	// Likewise, a bad LTSH table, such as one whose number of glyphs was
+	// not updated when the font was subset, is ignored, and
+	// LinearThreshold returns 0.
+	if f.parseLTSH() != nil {
+		f.ignoreTable("LTSH")
+	}
+	if err = f.parsePost(); err != nil {
+		return
+	}
+	if err = f.parseName(); err != nil {
+		return
+	}
+	if err = f.parseBitmaps(); err != nil {
+		return
+	}
+	if err = f.parseCOLR(); err != nil {
+		return
+	}
+	if err = f.parseFvar(); err != nil {
+		return
+	}
+	if err = f.parseAvar(); err != nil {
+		return
+	}
+	if err = f.parseGvar(); err != nil {
+		return
+	}
+	return nil
 }
@@ -7,15 +7,425 @@ package truetype
 
 import (
 	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/andybalholm/brotli"
 )
 
+// appendU16 appends the big-endian encodings of vs to b.
+func appendU16(b []byte, vs ...uint16) []byte {
+	for _, v := range vs {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// appendU32 appends the big-endian encodings of vs to b.
+func appendU32(b []byte, vs ...uint32) []byte {
+	for _, v := range vs {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// A testFont holds a font's tables, keyed by tag. It is used to build
+// modified copies of the luxi fonts, so that features that those fonts don't
+// use can still be tested.
+type testFont map[string][]byte
+
+// readTestFont returns the tables of the named font in the luxi-fonts
+// directory.
+func readTestFont(t testing.TB, filename string) testFont {
+	b, err := ioutil.ReadFile("../../luxi-fonts/" + filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := testFont{}
+	for i, n := 0, int(u16(b, 4)); i < n; i++ {
+		x := 16*i + 12
+		offset, length := u32(b, x+8), u32(b, x+12)
+		tf[string(b[x:x+4])] = b[offset : offset+length]
+	}
+	return tf
+}
+
+// bytes returns the TTF data for tf.
+func (tf testFont) bytes() []byte {
+	tags := make([]string, 0, len(tf))
+	for tag := range tf {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	b := appendU32(nil, 0x00010000)
+	if _, ok := tf["CFF "]; ok {
+		b = append(b[:0], "OTTO"...)
+	}
+	b = appendU16(b, uint16(len(tags)), 0, 0, 0)
+	b = append(b, make([]byte, 16*len(tags))...)
+	for i, tag := range tags {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		x := 16*i + 12
+		copy(b[x:], tag)
+		copy(b[x+8:], appendU32(nil, uint32(len(b)), uint32(len(tf[tag]))))
+		b = append(b, tf[tag]...)
+	}
+	return b
+}
+
+// woff returns the WOFF data for tf. Each table is zlib-compressed, unless
+// that would not make it shorter.
+func (tf testFont) woff() []byte {
+	tags := make([]string, 0, len(tf))
+	for tag := range tf {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	flavor := uint32(0x00010000)
+	if _, ok := tf["CFF "]; ok {
+		flavor = 0x4f54544f
+	}
+	b := append([]byte("wOFF"), appendU32(nil, flavor, 0)...)
+	b = appendU16(b, uint16(len(tags)), 0)
+	b = append(b, make([]byte, 28+20*len(tags))...)
+	for i, tag := range tags {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		t := tf[tag]
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write(t)
+		w.Close()
+		data := t
+		if z.Len() < len(t) {
+			data = z.Bytes()
+		}
+		x := 44 + 20*i
+		copy(b[x:], tag)
+		copy(b[x+4:], appendU32(nil, uint32(len(b)), uint32(len(data)), uint32(len(t)), TableChecksum(tag, t)))
+		b = append(b, data...)
+	}
+	copy(b[8:], appendU32(nil, uint32(len(b))))
+	return b
+}
+
+// woff2 returns the WOFF2 data for tf. If transform is true, then the glyf
+// and loca tables are transformed, and so is the hmtx table if its left side
+// bearings are all equal to their glyphs' xMin.
+func (tf testFont) woff2(transform bool) []byte {
+	tags := make([]string, 0, len(tf))
+	for tag := range tf {
+		tags = append(tags, tag)
+	}
+	// The loca table must follow the glyf table.
+	sort.Strings(tags)
+	tables := make(map[string][]byte, len(tf))
+	for tag, data := range tf {
+		tables[tag] = data
+	}
+	versions := map[string]uint8{"glyf": 3, "loca": 3}
+	if transform {
+		var xMins []int16
+		tables["glyf"], xMins = woff2TransformGlyf(tf)
+		tables["loca"] = nil
+		versions["glyf"], versions["loca"] = 0, 0
+		if hmtx, ok := woff2TransformHmtx(tf, xMins); ok {
+			tables["hmtx"] = hmtx
+			versions["hmtx"] = 1
+		}
+	}
+
+	var dir, data []byte
+	appendBase128 := func(b []byte, v uint32) []byte {
+		n := 1
+		for ; v>>(7*uint(n)) != 0; n++ {
+		}
+		for i := n - 1; i >= 0; i-- {
+			c := uint8(v>>(7*uint(i))) & 0x7f
+			if i != 0 {
+				c |= 0x80
+			}
+			b = append(b, c)
+		}
+		return b
+	}
+	for _, tag := range tags {
+		k := uint8(0x3f)
+		for i, wt := range woff2Tags {
+			if wt == tag {
+				k = uint8(i)
+			}
+		}
+		dir = append(dir, versions[tag]<<6|k)
+		if k == 0x3f {
+			dir = append(dir, tag...)
+		}
+		dir = appendBase128(dir, uint32(len(tf[tag])))
+		if (tag == "glyf" || tag == "loca") && versions[tag] == 0 || versions[tag] == 1 {
+			dir = appendBase128(dir, uint32(len(tables[tag])))
+		}
+		data = append(data, tables[tag]...)
+	}
+	var z bytes.Buffer
+	w := brotli.NewWriter(&z)
+	w.Write(data)
+	w.Close()
+
+	flavor := uint32(0x00010000)
+	if _, ok := tf["CFF "]; ok {
+		flavor = 0x4f54544f
+	}
+	b := append([]byte("wOF2"), appendU32(nil, flavor, 0)...)
+	b = appendU16(b, uint16(len(tags)), 0)
+	b = appendU32(b, uint32(len(tf.bytes())), uint32(z.Len()))
+	b = append(b, make([]byte, 24)...)
+	b = append(append(b, dir...), z.Bytes()...)
+	copy(b[8:], appendU32(nil, uint32(len(b))))
+	return b
+}
+
+// woff2TransformGlyf returns tf's glyf and loca tables in the WOFF2 glyf
+// transform's encoding, and each glyph's xMin. Every point's delta uses the
+// longest triplet encoding, and every 255UInt16 its three byte encoding.
+func woff2TransformGlyf(tf testFont) ([]byte, []int16) {
+	glyf, loca, head := tf["glyf"], tf["loca"], tf["head"]
+	numGlyphs := int(u16(tf["maxp"], 4))
+	offset := func(j int) int {
+		if u16(head, 50) == 0 {
+			return 2 * int(u16(loca, 2*j))
+		}
+		return int(u32(loca, 4*j))
+	}
+	u255 := func(b []byte, v int) []byte {
+		return append(b, 253, uint8(v>>8), uint8(v))
+	}
+	var nContour, nPoints, flags, glyphs, composite, bbox, instructions []byte
+	bboxBitmap := make([]byte, 4*((numGlyphs+31)>>5))
+	xMins := make([]int16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		d := glyf[offset(i):offset(i+1)]
+		if len(d) == 0 {
+			nContour = appendU16(nContour, 0)
+			continue
+		}
+		nc := int16(u16(d, 0))
+		nContour = append(nContour, d[0], d[1])
+		xMins[i] = int16(u16(d, 2))
+		if nc < 0 {
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			bbox = append(bbox, d[2:10]...)
+			x, hasInstructions := 10, false
+			for {
+				f := u16(d, x)
+				n := 4
+				if f&flagArg1And2AreWords != 0 {
+					n += 4
+				} else {
+					n += 2
+				}
+				switch {
+				case f&flagWeHaveAScale != 0:
+					n += 2
+				case f&flagWeHaveAnXAndYScale != 0:
+					n += 4
+				case f&flagWeHaveATwoByTwo != 0:
+					n += 8
+				}
+				composite = append(composite, d[x:x+n]...)
+				x += n
+				hasInstructions = hasInstructions || f&flagWeHaveInstructions != 0
+				if f&flagMoreComponents == 0 {
+					break
+				}
+			}
+			if hasInstructions {
+				n := int(u16(d, x))
+				glyphs = u255(glyphs, n)
+				instructions = append(instructions, d[x+2:x+2+n]...)
+			}
+			continue
+		}
+
+		// Decode the simple glyph's points.
+		x, np := 10, 0
+		for j := 0; j < int(nc); j++ {
+			end := int(u16(d, x)) + 1
+			nPoints = u255(nPoints, end-np)
+			np, x = end, x+2
+		}
+		nInstructions := int(u16(d, x))
+		instr := d[x+2 : x+2+nInstructions]
+		x += 2 + nInstructions
+		fs := make([]uint8, 0, np)
+		for len(fs) < np {
+			f := d[x]
+			x++
+			fs = append(fs, f)
+			if f&flagRepeat != 0 {
+				for n := d[x]; n > 0; n-- {
+					fs = append(fs, f)
+				}
+				x++
+			}
+		}
+		ps := make([]Point, np)
+		for _, axis := range []int{0, 1} {
+			short, same := uint8(flagXShortVector), uint8(flagThisXIsSame)
+			if axis == 1 {
+				short, same = flagYShortVector, flagThisYIsSame
+			}
+			v := int32(0)
+			for j, f := range fs {
+				switch {
+				case f&short != 0 && f&same != 0:
+					v += int32(d[x])
+					x++
+				case f&short != 0:
+					v -= int32(d[x])
+					x++
+				case f&same == 0:
+					v += int32(int16(u16(d, x)))
+					x += 2
+				}
+				if axis == 0 {
+					ps[j].X = v
+				} else {
+					ps[j].Y = v
+				}
+			}
+		}
+
+		// Encode the points as triplets.
+		var px, py int32
+		for j, p := range ps {
+			dx, dy := p.X-px, p.Y-py
+			px, py = p.X, p.Y
+			f := uint8(124)
+			if dx >= 0 {
+				f |= 1
+			} else {
+				dx = -dx
+			}
+			if dy >= 0 {
+				f |= 2
+			} else {
+				dy = -dy
+			}
+			if fs[j]&flagOnCurve == 0 {
+				f |= 0x80
+			}
+			flags = append(flags, f)
+			glyphs = appendU16(glyphs, uint16(dx), uint16(dy))
+		}
+		glyphs = u255(glyphs, nInstructions)
+		instructions = append(instructions, instr...)
+		if b := pointBounds(ps); b != (Bounds{
+			int32(int16(u16(d, 2))), int32(int16(u16(d, 4))),
+			int32(int16(u16(d, 6))), int32(int16(u16(d, 8))),
+		}) {
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			bbox = append(bbox, d[2:10]...)
+		}
+	}
+	bbox = append(bboxBitmap, bbox...)
+	b := appendU16(nil, 0, 0, uint16(numGlyphs), u16(head, 50))
+	streams := [][]byte{nContour, nPoints, flags, glyphs, composite, bbox, instructions}
+	for _, s := range streams {
+		b = appendU32(b, uint32(len(s)))
+	}
+	for _, s := range streams {
+		b = append(b, s...)
+	}
+	return b, xMins
+}
+
+// woff2TransformHmtx returns tf's hmtx table in the WOFF2 hmtx transform's
+// encoding, given each glyph's xMin, or false if no left side bearings can
+// be omitted.
+func woff2TransformHmtx(tf testFont, xMins []int16) ([]byte, bool) {
+	hmtx, nHMetric := tf["hmtx"], int(u16(tf["hhea"], 34))
+	lsb := func(i int) int16 {
+		if i < nHMetric {
+			return int16(u16(hmtx, 4*i+2))
+		}
+		return int16(u16(hmtx, 4*nHMetric+2*(i-nHMetric)))
+	}
+	flags := uint8(3)
+	for i, xMin := range xMins {
+		if lsb(i) != xMin {
+			if i < nHMetric {
+				flags &^= 1
+			} else {
+				flags &^= 2
+			}
+		}
+	}
+	if flags == 0 {
+		return nil, false
+	}
+	b := []byte{flags}
+	for i := 0; i < nHMetric; i++ {
+		b = append(b, hmtx[4*i:4*i+2]...)
+	}
+	for i := range xMins {
+		if i < nHMetric && flags&1 == 0 || i >= nHMetric && flags&2 == 0 {
+			b = appendU16(b, uint16(lsb(i)))
+		}
+	}
+	return b, true
+}
+
+// setGlyph replaces the data for the i'th glyph, rewriting the glyf and loca
+// tables. The new loca table is always in the long format.
+func (tf testFont) setGlyph(i int, data []byte) {
+	head, oldGlyf, oldLoca := tf["head"], tf["glyf"], tf["loca"]
+	offset := func(j int) uint32 {
+		if u16(head, 50) == 0 {
+			return 2 * uint32(u16(oldLoca, 2*j))
+		}
+		return u32(oldLoca, 4*j)
+	}
+	var glyf, loca []byte
+	for j, n := 0, int(u16(tf["maxp"], 4)); j < n; j++ {
+		loca = appendU32(loca, uint32(len(glyf)))
+		if j == i {
+			glyf = append(glyf, data...)
+		} else {
+			glyf = append(glyf, oldGlyf[offset(j):offset(j+1)]...)
+		}
+	}
+	loca = appendU32(loca, uint32(len(glyf)))
+	tf["head"] = append(append([]byte(nil), head[:50]...), 0, 1, head[52], head[53])
+	tf["glyf"], tf["loca"] = glyf, loca
+}
+
+// parseTestFont parses the TTF data for tf.
+func parseTestFont(t testing.TB, tf testFont) *Font {
+	font, err := Parse(tf.bytes())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return font
+}
+
 // TestParse tests that the luxisr.ttf metrics and glyphs are parsed correctly.
 // The numerical values can be manually verified by examining luxisr.ttx.
 func TestParse(t *testing.T) {
@@ -30,6 +440,9 @@ func TestParse(t *testing.T) {
 	if got, want := font.FUnitsPerEm(), int32(2048); got != want {
 		t.Errorf("FUnitsPerEm: got %v, want %v", got, want)
 	}
+	if got, want := font.NumGlyphs(), 391; got != want {
+		t.Errorf("NumGlyphs: got %v, want %v", got, want)
+	}
 	fupe := font.FUnitsPerEm()
 	if got, want := font.Bounds(fupe), (Bounds{-441, -432, 2024, 2033}); got != want {
 		t.Errorf("Bounds: got %v, want %v", got, want)
@@ -53,7 +466,8 @@ func TestParse(t *testing.T) {
 		t.Fatalf("Load: %v", err)
 	}
 	g1 := &GlyphBuf{
-		B: Bounds{19, 0, 1342, 1480},
+		B:            Bounds{19, 0, 1342, 1480},
+		AdvanceWidth: 1366,
 		Point: []Point{
 			{19, 0, 51},
 			{581, 1480, 1},
@@ -68,76 +482,3834 @@ func TestParse(t *testing.T) {
 			{667, 1200, 3},
 		},
 		End: []int{8, 11},
+		phantom: [4]Point{
+			{0, 0, 0},
+			{1366, 0, 0},
+			{0, 2033, 0},
+			{0, -432, 0},
+		},
 	}
 	if got, want := fmt.Sprint(g0), fmt.Sprint(g1); got != want {
 		t.Errorf("GlyphBuf:\ngot  %v\nwant %v", got, want)
 	}
 }
 
-func testScaling(t *testing.T, filename string, hinter *Hinter) {
+// countingReaderAt is an io.ReaderAt that counts the bytes read from it.
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+// readerTestFont is like parseTestFont, but parses tf's data with
+// ParseReader.
+func readerTestFont(t testing.TB, tf testFont) *Font {
+	b := tf.bytes()
+	font, err := ParseReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("ParseReader: %v", err)
+	}
+	return font
+}
+
+func TestParseReader(t *testing.T) {
 	b, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
 	if err != nil {
-		t.Fatalf("ReadFile: %v", err)
+		t.Fatal(err)
 	}
-	font, err := Parse(b)
+	want, err := Parse(b)
 	if err != nil {
-		t.Fatalf("Parse: %v", err)
+		t.Fatal(err)
 	}
-	f, err := os.Open("../../luxi-fonts/" + filename)
+	tf := readTestFont(t, "luxisr.ttf")
+	r := &countingReaderAt{r: bytes.NewReader(b)}
+	got, err := ParseReader(r, int64(len(b)))
 	if err != nil {
-		t.Fatalf("Open: %v", err)
+		t.Fatal(err)
+	}
+	// The glyph outlines are not read up front.
+	if max := len(b) - len(tf["glyf"]); r.n > max {
+		t.Errorf("bytes read: got %d, want <= %d", r.n, max)
+	}
+	// Loading a simple glyph reads only that glyph's data.
+	i := want.Index('A')
+	data, err := want.glyphData(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := r.n
+	g0, g1 := NewGlyphBuf(), NewGlyphBuf()
+	if err := g1.Load(got, 12*64, i, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if r.n-n != len(data) {
+		t.Errorf("bytes read by Load: got %d, want %d", r.n-n, len(data))
+	}
+	var h0, h1 Hinter
+	for i := 0; i < want.NumGlyphs(); i++ {
+		if err := g0.Load(want, 12*64, Index(i), &h0); err != nil {
+			t.Fatalf("glyph #%d: Load: %v", i, err)
+		}
+		if err := g1.Load(got, 12*64, Index(i), &h1); err != nil {
+			t.Fatalf("glyph #%d: ParseReader Load: %v", i, err)
+		}
+		if g0.B != g1.B || g0.AdvanceWidth != g1.AdvanceWidth ||
+			!reflect.DeepEqual(g0.End, g1.End) || !reflect.DeepEqual(g0.Point, g1.Point) {
+			t.Fatalf("glyph #%d: ParseReader and Parse glyphs differ", i)
+		}
+	}
+	if data, ok := got.Table(tableTag("glyf")); !ok || !bytes.Equal(data, tf["glyf"]) {
+		t.Errorf(`Table("glyf"): got %d bytes, %t, want %d bytes, true`, len(data), ok, len(tf["glyf"]))
+	}
+	// Other than for the glyf table, the Fonts are the same.
+	got.glyf, got.reader, got.readerTables = want.glyf, nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseReader and Parse results differ")
 	}
-	defer f.Close()
 
-	wants := [][]Point{}
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		text := scanner.Text()
-		if text == "" {
-			wants = append(wants, []Point{})
-			continue
+	// An unknown table is unused, and should not have been read.
+	tf["zzzz"] = make([]byte, 1000)
+	b = tf.bytes()
+	r = &countingReaderAt{r: bytes.NewReader(b)}
+	if _, err := ParseReader(r, int64(len(b))); err != nil {
+		t.Fatal(err)
+	}
+	if max := len(b) - len(tf["glyf"]) - len(tf["zzzz"]); r.n > max {
+		t.Errorf("bytes read: got %d, want <= %d", r.n, max)
+	}
+
+	// The tables that opts skips are not read either.
+	if b, err = ioutil.ReadFile("../../luxi-fonts/luxisr.ttf"); err != nil {
+		t.Fatal(err)
+	}
+	opts := &ParseOptions{Tables: []string{"cmap"}, VerifyChecksums: true}
+	r = &countingReaderAt{r: bytes.NewReader(b)}
+	f, err := ParseReaderWithOptions(r, int64(len(b)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := len(b) - len(tf["glyf"]) - len(tf["loca"]); r.n > max {
+		t.Errorf("bytes read with opts: got %d, want <= %d", r.n, max)
+	}
+	if got, want := f.Index('A'), want.Index('A'); got != want {
+		t.Errorf("Index('A') with opts: got %d, want %d", got, want)
+	}
+	if err := NewGlyphBuf().Load(f, 12*64, f.Index('A'), nil); err != ErrNoOutlines {
+		t.Errorf("Load with opts: got %v, want ErrNoOutlines", err)
+	}
+	// A table that is read has its checksum verified, and so does a table
+	// that is read on demand.
+	for _, tag := range []string{"cmap", "glyf"} {
+		c := append([]byte(nil), b...)
+		for i := 0; i < int(u16(c, 4)); i++ {
+			if x := 12 + 16*i; string(c[x:x+4]) == tag {
+				c[u32(c, x+8)]++
+			}
 		}
-		ss := strings.Split(text, ",")
-		points := make([]Point, len(ss))
-		for i, s := range ss {
-			p := &points[i]
-			if _, err := fmt.Sscanf(s, "%d %d %d", &p.X, &p.Y, &p.Flags); err != nil {
-				t.Fatalf("Sscanf: %v", err)
+		opts := &ParseOptions{VerifyChecksums: true}
+		if _, err := ParseReaderWithOptions(bytes.NewReader(c), int64(len(c)), opts); err == nil {
+			t.Errorf("corrupt %s: got nil error", tag)
+		}
+	}
+	if _, err := ParseReaderWithOptions(bytes.NewReader(b), int64(len(b)), &ParseOptions{VerifyChecksums: true}); err != nil {
+		t.Errorf("VerifyChecksums: %v", err)
+	}
+}
+
+func TestParseWOFF(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	want := parseTestFont(t, tf)
+	b := tf.woff()
+	got, err := ParseWOFF(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseWOFF and Parse results differ")
+	}
+
+	// glyf is the offset of the glyf table's entry in the WOFF table
+	// directory, which is sorted by tag: "OS/2", "cmap", "cvt ", "fpgm",
+	// "gasp", "glyf", and so on.
+	const glyf = 44 + 20*5
+	if tag := string(b[glyf : glyf+4]); tag != "glyf" {
+		t.Fatalf("table directory entry: got %q, want \"glyf\"", tag)
+	}
+	testCases := []struct {
+		desc   string
+		modify func(b []byte)
+		want   string
+	}{
+		{"bad signature", func(b []byte) { b[0] = 'x' }, "bad WOFF signature"},
+		{"bad length", func(b []byte) { b[11]++ }, "bad WOFF length"},
+		{"bad checksum", func(b []byte) { b[glyf+19]++ }, `bad "glyf" table checksum`},
+		{"bad original length", func(b []byte) { b[glyf+15]++ }, "bad WOFF table compression"},
+		{"bad compressed data", func(b []byte) {
+			b[int(u32(b, glyf+4))+int(u32(b, glyf+8))/2] ^= 0xff
+		}, "bad WOFF table compression"},
+	}
+	for _, tc := range testCases {
+		bb := append([]byte(nil), b...)
+		tc.modify(bb)
+		_, err := ParseWOFF(bb)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.desc, err, tc.want)
+		}
+	}
+
+	// TTF data is not WOFF data.
+	if _, err := ParseWOFF(tf.bytes()); err == nil {
+		t.Error("TTF data: got no error, want one")
+	}
+}
+
+func TestParseWOFF2(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	want := parseTestFont(t, tf)
+
+	// Without the glyf transform, the tables are unchanged.
+	got, err := ParseWOFF2(tf.woff2(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("untransformed: ParseWOFF2 and Parse results differ")
+	}
+
+	// With the glyf transform, the glyf and loca tables are re-encoded, but
+	// their glyphs are unchanged.
+	b := tf.woff2(true)
+	got, err = ParseWOFF2(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h0, h1 Hinter
+	g0, g1 := NewGlyphBuf(), NewGlyphBuf()
+	for i := 0; i < want.NumGlyphs(); i++ {
+		for _, scale := range []int32{want.FUnitsPerEm(), 12 * 64} {
+			if err := g0.Load(want, scale, Index(i), &h0); err != nil {
+				t.Fatalf("glyph #%d: Load: %v", i, err)
+			}
+			if err := g1.Load(got, scale, Index(i), &h1); err != nil {
+				t.Fatalf("glyph #%d: transformed Load: %v", i, err)
+			}
+			if g0.B != g1.B || g0.AdvanceWidth != g1.AdvanceWidth ||
+				!reflect.DeepEqual(g0.End, g1.End) || !woff2SamePoints(g0.Point, g1.Point) {
+				t.Fatalf("glyph #%d, scale %d: transformed glyph differs", i, scale)
 			}
 		}
-		wants = append(wants, points)
+		if h0, h1 := want.HMetric(2048, Index(i)), got.HMetric(2048, Index(i)); h0 != h1 {
+			t.Fatalf("glyph #%d: HMetric: got %v, want %v", i, h1, h0)
+		}
 	}
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		t.Fatalf("Scanner: %v", err)
+
+	testCases := []struct {
+		desc   string
+		modify func(b []byte) []byte
+		want   string
+	}{
+		{"bad signature", func(b []byte) []byte { b[3] = 'x'; return b }, "bad WOFF2 signature"},
+		{"bad length", func(b []byte) []byte { b[11]++; return b }, "bad WOFF2 length"},
+		{"collection", func(b []byte) []byte { copy(b[4:], "ttcf"); return b }, "WOFF2 font collection"},
+		{"truncated data", func(b []byte) []byte {
+			b = b[:len(b)-16]
+			copy(b[8:], appendU32(nil, uint32(len(b))))
+			return b
+		}, "bad WOFF2 compressed size"},
+	}
+	for _, tc := range testCases {
+		_, err := ParseWOFF2(tc.modify(append([]byte(nil), b...)))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.desc, err, tc.want)
+		}
 	}
 
-	const fontSize = 12
-	glyphBuf := NewGlyphBuf()
-	for i, want := range wants {
-		// TODO: completely implement hinting. For now, only the first N glyphs
-		// of luxisr.ttf are correctly hinted.
-		const N = 1
-		if hinter != nil && i == N {
+	// WOFF data is not WOFF2 data.
+	if _, err := ParseWOFF2(tf.woff()); err == nil {
+		t.Error("WOFF data: got no error, want one")
+	}
+}
+
+func TestWOFF2GlyfTruncated(t *testing.T) {
+	// transform returns a WOFF2 glyf transform of one glyph, whose bbox
+	// bitmap marks that glyph but whose bbox stream then ends.
+	transform := func(nContour, nPoints, flag, glyph, composite []byte) []byte {
+		bbox := []byte{0x80, 0, 0, 0}
+		streams := [][]byte{nContour, nPoints, flag, glyph, composite, bbox, nil}
+		b := appendU16(nil, 0, 0, 1, 0)
+		for _, s := range streams {
+			b = appendU32(b, uint32(len(s)))
+		}
+		for _, s := range streams {
+			b = append(b, s...)
+		}
+		return b
+	}
+	testCases := []struct {
+		desc string
+		b    []byte
+	}{
+		{"simple", transform([]byte{0, 1}, []byte{1}, []byte{0}, []byte{5, 0}, nil)},
+		{"compound", transform([]byte{0xff, 0xff}, nil, nil, nil, []byte{0, 0, 0, 0, 0, 0})},
+	}
+	for _, tc := range testCases {
+		_, _, _, err := woff2Glyf(tc.b, 0)
+		if _, ok := err.(FormatError); !ok {
+			t.Errorf("%s: got error %v, want a FormatError", tc.desc, err)
+		}
+	}
+}
+
+// woff2SamePoints returns whether the two slices of points have the same
+// co-ordinates and on-curve flags.
+func woff2SamePoints(ps, qs []Point) bool {
+	if len(ps) != len(qs) {
+		return false
+	}
+	for i, p := range ps {
+		q := qs[i]
+		if p.X != q.X || p.Y != q.Y || p.Flags&flagOnCurve != q.Flags&flagOnCurve {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReadUintBase128(t *testing.T) {
+	testCases := []struct {
+		b    []byte
+		want uint32
+		ok   bool
+	}{
+		{[]byte{0x00}, 0, true},
+		{[]byte{0x3f}, 63, true},
+		{[]byte{0x81, 0x00}, 128, true},
+		{[]byte{0x8f, 0xff, 0xff, 0xff, 0x7f}, 0xffffffff, true},
+		{[]byte{0x80, 0x01}, 0, false},
+		{[]byte{0x90, 0x80, 0x80, 0x80, 0x00}, 0, false},
+		{[]byte{0x81, 0x81, 0x81, 0x81, 0x81, 0x01}, 0, false},
+		{[]byte{0x81}, 0, false},
+	}
+	for _, tc := range testCases {
+		got, _, err := readUintBase128(tc.b, 0)
+		if got != tc.want || (err == nil) != tc.ok {
+			t.Errorf("% x: got %d, %v, want %d, ok=%t", tc.b, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestSubset(t *testing.T) {
+	f := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	// 'é' is a compound glyph, whose components are 'e' and the acute
+	// accent.
+	glyphs := f.IndexString("Hé H")
+	b, err := f.Subset(glyphs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subset's glyphs are .notdef, 'H', 'é', ' ', and then the
+	// components of 'é'.
+	order := []Index{0, f.Index('H'), f.Index('é'), f.Index(' ')}
+	glyf, err := f.glyphData(f.Index('é'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 10; ; {
+		c, offset1, err := decodeComponent(glyf, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, c.glyph)
+		if c.flags&flagMoreComponents == 0 {
 			break
 		}
+		offset = offset1
+	}
+	if len(order) != 6 || indexOf(order, f.Index('e')) < 0 {
+		t.Fatalf("'é' components: got %v, want 'e' and an accent", order[4:])
+	}
+	if got, want := sub.NumGlyphs(), len(order); got != want {
+		t.Fatalf("NumGlyphs: got %d, want %d", got, want)
+	}
+	for _, r := range "Hé e" {
+		if got, want := sub.Index(r), Index(indexOf(order, f.Index(r))); got != want {
+			t.Errorf("Index(%q): got %d, want %d", r, got, want)
+		}
+	}
+	if got := sub.Index('A'); got != 0 {
+		t.Errorf("Index('A'): got %d, want 0", got)
+	}
 
-		if err = glyphBuf.Load(font, fontSize*64, Index(i), hinter); err != nil {
-			t.Fatalf("Load: %v", err)
+	g0, g1 := NewGlyphBuf(), NewGlyphBuf()
+	var h0, h1 Hinter
+	for j, i := range order {
+		if err := g0.Load(f, 12*64, i, &h0); err != nil {
+			t.Fatal(err)
 		}
-		got := glyphBuf.Point
-		for i := range got {
-			got[i].Flags &= 0x01
+		if err := g1.Load(sub, 12*64, Index(j), &h1); err != nil {
+			t.Fatal(err)
 		}
-		if !reflect.DeepEqual(got, want) {
-			t.Errorf("glyph #%d:\ngot  %v\nwant %v\n", i, got, want)
+		if !reflect.DeepEqual(g0.Point, g1.Point) || !reflect.DeepEqual(g0.End, g1.End) ||
+			g0.AdvanceWidth != g1.AdvanceWidth {
+			t.Errorf("glyph #%d: subset glyph #%d differs", i, j)
+		}
+		if got, want := sub.HMetric(2048, Index(j)), f.HMetric(2048, i); got != want {
+			t.Errorf("glyph #%d: HMetric: got %v, want %v", i, got, want)
+		}
+		if got, want := sub.GlyphName(Index(j)), f.GlyphName(i); got != want {
+			t.Errorf("glyph #%d: GlyphName: got %q, want %q", i, got, want)
+		}
+	}
+
+	// The whole font's checksum is 0xB1B0AFBA.
+	if got := TableChecksum("", b); got != 0xb1b0afba {
+		t.Errorf("checksum: got %#08x, want 0xb1b0afba", got)
+	}
+	if _, err := f.Subset([]Index{391}); err == nil {
+		t.Error("bad glyph index: got no error, want one")
+	}
+}
+
+// indexOf returns the index of i in is, or -1.
+func indexOf(is []Index, i Index) int {
+	for j, k := range is {
+		if k == i {
+			return j
 		}
 	}
+	return -1
 }
 
-func TestScalingSansHinting(t *testing.T) {
-	testScaling(t, "luxisr-12pt-sans-hinting.txt", nil)
+// tableTag returns the table tag s as an array.
+func tableTag(s string) (tag [4]byte) {
+	copy(tag[:], s)
+	return tag
 }
 
-func TestScalingWithHinting(t *testing.T) {
-	testScaling(t, "luxisr-12pt-with-hinting.txt", &Hinter{})
+func TestTable(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["zzzz"] = []byte("unknown table")
+	b := tf.bytes()
+	f, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"name", "glyf", "zzzz"} {
+		if got, ok := f.Table(tableTag(tag)); !ok || !bytes.Equal(got, tf[tag]) {
+			t.Errorf("Table(%q): got %d bytes, %t, want %d bytes, true", tag, len(got), ok, len(tf[tag]))
+		}
+	}
+	if _, ok := f.Table(tableTag("CFF ")); ok {
+		t.Error(`Table("CFF "): got ok, want not ok`)
+	}
+
+	// A table that ParseWithOptions skips is still available.
+	f, err = ParseWithOptions(b, &ParseOptions{Tables: []string{"cmap"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := f.Table(tableTag("kern")); !ok || !bytes.Equal(got, tf["kern"]) {
+		t.Errorf(`skipped Table("kern"): got %d bytes, %t, want %d bytes, true`, len(got), ok, len(tf["kern"]))
+	}
+
+	// ParseReader does not read the tables that it does not use.
+	f, err = ParseReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Table(tableTag("zzzz")); ok {
+		t.Error(`ParseReader Table("zzzz"): got ok, want not ok`)
+	}
+	if got, ok := f.Table(tableTag("name")); !ok || !bytes.Equal(got, tf["name"]) {
+		t.Errorf(`ParseReader Table("name"): got %d bytes, %t, want %d bytes, true`, len(got), ok, len(tf["name"]))
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	b, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &ParseOptions{VerifyChecksums: true}
+	if _, err := ParseWithOptions(b, opts); err != nil {
+		t.Fatalf("luxisr: %v", err)
+	}
+	// x is the offset of the head table's checkSumAdjustment field.
+	x := -1
+	for i := 0; i < int(u16(b, 4)); i++ {
+		if string(b[12+16*i:16+16*i]) == "head" {
+			x = int(u32(b, 20+16*i)) + 8
+		}
+	}
+	if got, err := CheckSumAdjustment(b); err != nil || got != u32(b, x) {
+		t.Errorf("CheckSumAdjustment: got %#08x, %v, want %#08x, nil", got, err, u32(b, x))
+	}
+
+	testCases := []struct {
+		desc   string
+		modify func(b []byte)
+		want   string
+	}{
+		{"corrupt glyf", func(b []byte) {
+			tf := readTestFont(t, "luxisr.ttf")
+			b[bytes.Index(b, tf["glyf"])+100]++
+		}, `bad table checksums: "glyf"`},
+		{"corrupt name and post", func(b []byte) {
+			tf := readTestFont(t, "luxisr.ttf")
+			b[bytes.Index(b, tf["name"])+10]++
+			b[bytes.Index(b, tf["post"])+10]++
+		}, `bad table checksums: "name", "post"`},
+		{"bad checkSumAdjustment", func(b []byte) { b[x]++ }, "bad head checkSumAdjustment"},
+	}
+	for _, tc := range testCases {
+		bb := append([]byte(nil), b...)
+		tc.modify(bb)
+		if _, err := Parse(bb); err != nil {
+			t.Errorf("%s: Parse: %v", tc.desc, err)
+		}
+		_, err := ParseWithOptions(bb, opts)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.desc, err, tc.want)
+		}
+	}
+
+	// A subset's checksums are valid.
+	f, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := f.Subset(f.IndexString("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWithOptions(sub, opts); err != nil {
+		t.Errorf("subset: %v", err)
+	}
+}
+
+func TestParseWithOptions(t *testing.T) {
+	b, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseWithOptions(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseWithOptions(nil) and Parse results differ")
+	}
+
+	// Parse only what is needed to measure text.
+	got, err = ParseWithOptions(b, &ParseOptions{Tables: []string{"cmap", "kern"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i0, i1 := want.Index('A'), want.Index('V')
+	if g := got.Index('A'); g != i0 {
+		t.Errorf("Index: got %d, want %d", g, i0)
+	}
+	if g, w := got.HMetric(2048, i0), want.HMetric(2048, i0); g != w {
+		t.Errorf("HMetric: got %v, want %v", g, w)
+	}
+	if g, w := got.Kerning(2048, i0, i1), want.Kerning(2048, i0, i1); g != w {
+		t.Errorf("Kerning: got %d, want %d", g, w)
+	}
+	if len(got.glyf) != 0 || len(got.loca) != 0 || len(got.fpgm) != 0 || len(got.prep) != 0 {
+		t.Errorf("glyf, loca, fpgm or prep table was decoded")
+	}
+	if err := NewGlyphBuf().Load(got, 2048, i0, nil); err != ErrNoOutlines {
+		t.Errorf("Load: got %v, want %v", err, ErrNoOutlines)
+	}
+
+	// Listing glyf also decodes loca and the hinting tables.
+	got, err = ParseWithOptions(b, &ParseOptions{Tables: []string{"cmap", "glyf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.cvt) == 0 || len(got.fpgm) == 0 || len(got.prep) == 0 {
+		t.Errorf("cvt, fpgm or prep table was not decoded")
+	}
+	g := NewGlyphBuf()
+	if err := g.Load(got, 12*64, i0, &Hinter{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	w := NewGlyphBuf()
+	if err := w.Load(want, 12*64, i0, &Hinter{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(g.Point, w.Point) {
+		t.Errorf("Point: got %v, want %v", g.Point, w.Point)
+	}
+
+	// For a PostScript font, listing glyf decodes the CFF table.
+	cff := cffTestFont(t, map[Index][]byte{
+		36: {10 + 139, 20 + 139, 21, 100 + 139, 139, 5, 14},
+	}, nil, nil).bytes()
+	want, err = Parse(cff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ParseWithOptions(cff, &ParseOptions{Tables: []string{"glyf"}})
+	if err != nil {
+		t.Fatalf("CFF: %v", err)
+	}
+	if err := g.Load(got, 12*64, 36, nil); err != nil {
+		t.Fatalf("CFF: Load: %v", err)
+	}
+	if err := w.Load(want, 12*64, 36, nil); err != nil {
+		t.Fatalf("CFF: Load: %v", err)
+	}
+	if !reflect.DeepEqual(g.Point, w.Point) {
+		t.Errorf("CFF: Point: got %v, want %v", g.Point, w.Point)
+	}
+}
+
+// ttcBytes returns TTC data that holds the given fonts' TTF data. Each font's
+// table offsets are adjusted for where that font lies in the collection.
+func ttcBytes(fonts ...[]byte) []byte {
+	b := appendU32(nil, 0x74746366, 0x00010000, uint32(len(fonts)))
+	b = append(b, make([]byte, 4*len(fonts))...)
+	for i, font := range fonts {
+		base := len(b)
+		copy(b[12+4*i:], appendU32(nil, uint32(base)))
+		b = append(b, font...)
+		for j, n := 0, int(u16(font, 4)); j < n; j++ {
+			x := base + 16*j + 12
+			copy(b[x+8:], appendU32(nil, u32(b, x+8)+uint32(base)))
+		}
+	}
+	return b
+}
+
+func TestParseCollection(t *testing.T) {
+	var (
+		ttfs  [][]byte
+		wants []*Font
+	)
+	for _, filename := range []string{"luxisr.ttf", "luximr.ttf"} {
+		b, err := ioutil.ReadFile("../../luxi-fonts/" + filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		font, err := Parse(b)
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", filename, err)
+		}
+		ttfs = append(ttfs, b)
+		wants = append(wants, font)
+	}
+	ttc := ttcBytes(ttfs...)
+
+	fonts, err := ParseCollection(ttc)
+	if err != nil {
+		t.Fatalf("ParseCollection: %v", err)
+	}
+	if !reflect.DeepEqual(fonts, wants) {
+		t.Errorf("ParseCollection: fonts differ from those parsed separately")
+	}
+	for i, want := range wants {
+		got, err := ParseIndex(ttc, i)
+		if err != nil {
+			t.Fatalf("ParseIndex(%d): %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseIndex(%d): font differs from that parsed separately", i)
+		}
+	}
+	if got, err := Parse(ttc); err != nil || !reflect.DeepEqual(got, wants[0]) {
+		t.Errorf("Parse: got the wrong font, err=%v", err)
+	}
+	if _, err := ParseIndex(ttc, 2); err == nil {
+		t.Errorf("ParseIndex(2): got nil error, want non-nil")
+	}
+	if _, err := ParseCollection(ttfs[0]); err == nil {
+		t.Errorf("ParseCollection(TTF data): got nil error, want non-nil")
+	}
+}
+
+// setNumHMetrics rewrites tf's hhea and hmtx tables so that the hmtx table
+// holds only the first n glyphs' metrics, and the remaining glyphs have only
+// left side bearings.
+func setNumHMetrics(tf testFont, n int) {
+	nGlyph := int(u16(tf["maxp"], 4))
+	hmtx := append([]byte(nil), tf["hmtx"][:4*n]...)
+	for i := n; i < nGlyph; i++ {
+		hmtx = append(hmtx, tf["hmtx"][4*i+2:4*i+4]...)
+	}
+	tf["hmtx"] = hmtx
+	tf["hhea"] = append([]byte(nil), tf["hhea"]...)
+	copy(tf["hhea"][34:], appendU16(nil, uint16(n)))
+}
+
+func TestHMetric(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	fupe := font.FUnitsPerEm()
+	want := make([]HMetric, font.nGlyph)
+	for i := range want {
+		want[i] = font.HMetric(fupe, Index(i))
+	}
+
+	// The glyphs after the first n keep their own left side bearings, but
+	// have the n-1'th glyph's advance width.
+	const n = 100
+	setNumHMetrics(tf, n)
+	font = parseTestFont(t, tf)
+	for i := range want {
+		w := want[i]
+		if i >= n {
+			w.AdvanceWidth = want[n-1].AdvanceWidth
+		}
+		if got := font.HMetric(fupe, Index(i)); got != w {
+			t.Errorf("glyph #%d: got %v, want %v", i, got, w)
+		}
+		if got := font.LeftSideBearing(fupe, Index(i)); got != w.LeftSideBearing {
+			t.Errorf("glyph #%d: LeftSideBearing: got %d, want %d", i, got, w.LeftSideBearing)
+		}
+	}
+	if got := font.HMetric(fupe, Index(font.nGlyph)); got != (HMetric{}) {
+		t.Errorf("glyph #%d: got %v, want zero", font.nGlyph, got)
+	}
+	if got := font.LeftSideBearing(fupe, Index(font.nGlyph)); got != 0 {
+		t.Errorf("glyph #%d: LeftSideBearing: got %d, want zero", font.nGlyph, got)
+	}
+
+	// The hmtx table must hold at least one glyph's metrics.
+	tf = readTestFont(t, "luxisr.ttf")
+	setNumHMetrics(tf, 0)
+	if _, err := Parse(tf.bytes()); err == nil {
+		t.Errorf("zero hmtx metrics: got nil error, want non-nil")
+	}
+}
+
+func TestAdvanceWidths(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	want := make([]int32, font.nGlyph)
+	for i := range want {
+		want[i] = font.HMetric(font.FUnitsPerEm(), Index(i)).AdvanceWidth
+	}
+	if got := font.AdvanceWidths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Keep only the first n of the hmtx table's metrics, so that the
+	// remaining glyphs have the n-1'th glyph's advance width.
+	const n = 100
+	setNumHMetrics(tf, n)
+	for i := n; i < len(want); i++ {
+		want[i] = want[n-1]
+	}
+	if got := parseTestFont(t, tf).AdvanceWidths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("monospaced run: got %v, want %v", got, want)
+	}
+}
+
+func TestVMetric(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	fupe := font.FUnitsPerEm()
+	if got, want := font.VMetric(fupe, 36), (VMetric{2465, 553}); got != want {
+		t.Errorf("with vmtx: got %v, want %v", got, want)
+	}
+
+	// Without a vmtx table, the metrics are derived from the OS/2 table's
+	// typographic ascent (1604) and descent (-420), and the 'A' glyph's
+	// yMax (1480).
+	delete(tf, "vhea")
+	delete(tf, "vmtx")
+	font = parseTestFont(t, tf)
+	if got, want := font.VMetric(fupe, 36), (VMetric{2024, 124}); got != want {
+		t.Errorf("sans vmtx: got %v, want %v", got, want)
+	}
+}
+
+func TestGasp(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	f := parseTestFont(t, tf)
+	// Luxi Sans is anti-aliased but not grid-fitted up to 8 pixels per em,
+	// grid-fitted but not anti-aliased up to 16, and both above that.
+	testCases := []struct {
+		ppem            int
+		gridfit, doGray bool
+	}{
+		{0, false, true},
+		{8, false, true},
+		{9, true, false},
+		{16, true, false},
+		{17, true, true},
+		{0xffff, true, true},
+		{0x10000, true, true},
+	}
+	for _, tc := range testCases {
+		gridfit, doGray := f.GaspBehavior(tc.ppem)
+		if gridfit != tc.gridfit || doGray != tc.doGray {
+			t.Errorf("ppem %d: got %t, %t, want %t, %t", tc.ppem, gridfit, doGray, tc.gridfit, tc.doGray)
+		}
+	}
+
+	gasp := tf["gasp"]
+	delete(tf, "gasp")
+	f = parseTestFont(t, tf)
+	if gridfit, doGray := f.GaspBehavior(8); !gridfit || !doGray {
+		t.Errorf("no gasp table: got %t, %t, want true, true", gridfit, doGray)
+	}
+
+	// An unsupported or truncated gasp table is ignored, as if there were
+	// none.
+	bad := []struct {
+		desc string
+		gasp []byte
+	}{
+		{"gasp version 2", append([]byte{0x00, 0x02}, gasp[2:]...)},
+		{"truncated gasp table", gasp[:len(gasp)-4]},
+	}
+	for _, tc := range bad {
+		tf["gasp"] = tc.gasp
+		f, err := Parse(tf.bytes())
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if gridfit, doGray := f.GaspBehavior(8); !gridfit || !doGray {
+			t.Errorf("%s: got %t, %t, want true, true", tc.desc, gridfit, doGray)
+		}
+	}
+}
+
+func TestDeviceAdvance(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	f := parseTestFont(t, tf)
+	nGlyph := f.NumGlyphs()
+	// Without an hdmx table, the advance is HMetric's, rounded. The 'A' is
+	// 1366 FUnits wide, or 8.004 pixels at 12 pixels per em.
+	if got, ok := f.DeviceAdvance(12, 36); got != 8 || ok {
+		t.Errorf("no hdmx table: got %d, %t, want 8, false", got, ok)
+	}
+
+	// An hdmx table with records for 12 and 16 pixels per em, each of which
+	// is padded to a multiple of four bytes.
+	size := (2 + nGlyph + 3) &^ 3
+	hdmx := appendU32(appendU16(appendU16(nil, 0), 2), uint32(size))
+	for _, ppem := range []int{12, 16} {
+		r := make([]byte, size)
+		r[0] = uint8(ppem)
+		for i := 0; i < nGlyph; i++ {
+			r[2+i] = uint8(ppem + i%3)
+		}
+		hdmx = append(hdmx, r...)
+	}
+	tf["hdmx"] = hdmx
+	f = parseTestFont(t, tf)
+	testCases := []struct {
+		ppem int
+		i    Index
+		want int
+		ok   bool
+	}{
+		{12, 36, 12, true},
+		{12, 37, 13, true},
+		{16, 38, 18, true},
+		{13, 36, 9, false},
+		{12, Index(nGlyph), 0, false},
+	}
+	for _, tc := range testCases {
+		if got, ok := f.DeviceAdvance(tc.ppem, tc.i); got != tc.want || ok != tc.ok {
+			t.Errorf("ppem %d, glyph %d: got %d, %t, want %d, %t", tc.ppem, tc.i, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	bad := []struct {
+		desc string
+		hdmx []byte
+	}{
+		{"version 1", append([]byte{0, 1}, hdmx[2:]...)},
+		{"short record", appendU32(appendU16(appendU16(nil, 0), 1), uint32(nGlyph))},
+		{"truncated", hdmx[:len(hdmx)-1]},
+	}
+	// A bad hdmx table is ignored, as if there were none.
+	for _, tc := range bad {
+		tf["hdmx"] = tc.hdmx
+		f, err := Parse(tf.bytes())
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got, ok := f.DeviceAdvance(12, 36); got != 8 || ok {
+			t.Errorf("%s: got %d, %t, want 8, false", tc.desc, got, ok)
+		}
+		if got, ok := f.Table(tableTag("hdmx")); !ok || !bytes.Equal(got, tc.hdmx) {
+			t.Errorf("%s: Table: got %d bytes, %t, want %d bytes, true", tc.desc, len(got), ok, len(tc.hdmx))
+		}
+	}
+}
+
+func TestLinearThreshold(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	f := parseTestFont(t, tf)
+	if got := f.LinearThreshold(36); got != 0 {
+		t.Errorf("no LTSH table: got %d, want 0", got)
+	}
+
+	nGlyph := f.NumGlyphs()
+	ltsh := appendU16(appendU16(nil, 0), uint16(nGlyph))
+	for i := 0; i < nGlyph; i++ {
+		ltsh = append(ltsh, uint8(1+i%50))
+	}
+	tf["LTSH"] = ltsh
+	f = parseTestFont(t, tf)
+	testCases := []struct {
+		i    Index
+		want uint8
+	}{
+		{0, 1},
+		{36, 37},
+		{Index(nGlyph - 1), uint8(1 + (nGlyph-1)%50)},
+		{Index(nGlyph), 0},
+	}
+	for _, tc := range testCases {
+		if got := f.LinearThreshold(tc.i); got != tc.want {
+			t.Errorf("glyph %d: got %d, want %d", tc.i, got, tc.want)
+		}
+	}
+
+	bad := []struct {
+		desc string
+		ltsh []byte
+	}{
+		{"version 1", append([]byte{0, 1}, ltsh[2:]...)},
+		{"wrong number of glyphs", append(appendU16(appendU16(nil, 0), uint16(nGlyph-1)), ltsh[4:]...)},
+		{"truncated", ltsh[:len(ltsh)-1]},
+	}
+	// A bad LTSH table is ignored, as if there were none.
+	for _, tc := range bad {
+		tf["LTSH"] = tc.ltsh
+		f, err := Parse(tf.bytes())
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got := f.LinearThreshold(36); got != 0 {
+			t.Errorf("%s: got %d, want 0", tc.desc, got)
+		}
+	}
+}
+
+func TestVerticalOrigin(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	// Without a VORG table, the origin is the typographic ascent.
+	font := parseTestFont(t, tf)
+	if got, want := font.VerticalOrigin(36), int32(1604); got != want {
+		t.Errorf("no VORG: got %d, want %d", got, want)
+	}
+
+	tf["VORG"] = appendU16(nil, 1, 0, 1700, 3, 36, 1600, 50, 0xfe0c, 200, 1480)
+	font = parseTestFont(t, tf)
+	testCases := []struct {
+		i    Index
+		want int32
+	}{
+		{0, 1700},
+		{36, 1600},
+		{37, 1700},
+		{50, -500},
+		{200, 1480},
+		{390, 1700},
+	}
+	for _, tc := range testCases {
+		if got := font.VerticalOrigin(tc.i); got != tc.want {
+			t.Errorf("glyph #%d: got %d, want %d", tc.i, got, tc.want)
+		}
+	}
+
+	// A VORG table that is shorter than its number of records, or that has
+	// an unknown major version, is ignored, as if there were none.
+	vorg := tf["VORG"]
+	bad := []struct {
+		desc string
+		vorg []byte
+	}{
+		{"truncated VORG table", vorg[:len(vorg)-2]},
+		{"VORG version 2", append([]byte{0x00, 0x02}, vorg[2:]...)},
+	}
+	for _, tc := range bad {
+		tf["VORG"] = tc.vorg
+		font, err := Parse(tf.bytes())
+		if err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got, want := font.VerticalOrigin(36), int32(1604); got != want {
+			t.Errorf("%s: got %d, want %d", tc.desc, got, want)
+		}
+	}
+}
+
+func TestOS2(t *testing.T) {
+	type metrics struct {
+		typoAscender, typoDescender, typoLineGap, xHeight, capHeight int32
+		weightClass, widthClass                                      int
+	}
+	get := func(font *Font) metrics {
+		fupe := font.FUnitsPerEm()
+		return metrics{
+			font.TypoAscender(fupe), font.TypoDescender(fupe), font.TypoLineGap(fupe),
+			font.XHeight(fupe), font.CapHeight(fupe),
+			font.WeightClass(), font.WidthClass(),
+		}
+	}
+
+	tf := readTestFont(t, "luxisr.ttf")
+	if got, want := get(parseTestFont(t, tf)), (metrics{1604, -420, 167, 0, 0, 400, 5}); got != want {
+		t.Errorf("luxisr: got %v, want %v", got, want)
+	}
+
+	// Set the sxHeight and sCapHeight fields, which are zero in luxisr.ttf.
+	os2 := append([]byte(nil), tf["OS/2"]...)
+	copy(os2[86:], appendU16(nil, 1096, 1480))
+	tf["OS/2"] = os2
+	if got, want := get(parseTestFont(t, tf)), (metrics{1604, -420, 167, 1096, 1480, 400, 5}); got != want {
+		t.Errorf("heights: got %v, want %v", got, want)
+	}
+
+	// A version 0 table of the original 68 bytes has no typographic
+	// metrics, and so the hhea values are used instead, and a version 2
+	// table that is too short to have the heights does not have them.
+	testCases := []struct {
+		desc    string
+		version uint16
+		length  int
+		want    metrics
+	}{
+		{"68 bytes", 0, 68, metrics{2033, -432, 0, 0, 0, 400, 5}},
+		{"78 bytes", 0, 78, metrics{1604, -420, 167, 0, 0, 400, 5}},
+		{"short version 2", 2, 86, metrics{1604, -420, 167, 0, 0, 400, 5}},
+		{"version 2", 2, 96, metrics{1604, -420, 167, 1096, 1480, 400, 5}},
+	}
+	for _, tc := range testCases {
+		short := append([]byte(nil), os2[:tc.length]...)
+		copy(short, appendU16(nil, tc.version))
+		tf["OS/2"] = short
+		if got := get(parseTestFont(t, tf)); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+
+	// Without an OS/2 table, the hhea values are used instead.
+	delete(tf, "OS/2")
+	if got, want := get(parseTestFont(t, tf)), (metrics{2033, -432, 0, 0, 0, 0, 0}); got != want {
+		t.Errorf("no OS/2: got %v, want %v", got, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	fupe := font.FUnitsPerEm()
+	// luxisr.ttf's OS/2 table has no x-height or cap height, and so they are
+	// those of its 'x' and 'H' glyphs.
+	want := Metrics{Ascent: 1604, Descent: 420, LineGap: 167, Height: 2191, XHeight: 1086, CapHeight: 1480}
+	if got := font.Metrics(fupe); got != want {
+		t.Errorf("luxisr: got %+v, want %+v", got, want)
+	}
+
+	os2 := append([]byte(nil), tf["OS/2"]...)
+	copy(os2[86:], appendU16(nil, 1100, 1500))
+	tf["OS/2"] = os2
+	want.XHeight, want.CapHeight = 1100, 1500
+	if got := parseTestFont(t, tf).Metrics(fupe); got != want {
+		t.Errorf("heights: got %+v, want %+v", got, want)
+	}
+
+	// Zero typographic ascender and descender fall back to the hhea values.
+	copy(os2[68:], appendU16(nil, 0, 0, 100))
+	want.Ascent, want.Descent, want.LineGap, want.Height = 2033, 432, 0, 2465
+	if got := parseTestFont(t, tf).Metrics(fupe); got != want {
+		t.Errorf("zero OS/2 ascender: got %+v, want %+v", got, want)
+	}
+
+	// The metrics scale with scale.
+	want = Metrics{Ascent: 12, Descent: 3, LineGap: 0, Height: 15, XHeight: 6, CapHeight: 9}
+	if got := parseTestFont(t, tf).Metrics(12); got != want {
+		t.Errorf("scale 12: got %+v, want %+v", got, want)
+	}
+}
+
+func TestHead(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	wantFlags := HeadFlagBaselineAtZero | HeadFlagLeftSideBearingAtZero |
+		HeadFlagInstructionsDependOnSize | HeadFlagIntegerPPEM
+	if got := font.Flags(); got != wantFlags {
+		t.Errorf("Flags: got %#x, want %#x", got, wantFlags)
+	}
+	if got := font.MacStyle(); got != 0 {
+		t.Errorf("MacStyle: got %#x, want 0", got)
+	}
+	if got := font.IndexToLocFormat(); got != 0 {
+		t.Errorf("IndexToLocFormat: got %d, want 0", got)
+	}
+
+	tf["head"] = append([]byte(nil), tf["head"]...)
+	copy(tf["head"][44:], appendU16(nil, uint16(MacStyleBold|MacStyleItalic)))
+	if got, want := parseTestFont(t, tf).MacStyle(), MacStyleBold|MacStyleItalic; got != want {
+		t.Errorf("bold italic MacStyle: got %#x, want %#x", got, want)
+	}
+}
+
+// A nameRecord is a name table entry, whose string is already encoded.
+type nameRecord struct {
+	pid, psid, lang, id uint16
+	s                   string
+}
+
+// nameTable returns a format 0 name table with the given entries.
+func nameTable(records ...nameRecord) []byte {
+	b := appendU16(nil, 0, uint16(len(records)), uint16(6+12*len(records)))
+	var strs []byte
+	for _, r := range records {
+		b = appendU16(b, r.pid, r.psid, r.lang, r.id, uint16(len(r.s)), uint16(len(strs)))
+		strs = append(strs, r.s...)
+	}
+	return append(b, strs...)
+}
+
+func TestName(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	testCases := []struct {
+		id   NameID
+		want string
+	}{
+		{NameIDFontFamily, "Luxi Sans"},
+		{NameIDFontSubfamily, "Regular"},
+		{NameIDFontFullName, "Luxi Sans Regular"},
+		{NameIDVersion, "1.2 : October 12, 2001"},
+		{NameIDPostscriptName, "LuxiSans"},
+		{NameIDDescription, ""},
+	}
+	for _, tc := range testCases {
+		if got := font.Name(tc.id); got != tc.want {
+			t.Errorf("id=%d: got %q, want %q", tc.id, got, tc.want)
+		}
+	}
+
+	// The family name has a Windows entry, in UTF-16BE with a surrogate pair
+	// for U+1F600, which is preferred over the Macintosh entry. The
+	// subfamily name only has a Macintosh entry, whose 0x8e byte is 'é' in
+	// the Mac Roman encoding.
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["name"] = nameTable(
+		nameRecord{1, 0, 0, 1, "Mac"},
+		nameRecord{1, 0, 0, 2, "Caf\x8e"},
+		nameRecord{3, 1, 0x0407, 1, "\x00G"},
+		nameRecord{3, 1, 0x0409, 1, "\x00W\xd8\x3d\xde\x00"},
+	)
+	font = parseTestFont(t, tf)
+	if got, want := font.Name(NameIDFontFamily), "W\U0001f600"; got != want {
+		t.Errorf("family: got %q, want %q", got, want)
+	}
+	if got, want := font.Name(NameIDFontSubfamily), "Café"; got != want {
+		t.Errorf("subfamily: got %q, want %q", got, want)
+	}
+}
+
+func TestFixedPitch(t *testing.T) {
+	// luximr.ttf is monospaced, although its combining marks have zero
+	// advance widths.
+	font := parseTestFont(t, readTestFont(t, "luximr.ttf"))
+	if !font.FixedPitchFlag() || !font.IsFixedPitch() {
+		t.Errorf("luximr: got %t, %t, want true, true", font.FixedPitchFlag(), font.IsFixedPitch())
+	}
+	tf := readTestFont(t, "luxisr.ttf")
+	font = parseTestFont(t, tf)
+	if font.FixedPitchFlag() || font.IsFixedPitch() {
+		t.Errorf("luxisr: got %t, %t, want false, false", font.FixedPitchFlag(), font.IsFixedPitch())
+	}
+
+	// A proportional font that claims to be monospaced is not.
+	tf["post"] = append([]byte(nil), tf["post"]...)
+	copy(tf["post"][12:], appendU32(nil, 1))
+	font = parseTestFont(t, tf)
+	if !font.FixedPitchFlag() || font.IsFixedPitch() {
+		t.Errorf("lying luxisr: got %t, %t, want true, false", font.FixedPitchFlag(), font.IsFixedPitch())
+	}
+}
+
+func TestGlyphName(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+
+	// The glyph names in luxisr.ttx are those from the post table, except
+	// that ttx disambiguates duplicate names with a "#1", "#2", etc. suffix.
+	ttx, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`<GlyphID id="([0-9]+)" name="([^"#]*)`)
+	matches := re.FindAllStringSubmatch(string(ttx), -1)
+	if len(matches) != 391 {
+		t.Fatalf("got %d GlyphIDs in luxisr.ttx, want 391", len(matches))
+	}
+	for i, m := range matches {
+		if got, want := font.GlyphName(Index(i)), m[2]; got != want {
+			t.Errorf("GlyphName(%d): got %q, want %q", i, got, want)
+		}
+	}
+
+	for _, name := range []string{".notdef", "A", "Aacute", "dotlessj"} {
+		i, ok := font.IndexByName(name)
+		if !ok || font.GlyphName(i) != name {
+			t.Errorf("IndexByName(%q): got %d, %t", name, i, ok)
+		}
+	}
+	if i, ok := font.IndexByName(".notdef"); i != 0 || !ok {
+		t.Errorf("IndexByName(\".notdef\"): got %d, %t, want 0, true", i, ok)
+	}
+	if i, ok := font.IndexByName("uni1234"); i != 0 || ok {
+		t.Errorf("IndexByName(\"uni1234\"): got %d, %t, want 0, false", i, ok)
+	}
+
+	// Change the post table's version to 3.0, its italic angle to -12.5
+	// degrees and its underline position and thickness to -150 and 100.
+	post := append([]byte(nil), tf["post"]...)
+	copy(post, appendU32(nil, 0x00030000, 0xfff38000))
+	copy(post[8:], appendU16(nil, 0xff6a, 100))
+	tf["post"] = post
+	font = parseTestFont(t, tf)
+	if got := font.GlyphName(36); got != "" {
+		t.Errorf("version 3.0: GlyphName: got %q, want \"\"", got)
+	}
+	if got, want := font.ItalicAngle(), -12.5; got != want {
+		t.Errorf("ItalicAngle: got %v, want %v", got, want)
+	}
+	if got, want := font.UnderlinePosition(font.FUnitsPerEm()), int32(-150); got != want {
+		t.Errorf("UnderlinePosition: got %v, want %v", got, want)
+	}
+	if got, want := font.UnderlineThickness(font.FUnitsPerEm()), int32(100); got != want {
+		t.Errorf("UnderlineThickness: got %v, want %v", got, want)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	ttx, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]Index{}
+	re := regexp.MustCompile(`<GlyphID id="([0-9]+)" name="([^"]*)"`)
+	for _, m := range re.FindAllStringSubmatch(string(ttx), -1) {
+		var i Index
+		fmt.Sscan(m[1], &i)
+		names[m[2]] = i
+	}
+	// Check every mapping in luxisr.ttf's format 4 cmap subtable.
+	s := string(ttx)
+	s = s[strings.Index(s, "<cmap_format_4"):strings.Index(s, "</cmap_format_4>")]
+	re = regexp.MustCompile(`<map code="0x([0-9a-f]+)" name="([^"]*)"`)
+	matches := re.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		t.Fatal("no cmap entries found")
+	}
+	for _, m := range matches {
+		var r rune
+		fmt.Sscanf(m[1], "%x", &r)
+		if got, want := font.Index(r), names[m[2]]; got != want {
+			t.Errorf("Index(%U): got %d, want %d", r, got, want)
+		}
+	}
+}
+
+func TestIndexOK(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	testCases := []struct {
+		r    rune
+		want Index
+		ok   bool
+	}{
+		{'A', 36, true},
+		{'\u00e9', 112, true},
+		{'\u4e16', 0, false},
+		{'\U0001f600', 0, false},
+		{-1, 0, false},
+	}
+	for _, tc := range testCases {
+		if got, ok := font.IndexOK(tc.r); got != tc.want || ok != tc.ok {
+			t.Errorf("IndexOK(%U): got %d, %t, want %d, %t", tc.r, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestIndexString(t *testing.T) {
+	const s = "Hello, 世界 \U0001f600!\xff"
+	tf := readTestFont(t, "luxisr.ttf")
+	for _, name := range []string{"format 4", "format 12"} {
+		if name == "format 12" {
+			tf["cmap"] = cmapTable(cmapSubtable{3, 10, cmapFormat12()})
+		}
+		font := parseTestFont(t, tf)
+		var want []Index
+		for _, r := range s {
+			want = append(want, font.Index(r))
+		}
+		if got := font.IndexString(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	if got := parseTestFont(t, tf).IndexString(""); len(got) != 0 {
+		t.Errorf("empty string: got %v", got)
+	}
+}
+
+// A cmapSubtable is a cmap subtable and its platform and platform specific
+// IDs.
+type cmapSubtable struct {
+	pid, psid uint16
+	data      []byte
+}
+
+// cmapTable returns a cmap table with the given subtables.
+func cmapTable(subtables ...cmapSubtable) []byte {
+	b := appendU16(nil, 0, uint16(len(subtables)))
+	offset := 4 + 8*len(subtables)
+	for _, st := range subtables {
+		b = appendU16(b, st.pid, st.psid)
+		b = appendU32(b, uint32(offset))
+		offset += len(st.data)
+	}
+	for _, st := range subtables {
+		b = append(b, st.data...)
+	}
+	return b
+}
+
+// cmapFormat12 returns a format 12 cmap subtable that maps U+0020 to U+007E
+// to glyphs #3 to #97, the same as luxisr.ttf, and maps U+1F600 to glyph
+// #201.
+func cmapFormat12() []byte {
+	b := appendU16(nil, 12, 0)
+	b = appendU32(b, 16+12*2, 0, 2)
+	b = appendU32(b, 0x20, 0x7e, 3)
+	b = appendU32(b, 0x1f600, 0x1f600, 201)
+	return b
+}
+
+func TestCmapFormat12(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["cmap"] = cmapTable(cmapSubtable{3, 10, cmapFormat12()})
+	font := parseTestFont(t, tf)
+
+	testCases := []struct {
+		r    rune
+		want Index
+	}{
+		{0x1f, 0},
+		{' ', 3},
+		{'A', 36},
+		{'~', 97},
+		{0x7f, 0},
+		{0x10041, 0},
+		{0x1f5ff, 0},
+		{0x1f600, 201},
+		{0x1f601, 0},
+	}
+	for _, tc := range testCases {
+		if got := font.Index(tc.r); got != tc.want {
+			t.Errorf("Index(%U): got %d, want %d", tc.r, got, tc.want)
+		}
+	}
+}
+
+func TestCmapMacRoman(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	luxisr := parseTestFont(t, tf)
+	// The format 0 subtable maps each Macintosh Roman character code to
+	// luxisr.ttf's glyph for that character.
+	format0 := appendU16(nil, 0, 262, 0)
+	for c := 0; c < 256; c++ {
+		r := rune(c)
+		if c >= 0x80 {
+			r = macRoman[c-0x80]
+		}
+		format0 = append(format0, uint8(luxisr.Index(r)))
+	}
+	// The format 6 subtable maps only the codes from 'A' to 'Z'.
+	format6 := appendU16(nil, 6, 10+2*26, 0, 'A', 26)
+	for c := 'A'; c <= 'Z'; c++ {
+		format6 = appendU16(format6, uint16(luxisr.Index(c)))
+	}
+
+	for _, subtable := range [][]byte{format0, format6} {
+		// The font has a Macintosh Roman subtable and no Unicode one.
+		tf["cmap"] = cmapTable(cmapSubtable{1, 0, subtable})
+		font := parseTestFont(t, tf)
+		format := u16(subtable, 0)
+		for _, r := range "AHZ" {
+			if got, want := font.Index(r), luxisr.Index(r); got != want || got == 0 {
+				t.Errorf("format %d: Index(%q): got %d, want %d", format, r, got, want)
+			}
+		}
+		if format != 0 {
+			continue
+		}
+		// é is 0x8E in Macintosh Roman, but the rune 0x8E is not é.
+		if got, want := font.Index('é'), luxisr.Index('é'); got != want {
+			t.Errorf("Index('é'): got %d, want %d", got, want)
+		}
+		if got := font.Index(0x8e); got != 0 {
+			t.Errorf("Index(0x8E): got %d, want 0", got)
+		}
+		if got := font.Index('ł'); got != 0 {
+			t.Errorf("Index('ł'): got %d, want 0", got)
+		}
+	}
+
+	// A Unicode subtable is preferred to a Macintosh Roman one.
+	tf["cmap"] = cmapTable(cmapSubtable{1, 0, format6}, cmapSubtable{3, 10, cmapFormat12()})
+	if got := parseTestFont(t, tf).Index(' '); got != 3 {
+		t.Errorf("Unicode and Macintosh Roman: Index(' '): got %d, want 3", got)
+	}
+
+	// A truncated subtable is a FormatError, not a panic.
+	for _, n := range []int{6, 8} {
+		tf["cmap"] = cmapTable(cmapSubtable{1, 0, format6[:n]})
+		if _, err := Parse(tf.bytes()); err == nil {
+			t.Errorf("format 6 truncated to %d bytes: got nil error", n)
+		} else if _, ok := err.(FormatError); !ok {
+			t.Errorf("format 6 truncated to %d bytes: got %v, want a FormatError", n, err)
+		}
+	}
+}
+
+func TestCmapFormat2(t *testing.T) {
+	// The format 2 subtable has two subHeaders. Every subHeaderKey is zero
+	// (meaning subHeader #0) except for byte 0x81, which is the first byte
+	// of the double-byte characters covered by subHeader #1 (whose key is
+	// 1*8). subHeader #0 maps 0x41 and 0x42 to glyphs #36 and #37.
+	// subHeader #1 maps 0x8140 to glyph #1 and 0x8142 to glyph #101, each
+	// plus an idDelta of 100. The subHeaders start at offset 6+512 = 518 and
+	// their glyphIndexArrays start at offsets 534 and 538. Each idRangeOffset
+	// is relative to the idRangeOffset field itself, at 518+6 and 526+6.
+	subtable := appendU16(nil, 2, 544, 0)
+	for i := 0; i < 256; i++ {
+		key := uint16(0)
+		if i == 0x81 {
+			key = 8
+		}
+		subtable = appendU16(subtable, key)
+	}
+	subtable = appendU16(subtable, 0x41, 2, 0, 534-524)
+	subtable = appendU16(subtable, 0x40, 3, 100, 538-532)
+	subtable = appendU16(subtable, 36, 37)
+	subtable = appendU16(subtable, 1, 0, 101)
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["cmap"] = cmapTable(cmapSubtable{3, 2, subtable})
+	font := parseTestFont(t, tf)
+
+	testCases := []struct {
+		r    rune
+		want Index
+	}{
+		{0x40, 0},
+		{0x41, 36},
+		{0x42, 37},
+		{0x43, 0},
+		{0x81, 0},
+		{0x0141, 0},
+		{0x813f, 0},
+		{0x8140, 101},
+		{0x8141, 0},
+		{0x8142, 201},
+		{0x8143, 0},
+		{0x8241, 0},
+		{0x18140, 0},
+	}
+	for _, tc := range testCases {
+		if got := font.Index(tc.r); got != tc.want {
+			t.Errorf("Index(%#x): got %d, want %d", tc.r, got, tc.want)
+		}
+	}
+}
+
+func TestCmapFormat14(t *testing.T) {
+	// The format 14 subtable has two variation selector records. For
+	// U+FE0F, U+0041 uses the default glyph and U+0042 maps to glyph #201.
+	// For U+E0100, U+0041 maps to glyph #202. The records are 11 bytes
+	// long, and the Default and Non-Default UVS tables are at offsets 32,
+	// 40 and 49.
+	subtable := appendU16(nil, 14)
+	subtable = appendU32(subtable, 58, 2)
+	subtable = append(subtable, 0x00, 0xfe, 0x0f)
+	subtable = appendU32(subtable, 32, 40)
+	subtable = append(subtable, 0x0e, 0x01, 0x00)
+	subtable = appendU32(subtable, 0, 49)
+	subtable = appendU32(subtable, 1, 0x00004100)
+	subtable = appendU32(subtable, 1)
+	subtable = appendU16(append(subtable, 0x00, 0x00, 0x42), 201)
+	subtable = appendU32(subtable, 1)
+	subtable = appendU16(append(subtable, 0x00, 0x00, 0x41), 202)
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["cmap"] = cmapTable(
+		cmapSubtable{0, 5, subtable},
+		cmapSubtable{3, 10, cmapFormat12()},
+	)
+	font := parseTestFont(t, tf)
+
+	testCases := []struct {
+		r, vs  rune
+		want   Index
+		wantOK bool
+	}{
+		{'A', 0xfe0f, 36, true},
+		{'B', 0xfe0f, 201, true},
+		{'C', 0xfe0f, 38, false},
+		{'A', 0xe0100, 202, true},
+		{'B', 0xe0100, 37, false},
+		{'A', 0xfe0e, 36, false},
+	}
+	for _, tc := range testCases {
+		got, gotOK := font.IndexVariation(tc.r, tc.vs)
+		if got != tc.want || gotOK != tc.wantOK {
+			t.Errorf("IndexVariation(%U, %U): got %d, %t, want %d, %t",
+				tc.r, tc.vs, got, gotOK, tc.want, tc.wantOK)
+		}
+	}
+}
+
+// compoundGlyph returns the glyf data for a compound glyph with the given
+// components. Each component is encoded as its flags, glyph index,
+// arguments and optional scale/transform values, all as 16-bit words.
+// gposTable returns a GPOS table with a single feature, with the given tag,
+// whose single lookup is a pair adjustment lookup with the given subtables.
+func gposTable(tag string, subtables ...[]byte) []byte {
+	// The header, an empty script list at 10, a feature list at 12 whose
+	// feature table is at 20, and a lookup list at 26 whose lookup is at 30.
+	b := appendU16(nil, 1, 0, 10, 12, 26, 0, 1)
+	b = append(b, tag...)
+	b = appendU16(b, 8, 0, 1, 0, 1, 4, 2, 0, uint16(len(subtables)))
+	offset := 6 + 2*len(subtables)
+	for _, subtable := range subtables {
+		b = appendU16(b, uint16(offset))
+		offset += len(subtable)
+	}
+	for _, subtable := range subtables {
+		b = append(b, subtable...)
+	}
+	return b
+}
+
+func TestGPOSKerning(t *testing.T) {
+	// A format 1 subtable that kerns 'A' (36) followed by 'V' (57) or 'W'
+	// (58). Its ValueFormat1 is XAdvance only.
+	format1 := appendU16(nil, 1, 22, 0x0004, 0, 1, 12)
+	format1 = appendU16(format1, 2, 57, 0xff9c, 58, 0xffb0) // -100 and -80.
+	format1 = appendU16(format1, 1, 1, 36)
+	// A format 2 subtable that kerns 'V' (57) followed by class 1, which is
+	// 'A' (36) and 'a' (68). Its ValueFormat1 is XPlacement and XAdvance.
+	format2 := appendU16(nil, 2, 32, 0x0005, 0, 42, 50, 2, 2)
+	format2 = appendU16(format2, 0, 0, 0, 0, 0, 0, 7, 0xffce) // -50 for [1][1].
+	format2 = appendU16(format2, 2, 1, 57, 57, 0)             // Coverage.
+	format2 = appendU16(format2, 1, 57, 1, 1)                 // ClassDef1.
+	format2 = appendU16(format2, 2, 2, 36, 36, 1, 68, 68, 1)  // ClassDef2.
+
+	tf := readTestFont(t, "luxisr.ttf")
+	delete(tf, "kern")
+	tf["GPOS"] = gposTable("kern", format1, format2)
+	font := parseTestFont(t, tf)
+	testCases := []struct {
+		r0, r1 rune
+		want   int32
+	}{
+		{'A', 'V', -100},
+		{'A', 'W', -80},
+		{'A', 'A', 0},
+		{'V', 'A', -50},
+		{'V', 'a', -50},
+		{'V', 'o', 0},
+		{'o', 'V', 0},
+	}
+	fupe := font.FUnitsPerEm()
+	for _, tc := range testCases {
+		got := font.Kerning(fupe, font.Index(tc.r0), font.Index(tc.r1))
+		if got != tc.want {
+			t.Errorf("%c%c: got %d, want %d", tc.r0, tc.r1, got, tc.want)
+		}
+	}
+
+	// A GPOS table without a 'kern' feature falls back to the kern table.
+	tf = readTestFont(t, "luxisr.ttf")
+	tf["GPOS"] = gposTable("liga", format1)
+	font = parseTestFont(t, tf)
+	if got, want := font.Kerning(fupe, 36, 57), int32(-144); got != want {
+		t.Errorf("fallback: got %d, want %d", got, want)
+	}
+}
+
+func TestNoKern(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	delete(tf, "kern")
+	font := parseTestFont(t, tf)
+	fupe := font.FUnitsPerEm()
+	for i0 := Index(0); i0 < Index(font.NumGlyphs()); i0 += 7 {
+		for i1 := Index(0); i1 < Index(font.NumGlyphs()); i1 += 11 {
+			if got := font.Kerning(fupe, i0, i1); got != 0 {
+				t.Fatalf("Kerning(%d, %d): got %d, want 0", i0, i1, got)
+			}
+		}
+	}
+
+	// A kern table that is shorter than its header says is rejected by
+	// Parse, rather than causing Kerning to index out of range.
+	tf = readTestFont(t, "luxisr.ttf")
+	tf["kern"] = tf["kern"][:len(tf["kern"])/2]
+	if _, err := Parse(tf.bytes()); err == nil {
+		t.Error("truncated kern table: got no error, want one")
+	}
+}
+
+// A kernPair is a kerning pair in a format 0 kern subtable.
+type kernPair struct {
+	i0, i1 Index
+	v      int16
+}
+
+// kernFormat0 returns the body of a format 0 kern subtable, after its
+// header, that lists the given pairs, which must be sorted.
+func kernFormat0(pairs ...kernPair) []byte {
+	b := appendU16(nil, uint16(len(pairs)), 0, 0, 0)
+	for _, p := range pairs {
+		b = appendU16(b, uint16(p.i0), uint16(p.i1), uint16(p.v))
+	}
+	return b
+}
+
+// A kernSubtableData is a kern subtable's coverage and body.
+type kernSubtableData struct {
+	coverage uint16
+	body     []byte
+}
+
+// kernTable returns a Microsoft kern table, or an Apple kern table if apple
+// is true, that holds the given subtables.
+func kernTable(apple bool, subtables ...kernSubtableData) []byte {
+	if apple {
+		b := appendU32(nil, 0x00010000, uint32(len(subtables)))
+		for _, t := range subtables {
+			b = appendU32(b, uint32(8+len(t.body)))
+			b = appendU16(b, t.coverage, 0)
+			b = append(b, t.body...)
+		}
+		return b
+	}
+	b := appendU16(nil, 0, uint16(len(subtables)))
+	for _, t := range subtables {
+		b = appendU16(b, 0, uint16(6+len(t.body)), t.coverage)
+		b = append(b, t.body...)
+	}
+	return b
+}
+
+func TestKernSubtables(t *testing.T) {
+	const (
+		msHorizontal  = 0x0001
+		msMinimum     = 0x0002
+		msOverride    = 0x0008
+		appleVertical = 0x8000
+	)
+	testCases := []struct {
+		desc   string
+		apple  bool
+		tables []kernSubtableData
+	}{
+		{"Microsoft", false, []kernSubtableData{
+			{msHorizontal, kernFormat0(kernPair{36, 57, -100}, kernPair{36, 58, -50})},
+			// The second subtable's values add to the first's.
+			{msHorizontal, kernFormat0(kernPair{36, 57, -20}, kernPair{57, 36, -30})},
+			// The third subtable overrides the sum so far.
+			{msHorizontal | msOverride, kernFormat0(kernPair{36, 58, -70})},
+			// Vertical, minimum and format 2 subtables are ignored.
+			{0, kernFormat0(kernPair{36, 57, -1000})},
+			{msHorizontal | msMinimum, kernFormat0(kernPair{36, 57, -1000})},
+			{0x0200 | msHorizontal, appendU16(nil, 1, 2, 3, 4)},
+		}},
+		{"Apple", true, []kernSubtableData{
+			{0, kernFormat0(kernPair{36, 57, -100}, kernPair{36, 58, -70})},
+			{0, kernFormat0(kernPair{36, 57, -20}, kernPair{57, 36, -30})},
+			// Vertical and format 1 subtables are ignored.
+			{appleVertical, kernFormat0(kernPair{36, 57, -1000})},
+			{0x0001, appendU16(nil, 1, 2, 3, 4)},
+		}},
+	}
+	want := map[[2]Index]int32{
+		{36, 57}: -120,
+		{36, 58}: -70,
+		{57, 36}: -30,
+		{57, 58}: 0,
+	}
+	for _, tc := range testCases {
+		tf := readTestFont(t, "luxisr.ttf")
+		tf["kern"] = kernTable(tc.apple, tc.tables...)
+		font := parseTestFont(t, tf)
+		fupe := font.FUnitsPerEm()
+		for pair, w := range want {
+			if got := font.Kerning(fupe, pair[0], pair[1]); got != w {
+				t.Errorf("%s: Kerning(%d, %d): got %d, want %d", tc.desc, pair[0], pair[1], got, w)
+			}
+		}
+
+		// A subtable that is longer than the kern table is rejected.
+		tf["kern"] = tf["kern"][:len(tf["kern"])-1]
+		if _, err := Parse(tf.bytes()); err == nil {
+			t.Errorf("%s: truncated kern table: got no error, want one", tc.desc)
+		}
+	}
+}
+
+// loadAll loads each of font's glyphs, with and without hinting, and
+// returns the first error.
+func loadAll(font *Font) error {
+	g, h := NewGlyphBuf(), &Hinter{}
+	for i := 0; i < font.NumGlyphs(); i++ {
+		if err := g.Load(font, 12*64, Index(i), nil); err != nil {
+			return err
+		}
+		if err := g.Load(font, 12*64, Index(i), h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestTruncatedFont(t *testing.T) {
+	b := readTestFont(t, "luxisr.ttf").bytes()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		n := rng.Intn(len(b))
+		// Parsing and loading must fail gracefully, rather than panic.
+		if font, err := Parse(b[:n]); err == nil {
+			loadAll(font)
+		}
+	}
+}
+
+// FuzzParse tests that Parse, and then loading a parsed Font's glyphs,
+// fail gracefully on malformed data, rather than panic. Run it with
+// "go test -fuzz=FuzzParse".
+func FuzzParse(f *testing.F) {
+	tf := readTestFont(f, "luxisr.ttf")
+	f.Add(tf.bytes())
+	// Malformed fonts that used to cause panics.
+	tf["head"] = append([]byte(nil), tf["head"]...)
+	tf["head"][18], tf["head"][19] = 0, 0 // A zero unitsPerEm.
+	f.Add(tf.bytes())
+	f.Fuzz(func(t *testing.T, b []byte) {
+		font, err := Parse(b)
+		if err != nil {
+			return
+		}
+		for _, r := range "Aa0 \u00e9\U0001f600" {
+			font.Index(r)
+		}
+		loadAll(font)
+	})
+}
+
+func FuzzParseWOFF2(f *testing.F) {
+	tf := readTestFont(f, "luxisr.ttf")
+	f.Add(tf.woff2(false))
+	f.Add(tf.woff2(true))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		font, err := ParseWOFF2(b)
+		if err != nil {
+			return
+		}
+		for _, r := range "Aa0 \u00e9\U0001f600" {
+			font.Index(r)
+		}
+		loadAll(font)
+	})
+}
+
+func TestTruncatedGlyph(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	// Glyph #36 is a simple glyph. Every truncation of its data, other than
+	// of any trailing padding, is missing some of its flags or co-ordinates.
+	data, err := font.glyphData(36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append([]byte(nil), data...)
+	g := NewGlyphBuf()
+	for n := 0; n < len(data)-1; n++ {
+		tf.setGlyph(36, data[:n])
+		font := parseTestFont(t, tf)
+		if err := g.Load(font, 12*64, 36, nil); n != 0 && err == nil {
+			t.Errorf("n=%d: got no error, want one", n)
+		}
+	}
+
+	// A contour end index that is not greater than the previous one.
+	bad := append([]byte(nil), data...)
+	copy(bad[12:14], bad[10:12])
+	tf.setGlyph(36, bad)
+	font = parseTestFont(t, tf)
+	if err := g.Load(font, 12*64, 36, nil); err == nil {
+		t.Error("bad contour end: got no error, want one")
+	}
+}
+
+func TestBadLoca(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	// Rewrite the loca table in the long format.
+	notdef, err := parseTestFont(t, tf).glyphData(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf.setGlyph(0, notdef)
+	loca := tf["loca"]
+	testCases := []struct {
+		desc string
+		loca []byte
+		want string
+	}{
+		{"short", loca[:len(loca)-4], "bad loca length"},
+		{"decreasing", append(appendU32(nil, 0, 1000, 999), loca[12:]...), "bad loca offset for glyph 2"},
+		{"beyond glyf", append(loca[:len(loca)-4:len(loca)-4], appendU32(nil, uint32(len(tf["glyf"])+4))...), "loca offset too large"},
+	}
+	for _, tc := range testCases {
+		tf["loca"] = tc.loca
+		_, err := Parse(tf.bytes())
+		if err == nil {
+			t.Errorf("%s: got no error, want %q", tc.desc, tc.want)
+		} else if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.desc, err, tc.want)
+		}
+	}
+}
+
+func TestFvar(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	if font := parseTestFont(t, tf); font.Axes() != nil || font.NamedInstances() != nil {
+		t.Errorf("luxisr.ttf: got axes or instances, want none")
+	}
+
+	// Two axes, the second of which is hidden, and two instances, the
+	// second of which has no PostScript name.
+	fvar := appendU16(nil, 1, 0, 16, 2, 2, 20, 2, 14)
+	fvar = append(fvar, "wght"...)
+	fvar = appendU32(fvar, 100<<16, 400<<16, 900<<16)
+	fvar = appendU16(fvar, 0, 256)
+	fvar = append(fvar, "wdth"...)
+	fvar = appendU32(fvar, 50<<16, 100<<16, 0x00008000|112<<16)
+	fvar = appendU16(fvar, 1, 257)
+	fvar = appendU16(fvar, 258, 0)
+	fvar = appendU32(fvar, 700<<16, 100<<16)
+	fvar = appendU16(fvar, 259)
+	fvar = appendU16(fvar, 260, 0)
+	fvar = appendU32(fvar, 300<<16, 75<<16)
+	fvar = appendU16(fvar, 0xffff)
+	tf["fvar"] = fvar
+	tf["name"] = nameTable(
+		nameRecord{1, 0, 0, 256, "Weight"},
+		nameRecord{1, 0, 0, 257, "Width"},
+		nameRecord{1, 0, 0, 258, "Bold"},
+		nameRecord{1, 0, 0, 259, "Test-Bold"},
+		nameRecord{1, 0, 0, 260, "Light Condensed"},
+	)
+	font := parseTestFont(t, tf)
+	wantAxes := []Axis{
+		{"wght", 100, 400, 900, "Weight", false},
+		{"wdth", 50, 100, 112.5, "Width", true},
+	}
+	if got := font.Axes(); !reflect.DeepEqual(got, wantAxes) {
+		t.Errorf("Axes:\ngot  %v\nwant %v", got, wantAxes)
+	}
+	wantInstances := []NamedInstance{
+		{"Bold", "Test-Bold", []float64{700, 100}},
+		{"Light Condensed", "", []float64{300, 75}},
+	}
+	if got := font.NamedInstances(); !reflect.DeepEqual(got, wantInstances) {
+		t.Errorf("NamedInstances:\ngot  %v\nwant %v", got, wantInstances)
+	}
+
+	// An instance record that is neither with nor without a PostScript name.
+	tf["fvar"] = append(appendU16(nil, 1, 0, 16, 2, 2, 20, 2, 15), fvar[16:]...)
+	if _, err := Parse(tf.bytes()); err == nil {
+		t.Error("bad instance size: got no error, want one")
+	}
+	// A truncated table.
+	tf["fvar"] = fvar[:len(fvar)-1]
+	if _, err := Parse(tf.bytes()); err == nil {
+		t.Error("truncated: got no error, want one")
+	}
+}
+
+func TestLoadVar(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	nGlyph := int(u16(tf["maxp"], 4))
+	// Glyph #36 is a square, and glyph #37 is a compound glyph with glyph
+	// #36 as its only component.
+	square := appendU16(nil, 1, 0, 0, 100, 100, 3, 0)
+	square = append(square, 1, 1, 1, 1)
+	square = appendU16(square, 0, 100, 0, 0xff9c, 0, 0, 100, 0)
+	tf.setGlyph(36, square)
+	tf.setGlyph(37, appendU16(nil, 0xffff, 0, 0, 100, 100, 0x0003, 36, 0, 0))
+
+	// The only axis is the weight, from 100 to 900.
+	fvar := appendU16(nil, 1, 0, 16, 2, 1, 20, 0, 8)
+	fvar = append(fvar, "wght"...)
+	fvar = appendU32(fvar, 100<<16, 400<<16, 900<<16)
+	fvar = appendU16(fvar, 0, 256)
+	tf["fvar"] = fvar
+
+	// Glyph #36 has three tuple variations:
+	//  - at a peak of +1, deltas for points 1 and 2, from which the deltas
+	//    for points 0 and 3 are inferred,
+	//  - at a peak of +0.5, in the region from 0 to +1, deltas for all of
+	//    the points, including the phantom points, and
+	//  - at the shared peak of -1, a delta for point 0, which is inferred
+	//    for the other points.
+	var g36 []byte
+	g36 = appendU16(g36, 0x8003, 24)
+	g36 = appendU16(g36, 10, 0xa000, 0x4000)
+	g36 = appendU16(g36, 18, 0xc000, 0x2000, 0x0000, 0x4000)
+	g36 = appendU16(g36, 6, 0x2000)
+	g36 = append(g36, 0x00)
+	g36 = append(g36, 0x02, 0x01, 1, 1, 0x01, 10, 10, 0x01, 0, 20)
+	g36 = append(g36, 0x07, 0, 0, 0, 0, 0, 8, 0, 0, 0x07, 0, 0, 4, 0, 0, 0, 0, 0)
+	g36 = append(g36, 0x01, 0x00, 0, 0x00, 0xec, 0x80)
+	// Glyph #37 has one tuple variation, at a peak of +1, which moves its
+	// component.
+	var g37 []byte
+	g37 = appendU16(g37, 0x0001, 10)
+	g37 = appendU16(g37, 7, 0x8000, 0x4000)
+	g37 = append(g37, 0x04, 50, 0, 0, 0, 0, 0x84)
+
+	gvar := appendU16(nil, 1, 0, 1, 1)
+	gvar = appendU32(gvar, uint32(20+4*(nGlyph+1)))
+	gvar = appendU16(gvar, uint16(nGlyph), 1)
+	gvar = appendU32(gvar, uint32(20+4*(nGlyph+1)+2))
+	for j := 0; j <= nGlyph; j++ {
+		switch {
+		case j <= 36:
+			gvar = appendU32(gvar, 0)
+		case j == 37:
+			gvar = appendU32(gvar, uint32(len(g36)))
+		default:
+			gvar = appendU32(gvar, uint32(len(g36)+len(g37)))
+		}
+	}
+	gvar = appendU16(gvar, 0xc000)
+	gvar = append(gvar, g36...)
+	gvar = append(gvar, g37...)
+	tf["gvar"] = gvar
+	font := parseTestFont(t, tf)
+
+	testCases := []struct {
+		i       Index
+		wght    int16
+		xy      []int32
+		advance int32
+	}{
+		{36, 0x0000, []int32{0, 0, 100, 0, 100, 100, 0, 100}, 0},
+		{36, 0x4000, []int32{10, 0, 110, 0, 110, 120, 10, 120}, 0},
+		{36, 0x2000, []int32{5, 0, 105, 0, 105, 114, 5, 110}, 8},
+		{36, 0x1000, []int32{3, 0, 103, 0, 103, 107, 3, 105}, 4},
+		{36, -0x2000, []int32{-10, 0, 90, 0, 90, 100, -10, 100}, 0},
+		{37, 0x4000, []int32{60, 0, 160, 0, 160, 120, 60, 120}, 0},
+	}
+	// At a scale of the font's units per em, 26.6 fixed point units are
+	// FUnits.
+	scale := font.FUnitsPerEm()
+	advance := font.HMetric(scale, 36).AdvanceWidth
+	g := NewGlyphBuf()
+	for _, tc := range testCases {
+		if err := g.LoadVar(font, scale, tc.i, []int16{tc.wght}, nil); err != nil {
+			t.Errorf("glyph #%d, wght %#x: %v", tc.i, tc.wght, err)
+			continue
+		}
+		var xy []int32
+		for _, p := range g.Point {
+			xy = append(xy, p.X, p.Y)
+		}
+		if !reflect.DeepEqual(xy, tc.xy) {
+			t.Errorf("glyph #%d, wght %#x: points: got %v, want %v", tc.i, tc.wght, xy, tc.xy)
+		}
+		if tc.i == 36 && g.AdvanceWidth != advance+tc.advance {
+			t.Errorf("glyph #%d, wght %#x: advance: got %d, want %d", tc.i, tc.wght, g.AdvanceWidth, advance+tc.advance)
+		}
+	}
+	if err := g.LoadVar(font, scale, 36, []int16{0, 0}, nil); err == nil {
+		t.Error("two co-ordinates: got no error, want one")
+	}
+}
+
+func TestNormalizeCoords(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	// The only axis is the weight, from 100 to 900.
+	fvar := appendU16(nil, 1, 0, 16, 2, 1, 20, 0, 8)
+	fvar = append(fvar, "wght"...)
+	fvar = appendU32(fvar, 100<<16, 400<<16, 900<<16)
+	fvar = appendU16(fvar, 0, 256)
+	tf["fvar"] = fvar
+	// The avar table maps +0.5 to +0.8.
+	avar := appendU16(nil, 1, 0, 0, 1, 4)
+	avar = appendU16(avar, 0xc000, 0xc000, 0x0000, 0x0000, 0x2000, 0x3333, 0x4000, 0x4000)
+
+	testCases := []struct {
+		wght       float64
+		linear, av int16
+	}{
+		{400, 0, 0},
+		{650, 0x2000, 0x3333},
+		{775, 0x3000, 14746},
+		{900, 0x4000, 0x4000},
+		{1000, 0x4000, 0x4000},
+		{250, -0x2000, -0x2000},
+		{100, -0x4000, -0x4000},
+	}
+	for _, avar := range [][]byte{nil, avar} {
+		if avar != nil {
+			tf["avar"] = avar
+		}
+		font := parseTestFont(t, tf)
+		for _, tc := range testCases {
+			want := tc.linear
+			if avar != nil {
+				want = tc.av
+			}
+			got, err := font.NormalizeCoords([]float64{tc.wght})
+			if err != nil {
+				t.Errorf("avar=%t, wght %v: %v", avar != nil, tc.wght, err)
+				continue
+			}
+			if got[0] != want {
+				t.Errorf("avar=%t, wght %v: got %#x, want %#x", avar != nil, tc.wght, got[0], want)
+			}
+		}
+	}
+	if _, err := parseTestFont(t, readTestFont(t, "luxisr.ttf")).NormalizeCoords([]float64{400}); err == nil {
+		t.Error("no axes: got no error, want one")
+	}
+}
+
+// testParsers are the functions that the bitmap tests parse their fonts
+// with, as ParseReader reads the bitmap data on demand.
+var testParsers = []struct {
+	desc  string
+	parse func(testing.TB, testFont) *Font
+}{
+	{"Parse", parseTestFont},
+	{"ParseReader", readerTestFont},
+}
+
+func TestBitmapGlyph(t *testing.T) {
+	bitmapSize := func(offset, n uint32, first, last uint16, ppem, bitDepth byte) []byte {
+		b := appendU32(nil, offset, 0, n, 0)
+		b = append(b, make([]byte, 24)...) // The line metrics.
+		b = appendU16(b, first, last)
+		return append(b, ppem, ppem, bitDepth, 0x01)
+	}
+	// The 12 ppem strike has a 1 bit per pixel bitmap for glyph #36, with
+	// index format 1 and image format 1, and for glyph #37, with index
+	// format 2 and image format 5. The 16 ppem strike has a 2 bits per pixel
+	// bitmap for glyph #36, with index format 3 and image format 7.
+	eblc := appendU32(nil, 0x00020000, 2)
+	eblc = append(eblc, bitmapSize(104, 2, 36, 37, 12, 1)...)
+	eblc = append(eblc, bitmapSize(156, 1, 36, 36, 16, 2)...)
+	eblc = appendU16(eblc, 36, 36, 0, 16, 37, 37, 0, 32)
+	eblc = appendU16(eblc, 1, 1, 0, 4, 0, 0, 0, 7)
+	eblc = appendU16(eblc, 2, 5, 0, 11, 0, 1)
+	eblc = append(eblc, 2, 3, 0, 2, 4, 0, 0, 0)
+	eblc = appendU16(eblc, 36, 36, 0, 8)
+	eblc = appendU16(eblc, 3, 7, 0, 12, 0, 9)
+	ebdt := appendU32(nil, 0x00020000)
+	ebdt = append(ebdt, 2, 3, 1, 2, 5, 0xa0, 0x40)
+	ebdt = append(ebdt, 0xcc)
+	ebdt = append(ebdt, 1, 3, 0, 1, 4, 0, 0, 0, 0xd0)
+
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["EBLC"], tf["EBDT"] = eblc, ebdt
+	testCases := []struct {
+		i       Index
+		ppem    int
+		pix     []byte
+		width   int
+		metrics BitmapMetrics
+	}{
+		{36, 12, []byte{0xff, 0x00, 0xff, 0x00, 0xff, 0x00}, 3, BitmapMetrics{1, 2, 5, 12}},
+		{37, 12, []byte{0xff, 0xff, 0x00, 0x00, 0xff, 0xff}, 3, BitmapMetrics{0, 2, 4, 12}},
+		{36, 16, []byte{0xff, 0x55, 0x00}, 3, BitmapMetrics{0, 1, 4, 16}},
+	}
+	for _, p := range testParsers {
+		font := p.parse(t, tf)
+		for _, tc := range testCases {
+			m, metrics, err := font.BitmapGlyph(tc.i, tc.ppem)
+			if err != nil {
+				t.Errorf("%s: glyph #%d at %d ppem: %v", p.desc, tc.i, tc.ppem, err)
+				continue
+			}
+			if got := m.Bounds(); got != image.Rect(0, 0, tc.width, len(tc.pix)/tc.width) {
+				t.Errorf("%s: glyph #%d at %d ppem: bounds: got %v", p.desc, tc.i, tc.ppem, got)
+				continue
+			}
+			if !bytes.Equal(m.Pix, tc.pix) {
+				t.Errorf("%s: glyph #%d at %d ppem: pixels: got % x, want % x", p.desc, tc.i, tc.ppem, m.Pix, tc.pix)
+			}
+			if metrics != tc.metrics {
+				t.Errorf("%s: glyph #%d at %d ppem: metrics: got %v, want %v", p.desc, tc.i, tc.ppem, metrics, tc.metrics)
+			}
+		}
+
+		// There is no bitmap for other glyphs or sizes.
+		if _, _, err := font.BitmapGlyph(38, 12); err != ErrNoBitmap {
+			t.Errorf("%s: glyph #38: got %v, want ErrNoBitmap", p.desc, err)
+		}
+		if _, _, err := font.BitmapGlyph(36, 13); err != ErrNoBitmap {
+			t.Errorf("%s: 13 ppem: got %v, want ErrNoBitmap", p.desc, err)
+		}
+	}
+	// Nor is there for a font without embedded bitmaps.
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	if _, _, err := font.BitmapGlyph(36, 12); err != ErrNoBitmap {
+		t.Errorf("no EBLC: got %v, want ErrNoBitmap", err)
+	}
+}
+
+func TestBitmapImage(t *testing.T) {
+	// A 2x3 PNG image.
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 3))
+	src.Set(1, 2, color.NRGBA{0xff, 0x00, 0x00, 0xff})
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+	pngData := buf.Bytes()
+
+	tf := readTestFont(t, "luxisr.ttf")
+	nGlyph := parseTestFont(t, tf).nGlyph
+	// sbixStrike returns an sbix strike whose glyphs' data are given by the
+	// map, keyed by glyph.
+	sbixStrike := func(ppem uint16, data map[Index][]byte) []byte {
+		b := appendU16(nil, ppem, 72)
+		o := uint32(4 + 4*(nGlyph+1))
+		var d []byte
+		for i := 0; i <= nGlyph; i++ {
+			b = appendU32(b, o+uint32(len(d)))
+			d = append(d, data[Index(i)]...)
+		}
+		return append(b, d...)
+	}
+	// The 16 ppem strike has a PNG image for glyph #36 and a dupe of it
+	// for glyph #37. The 32 ppem strike has a PNG image for glyph #36.
+	png36 := append(appendU16(nil, 1, 0xfffe), "png "...)
+	png36 = append(png36, pngData...)
+	dupe37 := append(appendU16(nil, 0, 0), "dupe"...)
+	dupe37 = appendU16(dupe37, 36)
+	strike16 := sbixStrike(16, map[Index][]byte{36: png36, 37: dupe37})
+	strike32 := sbixStrike(32, map[Index][]byte{36: png36})
+	sbix := appendU16(nil, 1, 1)
+	sbix = appendU32(sbix, 2, 16, uint32(16+len(strike16)))
+	sbix = append(sbix, strike16...)
+	sbix = append(sbix, strike32...)
+
+	tf["sbix"] = sbix
+	testCases := []struct {
+		i       Index
+		ppem    int
+		metrics BitmapMetrics
+	}{
+		{36, 12, BitmapMetrics{1, 1, 11, 16}},
+		{36, 16, BitmapMetrics{1, 1, 11, 16}},
+		{37, 16, BitmapMetrics{1, 1, 11, 16}},
+		{36, 20, BitmapMetrics{1, 1, 21, 32}},
+		{36, 64, BitmapMetrics{1, 1, 21, 32}},
+	}
+	for _, p := range testParsers {
+		font := p.parse(t, tf)
+		for _, tc := range testCases {
+			m, metrics, err := font.BitmapImage(tc.i, tc.ppem)
+			if err != nil {
+				t.Errorf("%s: sbix glyph #%d at %d ppem: %v", p.desc, tc.i, tc.ppem, err)
+				continue
+			}
+			if got := m.Bounds(); got != image.Rect(0, 0, 2, 3) {
+				t.Errorf("%s: sbix glyph #%d at %d ppem: bounds: got %v", p.desc, tc.i, tc.ppem, got)
+			}
+			if r, _, _, _ := m.At(1, 2).RGBA(); r != 0xffff {
+				t.Errorf("%s: sbix glyph #%d at %d ppem: got no red pixel", p.desc, tc.i, tc.ppem)
+			}
+			if metrics != tc.metrics {
+				t.Errorf("%s: sbix glyph #%d at %d ppem: metrics: got %v, want %v", p.desc, tc.i, tc.ppem, metrics, tc.metrics)
+			}
+		}
+		if _, _, err := font.BitmapImage(37, 32); err != ErrNoBitmap {
+			t.Errorf("%s: sbix glyph #37 at 32 ppem: got %v, want ErrNoBitmap", p.desc, err)
+		}
+	}
+
+	// The CBLC table has one 20 ppem strike, with a bitmap for glyph #36,
+	// with index format 1 and image format 17.
+	cblc := appendU32(nil, 0x00030000, 1)
+	cblc = appendU32(cblc, 56, 0, 1, 0)
+	cblc = append(cblc, make([]byte, 24)...) // The line metrics.
+	cblc = appendU16(cblc, 36, 36)
+	cblc = append(cblc, 20, 20, 32, 0x01)
+	cblc = appendU16(cblc, 36, 36, 0, 8)
+	cblc = appendU16(cblc, 1, 17, 0, 4)
+	cblc = appendU32(cblc, 0, uint32(9+len(pngData)))
+	cbdt := appendU32(nil, 0x00030000)
+	cbdt = append(cbdt, 3, 2, 0, 3, 12)
+	cbdt = appendU32(cbdt, uint32(len(pngData)))
+	cbdt = append(cbdt, pngData...)
+
+	tf = readTestFont(t, "luxisr.ttf")
+	tf["CBLC"], tf["CBDT"] = cblc, cbdt
+	for _, p := range testParsers {
+		font := p.parse(t, tf)
+		m, metrics, err := font.BitmapImage(36, 12)
+		if err != nil {
+			t.Fatalf("%s: CBDT glyph #36: %v", p.desc, err)
+		}
+		if got := m.Bounds(); got != image.Rect(0, 0, 2, 3) {
+			t.Errorf("%s: CBDT glyph #36: bounds: got %v", p.desc, got)
+		}
+		if want := (BitmapMetrics{0, 3, 12, 20}); metrics != want {
+			t.Errorf("%s: CBDT glyph #36: metrics: got %v, want %v", p.desc, metrics, want)
+		}
+		if _, _, err := font.BitmapImage(37, 12); err != ErrNoBitmap {
+			t.Errorf("%s: CBDT glyph #37: got %v, want ErrNoBitmap", p.desc, err)
+		}
+		// Color bitmaps are not monochrome or grayscale bitmaps.
+		if _, _, err := font.BitmapGlyph(36, 20); err != ErrNoBitmap {
+			t.Errorf("%s: BitmapGlyph: got %v, want ErrNoBitmap", p.desc, err)
+		}
+	}
+}
+
+func TestColorLayers(t *testing.T) {
+	// The first palette is opaque red and translucent blue. The second
+	// palette is unused.
+	cpal := appendU16(nil, 0, 2, 2, 4, 0, 16, 0, 2)
+	cpal = append(cpal, 0x00, 0x00, 0xff, 0xff, 0xff, 0x00, 0x00, 0x80)
+	cpal = append(cpal, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff)
+	// Glyph #36 is a color glyph of three layers: glyph #68 in red, glyph
+	// #69 in blue and glyph #70 in the foreground color.
+	colr := appendU16(nil, 0, 1, 0, 14, 0, 20, 3)
+	colr = appendU16(colr, 36, 0, 3)
+	colr = appendU16(colr, 68, 0, 69, 1, 70, 0xffff)
+
+	tf := readTestFont(t, "luxisr.ttf")
+	tf["COLR"], tf["CPAL"] = colr, cpal
+	font := parseTestFont(t, tf)
+	got, ok := font.ColorLayers(36)
+	if !ok {
+		t.Fatal("glyph #36: got no layers")
+	}
+	want := []ColorLayer{
+		{68, color.NRGBA{0xff, 0x00, 0x00, 0xff}, false},
+		{69, color.NRGBA{0x00, 0x00, 0xff, 0x80}, false},
+		{70, color.NRGBA{}, true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("glyph #36:\ngot  %v\nwant %v", got, want)
+	}
+	if _, ok := font.ColorLayers(37); ok {
+		t.Error("glyph #37: got layers, want none")
+	}
+
+	// A palette index that is out of range is rejected by Parse.
+	tf["COLR"] = appendU16(colr[:len(colr)-2:len(colr)-2], 2)
+	if _, err := Parse(tf.bytes()); err == nil {
+		t.Error("bad palette index: got no error, want one")
+	}
+}
+
+func compoundGlyph(components ...[]uint16) []byte {
+	// The header's number of contours is -1, and its bounds are all zero.
+	b := appendU16(nil, 0xffff, 0, 0, 0, 0)
+	for i, c := range components {
+		flags := c[0] | 0x0001 // ARG_1_AND_2_ARE_WORDS.
+		if i != len(components)-1 {
+			flags |= 0x0020 // MORE_COMPONENTS.
+		}
+		b = appendU16(b, flags)
+		b = appendU16(b, c[1:]...)
+	}
+	return b
+}
+
+// testCompound replaces glyphs #201, #202, etc. with the given glyph data,
+// loads glyph #201 and returns the resultant points, with their flags masked
+// to the on-curve bit.
+func testCompound(t *testing.T, glyphs ...[]byte) []Point {
+	tf := readTestFont(t, "luxisr.ttf")
+	for i, glyph := range glyphs {
+		tf.setGlyph(201+i, glyph)
+	}
+	font := parseTestFont(t, tf)
+	g := NewGlyphBuf()
+	if err := g.Load(font, font.FUnitsPerEm(), 201, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for i := range g.Point {
+		g.Point[i].Flags &= 0x01
+	}
+	return g.Point
+}
+
+// The flags for a compound glyph's components. In the tests below, glyph #36
+// is 'A' and the 2.14 fixed point numbers 0x4000, 0x2000 and 0x1000 are 1,
+// 0.5 and 0.25.
+const (
+	compArgsAreXYValues       = 0x0002
+	compRoundXYToGrid         = 0x0004
+	compWeHaveAScale          = 0x0008
+	compWeHaveAnXAndYScale    = 0x0040
+	compWeHaveATwoByTwo       = 0x0080
+	compUseMyMetrics          = 0x0200
+	compOverlapCompound       = 0x0400
+	compScaledComponentOffset = 0x0800
+)
+
+func TestCompoundOverlap(t *testing.T) {
+	// Glyph #201 is two copies of the 'l', offset so that they overlap.
+	// Filled by the even-odd rule, the overlap would be a hole.
+	l := parseTestFont(t, readTestFont(t, "luxisr.ttf")).Index('l')
+	for _, overlap := range []bool{false, true} {
+		flags := uint16(compArgsAreXYValues)
+		if overlap {
+			flags |= compOverlapCompound
+		}
+		tf := readTestFont(t, "luxisr.ttf")
+		tf.setGlyph(201, compoundGlyph(
+			[]uint16{flags, uint16(l), 0, 0},
+			[]uint16{compArgsAreXYValues, uint16(l), 60, 0},
+		))
+		font := parseTestFont(t, tf)
+		for _, h := range []*Hinter{nil, &Hinter{}} {
+			g := NewGlyphBuf()
+			if err := g.Load(font, 64*64, 201, h); err != nil {
+				t.Fatalf("overlap=%t, hinted=%t: Load: %v", overlap, h != nil, err)
+			}
+			if g.Overlap != overlap {
+				t.Errorf("overlap=%t, hinted=%t: Overlap: got %t", overlap, h != nil, g.Overlap)
+			}
+			nonZero, evenOdd := g.MaskFill(0, 0, FillNonZero), g.MaskFill(0, 0, FillEvenOdd)
+			if got := bytes.Equal(nonZero.Pix, evenOdd.Pix); got != overlap {
+				t.Errorf("overlap=%t, hinted=%t: masks equal: got %t", overlap, h != nil, got)
+			}
+		}
+	}
+	// Re-using the GlyphBuf for a simple glyph clears Overlap.
+	tf := readTestFont(t, "luxisr.ttf")
+	tf.setGlyph(201, compoundGlyph([]uint16{compArgsAreXYValues | compOverlapCompound, uint16(l), 0, 0}))
+	font := parseTestFont(t, tf)
+	g := NewGlyphBuf()
+	if err := g.Load(font, 64*64, 201, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := g.Load(font, 64*64, l, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if g.Overlap {
+		t.Errorf("simple glyph: Overlap: got true, want false")
+	}
+}
+
+func TestCompoundNesting(t *testing.T) {
+	// nest returns a font in which glyph #201 has glyph #202 as a component,
+	// and so on, for n levels, with the last level being the 'A' glyph or,
+	// if cycle is true, glyph #201 again.
+	nest := func(n int, cycle bool, opts *ParseOptions) *Font {
+		tf := readTestFont(t, "luxisr.ttf")
+		for i := 0; i < n; i++ {
+			c := uint16(202 + i)
+			if i == n-1 {
+				c = 36
+				if cycle {
+					c = 201
+				}
+			}
+			tf.setGlyph(201+i, compoundGlyph([]uint16{compArgsAreXYValues, c, 0, 0}))
+		}
+		font, err := ParseWithOptions(tf.bytes(), opts)
+		if err != nil {
+			t.Fatalf("ParseWithOptions: %v", err)
+		}
+		return font
+	}
+	g := NewGlyphBuf()
+
+	// Five levels of nesting is deeper than some fonts need, but allowed
+	// by default.
+	font := nest(5, false, nil)
+	if err := g.Load(font, 12*64, 201, nil); err != nil {
+		t.Errorf("default limit: Load: %v", err)
+	}
+	if _, err := font.GlyphBounds(12*64, 201); err != nil {
+		t.Errorf("default limit: GlyphBounds: %v", err)
+	}
+
+	// A lower limit rejects it, and the error says where.
+	font = nest(5, false, &ParseOptions{MaxComponentDepth: 4})
+	const want = "freetype: unsupported TrueType feature: excessive compound glyph recursion: " +
+		"glyph 36 is nested 5 deep in glyph 201"
+	if err := g.Load(font, 12*64, 201, nil); err == nil || err.Error() != want {
+		t.Errorf("limit of 4: Load: got %v, want %q", err, want)
+	}
+	if _, err := font.GlyphBounds(12*64, 201); err == nil || err.Error() != want {
+		t.Errorf("limit of 4: GlyphBounds: got %v, want %q", err, want)
+	}
+	if err := g.Load(font, 12*64, 202, nil); err != nil {
+		t.Errorf("limit of 4: Load of a shallower glyph: %v", err)
+	}
+
+	// A cycle is reported as soon as it is found.
+	font = nest(2, true, nil)
+	for _, h := range []*Hinter{nil, &Hinter{}} {
+		err := g.Load(font, 12*64, 201, h)
+		if _, ok := err.(FormatError); !ok || !strings.Contains(err.Error(), "compound glyph 201 is its own component") {
+			t.Errorf("cycle, hinted=%t: Load: got %v", h != nil, err)
+		}
+	}
+	if _, err := font.GlyphBounds(12*64, 201); err == nil {
+		t.Errorf("cycle: GlyphBounds: got nil error")
+	}
+}
+
+func TestCompoundCycle(t *testing.T) {
+	testCases := []struct {
+		desc string
+		// components are the components of glyphs #201, #202, etc.
+		components []uint16
+		// want is the glyph that is found to be its own component.
+		want Index
+	}{
+		{"self", []uint16{201}, 201},
+		{"two glyphs", []uint16{202, 201}, 201},
+		{"inner cycle", []uint16{202, 203, 204, 202}, 202},
+	}
+	for _, tc := range testCases {
+		tf := readTestFont(t, "luxisr.ttf")
+		for i, c := range tc.components {
+			tf.setGlyph(201+i, compoundGlyph(
+				[]uint16{compArgsAreXYValues, 36, 0, 0},
+				[]uint16{compArgsAreXYValues, c, 0, 0},
+			))
+		}
+		// Even with a very lax nesting limit, the cycle is found as soon as
+		// it is first followed.
+		font, err := ParseWithOptions(tf.bytes(), &ParseOptions{MaxComponentDepth: 1 << 20})
+		if err != nil {
+			t.Fatalf("%s: ParseWithOptions: %v", tc.desc, err)
+		}
+		want := FormatError(fmt.Sprintf("compound glyph %d is its own component", tc.want))
+		for _, h := range []*Hinter{nil, &Hinter{}} {
+			if err := NewGlyphBuf().Load(font, 12*64, 201, h); err != want {
+				t.Errorf("%s, hinted=%t: Load: got %v, want %v", tc.desc, h != nil, err, want)
+			}
+		}
+		if _, err := font.GlyphBounds(12*64, 201); err != want {
+			t.Errorf("%s: GlyphBounds: got %v, want %v", tc.desc, err, want)
+		}
+	}
+}
+
+func TestCompoundRounding(t *testing.T) {
+	// At 12 ppem, the component's x offset of 100 FUnits is 37.5/64 of a
+	// pixel, which scales to 38 in 26.6 fixed point.
+	tf := readTestFont(t, "luxisr.ttf")
+	tf.setGlyph(201, compoundGlyph([]uint16{compArgsAreXYValues | compRoundXYToGrid, 36, 100, 0}))
+	font := parseTestFont(t, tf)
+	testCases := []struct {
+		mode RoundingMode
+		want int32
+	}{
+		{RoundToGrid, 64},
+		{RoundToHalfGrid, 32},
+		{RoundToDoubleGrid, 32},
+		{RoundDownToGrid, 0},
+		{RoundUpToGrid, 64},
+		{RoundOff, 38},
+	}
+	a, g := NewGlyphBuf(), NewGlyphBuf()
+	for _, h := range []*Hinter{nil, &Hinter{}} {
+		if err := a.Load(font, 12*64, 36, h); err != nil {
+			t.Fatalf("hinted=%t: Load: %v", h != nil, err)
+		}
+		for _, tc := range testCases {
+			g.Rounding = tc.mode
+			if err := g.Load(font, 12*64, 201, h); err != nil {
+				t.Fatalf("hinted=%t, mode=%d: Load: %v", h != nil, tc.mode, err)
+			}
+			if got := g.Point[0].X - a.Point[0].X; got != tc.want {
+				t.Errorf("hinted=%t, mode=%d: offset: got %d, want %d", h != nil, tc.mode, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestCompoundScale(t *testing.T) {
+	got := testCompound(t, compoundGlyph(
+		[]uint16{compArgsAreXYValues | compWeHaveAScale, 36, 100, 200, 0x2000},
+	))
+	want := []Point{
+		{110, 200, 1},
+		{391, 940, 1},
+		{495, 940, 1},
+		{771, 200, 1},
+		{658, 200, 1},
+		{581, 405, 1},
+		{284, 405, 1},
+		{207, 200, 1},
+		{314, 483, 1},
+		{552, 483, 1},
+		{434, 800, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestCompoundTransform(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		glyphs [][]byte
+		want   []Point
+	}{{
+		// A rotation by 90 degrees counter-clockwise, so that (x, y) becomes
+		// (-y, x). The offset is unaffected by the rotation.
+		"rotate",
+		[][]byte{compoundGlyph(
+			[]uint16{compArgsAreXYValues | compWeHaveATwoByTwo, 36, 10, 20, 0, 0x4000, 0xc000, 0},
+		)},
+		[]Point{
+			{10, 39, 1},
+			{-1470, 601, 1},
+			{-1470, 809, 1},
+			{10, 1362, 1},
+			{10, 1136, 1},
+			{-400, 982, 1},
+			{-400, 388, 1},
+			{10, 234, 1},
+			{-556, 448, 1},
+			{-556, 924, 1},
+			{-1190, 687, 1},
+		},
+	}, {
+		// The same rotation, but with SCALED_COMPONENT_OFFSET set, so that the
+		// offset (10, 20) is also rotated, becoming (-20, 10).
+		"rotate scaled offset",
+		[][]byte{compoundGlyph(
+			[]uint16{compArgsAreXYValues | compWeHaveATwoByTwo | compScaledComponentOffset, 36, 10, 20, 0, 0x4000, 0xc000, 0},
+		)},
+		[]Point{
+			{-20, 29, 1},
+			{-1500, 591, 1},
+			{-1500, 799, 1},
+			{-20, 1352, 1},
+			{-20, 1126, 1},
+			{-430, 972, 1},
+			{-430, 378, 1},
+			{-20, 224, 1},
+			{-586, 438, 1},
+			{-586, 914, 1},
+			{-1220, 677, 1},
+		},
+	}, {
+		// Glyph #201 scales glyph #202 by (0.5, 1), and glyph #202 shears
+		// glyph #36 so that (x, y) becomes (x + 0.5*y, y). The combined
+		// transform takes (x, y) to (0.5*x + 0.25*y, y). Applying the two
+		// transforms in the opposite order would give (0.5*x + 0.5*y, y).
+		"nested",
+		[][]byte{
+			compoundGlyph([]uint16{compArgsAreXYValues | compWeHaveAnXAndYScale, 202, 0, 0, 0x2000, 0x4000}),
+			compoundGlyph([]uint16{compArgsAreXYValues | compWeHaveATwoByTwo, 36, 0, 0, 0x4000, 0, 0x2000, 0x4000}),
+		},
+		[]Point{
+			{10, 0, 1},
+			{661, 1480, 1},
+			{765, 1480, 1},
+			{671, 0, 1},
+			{558, 0, 1},
+			{584, 410, 1},
+			{287, 410, 1},
+			{107, 0, 1},
+			{356, 566, 1},
+			{594, 566, 1},
+			{634, 1200, 1},
+		},
+	}}
+	for _, tc := range testCases {
+		got := testCompound(t, tc.glyphs...)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestCompoundPointMatching(t *testing.T) {
+	// The second component has ARGS_ARE_XY_VALUES unset, so that its
+	// arguments are point numbers. Its point #0, (19, 0), is anchored to the
+	// first component's point #3, (1342, 0), giving an offset of (1323, 0).
+	got := testCompound(t, compoundGlyph(
+		[]uint16{compArgsAreXYValues, 36, 0, 0},
+		[]uint16{0, 36, 3, 0},
+	))
+	want := []Point{
+		{19, 0, 1},
+		{581, 1480, 1},
+		{789, 1480, 1},
+		{1342, 0, 1},
+		{1116, 0, 1},
+		{962, 410, 1},
+		{368, 410, 1},
+		{214, 0, 1},
+		{428, 566, 1},
+		{904, 566, 1},
+		{667, 1200, 1},
+		{1342, 0, 1},
+		{1904, 1480, 1},
+		{2112, 1480, 1},
+		{2665, 0, 1},
+		{2439, 0, 1},
+		{2285, 410, 1},
+		{1691, 410, 1},
+		{1537, 0, 1},
+		{1751, 566, 1},
+		{2227, 566, 1},
+		{1990, 1200, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestGlyphBounds(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g := NewGlyphBuf()
+	for _, scale := range []int32{font.FUnitsPerEm(), 12 * 64} {
+		for i := 0; i < font.NumGlyphs(); i++ {
+			if err := g.Load(font, scale, Index(i), nil); err != nil {
+				t.Fatalf("scale=%d, i=%d: Load: %v", scale, i, err)
+			}
+			got, err := font.GlyphBounds(scale, Index(i))
+			if err != nil {
+				t.Fatalf("scale=%d, i=%d: GlyphBounds: %v", scale, i, err)
+			}
+			if got != g.B {
+				t.Errorf("scale=%d, i=%d: got %v, want %v", scale, i, got, g.B)
+			}
+		}
+	}
+
+	// The compound glyph's own header bounds are all zero, so the bounds
+	// must come from the union of its components, the second of which is
+	// rotated by 90 degrees counter-clockwise.
+	tf := readTestFont(t, "luxisr.ttf")
+	tf.setGlyph(201, compoundGlyph(
+		[]uint16{compArgsAreXYValues, 36, 0, 0},
+		[]uint16{compArgsAreXYValues | compWeHaveATwoByTwo, 36, 10, 20, 0, 0x4000, 0xc000, 0},
+	))
+	font = parseTestFont(t, tf)
+	got, err := font.GlyphBounds(font.FUnitsPerEm(), 201)
+	if err != nil {
+		t.Fatalf("GlyphBounds: %v", err)
+	}
+	if want := (Bounds{-1470, 0, 1342, 1480}); got != want {
+		t.Errorf("compound: got %v, want %v", got, want)
+	}
+}
+
+func TestBoundsUnion(t *testing.T) {
+	b := Bounds{-10, 0, 20, 30}
+	c := Bounds{5, -5, 40, 25}
+	want := Bounds{-10, -5, 40, 30}
+	if got := b.Union(c); got != want {
+		t.Errorf("b.Union(c): got %v, want %v", got, want)
+	}
+	if got := c.Union(b); got != want {
+		t.Errorf("c.Union(b): got %v, want %v", got, want)
+	}
+}
+
+func TestStringBounds(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	const scale = 12 * 64
+	// The bounds run from the 'j''s left side bearing, which is negative, to
+	// the right of the 'V', which is kerned against the 'A'.
+	j, a, v := font.Index('j'), font.Index('A'), font.Index('V')
+	bj, err := font.GlyphBounds(scale, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := font.GlyphBounds(scale, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bj.XMin >= 0 {
+		t.Fatalf("'j' XMin: got %d, want < 0", bj.XMin)
+	}
+	xv := font.HMetric(scale, j).AdvanceWidth + font.Kerning(scale, j, a) +
+		font.HMetric(scale, a).AdvanceWidth + font.Kerning(scale, a, v)
+	wantAdvance := xv + font.HMetric(scale, v).AdvanceWidth
+	b, advance, err := font.StringBounds(scale, "jAV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.XMin != bj.XMin || b.XMax != xv+bv.XMax || b.YMin != bj.YMin {
+		t.Errorf("bounds: got %v, want XMin=%d, XMax=%d, YMin=%d", b, bj.XMin, xv+bv.XMax, bj.YMin)
+	}
+	if advance != wantAdvance {
+		t.Errorf("advance: got %d, want %d", advance, wantAdvance)
+	}
+
+	// A space advances the pen, but has no bounds.
+	space := font.HMetric(scale, font.Index(' ')).AdvanceWidth
+	b, advance, err = font.StringBounds(scale, "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != (Bounds{}) || advance != 2*space {
+		t.Errorf("spaces: got %v, %d, want %v, %d", b, advance, Bounds{}, 2*space)
+	}
+}
+
+func TestLoadPhase(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g0, g1 := NewGlyphBuf(), NewGlyphBuf()
+	if err := g0.Load(font, 12*64, 36, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	const px, py = 21, 5
+	if err := g1.LoadPhase(font, 12*64, 36, nil, px, py); err != nil {
+		t.Fatalf("LoadPhase: %v", err)
+	}
+	want := Bounds{g0.B.XMin + px, g0.B.YMin + py, g0.B.XMax + px, g0.B.YMax + py}
+	if g1.B != want {
+		t.Errorf("bounds: got %v, want %v", g1.B, want)
+	}
+	if len(g1.Point) != len(g0.Point) {
+		t.Fatalf("number of points: got %d, want %d", len(g1.Point), len(g0.Point))
+	}
+	for i, p := range g0.Point {
+		p.X += px
+		p.Y += py
+		if g1.Point[i] != p {
+			t.Errorf("point #%d: got %v, want %v", i, g1.Point[i], p)
+		}
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g := NewGlyphBuf()
+	testCases := []struct {
+		i    Index
+		h    *Hinter
+		want int32
+	}{
+		{36, nil, 427},
+		{36, &Hinter{}, 448},
+		// Glyph #3 is empty, but its hinted advance is still rounded.
+		{3, nil, 178},
+		{3, &Hinter{}, 192},
+	}
+	for _, tc := range testCases {
+		if err := g.Load(font, 10*64, tc.i, tc.h); err != nil {
+			t.Errorf("glyph #%d: Load: %v", tc.i, err)
+			continue
+		}
+		if got := g.AdvanceWidth; got != tc.want {
+			t.Errorf("glyph #%d, hinted=%t: AdvanceWidth: got %d, want %d", tc.i, tc.h != nil, got, tc.want)
+		}
+		if got := g.Advance(); got != tc.want {
+			t.Errorf("glyph #%d, hinted=%t: Advance: got %d, want %d", tc.i, tc.h != nil, got, tc.want)
+		}
+	}
+}
+
+func TestContourIsClockwise(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g := NewGlyphBuf()
+	// The 'o' has an outer contour and a hole, which wind in opposite
+	// directions, whether or not the glyph is hinted.
+	for _, h := range []*Hinter{nil, &Hinter{}} {
+		if err := g.Load(font, 12*64, font.Index('o'), h); err != nil {
+			t.Fatalf("hinted=%t: Load: %v", h != nil, err)
+		}
+		if len(g.End) != 2 {
+			t.Fatalf("hinted=%t: got %d contours, want 2", h != nil, len(g.End))
+		}
+		got := [2]bool{g.ContourIsClockwise(0), g.ContourIsClockwise(1)}
+		if got[0] == got[1] {
+			t.Errorf("hinted=%t: contours wind the same way: %v", h != nil, got)
+		}
+		// The outer contour is the one whose bounds contain the other's.
+		b0, b1 := pointBounds(g.Point[:g.End[0]]), pointBounds(g.Point[g.End[0]:g.End[1]])
+		outer := 0
+		if b1.Union(b0) == b1 {
+			outer = 1
+		}
+		if !got[outer] {
+			t.Errorf("hinted=%t: outer contour #%d is counter-clockwise", h != nil, outer)
+		}
+	}
+}
+
+func TestLoadEmptyGlyph(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	space := font.Index(' ')
+	g := NewGlyphBuf()
+	for _, h := range []*Hinter{nil, &Hinter{}} {
+		// Load the 'A' first, so that loading the space must overwrite it.
+		if err := g.Load(font, 12*64, font.Index('A'), h); err != nil {
+			t.Fatalf("hinted=%t: Load('A'): %v", h != nil, err)
+		}
+		if err := g.Load(font, 12*64, space, h); err != nil {
+			t.Fatalf("hinted=%t: Load(' '): %v", h != nil, err)
+		}
+		if g.B != (Bounds{}) {
+			t.Errorf("hinted=%t: B: got %v, want zero", h != nil, g.B)
+		}
+		if len(g.Point) != 0 || len(g.Unhinted) != 0 || len(g.InFontUnits) != 0 || len(g.End) != 0 {
+			t.Errorf("hinted=%t: got %d points and %d contours, want none", h != nil, len(g.Point), len(g.End))
+		}
+		if g.AdvanceWidth == 0 {
+			t.Errorf("hinted=%t: AdvanceWidth: got 0, want non-zero", h != nil)
+		}
+	}
+
+	// A compound glyph's empty component with the USE_MY_METRICS flag gives
+	// the compound glyph zero bounds, as if the component were loaded alone,
+	// rather than the compound glyph's own, non-zero, bounds.
+	data := compoundGlyph(
+		[]uint16{compArgsAreXYValues, 36, 0, 0},
+		[]uint16{compArgsAreXYValues | compUseMyMetrics, uint16(space), 0, 0},
+	)
+	copy(data[2:], appendU16(nil, 10, 20, 1000, 1400))
+	tf := readTestFont(t, "luxisr.ttf")
+	tf.setGlyph(201, data)
+	font = parseTestFont(t, tf)
+	if err := g.Load(font, font.FUnitsPerEm(), 201, nil); err != nil {
+		t.Fatalf("compound: Load: %v", err)
+	}
+	if g.B != (Bounds{}) {
+		t.Errorf("compound: B: got %v, want zero", g.B)
+	}
+	if len(g.End) != 2 {
+		t.Errorf("compound: got %d contours, want the 'A''s 2", len(g.End))
+	}
+}
+
+func TestIntegerPPEM(t *testing.T) {
+	tf := readTestFont(t, "luxisr.ttf")
+	font := parseTestFont(t, tf)
+	// Unlike a fractional size, 12.3125 ppem rounds to 12 ppem.
+	const scale = 12*64 + 20
+	for _, h := range []*Hinter{nil, &Hinter{}} {
+		want, frac := NewGlyphBuf(), NewGlyphBuf()
+		if err := want.Load(font, 12*64, 36, h); err != nil {
+			t.Fatalf("hinted=%t: Load: %v", h != nil, err)
+		}
+		if err := frac.Load(font, scale, 36, h); err != nil {
+			t.Fatalf("hinted=%t: Load: %v", h != nil, err)
+		}
+		g := NewGlyphBuf()
+		g.IntegerPPEM = true
+		if err := g.Load(font, scale, 36, h); err != nil {
+			t.Fatalf("hinted=%t: Load: %v", h != nil, err)
+		}
+		if !reflect.DeepEqual(g.Point, want.Point) || g.AdvanceWidth != want.AdvanceWidth {
+			t.Errorf("hinted=%t: got %v, %d, want %v, %d", h != nil, g.Point, g.AdvanceWidth, want.Point, want.AdvanceWidth)
+		}
+		if reflect.DeepEqual(frac.Point, want.Point) {
+			t.Errorf("hinted=%t: fractional size was rounded without IntegerPPEM", h != nil)
+		}
+	}
+
+	// IntegerPPEM has no effect on a font without the head table's flag.
+	tf["head"] = append([]byte(nil), tf["head"]...)
+	copy(tf["head"][16:], appendU16(nil, uint16(font.Flags()&^HeadFlagIntegerPPEM)))
+	font = parseTestFont(t, tf)
+	g, frac := NewGlyphBuf(), NewGlyphBuf()
+	g.IntegerPPEM = true
+	if err := g.Load(font, scale, 36, nil); err != nil {
+		t.Fatalf("no flag: Load: %v", err)
+	}
+	if err := frac.Load(font, scale, 36, nil); err != nil {
+		t.Fatalf("no flag: Load: %v", err)
+	}
+	if !reflect.DeepEqual(g.Point, frac.Point) {
+		t.Errorf("no flag: got %v, want %v", g.Point, frac.Point)
+	}
+}
+
+func TestTwilight(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g := NewGlyphBuf()
+	// Glyph #4's instructions create four points in the twilight zone.
+	if err := g.Load(font, 12*64, 4, &Hinter{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got := make([]int32, len(g.Twilight))
+	for i, p := range g.Twilight {
+		got[i] = p.Y
+	}
+	if want := []int32{576, 384, 0, -192}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hinted: got %v, want %v", got, want)
+	}
+	if err := g.Load(font, 12*64, 4, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(g.Twilight) != 0 {
+		t.Errorf("unhinted: got %d twilight points, want 0", len(g.Twilight))
+	}
+}
+
+func TestAppendPath(t *testing.T) {
+	g := &GlyphBuf{
+		Point: []Point{
+			// Two on-curve and two off-curve points.
+			{0, 0, 1}, {100, 0, 0}, {100, 100, 0}, {0, 100, 1},
+			// Only off-curve points.
+			{0, 0, 0}, {100, 0, 0}, {100, 100, 0}, {0, 100, 0},
+			// An off-curve first point and an on-curve last point.
+			{10, 10, 0}, {20, 20, 1}, {30, 10, 1},
+			// Cubic control points, including a pair before the wrap-around.
+			{0, 0, 1}, {10, 20, 0x100}, {30, 20, 0x100}, {40, 0, 1}, {30, -20, 0x100}, {10, -20, 0x100},
+		},
+		End: []int{4, 8, 11, 17},
+	}
+	move := func(x, y int32) Segment {
+		return Segment{SegmentOpMoveTo, [3]Point{{X: x, Y: y}}}
+	}
+	line := func(x, y int32) Segment {
+		return Segment{SegmentOpLineTo, [3]Point{{X: x, Y: y}}}
+	}
+	quad := func(x0, y0, x1, y1 int32) Segment {
+		return Segment{SegmentOpQuadTo, [3]Point{{X: x0, Y: y0}, {X: x1, Y: y1}}}
+	}
+	cube := func(x0, y0, x1, y1, x2, y2 int32) Segment {
+		return Segment{SegmentOpCubeTo, [3]Point{{X: x0, Y: y0}, {X: x1, Y: y1}, {X: x2, Y: y2}}}
+	}
+	want := []Segment{
+		move(0, 0),
+		quad(100, 0, 100, 50),
+		quad(100, 100, 0, 100),
+		line(0, 0),
+
+		move(0, 50),
+		quad(0, 0, 50, 0),
+		quad(100, 0, 100, 50),
+		quad(100, 100, 50, 100),
+		quad(0, 100, 0, 50),
+
+		move(30, 10),
+		quad(10, 10, 20, 20),
+		line(30, 10),
+
+		move(0, 0),
+		cube(10, 20, 30, 20, 40, 0),
+		cube(30, -20, 10, -20, 0, 0),
+	}
+	got := g.AppendPath(nil)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot  %v\nwant %v", got, want)
+	}
+}
+
+// appendCFFIndex appends a CFF INDEX of the given objects to b.
+func appendCFFIndex(b []byte, objects ...[]byte) []byte {
+	b = appendU16(b, uint16(len(objects)))
+	if len(objects) == 0 {
+		return b
+	}
+	b = append(b, 4)
+	o := uint32(1)
+	b = appendU32(b, o)
+	for _, object := range objects {
+		o += uint32(len(object))
+		b = appendU32(b, o)
+	}
+	for _, object := range objects {
+		b = append(b, object...)
+	}
+	return b
+}
+
+// cffTestFont returns luxisr.ttf with its TrueType outlines replaced by a
+// CFF table. Each glyph's charstring is given by charStrings, or is just
+// an endchar operator if it has no entry.
+func cffTestFont(t *testing.T, charStrings map[Index][]byte, globalSubrs, subrs [][]byte) testFont {
+	tf := readTestFont(t, "luxisr.ttf")
+	nGlyph := u16(tf["maxp"], 4)
+	for _, tag := range []string{"cvt ", "fpgm", "glyf", "loca", "prep"} {
+		delete(tf, tag)
+	}
+	tf["maxp"] = appendU16(appendU32(nil, 0x00005000), nGlyph)
+
+	// The Top DICT's operands are all 5 byte integers, so that its size
+	// does not depend on their values.
+	cffInt := func(v int) []byte {
+		return append([]byte{29}, appendU32(nil, uint32(v))...)
+	}
+	cs := make([][]byte, nGlyph)
+	for i := range cs {
+		if cs[i] = charStrings[Index(i)]; cs[i] == nil {
+			cs[i] = []byte{14}
+		}
+	}
+	b := []byte{1, 0, 4, 4}
+	b = appendCFFIndex(b, []byte("Test"))
+	topDictOffset := len(b)
+	b = appendCFFIndex(b, make([]byte, 17))
+	b = appendCFFIndex(b)
+	b = appendCFFIndex(b, globalSubrs...)
+	charStringsOffset := len(b)
+	b = appendCFFIndex(b, cs...)
+	// The Private DICT's only operator is Subrs, whose offset is relative
+	// to the Private DICT.
+	private := append(cffInt(6), 19)
+	privateOffset := len(b)
+	b = append(b, private...)
+	b = appendCFFIndex(b, subrs...)
+	topDict := append(cffInt(charStringsOffset), 17)
+	topDict = append(topDict, cffInt(len(private))...)
+	topDict = append(topDict, cffInt(privateOffset)...)
+	topDict = append(topDict, 18)
+	copy(b[topDictOffset+11:], topDict)
+	tf["CFF "] = b
+	return tf
+}
+
+func TestCFF(t *testing.T) {
+	// n returns the charstring encoding of a small integer operand.
+	n := func(v int) byte {
+		return byte(v + 139)
+	}
+	charStrings := map[Index][]byte{
+		// An hstem whose extra argument is the width, a hintmask, two
+		// contours, one of them from a global subroutine, and a local
+		// subroutine that draws a curve.
+		36: {
+			n(7), n(0), n(10), 1,
+			19, 0x80,
+			n(10), n(20), 21,
+			n(100), n(0), 5,
+			n(-107), 10,
+			n(-100), 7,
+			n(-107), 29,
+			14,
+		},
+		// A 3 byte integer, hvcurveto with a final delta and a 16.16 fixed
+		// point number (10.5).
+		37: {
+			28, 0x01, 0x2c, n(0), 21,
+			n(10), n(20), n(30), n(40), n(5), 30,
+			255, 0x00, 0x0a, 0x80, 0x00, 6,
+			14,
+		},
+		// An unsupported operator.
+		38: {n(1), n(2), 12, 23, 14},
+		// A local subroutine that does not exist.
+		39: {n(-106), 10, 14},
+	}
+	globalSubrs := [][]byte{{n(20), n(30), 21, n(5), n(10), n(10), n(10), n(10), 27, 11}}
+	subrs := [][]byte{{n(0), n(50), n(-50), n(50), n(-50), n(0), 8, 11}}
+	font := parseTestFont(t, cffTestFont(t, charStrings, globalSubrs, subrs))
+
+	const c = flagCubic
+	testCases := []struct {
+		i     Index
+		point []Point
+		end   []int
+		segs  []Segment
+	}{
+		{
+			36,
+			[]Point{
+				{10, 20, 1}, {110, 20, 1}, {110, 70, c}, {60, 120, c}, {10, 120, 1},
+				{30, 50, 1}, {40, 55, c}, {50, 65, c}, {60, 65, 1},
+			},
+			[]int{5, 9},
+			[]Segment{
+				{SegmentOpMoveTo, [3]Point{{X: 10, Y: 20}}},
+				{SegmentOpLineTo, [3]Point{{X: 110, Y: 20}}},
+				{SegmentOpCubeTo, [3]Point{{X: 110, Y: 70}, {X: 60, Y: 120}, {X: 10, Y: 120}}},
+				{SegmentOpLineTo, [3]Point{{X: 10, Y: 20}}},
+				{SegmentOpMoveTo, [3]Point{{X: 30, Y: 50}}},
+				{SegmentOpCubeTo, [3]Point{{X: 40, Y: 55}, {X: 50, Y: 65}, {X: 60, Y: 65}}},
+				{SegmentOpLineTo, [3]Point{{X: 30, Y: 50}}},
+			},
+		},
+		{
+			37,
+			[]Point{{300, 0, 1}, {300, 10, c}, {320, 40, c}, {360, 45, 1}, {371, 45, 1}},
+			[]int{5},
+			nil,
+		},
+	}
+	// At a scale of the font's units per em, 26.6 fixed point units are
+	// FUnits.
+	scale := font.FUnitsPerEm()
+	g := NewGlyphBuf()
+	for _, tc := range testCases {
+		if err := g.Load(font, scale, tc.i, nil); err != nil {
+			t.Errorf("glyph #%d: %v", tc.i, err)
+			continue
+		}
+		if !reflect.DeepEqual(g.Point, tc.point) || !reflect.DeepEqual(g.End, tc.end) {
+			t.Errorf("glyph #%d:\ngot  %v %v\nwant %v %v", tc.i, g.Point, g.End, tc.point, tc.end)
+		}
+		if tc.segs != nil {
+			if got := g.AppendPath(nil); !reflect.DeepEqual(got, tc.segs) {
+				t.Errorf("glyph #%d: path:\ngot  %v\nwant %v", tc.i, got, tc.segs)
+			}
+		}
+	}
+
+	if got, want := g.B, (Bounds{300, 0, 371, 45}); got != want {
+		t.Errorf("bounds: got %v, want %v", got, want)
+	}
+	if b, err := font.GlyphBounds(scale, 36); err != nil || b != (Bounds{10, 20, 110, 120}) {
+		t.Errorf("GlyphBounds: got %v, %v, want %v", b, err, Bounds{10, 20, 110, 120})
+	}
+	// A Hinter does not move a PostScript glyph's points, but it does round
+	// its advance width.
+	if err := g.Load(font, 10*64, 36, &Hinter{}); err != nil {
+		t.Fatalf("hinted: %v", err)
+	}
+	if !reflect.DeepEqual(g.Point, g.Unhinted) {
+		t.Errorf("hinted: got %v, want %v", g.Point, g.Unhinted)
+	}
+	if got, want := g.AdvanceWidth, int32(448); got != want {
+		t.Errorf("hinted advance: got %d, want %d", got, want)
+	}
+	for _, i := range []Index{38, 39} {
+		if err := g.Load(font, scale, i, nil); err == nil {
+			t.Errorf("glyph #%d: got no error, want one", i)
+		}
+	}
+}
+
+func TestSVGPath(t *testing.T) {
+	f := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g := NewGlyphBuf()
+	// At a scale of the font's units per em, in pixels, the glyph's points
+	// are in FUnits, and its curves' control points are exactly those of the
+	// font.
+	if err := g.Load(f, 64*f.FUnitsPerEm(), f.Index(','), nil); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		x, y int32
+		want string
+	}{
+		{0, 0, "M161 321L161 247Q257 220 257 20L257 0L161 0L161 -247L408 -247L408 -33Q407 294 161 321Z"},
+		{-64 * 161, 32, "M0 321.5L0 247.5Q96 220.5 96 20.5L96 0.5L0 0.5L0 -246.5L247 -246.5L247 -32.5Q246 294.5 0 321.5Z"},
+	}
+	for _, tc := range testCases {
+		if got := g.SVGPath(tc.x, tc.y); got != tc.want {
+			t.Errorf("(%d, %d):\ngot  %s\nwant %s", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	// Each contour, including a compound glyph's components', is a subpath.
+	if err := g.Load(f, 64*f.FUnitsPerEm(), f.Index('é'), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(g.SVGPath(0, 0), "M"), len(g.End); got != want {
+		t.Errorf("'é': got %d subpaths, want %d", got, want)
+	}
+	if got := strings.Count(g.SVGPath(0, 0), "Z"); got != len(g.End) {
+		t.Errorf("'é': got %d closed subpaths, want %d", got, len(g.End))
+	}
+
+	g.Point, g.End = nil, nil
+	if got := g.SVGPath(0, 0); got != "" {
+		t.Errorf("empty glyph: got %q, want \"\"", got)
+	}
+}
+
+func TestEmbolden(t *testing.T) {
+	// A clockwise 10x10 pixel square, with a counter-clockwise 4x4 pixel
+	// hole, whose first point is off-curve.
+	g := &GlyphBuf{
+		Point: []Point{
+			{0, 0, 1}, {0, 640, 1}, {640, 640, 1}, {640, 0, 1},
+			{192, 192, 0}, {448, 192, 1}, {448, 448, 1}, {192, 448, 1},
+		},
+		End:          []int{4, 8},
+		AdvanceWidth: 704,
+	}
+	g.Embolden(64)
+	want := []Point{
+		{-32, -32, 1}, {-32, 672, 1}, {672, 672, 1}, {672, -32, 1},
+		{224, 224, 0}, {416, 224, 1}, {416, 416, 1}, {224, 416, 1},
+	}
+	if !reflect.DeepEqual(g.Point, want) {
+		t.Errorf("points:\ngot  %v\nwant %v", g.Point, want)
+	}
+	if g.AdvanceWidth != 768 {
+		t.Errorf("advance: got %d, want 768", g.AdvanceWidth)
+	}
+	if want := (Bounds{-32, -32, 672, 672}); g.B != want {
+		t.Errorf("bounds: got %v, want %v", g.B, want)
+	}
+	if !reflect.DeepEqual(g.End, []int{4, 8}) {
+		t.Errorf("ends: got %v, want [4 8]", g.End)
+	}
+
+	// A CFF glyph's contours are in the opposite direction, but are also
+	// offset outwards. A repeated point moves with its neighbors.
+	g.Point = []Point{{0, 0, 1}, {640, 0, 1}, {640, 0, 1}, {640, 640, 1}, {0, 640, 1}}
+	g.End = []int{5}
+	g.Embolden(128)
+	want = []Point{{-64, -64, 1}, {704, -64, 1}, {704, -64, 1}, {704, 704, 1}, {-64, 704, 1}}
+	if !reflect.DeepEqual(g.Point, want) {
+		t.Errorf("CFF points:\ngot  %v\nwant %v", g.Point, want)
+	}
+
+	// A 45 degree corner moves further than the offset, along its bisector,
+	// so that both of its segments move by the offset.
+	g.Point = []Point{{0, 0, 1}, {640, 640, 1}, {640, 0, 1}}
+	g.End = []int{3}
+	g.Embolden(128)
+	if got, want := g.Point[2], (Point{704, -64, 1}); got != want {
+		t.Errorf("right angle: got %v, want %v", got, want)
+	}
+	// The 45 degree corner moves 64*(1+√2) to the left.
+	if got, want := g.Point[0], (Point{-155, -64, 1}); got != want {
+		t.Errorf("45 degree angle: got %v, want %v", got, want)
+	}
+
+	// Emboldening a real glyph increases its coverage.
+	f := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g = NewGlyphBuf()
+	coverage := func() (sum int) {
+		for _, a := range g.Mask(0, 0).Pix {
+			sum += int(a)
+		}
+		return sum
+	}
+	if err := g.Load(f, 32<<6, f.Index('O'), nil); err != nil {
+		t.Fatal(err)
+	}
+	c0 := coverage()
+	g.Embolden(64)
+	if c1 := coverage(); c1 <= c0 {
+		t.Errorf("'O': coverage got %d, want more than %d", c1, c0)
+	}
+}
+
+func TestOblique(t *testing.T) {
+	g := &GlyphBuf{
+		Point: []Point{{0, -64, 1}, {0, 640, 1}, {640, 640, 0}, {640, 0, 1}},
+		End:   []int{4},
+	}
+	g.Oblique(12 * math.Pi / 180)
+	// tan(12 degrees) is about 0.2126.
+	want := []Point{{-14, -64, 1}, {136, 640, 1}, {776, 640, 0}, {640, 0, 1}}
+	if !reflect.DeepEqual(g.Point, want) {
+		t.Errorf("got %v, want %v", g.Point, want)
+	}
+	if want := (Bounds{-14, -64, 776, 640}); g.B != want {
+		t.Errorf("bounds: got %v, want %v", g.B, want)
+	}
+	g.Oblique(-12 * math.Pi / 180)
+	if want := []Point{{0, -64, 1}, {0, 640, 1}, {640, 640, 0}, {640, 0, 1}}; !reflect.DeepEqual(g.Point, want) {
+		t.Errorf("slanting back: got %v, want %v", g.Point, want)
+	}
+}
+
+func TestMask(t *testing.T) {
+	// square returns the points of a square from (x0, y0) to (x1, y1), in
+	// 26.6 fixed point units, which is clockwise unless reverse is true.
+	square := func(x0, y0, x1, y1 int32, reverse bool) []Point {
+		ps := []Point{{x0, y0, 1}, {x0, y1, 1}, {x1, y1, 1}, {x1, y0, 1}}
+		if reverse {
+			ps[1], ps[3] = ps[3], ps[1]
+		}
+		return ps
+	}
+	g := &GlyphBuf{Point: square(0, 0, 640, 640, false), End: []int{4}}
+	m := g.Mask(0, 640)
+	if got, want := m.Bounds(), image.Rect(0, 0, 10, 10); got != want {
+		t.Fatalf("bounds: got %v, want %v", got, want)
+	}
+	for i, c := range m.Pix {
+		if c != 0xff {
+			t.Fatalf("pixel %d: got %#x, want 0xff", i, c)
+		}
+	}
+
+	// A half pixel offset spreads the square over 11 columns, and a
+	// negative offset moves the mask's bounds.
+	m = g.Mask(-128+32, 0)
+	if got, want := m.Bounds(), image.Rect(-2, -10, 9, 0); got != want {
+		t.Fatalf("offset bounds: got %v, want %v", got, want)
+	}
+	for _, x := range []int{-2, 8} {
+		if a := m.AlphaAt(x, -5).A; a < 0x7f || a > 0x80 {
+			t.Errorf("offset: pixel (%d, -5): got %#x, want half coverage", x, a)
+		}
+	}
+	if a := m.AlphaAt(3, -5).A; a != 0xff {
+		t.Errorf("offset: pixel (3, -5): got %#x, want 0xff", a)
+	}
+
+	// An inner contour in the opposite direction is a hole, but one in the
+	// same direction is not, by the non-zero winding rule.
+	for _, reverse := range []bool{true, false} {
+		g.Point = append(square(0, 0, 640, 640, false), square(128, 128, 512, 512, reverse)...)
+		g.End = []int{4, 8}
+		want := uint8(0xff)
+		if reverse {
+			want = 0
+		}
+		if a := g.Mask(0, 640).AlphaAt(5, 5).A; a != want {
+			t.Errorf("reverse=%t: got %#x, want %#x", reverse, a, want)
+		}
+	}
+
+	// A pentagram's contour crosses itself, winding twice around its center,
+	// which is inside by the non-zero rule but outside by the even-odd rule.
+	g.Point = []Point{{1280, 2560, 1}, {2032, 244, 1}, {64, 1676, 1}, {2496, 1676, 1}, {528, 244, 1}}
+	g.End = []int{5}
+	testCases := []struct {
+		rule FillRule
+		want uint8
+	}{
+		{FillNonZero, 0xff},
+		{FillEvenOdd, 0},
+	}
+	for _, tc := range testCases {
+		if a := g.MaskFill(0, 2560, tc.rule).AlphaAt(20, 20).A; a != tc.want {
+			t.Errorf("pentagram, rule %d: center: got %#x, want %#x", tc.rule, a, tc.want)
+		}
+		// A point in one of the star's arms is inside by either rule.
+		if a := g.MaskFill(0, 2560, tc.rule).AlphaAt(19, 5).A; a != 0xff {
+			t.Errorf("pentagram, rule %d: arm: got %#x, want 0xff", tc.rule, a)
+		}
+	}
+	if a := g.Mask(0, 2560).AlphaAt(20, 20).A; a != 0xff {
+		t.Errorf("pentagram, default rule: got %#x, want 0xff", a)
+	}
+
+	// An empty glyph has an empty mask.
+	g.Point, g.End = nil, nil
+	if got := g.Mask(0, 0).Bounds(); !got.Empty() {
+		t.Errorf("empty glyph: got bounds %v", got)
+	}
+}
+
+func TestSDF(t *testing.T) {
+	// A 10x10 pixel square, with a reversed 4x4 pixel hole in its middle.
+	g := &GlyphBuf{
+		Point: []Point{
+			{0, 0, 1}, {0, 640, 1}, {640, 640, 1}, {640, 0, 1},
+			{192, 192, 1}, {448, 192, 1}, {448, 448, 1}, {192, 448, 1},
+		},
+		End: []int{4, 8},
+	}
+	m := g.SDF(0, 640, 4)
+	if got, want := m.Bounds(), image.Rect(-4, -4, 14, 14); got != want {
+		t.Fatalf("bounds: got %v, want %v", got, want)
+	}
+	testCases := []struct {
+		x, y int
+		want uint8
+	}{
+		// Half a pixel outside and inside the square's left edge.
+		{-1, 1, 0x80 - 0x10},
+		{0, 1, 0x80 + 0x10},
+		// One and a half pixels inside the square, at its corner.
+		{1, 1, 0x80 + 0x30},
+		// Far enough from the outline to saturate.
+		{-4, -4, 0x00},
+		{13, 13, 0x00},
+		// Three and a half pixels outside the square.
+		{13, 5, 0x80 - 0x70},
+		// Inside the hole, which is four pixels wide.
+		{3, 3, 0x80 - 0x10},
+		{4, 4, 0x80 - 0x30},
+		{5, 5, 0x80 - 0x30},
+	}
+	for _, tc := range testCases {
+		if got := m.GrayAt(tc.x, tc.y).Y; got != tc.want {
+			t.Errorf("(%d, %d): got %#02x, want %#02x", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	// The pentagram's center is inside by the non-zero winding rule, as for
+	// Mask.
+	g.Point = []Point{{1280, 2560, 1}, {2032, 244, 1}, {64, 1676, 1}, {2496, 1676, 1}, {528, 244, 1}}
+	g.End = []int{5}
+	m = g.SDF(0, 2560, 4)
+	if got := m.GrayAt(20, 20).Y; got <= 0x80 {
+		t.Errorf("pentagram center: got %#02x, want inside", got)
+	}
+	f := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	g = &GlyphBuf{}
+	if err := g.Load(f, 32<<6, f.Index('O'), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Compare the field's sign with the curved glyph's mask, away from the
+	// outline.
+	mask, sdf := g.Mask(0, 0), g.SDF(0, 0, 4)
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		for x := mask.Rect.Min.X; x < mask.Rect.Max.X; x++ {
+			a, v := mask.AlphaAt(x, y).A, sdf.GrayAt(x, y).Y
+			if (a == 0xff && v < 0x80) || (a == 0 && v >= 0x80) {
+				t.Errorf("'O' (%d, %d): mask %#02x, field %#02x", x, y, a, v)
+			}
+		}
+	}
+
+	g.Point, g.End = nil, nil
+	if got := g.SDF(0, 0, 4).Bounds(); !got.Empty() {
+		t.Errorf("empty glyph: got bounds %v", got)
+	}
+}
+
+func TestGlyphCache(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	c := NewGlyphCache(font, 2)
+	get := func(i Index, scale int32, hinting bool) *GlyphBuf {
+		g, err := c.Get(i, scale, hinting)
+		if err != nil {
+			t.Fatalf("Get(%d, %d, %v): %v", i, scale, hinting, err)
+		}
+		return g
+	}
+	g0 := get(0, 12*64, false)
+	want := NewGlyphBuf()
+	if err := want.Load(font, 12*64, 0, nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(g0.Point, want.Point) || !reflect.DeepEqual(g0.End, want.End) {
+		t.Errorf("cached glyph differs from loaded glyph")
+	}
+	if get(0, 12*64, false) != g0 {
+		t.Errorf("second Get: got a different GlyphBuf, want a cache hit")
+	}
+	// A different scale or hinting is a different cache entry.
+	if get(0, 24*64, false) == g0 {
+		t.Errorf("different scale: got a cache hit")
+	}
+	if get(0, 12*64, true) == g0 {
+		t.Errorf("with hinting: got a cache hit")
+	}
+	if got := c.Len(); got != 2 {
+		t.Errorf("Len: got %d, want 2", got)
+	}
+	// The least recently used entry, g0, should have been evicted.
+	if get(0, 12*64, false) == g0 {
+		t.Errorf("after eviction: got a cache hit")
+	}
+
+	// Path returns the cached glyph's flattened path.
+	a := font.Index('a')
+	path, err := c.Path(a, 12*64, true)
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if err := want.Load(font, 12*64, a, &Hinter{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(path, flattenPath(want.AppendPath(nil), DefaultPathTolerance)) {
+		t.Errorf("cached path differs from loaded glyph's flattened path")
+	}
+	for _, seg := range path {
+		if seg.Op != SegmentOpMoveTo && seg.Op != SegmentOpLineTo {
+			t.Fatalf("cached path has a segment with op %d", seg.Op)
+		}
+	}
+	if path2, err := c.Path(a, 12*64, true); err != nil || &path2[0] != &path[0] {
+		t.Errorf("second Path: got a different path, want a cache hit")
+	}
+
+	// A finer tolerance empties the cache, and approximates the curves with
+	// more lines.
+	c.SetPathTolerance(1)
+	if got := c.Len(); got != 0 {
+		t.Errorf("Len after SetPathTolerance: got %d, want 0", got)
+	}
+	fine, err := c.Path(a, 12*64, true)
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if len(fine) <= len(path) {
+		t.Errorf("finer tolerance: got %d segments, want more than %d", len(fine), len(path))
+	}
+}
+
+func TestGlyphCacheConcurrent(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	var is []Index
+	for r := 'a'; r <= 'z'; r++ {
+		is = append(is, font.Index(r))
+	}
+	want := make([][]Segment, len(is))
+	for j, i := range is {
+		g := NewGlyphBuf()
+		if err := g.Load(font, 12*64, i, &Hinter{}); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		want[j] = flattenPath(g.AppendPath(nil), DefaultPathTolerance)
+	}
+	// The cache is too small to hold every glyph, so that the goroutines'
+	// hinted loads keep missing the cache, and run at the same time.
+	c := NewGlyphCache(font, 4)
+	errc := make(chan error)
+	for n := 0; n < 8; n++ {
+		go func(n int) {
+			for k := 0; k < 4*len(is); k++ {
+				j := (n + k) % len(is)
+				path, err := c.Path(is[j], 12*64, true)
+				if err == nil && !reflect.DeepEqual(path, want[j]) {
+					err = fmt.Errorf("glyph %d: cached path differs from loaded glyph's", is[j])
+				}
+				if err != nil {
+					errc <- err
+					return
+				}
+			}
+			errc <- nil
+		}(n)
+	}
+	for n := 0; n < 8; n++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFlattenPath(t *testing.T) {
+	// A quadratic and a cubic curve, in 26.6 fixed point units, and the
+	// points at which they are evaluated.
+	segs := []Segment{
+		{SegmentOpMoveTo, [3]Point{{X: 0, Y: 0}}},
+		{SegmentOpQuadTo, [3]Point{{X: 640, Y: 1280}, {X: 1280, Y: 0}}},
+		{SegmentOpCubeTo, [3]Point{{X: 1280, Y: -1280}, {X: 0, Y: -1280}, {X: 0, Y: 0}}},
+	}
+	quad := func(t float64) (float64, float64) {
+		s := 1 - t
+		return 2*s*t*640 + t*t*1280, 2 * s * t * 1280
+	}
+	cube := func(t float64) (float64, float64) {
+		s := 1 - t
+		return s*s*s*1280 + 3*s*s*t*1280, 3*s*s*t*-1280 + 3*s*t*t*-1280
+	}
+	for _, tol := range []int32{1, 4, 16} {
+		flat := flattenPath(segs, tol)
+		if flat[0] != segs[0] || flat[len(flat)-1].Args[0] != (Point{}) {
+			t.Errorf("tolerance %d: the path's ends moved", tol)
+		}
+		// Every point of each curve is within the tolerance, plus rounding,
+		// of the lines that approximate it.
+		var lines [][2]Point
+		for j := 1; j < len(flat); j++ {
+			if flat[j].Op != SegmentOpLineTo {
+				t.Fatalf("tolerance %d: segment #%d has op %d", tol, j, flat[j].Op)
+			}
+			lines = append(lines, [2]Point{flat[j-1].Args[0], flat[j].Args[0]})
+		}
+		for k := 0; k <= 1000; k++ {
+			for _, f := range []func(float64) (float64, float64){quad, cube} {
+				x, y := f(float64(k) / 1000)
+				d := math.Inf(1)
+				for _, l := range lines {
+					ax, ay := float64(l[0].X), float64(l[0].Y)
+					dx, dy := float64(l[1].X)-ax, float64(l[1].Y)-ay
+					u := math.Max(0, math.Min(1, ((x-ax)*dx+(y-ay)*dy)/(dx*dx+dy*dy)))
+					d = math.Min(d, math.Hypot(ax+u*dx-x, ay+u*dy-y))
+				}
+				if d > float64(tol)+1 {
+					t.Fatalf("tolerance %d: (%.1f, %.1f) is %.2f from the lines", tol, x, y, d)
+				}
+			}
+		}
+	}
+	if n1, n16 := len(flattenPath(segs, 1)), len(flattenPath(segs, 16)); n1 <= n16 {
+		t.Errorf("segments: got %d at tolerance 1 and %d at tolerance 16, want more at 1", n1, n16)
+	}
+}
+
+// TestConcurrentLoad tests that multiple goroutines can use the one Font at
+// the same time. It is most useful when run with the race detector.
+func TestConcurrentLoad(t *testing.T) {
+	font := parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	fupe := font.FUnitsPerEm()
+	load := func(g *GlyphBuf, h *Hinter) (string, error) {
+		var buf bytes.Buffer
+		for i := 0; i < font.NumGlyphs(); i++ {
+			if err := g.Load(font, 12*64, Index(i), h); err != nil {
+				return "", fmt.Errorf("glyph #%d: %v", i, err)
+			}
+			name := font.GlyphName(Index(i))
+			j, _ := font.IndexByName(name)
+			fmt.Fprintln(&buf, i, name, j, g.B, g.Point, g.End, font.HMetric(fupe, Index(i)))
+		}
+		return buf.String(), nil
+	}
+	want, err := load(NewGlyphBuf(), &Hinter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Parse a fresh Font, so that its lazily built caches are built
+	// concurrently.
+	font = parseTestFont(t, readTestFont(t, "luxisr.ttf"))
+	const n = 8
+	errc := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			got, err := load(NewGlyphBuf(), &Hinter{})
+			if err == nil && got != want {
+				err = errors.New("got different results")
+			}
+			errc <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errc; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func testScaling(t *testing.T, filename string, hinter *Hinter) {
+	b, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	font, err := Parse(b)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	f, err := os.Open("../../luxi-fonts/" + filename)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	wants := [][]Point{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if text == "" {
+			wants = append(wants, []Point{})
+			continue
+		}
+		ss := strings.Split(text, ",")
+		points := make([]Point, len(ss))
+		for i, s := range ss {
+			p := &points[i]
+			if _, err := fmt.Sscanf(s, "%d %d %d", &p.X, &p.Y, &p.Flags); err != nil {
+				t.Fatalf("Sscanf: %v", err)
+			}
+		}
+		wants = append(wants, points)
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		t.Fatalf("Scanner: %v", err)
+	}
+
+	const fontSize = 12
+	glyphBuf := NewGlyphBuf()
+	for i, want := range wants {
+		if err = glyphBuf.Load(font, fontSize*64, Index(i), hinter); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		got := glyphBuf.Point
+		for i := range got {
+			got[i].Flags &= 0x01
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("glyph #%d:\ngot  %v\nwant %v\n", i, got, want)
+		}
+	}
+}
+
+func TestScalingSansHinting(t *testing.T) {
+	testScaling(t, "luxisr-12pt-sans-hinting.txt", nil)
+}
+
+func TestScalingWithHinting(t *testing.T) {
+	testScaling(t, "luxisr-12pt-with-hinting.txt", &Hinter{})
+}
+
+func benchmarkLoad(b *testing.B, h *Hinter) {
+	data, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	font, err := Parse(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	g := NewGlyphBuf()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < font.NumGlyphs(); j++ {
+			if err := g.Load(font, 12*64, Index(j), h); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkLoadSansHinting(b *testing.B) {
+	benchmarkLoad(b, nil)
+}
+
+func BenchmarkLoadWithHinting(b *testing.B) {
+	benchmarkLoad(b, &Hinter{})
+}
+
+func TestLoadAllocs(t *testing.T) {
+	data, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadAll := func(g *GlyphBuf, h *Hinter) {
+		for i := 0; i < font.NumGlyphs(); i++ {
+			if err := g.Load(font, 12*64, Index(i), h); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, h := range []*Hinter{nil, &Hinter{}} {
+		// Loading the first glyph sizes the GlyphBuf's slices for the
+		// font's largest glyph, so loading the others does not grow them.
+		g := &GlyphBuf{}
+		if err := g.Load(font, 12*64, 0, h); err != nil {
+			t.Fatal(err)
+		}
+		caps := []int{cap(g.Point), cap(g.Unhinted), cap(g.InFontUnits), cap(g.Twilight), cap(g.End)}
+		loadAll(g, h)
+		if got := []int{cap(g.Point), cap(g.Unhinted), cap(g.InFontUnits), cap(g.Twilight), cap(g.End)}; !reflect.DeepEqual(got, caps) {
+			t.Errorf("hinted=%t: capacities grew from %v to %v", h != nil, caps, got)
+		}
+		if allocs := testing.AllocsPerRun(5, func() { loadAll(g, h) }); allocs != 0 {
+			t.Errorf("hinted=%t: got %v allocations, want 0", h != nil, allocs)
+		}
+	}
+}
+
+func TestPointMethods(t *testing.T) {
+	testCases := []struct {
+		flags          uint32
+		onCurve, cubic bool
+	}{
+		{0, false, false},
+		{flagOnCurve, true, false},
+		{flagCubic, false, true},
+		// Internal flags do not affect the methods.
+		{flagOnCurve | flagTouchedX | flagTouchedY, true, false},
+		{flagTouchedX | flagTouchedY, false, false},
+		{flagCubic | flagTouchedY, false, true},
+	}
+	for _, tc := range testCases {
+		p := Point{X: 3, Y: -4, Flags: tc.flags}
+		if got := p.OnCurve(); got != tc.onCurve {
+			t.Errorf("flags %#x: OnCurve: got %t, want %t", tc.flags, got, tc.onCurve)
+		}
+		if got := p.Cubic(); got != tc.cubic {
+			t.Errorf("flags %#x: Cubic: got %t, want %t", tc.flags, got, tc.cubic)
+		}
+		if x, y := p.Coord(); x != 3 || y != -4 {
+			t.Errorf("flags %#x: Coord: got %d, %d, want 3, -4", tc.flags, x, y)
+		}
+	}
+}
+
+func BenchmarkIndex(b *testing.B) {
+	font := parseTestFont(b, readTestFont(b, "luxisr.ttf"))
+	const s = "The quick brown fox jumps over the lazy dog."
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range s {
+			font.Index(r)
+		}
+	}
+}
+
+func BenchmarkIndexString(b *testing.B) {
+	font := parseTestFont(b, readTestFont(b, "luxisr.ttf"))
+	const s = "The quick brown fox jumps over the lazy dog."
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		font.IndexString(s)
+	}
+}
+
+// benchmarkGlyphPath benchmarks getting the flattened paths of a string's
+// glyphs, as a redraw of that string would, either from a GlyphCache or by
+// loading and flattening each glyph every time.
+func benchmarkGlyphPath(b *testing.B, cached bool) {
+	data, err := ioutil.ReadFile("../../luxi-fonts/luxisr.ttf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	font, err := Parse(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var is []Index
+	for _, r := range "The quick brown fox jumps over the lazy dog." {
+		is = append(is, font.Index(r))
+	}
+	c, g, h := NewGlyphCache(font, 64), NewGlyphBuf(), &Hinter{}
+	var segs []Segment
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, j := range is {
+			if cached {
+				if _, err := c.Path(j, 12*64, true); err != nil {
+					b.Fatal(err)
+				}
+				continue
+			}
+			if err := g.Load(font, 12*64, j, h); err != nil {
+				b.Fatal(err)
+			}
+			segs = g.AppendPath(segs[:0])
+			flattenPath(segs, DefaultPathTolerance)
+		}
+	}
+}
+
+func BenchmarkGlyphCachePath(b *testing.B) {
+	benchmarkGlyphPath(b, true)
+}
+
+func BenchmarkGlyphLoadPath(b *testing.B) {
+	benchmarkGlyphPath(b, false)
 }
@@ -0,0 +1,126 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// ParseWOFF returns a new Font for the given WOFF data. WOFF is the Web Open
+// Font Format, which wraps a TTF's tables, each of which may be compressed,
+// in its own header. The tables are decompressed and reassembled into TTF
+// data, which is then parsed as per Parse. Each table's checksum must match
+// the one that the WOFF data records for it. Any extended metadata and
+// private data are ignored.
+//
+// The WOFF specification is at http://www.w3.org/TR/WOFF/
+func ParseWOFF(woff []byte) (*Font, error) {
+	ttf, err := woffToTTF(woff)
+	if err != nil {
+		return nil, err
+	}
+	return parse(ttf, 0, nil)
+}
+
+// woffToTTF returns the TTF data that the given WOFF data wraps.
+func woffToTTF(woff []byte) ([]byte, error) {
+	if len(woff) < 44 {
+		return nil, FormatError("WOFF data is too short")
+	}
+	if u32(woff, 0) != 0x774f4646 { // "wOFF" as a big-endian uint32.
+		return nil, FormatError("bad WOFF signature")
+	}
+	if length := u32(woff, 8); int64(length) != int64(len(woff)) {
+		return nil, FormatError(fmt.Sprintf("bad WOFF length: %d", length))
+	}
+	n := int(u16(woff, 12))
+	if n == 0 || len(woff)-44 < 20*n {
+		return nil, FormatError("WOFF table directory is too short")
+	}
+	if u16(woff, 14) != 0 {
+		return nil, FormatError("bad WOFF reserved field")
+	}
+	// Decompress each table, and lay out the TTF data's table directory,
+	// which is followed by its tables, each of which is 4-byte aligned.
+	tables := make([][]byte, n)
+	checksums := make([]uint32, n)
+	size := 12 + 16*n
+	for i := range tables {
+		x := 44 + 20*i
+		offset, compLength, origLength := u32(woff, x+4), u32(woff, x+8), u32(woff, x+12)
+		if uint64(offset)+uint64(compLength) > uint64(len(woff)) {
+			return nil, FormatError(fmt.Sprintf("bad WOFF table offset: %d", offset))
+		}
+		if compLength > origLength {
+			return nil, FormatError(fmt.Sprintf("bad WOFF table length: %d", compLength))
+		}
+		t := woff[offset : offset+compLength]
+		if compLength < origLength {
+			var err error
+			if t, err = woffDecompress(t, origLength); err != nil {
+				return nil, err
+			}
+		}
+		tag := string(woff[x : x+4])
+		checksums[i] = u32(woff, x+16)
+		if sum := TableChecksum(tag, t); sum != checksums[i] {
+			return nil, FormatError(fmt.Sprintf("bad %q table checksum: got %#08x, want %#08x", tag, sum, checksums[i]))
+		}
+		tables[i] = t
+		size += (len(t) + 3) &^ 3
+	}
+	ttf := make([]byte, 12, size)
+	// The TTF's flavor, such as "OTTO" for CFF data, is the WOFF's. The
+	// search range fields are not used by parse, and so they are left zero.
+	copy(ttf, woff[4:8])
+	ttf[4], ttf[5] = uint8(n>>8), uint8(n)
+	offset := 12 + 16*n
+	for i, t := range tables {
+		x := 44 + 20*i
+		ttf = append(ttf, woff[x:x+4]...)
+		ttf = appendUint32(ttf, checksums[i])
+		ttf = appendUint32(ttf, uint32(offset))
+		ttf = appendUint32(ttf, uint32(len(t)))
+		offset += (len(t) + 3) &^ 3
+	}
+	for _, t := range tables {
+		ttf = append(ttf, t...)
+		for len(ttf)%4 != 0 {
+			ttf = append(ttf, 0)
+		}
+	}
+	return ttf, nil
+}
+
+// woffDecompress returns the zlib-decompressed contents of a WOFF table, which
+// must be exactly n bytes long.
+func woffDecompress(b []byte, n uint32) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, FormatError("bad WOFF table compression: " + err.Error())
+	}
+	defer r.Close()
+	// The buffer grows with the data, rather than being allocated up front,
+	// so that a bogus length does not allocate more memory than the
+	// compressed data actually decompresses to. Reading a byte past n also
+	// verifies the zlib checksum at the end of the data.
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(r, int64(n)+1)); err != nil {
+		return nil, FormatError("bad WOFF table compression: " + err.Error())
+	}
+	if uint64(buf.Len()) != uint64(n) {
+		return nil, FormatError(fmt.Sprintf("bad WOFF table compression: got %d bytes, want %d", buf.Len(), n))
+	}
+	return buf.Bytes(), nil
+}
+
+// appendUint32 appends v to b as a big-endian uint32.
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, uint8(v>>24), uint8(v>>16), uint8(v>>8), uint8(v))
+}
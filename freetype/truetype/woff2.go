@@ -0,0 +1,576 @@
+// Copyright 2013 The Freetype-Go Authors. All rights reserved.
+// Use of this source code is governed by your choice of either the
+// FreeType License or the GNU General Public License version 2 (or
+// any later version), both of which can be found in the LICENSE file.
+
+package truetype
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// woff2Tags are the tags of the tables that a WOFF2 table directory entry
+// can refer to by their index, rather than by an explicit tag.
+var woff2Tags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// A woff2Table is a WOFF2 table directory entry.
+type woff2Table struct {
+	tag         string
+	transformed bool
+	// origLength is the length of the table in the TTF data, and length the
+	// length of its possibly transformed data in the decompressed stream.
+	origLength, length uint32
+	data               []byte
+}
+
+// ParseWOFF2 returns a new Font for the given WOFF2 data. WOFF2 is the second
+// version of the Web Open Font Format, which compresses a TTF's tables as a
+// single Brotli stream, and which can transform the glyf, loca and hmtx
+// tables into a more compact encoding beforehand. The tables are
+// decompressed, untransformed and reassembled into TTF data, which is then
+// parsed as per Parse. Font collections are not supported, and any extended
+// metadata and private data are ignored.
+//
+// The WOFF2 specification is at http://www.w3.org/TR/WOFF2/
+func ParseWOFF2(woff2 []byte) (*Font, error) {
+	ttf, err := woff2ToTTF(woff2)
+	if err != nil {
+		return nil, err
+	}
+	return parse(ttf, 0, nil)
+}
+
+// woff2ToTTF returns the TTF data that the given WOFF2 data wraps.
+func woff2ToTTF(woff2 []byte) ([]byte, error) {
+	if len(woff2) < 48 {
+		return nil, FormatError("WOFF2 data is too short")
+	}
+	if u32(woff2, 0) != 0x774f4632 { // "wOF2" as a big-endian uint32.
+		return nil, FormatError("bad WOFF2 signature")
+	}
+	if u32(woff2, 4) == 0x74746366 { // "ttcf" as a big-endian uint32.
+		return nil, UnsupportedError("WOFF2 font collection")
+	}
+	if length := u32(woff2, 8); int64(length) != int64(len(woff2)) {
+		return nil, FormatError(fmt.Sprintf("bad WOFF2 length: %d", length))
+	}
+	n := int(u16(woff2, 12))
+	if n == 0 {
+		return nil, FormatError("bad number of WOFF2 tables: 0")
+	}
+	if u16(woff2, 14) != 0 {
+		return nil, FormatError("bad WOFF2 reserved field")
+	}
+	// The totalSfntSize field, at offset 16, is only a hint, as a glyf table
+	// that is reconstructed from its transform need not be the same size as
+	// the original.
+	compressedSize := u32(woff2, 20)
+
+	// Read the table directory.
+	tables := make([]woff2Table, n)
+	x, total := 48, uint64(0)
+	for i := range tables {
+		t := &tables[i]
+		if x >= len(woff2) {
+			return nil, FormatError("WOFF2 table directory is too short")
+		}
+		flags := woff2[x]
+		x++
+		if k := flags & 0x3f; k != 0x3f {
+			t.tag = woff2Tags[k]
+		} else {
+			if x+4 > len(woff2) {
+				return nil, FormatError("WOFF2 table directory is too short")
+			}
+			t.tag = string(woff2[x : x+4])
+			x += 4
+		}
+		var err error
+		if t.origLength, x, err = readUintBase128(woff2, x); err != nil {
+			return nil, err
+		}
+		t.length = t.origLength
+		// For the glyf and loca tables, transform version 0 is the glyf
+		// transform and version 3 is none. For other tables, version 0 is
+		// none, and the hmtx table's version 1 is the hmtx transform.
+		switch version := flags >> 6; t.tag {
+		case "glyf", "loca":
+			t.transformed = version == 0
+		case "hmtx":
+			t.transformed = version == 1
+		}
+		if flags>>6 != 0 && !t.transformed && t.tag != "glyf" && t.tag != "loca" {
+			return nil, UnsupportedError(fmt.Sprintf("WOFF2 transform version %d of the %q table", flags>>6, t.tag))
+		}
+		if t.transformed {
+			if t.length, x, err = readUintBase128(woff2, x); err != nil {
+				return nil, err
+			}
+			if t.tag == "loca" && t.length != 0 {
+				return nil, FormatError("bad WOFF2 loca transform length")
+			}
+		}
+		total += uint64(t.length)
+	}
+
+	// Decompress the tables, whose data are concatenated in directory order.
+	if uint64(x)+uint64(compressedSize) > uint64(len(woff2)) {
+		return nil, FormatError(fmt.Sprintf("bad WOFF2 compressed size: %d", compressedSize))
+	}
+	// As per ParseWOFF, the buffer grows with the data, and reading a byte
+	// past the expected total detects data that is too long.
+	var buf bytes.Buffer
+	r := brotli.NewReader(bytes.NewReader(woff2[x : x+int(compressedSize)]))
+	if _, err := buf.ReadFrom(io.LimitReader(r, int64(total)+1)); err != nil {
+		return nil, FormatError("bad WOFF2 compression: " + err.Error())
+	}
+	if uint64(buf.Len()) != total {
+		return nil, FormatError(fmt.Sprintf("bad WOFF2 compression: got %d bytes, want %d", buf.Len(), total))
+	}
+	data := buf.Bytes()
+	for i := range tables {
+		t := &tables[i]
+		t.data, data = data[:t.length], data[t.length:]
+	}
+
+	// Reverse the transforms. The glyf and loca tables must either both be
+	// transformed or both not be, and the hmtx transform depends on the
+	// reconstructed glyf table.
+	find := func(tag string) *woff2Table {
+		for i := range tables {
+			if tables[i].tag == tag {
+				return &tables[i]
+			}
+		}
+		return nil
+	}
+	glyf, loca, hmtx := find("glyf"), find("loca"), find("hmtx")
+	if (glyf == nil) != (loca == nil) || glyf != nil && glyf.transformed != loca.transformed {
+		return nil, FormatError("bad WOFF2 glyf and loca tables")
+	}
+	var xMins []int16
+	if glyf != nil && glyf.transformed {
+		head := find("head")
+		if head == nil || len(head.data) < 54 {
+			return nil, FormatError("WOFF2 glyf transform without a head table")
+		}
+		var err error
+		if glyf.data, loca.data, xMins, err = woff2Glyf(glyf.data, int(u16(head.data, 50))); err != nil {
+			return nil, err
+		}
+		if uint32(len(loca.data)) != loca.origLength {
+			return nil, FormatError(fmt.Sprintf("bad WOFF2 loca length: %d", loca.origLength))
+		}
+	}
+	if hmtx != nil && hmtx.transformed {
+		hhea := find("hhea")
+		if hhea == nil || len(hhea.data) != 36 || xMins == nil {
+			return nil, FormatError("bad WOFF2 hmtx transform")
+		}
+		var err error
+		if hmtx.data, err = woff2Hmtx(hmtx.data, xMins, int(u16(hhea.data, 34))); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reassemble the TTF data, as per ParseWOFF.
+	size := uint64(12 + 16*n)
+	for _, t := range tables {
+		size += uint64(len(t.data)+3) &^ 3
+	}
+	ttf := make([]byte, 12, size)
+	copy(ttf, woff2[4:8])
+	ttf[4], ttf[5] = uint8(n>>8), uint8(n)
+	offset := 12 + 16*n
+	for _, t := range tables {
+		ttf = append(ttf, t.tag...)
+		ttf = appendUint32(ttf, TableChecksum(t.tag, t.data))
+		ttf = appendUint32(ttf, uint32(offset))
+		ttf = appendUint32(ttf, uint32(len(t.data)))
+		offset += (len(t.data) + 3) &^ 3
+	}
+	for _, t := range tables {
+		ttf = append(ttf, t.data...)
+		for len(ttf)%4 != 0 {
+			ttf = append(ttf, 0)
+		}
+	}
+	return ttf, nil
+}
+
+// readUintBase128 reads a WOFF2 UIntBase128 number at b[x:], and returns it
+// and the offset after it. The number is big-endian, 7 bits per byte, with
+// the high bit of each byte but the last set.
+func readUintBase128(b []byte, x int) (uint32, int, error) {
+	v := uint32(0)
+	for i := 0; i < 5; i++ {
+		if x >= len(b) {
+			return 0, 0, FormatError("WOFF2 UIntBase128 is too short")
+		}
+		c := b[x]
+		x++
+		// Leading zeroes, and values that overflow a uint32, are invalid.
+		if i == 0 && c == 0x80 || v&0xfe000000 != 0 {
+			return 0, 0, FormatError("bad WOFF2 UIntBase128")
+		}
+		v = v<<7 | uint32(c&0x7f)
+		if c&0x80 == 0 {
+			return v, x, nil
+		}
+	}
+	return 0, 0, FormatError("bad WOFF2 UIntBase128")
+}
+
+// A woff2Stream is one of the streams of a transformed glyf table.
+type woff2Stream struct {
+	b   []byte
+	err bool
+}
+
+// next returns the next n bytes of the stream, or nil if there are fewer
+// than n bytes left, in which case the stream's err field is set.
+func (s *woff2Stream) next(n int) []byte {
+	if n > len(s.b) {
+		s.b, s.err = nil, true
+		return nil
+	}
+	b := s.b[:n]
+	s.b = s.b[n:]
+	return b
+}
+
+func (s *woff2Stream) u8() uint8 {
+	if b := s.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (s *woff2Stream) u16() uint16 {
+	if b := s.next(2); b != nil {
+		return u16(b, 0)
+	}
+	return 0
+}
+
+// u255 returns the next 255UInt16, a variable length encoding of a uint16.
+func (s *woff2Stream) u255() uint16 {
+	switch c := s.u8(); c {
+	case 253:
+		return s.u16()
+	case 254:
+		return uint16(s.u8()) + 2*253
+	case 255:
+		return uint16(s.u8()) + 253
+	default:
+		return uint16(c)
+	}
+}
+
+// woff2Glyf reverses the WOFF2 glyf transform of the glyf table data b, and
+// returns the glyf and loca tables, in the given loca format, and the xMin
+// of each glyph's bounding box.
+func woff2Glyf(b []byte, indexToLocFormat int) (glyf, loca []byte, xMins []int16, err error) {
+	if len(b) < 36 {
+		return nil, nil, nil, FormatError("WOFF2 glyf transform is too short")
+	}
+	optionFlags, numGlyphs, indexFormat := u16(b, 2), int(u16(b, 4)), int(u16(b, 6))
+	if indexFormat != indexToLocFormat {
+		return nil, nil, nil, FormatError(fmt.Sprintf("bad WOFF2 glyf index format: %d", indexFormat))
+	}
+	// Split the data into its seven streams.
+	var (
+		nContour, nPoints, flag, glyph, composite, bbox, instruction woff2Stream
+	)
+	x := 36
+	for i, s := range []*woff2Stream{&nContour, &nPoints, &flag, &glyph, &composite, &bbox, &instruction} {
+		n := u32(b, 8+4*i)
+		if uint64(x)+uint64(n) > uint64(len(b)) {
+			return nil, nil, nil, FormatError("WOFF2 glyf transform is too short")
+		}
+		s.b = b[x : x+int(n)]
+		x += int(n)
+	}
+	bitmapLen := 4 * ((numGlyphs + 31) >> 5)
+	bboxBitmap := bbox.next(bitmapLen)
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		if x+(numGlyphs+7)>>3 > len(b) {
+			return nil, nil, nil, FormatError("WOFF2 glyf transform is too short")
+		}
+		overlapBitmap = b[x : x+(numGlyphs+7)>>3]
+	}
+	bit := func(bitmap []byte, i int) bool {
+		return bitmap[i>>3]&(0x80>>uint(i&7)) != 0
+	}
+
+	xMins = make([]int16, numGlyphs)
+	var (
+		offsets = make([]int, numGlyphs+1)
+		ends    []uint16
+		flags   []uint8
+		points  []Point
+	)
+	for i := 0; i < numGlyphs; i++ {
+		offsets[i] = len(glyf)
+		hasBBox := bboxBitmap != nil && bit(bboxBitmap, i)
+		var bb []byte
+		if hasBBox {
+			if bb = bbox.next(8); bbox.err {
+				return nil, nil, nil, FormatError(fmt.Sprintf("WOFF2 glyf transform is too short for glyph #%d", i))
+			}
+		}
+		switch nc := int16(nContour.u16()); {
+		case nc == 0:
+			if hasBBox {
+				return nil, nil, nil, FormatError(fmt.Sprintf("bad WOFF2 bbox for empty glyph #%d", i))
+			}
+
+		case nc < 0:
+			// A composite glyph, whose bounding box must be explicit, and
+			// whose components are copied verbatim.
+			if !hasBBox {
+				return nil, nil, nil, FormatError(fmt.Sprintf("missing WOFF2 bbox for compound glyph #%d", i))
+			}
+			glyf = append(glyf, 0xff, 0xff)
+			glyf = append(glyf, bb...)
+			hasInstructions := false
+			for more := true; more && !composite.err; {
+				f := composite.u16()
+				n := 4
+				if f&flagArg1And2AreWords != 0 {
+					n += 4
+				} else {
+					n += 2
+				}
+				switch {
+				case f&flagWeHaveAScale != 0:
+					n += 2
+				case f&flagWeHaveAnXAndYScale != 0:
+					n += 4
+				case f&flagWeHaveATwoByTwo != 0:
+					n += 8
+				}
+				glyf = append(glyf, uint8(f>>8), uint8(f))
+				glyf = append(glyf, composite.next(n-2)...)
+				more = f&flagMoreComponents != 0
+				hasInstructions = hasInstructions || f&flagWeHaveInstructions != 0
+			}
+			if hasInstructions {
+				n := glyph.u255()
+				glyf = append(glyf, uint8(n>>8), uint8(n))
+				glyf = append(glyf, instruction.next(int(n))...)
+			}
+			xMins[i] = int16(u16(bb, 0))
+
+		default:
+			// A simple glyph.
+			ends, flags, points = ends[:0], flags[:0], points[:0]
+			nPoint := 0
+			for j := 0; j < int(nc); j++ {
+				nPoint += int(nPoints.u255())
+				if nPoint > 0xffff {
+					return nil, nil, nil, FormatError(fmt.Sprintf("bad WOFF2 point count for glyph #%d", i))
+				}
+				ends = append(ends, uint16(nPoint-1))
+			}
+			var px, py int32
+			for j := 0; j < nPoint && !flag.err && !glyph.err; j++ {
+				f := flag.u8()
+				dx, dy := woff2Triplet(f&0x7f, &glyph)
+				px, py = px+dx, py+dy
+				points = append(points, Point{X: px, Y: py})
+				fl := uint8(0)
+				if f&0x80 == 0 {
+					fl = flagOnCurve
+				}
+				flags = append(flags, fl)
+			}
+			nInstruction := glyph.u255()
+			instructions := instruction.next(int(nInstruction))
+			if flag.err || glyph.err || instruction.err {
+				break
+			}
+			if hasBBox {
+				glyf = append(glyf, uint8(nc>>8), uint8(nc))
+				glyf = append(glyf, bb...)
+			} else {
+				pb := pointBounds(points)
+				glyf = appendU16s(glyf, uint16(nc), uint16(pb.XMin), uint16(pb.YMin), uint16(pb.XMax), uint16(pb.YMax))
+			}
+			xMins[i] = int16(u16(glyf, offsets[i]+2))
+			glyf = appendU16s(glyf, ends...)
+			glyf = appendU16s(glyf, nInstruction)
+			glyf = append(glyf, instructions...)
+			if overlapBitmap != nil && bit(overlapBitmap, i) && len(flags) != 0 {
+				// 0x40 is the glyf table's OVERLAP_SIMPLE flag, which only
+				// has meaning for a glyph's first point.
+				flags[0] |= 0x40
+			}
+			glyf = appendSimpleGlyphPoints(glyf, flags, points)
+		}
+		if nContour.err || nPoints.err || flag.err || glyph.err || composite.err || bbox.err || instruction.err {
+			return nil, nil, nil, FormatError(fmt.Sprintf("WOFF2 glyf transform is too short for glyph #%d", i))
+		}
+		// Pad each glyph, so that its offset is representable in a short
+		// loca table.
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	offsets[numGlyphs] = len(glyf)
+
+	for _, o := range offsets {
+		if indexFormat == 0 {
+			if o/2 > 0xffff {
+				return nil, nil, nil, FormatError("WOFF2 glyf table is too long for a short loca table")
+			}
+			loca = appendU16s(loca, uint16(o/2))
+		} else {
+			loca = appendUint32(loca, uint32(o))
+		}
+	}
+	return glyf, loca, xMins, nil
+}
+
+// woff2Triplet decodes a WOFF2 triplet, a point's delta from the previous
+// point, whose format is given by flag and whose data is read from s.
+func woff2Triplet(flag uint8, s *woff2Stream) (dx, dy int32) {
+	withSign := func(flag uint8, v int32) int32 {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	switch {
+	case flag < 10:
+		dy = withSign(flag, int32(flag&14)<<7+int32(s.u8()))
+	case flag < 20:
+		dx = withSign(flag, int32((flag-10)&14)<<7+int32(s.u8()))
+	case flag < 84:
+		b0, b1 := int32(flag-20), int32(s.u8())
+		dx = withSign(flag, 1+(b0&0x30)+b1>>4)
+		dy = withSign(flag>>1, 1+(b0&0x0c)<<2+b1&0x0f)
+	case flag < 120:
+		b0 := int32(flag - 84)
+		b := s.next(2)
+		if b == nil {
+			return 0, 0
+		}
+		dx = withSign(flag, 1+(b0/12)<<8+int32(b[0]))
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int32(b[1]))
+	case flag < 124:
+		b := s.next(3)
+		if b == nil {
+			return 0, 0
+		}
+		dx = withSign(flag, int32(b[0])<<4+int32(b[1])>>4)
+		dy = withSign(flag>>1, int32(b[1]&0x0f)<<8+int32(b[2]))
+	default:
+		b := s.next(4)
+		if b == nil {
+			return 0, 0
+		}
+		dx = withSign(flag, int32(u16(b, 0)))
+		dy = withSign(flag>>1, int32(u16(b, 2)))
+	}
+	return dx, dy
+}
+
+// appendSimpleGlyphPoints appends the flags and co-ordinates of a simple
+// glyph's points, in the glyf table's encoding, to b. Each co-ordinate is
+// encoded as a delta from the previous point's, in as few bytes as possible,
+// but the flags are not run-length encoded.
+func appendSimpleGlyphPoints(b []byte, flags []uint8, points []Point) []byte {
+	xs, ys := []byte(nil), []byte(nil)
+	var px, py int32
+	for i, p := range points {
+		f := flags[i]
+		switch dx := p.X - px; {
+		case dx == 0:
+			f |= flagThisXIsSame
+		case -0xff <= dx && dx <= 0xff:
+			f |= flagXShortVector
+			if dx > 0 {
+				f |= flagPositiveXShortVector
+			} else {
+				dx = -dx
+			}
+			xs = append(xs, uint8(dx))
+		default:
+			xs = appendU16s(xs, uint16(dx))
+		}
+		switch dy := p.Y - py; {
+		case dy == 0:
+			f |= flagThisYIsSame
+		case -0xff <= dy && dy <= 0xff:
+			f |= flagYShortVector
+			if dy > 0 {
+				f |= flagPositiveYShortVector
+			} else {
+				dy = -dy
+			}
+			ys = append(ys, uint8(dy))
+		default:
+			ys = appendU16s(ys, uint16(dy))
+		}
+		px, py = p.X, p.Y
+		b = append(b, f)
+	}
+	return append(append(b, xs...), ys...)
+}
+
+// woff2Hmtx reverses the WOFF2 hmtx transform of the hmtx table data b, given
+// the xMin of each glyph's bounding box and the hhea table's number of
+// horizontal metrics.
+func woff2Hmtx(b []byte, xMins []int16, nHMetric int) ([]byte, error) {
+	if len(b) < 1 || nHMetric == 0 || nHMetric > len(xMins) {
+		return nil, FormatError("bad WOFF2 hmtx transform")
+	}
+	s := woff2Stream{b: b}
+	flags := s.u8()
+	if flags&^3 != 0 || flags == 0 {
+		return nil, FormatError(fmt.Sprintf("bad WOFF2 hmtx transform flags: %#x", flags))
+	}
+	advances := s.next(2 * nHMetric)
+	// A left side bearing that is omitted is the glyph's xMin.
+	lsb := func(omitted bool, i int) uint16 {
+		if omitted {
+			return uint16(xMins[i])
+		}
+		return s.u16()
+	}
+	hmtx := make([]byte, 0, 4*nHMetric+2*(len(xMins)-nHMetric))
+	for i := 0; i < nHMetric && !s.err; i++ {
+		hmtx = append(hmtx, advances[2*i], advances[2*i+1])
+		hmtx = appendU16s(hmtx, lsb(flags&1 != 0, i))
+	}
+	for i := nHMetric; i < len(xMins) && !s.err; i++ {
+		hmtx = appendU16s(hmtx, lsb(flags&2 != 0, i))
+	}
+	if s.err {
+		return nil, FormatError("WOFF2 hmtx transform is too short")
+	}
+	return hmtx, nil
+}
+
+// appendU16s appends the big-endian encodings of vs to b.
+func appendU16s(b []byte, vs ...uint16) []byte {
+	for _, v := range vs {
+		b = append(b, uint8(v>>8), uint8(v))
+	}
+	return b
+}